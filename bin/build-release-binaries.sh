@@ -26,4 +26,4 @@ docker run \
   -v "${local_output_dir}":"${docker_output_dir}" \
   -w "${docker_gopath}${project}" \
   golang:${REQUIRED_GO_MAJOR}.${REQUIRED_GO_MINOR} \
-  /bin/bash -c "export PATH=${path} && make build-release && mv ${docker_gopath}/bin/terraform-provisioner-ansible* ${docker_output_dir}/"
\ No newline at end of file
+  /bin/bash -c "export PATH=${path} && make build-release && mv ${docker_gopath}/bin/terraform-provisioner-ansible* ${docker_gopath}/bin/terraform-provider-ansible* ${docker_output_dir}/"
\ No newline at end of file
@@ -0,0 +1,229 @@
+package events
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ansiEscapeSequence = regexp.MustCompile(`\x1b\[[0-9;?]*[a-zA-Z]`)
+	playHeader         = regexp.MustCompile(`^PLAY \[(.*)\]`)
+	taskHeader         = regexp.MustCompile(`^(?:TASK|RUNNING HANDLER) \[(.*)\]`)
+	recapHeader        = regexp.MustCompile(`^PLAY RECAP\b`)
+	recapHost          = regexp.MustCompile(`^(\S+)\s+:\s+(.*)$`)
+	recapCounter       = regexp.MustCompile(`(\w+)=(\d+)`)
+	taskResult         = regexp.MustCompile(`^(ok|changed|skipping|fatal|failed): \[([^\]]+)\](.*)$`)
+	profileHeader      = regexp.MustCompile(`^={20,}$`)
+	profileTask        = regexp.MustCompile(`^(.+?) -+ (\d+\.\d+)s$`)
+	timerDuration      = regexp.MustCompile(`^Playbook run took (\d+) days, (\d+) hours, (\d+) minutes, (\d+) seconds$`)
+)
+
+// Collector builds a result from the output of ansible-playbook, line by line.
+// The default text output and the output of the json stdout callback are recognized.
+type Collector struct {
+	result *Result
+	play   string
+	task   string
+	// items holds the task result of every host of a task with a loop, the result of each item is printed on its own line:
+	items    map[string]*Event
+	last     *Event
+	pending  *Event
+	message  strings.Builder
+	inRecap  bool
+	isJSON   bool
+	started  bool
+	jsonData strings.Builder
+	// timing is true while reading the task summary of the profile_tasks callback:
+	timing bool
+}
+
+// NewCollector returns an empty collector.
+func NewCollector() *Collector {
+	return &Collector{result: NewResult(), items: make(map[string]*Event)}
+}
+
+// Line adds a line of the output.
+func (c *Collector) Line(line string) {
+	plain := strings.TrimSpace(ansiEscapeSequence.ReplaceAllString(line, ""))
+	if !c.started {
+		if plain == "" {
+			return
+		}
+		c.started = true
+		c.isJSON = strings.HasPrefix(plain, "{")
+	}
+	if c.isJSON {
+		c.jsonData.WriteString(line)
+		c.jsonData.WriteString("\n")
+		return
+	}
+
+	if c.pending != nil {
+		if c.continueMessage(plain) {
+			return
+		}
+	}
+
+	if c.timing {
+		if matches := profileTask.FindStringSubmatch(plain); matches != nil {
+			seconds, _ := strconv.ParseFloat(matches[2], 64)
+			c.result.TaskDurations = append(c.result.TaskDurations,
+				TaskDuration{Task: matches[1], Duration: time.Duration(seconds * float64(time.Second))})
+			return
+		}
+		c.timing = false
+	}
+	if profileHeader.MatchString(plain) {
+		c.timing = true
+		return
+	}
+	if matches := timerDuration.FindStringSubmatch(plain); matches != nil {
+		c.result.Duration = 0
+		for idx, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+			value, _ := strconv.Atoi(matches[idx+1])
+			c.result.Duration += time.Duration(value) * unit
+		}
+		return
+	}
+
+	if recapHeader.MatchString(plain) {
+		c.inRecap = true
+		return
+	}
+	if c.inRecap {
+		if plain == "" {
+			return
+		}
+		if matches := recapHost.FindStringSubmatch(plain); matches != nil {
+			for _, counter := range recapCounter.FindAllStringSubmatch(matches[2], -1) {
+				value, _ := strconv.Atoi(counter[2])
+				c.result.addStat(matches[1], counter[1], value)
+			}
+			return
+		}
+		c.inRecap = false
+	}
+
+	if matches := playHeader.FindStringSubmatch(plain); matches != nil {
+		c.play = matches[1]
+		c.task = ""
+		c.items = make(map[string]*Event)
+		c.result.Events = append(c.result.Events, &Event{Type: TypePlayStart, Play: c.play})
+		return
+	}
+	if matches := taskHeader.FindStringSubmatch(plain); matches != nil {
+		c.task = matches[1]
+		c.items = make(map[string]*Event)
+		c.result.Events = append(c.result.Events, &Event{Type: TypeTaskStart, Play: c.play, Task: c.task})
+		return
+	}
+	if strings.HasPrefix(plain, "...ignoring") {
+		if c.last != nil && c.last.Type == TypeFailed {
+			c.last.IgnoreErrors = true
+		}
+		return
+	}
+	if matches := taskResult.FindStringSubmatch(plain); matches != nil {
+		c.addTaskResult(matches[1], matches[2], matches[3])
+	}
+}
+
+// addTaskResult adds the result of a task on a host, results of loop items are merged into one result per host.
+func (c *Collector) addTaskResult(status string, host string, rest string) {
+	// delegated tasks are printed as [host -> delegate]:
+	if idx := strings.Index(host, " -> "); idx > -1 {
+		host = host[:idx]
+	}
+	eventType := TypeOK
+	switch {
+	case strings.Contains(rest, "UNREACHABLE!"):
+		eventType = TypeUnreachable
+	case status == "fatal" || status == "failed":
+		eventType = TypeFailed
+	case status == "skipping":
+		eventType = TypeSkipped
+	}
+
+	isItem := strings.Contains(rest, "(item=")
+	event, merged := c.items[host]
+	if !isItem || !merged {
+		event = &Event{Type: eventType, Play: c.play, Task: c.task, Host: host}
+		c.result.Events = append(c.result.Events, event)
+		if isItem {
+			c.items[host] = event
+		}
+	} else if rank(eventType) > rank(event.Type) {
+		event.Type = eventType
+	}
+	if status == "changed" {
+		event.Changed = true
+	}
+	c.last = event
+
+	if eventType != TypeFailed && eventType != TypeUnreachable {
+		return
+	}
+	if event.Message != "" {
+		return
+	}
+	if idx := strings.Index(rest, "=> "); idx > -1 {
+		c.pending = event
+		c.message.Reset()
+		c.continueMessage(strings.TrimSpace(rest[idx+3:]))
+	}
+}
+
+// continueMessage adds a line of the JSON task result of the pending failure, returns false
+// when the line is not a part of the task result.
+func (c *Collector) continueMessage(plain string) bool {
+	if c.message.Len() == 0 && !strings.HasPrefix(plain, "{") {
+		c.pending = nil
+		return false
+	}
+	c.message.WriteString(plain)
+	res := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(c.message.String()), &res); err == nil {
+		c.pending.Message = resultMessage(res)
+		c.pending = nil
+		return true
+	}
+	// the task result is printed on one line, unless a result callback formats it over many lines,
+	// give up when a line of the next result shows up:
+	if plain == "" || strings.HasPrefix(plain, "...") || playHeader.MatchString(plain) || taskHeader.MatchString(plain) ||
+		taskResult.MatchString(plain) || recapHeader.MatchString(plain) {
+		c.pending = nil
+		c.message.Reset()
+		return false
+	}
+	return true
+}
+
+// rank orders the event types of loop items, the merged result is the worst item result.
+func rank(eventType string) int {
+	switch eventType {
+	case TypeUnreachable:
+		return 3
+	case TypeFailed:
+		return 2
+	case TypeOK:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Result returns the collected result. The output of the json stdout callback is decoded once
+// the whole output is collected, undecodable output gives an empty result.
+func (c *Collector) Result() *Result {
+	if c.isJSON {
+		result, err := ParseCallbackJSON([]byte(c.jsonData.String()))
+		if err != nil {
+			return NewResult()
+		}
+		return result
+	}
+	return c.result
+}
@@ -0,0 +1,175 @@
+// Package events turns the output of Ansible into typed events: the default text output,
+// the output of the json stdout callback and the job events of ansible-runner, AWX and Ansible Tower.
+package events
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Event types, named after the job events of ansible-runner.
+const (
+	TypePlaybookStart = "playbook_on_start"
+	TypePlayStart     = "playbook_on_play_start"
+	TypeTaskStart     = "playbook_on_task_start"
+	TypeOK            = "runner_on_ok"
+	TypeFailed        = "runner_on_failed"
+	TypeSkipped       = "runner_on_skipped"
+	TypeUnreachable   = "runner_on_unreachable"
+	TypeStats         = "playbook_on_stats"
+)
+
+// Recap counters, named like in the PLAY RECAP of ansible-playbook.
+const (
+	CounterOK          = "ok"
+	CounterChanged     = "changed"
+	CounterUnreachable = "unreachable"
+	CounterFailed      = "failed"
+	CounterSkipped     = "skipped"
+	CounterRescued     = "rescued"
+	CounterIgnored     = "ignored"
+)
+
+// Event is a single event of an Ansible run.
+type Event struct {
+	// Counter orders the events of a run, zero when the source does not number the events.
+	Counter int
+	Type    string
+	Play    string
+	Task    string
+	Host    string
+	// Action is the module of the task, empty for the text output.
+	Action  string
+	Changed bool
+	// IgnoreErrors is true for failed tasks with ignore_errors, these do not fail the play.
+	IgnoreErrors bool
+	// Message is the msg of the task result, the standard error when there is no msg.
+	Message string
+	// Stdout is the text ansible-playbook wrote for the event, empty for the text output.
+	Stdout string
+}
+
+// Failed returns true for a failed task result failing the play.
+func (e *Event) Failed() bool {
+	return e.Type == TypeFailed && !e.IgnoreErrors
+}
+
+// Unreachable returns true when the host could not be reached.
+func (e *Event) Unreachable() bool {
+	return e.Type == TypeUnreachable
+}
+
+// String describes failed and unreachable task results, with the module of the task when known.
+func (e *Event) String() string {
+	task := fmt.Sprintf("task '%s'", e.Task)
+	if e.Action != "" {
+		task = fmt.Sprintf("%s (%s)", task, e.Action)
+	}
+	switch e.Type {
+	case TypeFailed:
+		return fmt.Sprintf("%s failed on '%s': %s", task, e.Host, e.Message)
+	case TypeUnreachable:
+		return fmt.Sprintf("%s could not reach '%s': %s", task, e.Host, e.Message)
+	default:
+		return fmt.Sprintf("%s: task '%s' on '%s'", e.Type, e.Task, e.Host)
+	}
+}
+
+// Stats holds the recap counters, like ok, changed, unreachable or failed, by host.
+type Stats map[string]map[string]int
+
+// Hosts returns the number of hosts in the recap.
+func (v Stats) Hosts() int {
+	return len(v)
+}
+
+// HostsWith returns the number of hosts with a non-zero value of any of the counters.
+func (v Stats) HostsWith(counters ...string) int {
+	hosts := 0
+	for _, stats := range v {
+		for _, counter := range counters {
+			if stats[counter] > 0 {
+				hosts++
+				break
+			}
+		}
+	}
+	return hosts
+}
+
+// TaskDuration is the time a task took, as summarized by the profile_tasks callback.
+type TaskDuration struct {
+	Task     string
+	Duration time.Duration
+}
+
+// Result holds the events and the recap of a run.
+type Result struct {
+	Events []*Event
+	Stats  Stats
+	// TaskDurations holds the task summary of the profile_tasks callback, the slowest task first,
+	// empty when the callback is not enabled.
+	TaskDurations []TaskDuration
+	// Duration is the run time reported by the timer callback, zero when the callback is not enabled.
+	Duration time.Duration
+}
+
+// NewResult returns an empty result.
+func NewResult() *Result {
+	return &Result{Events: make([]*Event, 0), Stats: Stats{}, TaskDurations: make([]TaskDuration, 0)}
+}
+
+// Failures returns the failed and unreachable task results, in the order of the run.
+func (r *Result) Failures() []*Event {
+	failures := make([]*Event, 0)
+	for _, event := range r.Events {
+		if event.Failed() || event.Unreachable() {
+			failures = append(failures, event)
+		}
+	}
+	return failures
+}
+
+// Count returns the number of task results of the type, changed results are counted
+// by CounterChanged in addition to their type.
+func (r *Result) Count(counter string) int {
+	count := 0
+	for _, event := range r.Events {
+		switch counter {
+		case CounterOK:
+			if event.Type == TypeOK {
+				count++
+			}
+		case CounterChanged:
+			if event.Type == TypeOK && event.Changed {
+				count++
+			}
+		case CounterFailed:
+			if event.Type == TypeFailed {
+				count++
+			}
+		case CounterSkipped:
+			if event.Type == TypeSkipped {
+				count++
+			}
+		case CounterUnreachable:
+			if event.Type == TypeUnreachable {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// TaskResults returns the number of task results.
+func (r *Result) TaskResults() int {
+	return r.Count(CounterOK) + r.Count(CounterFailed) + r.Count(CounterSkipped) + r.Count(CounterUnreachable)
+}
+
+// Sort orders the events by their counter.
+func (r *Result) Sort() {
+	sort.SliceStable(r.Events, func(i, j int) bool {
+		return r.Events[i].Counter < r.Events[j].Counter
+	})
+}
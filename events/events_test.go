@@ -0,0 +1,158 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestAddRunnerEvent(t *testing.T) {
+	result := NewResult()
+	for _, data := range []string{
+		`{"counter": 3, "event": "runner_on_failed", "event_data": {"play": "web", "task": "Install nginx", "host": "web1",
+			"task_action": "ansible.builtin.apt", "res": {"changed": false, "msg": "No package matching nginx"}}}`,
+		`{"counter": 2, "event": "runner_on_ok", "event_data": {"play": "web", "task": "Gather facts", "host": "web1",
+			"res": {"changed": true}}}`,
+		`{"counter": 4, "event": "runner_on_failed", "event_data": {"play": "web", "task": "Check", "host": "web1",
+			"ignore_errors": true, "res": {"stderr": "not found\n"}}}`,
+		`{"counter": 5, "event": "playbook_on_stats", "event_data": {"ok": {"web1": 1}, "failures": {"web1": 1},
+			"dark": {}, "processed": {"web1": 1}}}`,
+	} {
+		if _, err := result.AddRunnerEvent([]byte(data)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	result.Sort()
+
+	if result.Events[0].Task != "Gather facts" || !result.Events[0].Changed {
+		t.Fatalf("Expected the events ordered by their counter but got: %+v", result.Events[0])
+	}
+	failures := result.Failures()
+	if len(failures) != 1 {
+		t.Fatalf("Expected failures with ignore_errors not to be reported but got: %v", failures)
+	}
+	if failures[0].String() != "task 'Install nginx' (ansible.builtin.apt) failed on 'web1': No package matching nginx" {
+		t.Fatalf("Unexpected failure description: %s", failures[0])
+	}
+	if result.Events[2].Message != "not found" {
+		t.Fatalf("Expected the standard error without a msg but got: '%s'", result.Events[2].Message)
+	}
+	if result.TaskResults() != 3 || result.Count(CounterChanged) != 1 || result.Count(CounterFailed) != 2 {
+		t.Fatalf("Unexpected counts: %d task results, %d changed, %d failed",
+			result.TaskResults(), result.Count(CounterChanged), result.Count(CounterFailed))
+	}
+	if result.Stats["web1"][CounterFailed] != 1 || result.Stats["web1"][CounterOK] != 1 {
+		t.Fatalf("Expected the recap counters to be renamed like in the PLAY RECAP but got: %v", result.Stats)
+	}
+	if _, ok := result.Stats["web1"]["processed"]; ok {
+		t.Fatalf("Expected processed not to be a recap counter but got: %v", result.Stats)
+	}
+}
+
+func TestParseCallbackJSON(t *testing.T) {
+	result, err := ParseCallbackJSON([]byte(`{
+		"plays": [{"play": {"name": "web"}, "tasks": [
+			{"task": {"name": "Install packages"}, "hosts": {
+				"web2": {"changed": true},
+				"web1": {"action": "ansible.builtin.package", "failed": true, "results": [
+					{"item": "curl", "changed": false},
+					{"item": "nginx", "failed": true, "msg": "No package matching nginx"}
+				]}
+			}},
+			{"task": {"name": "Ping"}, "hosts": {"web3": {"unreachable": true, "msg": "timed out"}}}
+		]}],
+		"stats": {"web1": {"ok": 0, "failures": 1, "unreachable": 0}}
+	}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	failures := result.Failures()
+	if len(failures) != 2 {
+		t.Fatalf("Expected 2 failures but got: %v", failures)
+	}
+	if failures[0].String() != "task 'Install packages' (ansible.builtin.package) failed on 'web1': No package matching nginx" {
+		t.Fatalf("Expected the module and the message of the failed loop item but got: %s", failures[0])
+	}
+	if failures[1].String() != "task 'Ping' could not reach 'web3': timed out" {
+		t.Fatalf("Unexpected failure description: %s", failures[1])
+	}
+	if result.Count(CounterChanged) != 1 || result.Stats["web1"][CounterFailed] != 1 {
+		t.Fatalf("Unexpected result: %d changed, stats %v", result.Count(CounterChanged), result.Stats)
+	}
+
+	if _, err := ParseCallbackJSON([]byte("PLAY [web]")); err == nil {
+		t.Fatalf("Expected text output to be rejected")
+	}
+}
+
+func TestCollectorTextOutput(t *testing.T) {
+	collector := NewCollector()
+	for _, line := range []string{
+		"",
+		"\x1b[0;32mPLAY [web] *********************************************\x1b[0m",
+		"TASK [Gathering Facts] *********************************************",
+		"ok: [web1]",
+		"ok: [web2 -> localhost]",
+		"TASK [Install packages] *********************************************",
+		"ok: [web1] => (item=curl)",
+		`failed: [web1] (item=nginx) => {"ansible_loop_var": "item", "changed": false, "item": "nginx", "msg": "No package matching nginx"}`,
+		"changed: [web2] => (item=curl)",
+		"changed: [web2] => (item=nginx)",
+		"TASK [Check config] *********************************************",
+		`fatal: [web2]: FAILED! => {"changed": false, "stderr": "syntax error\n"}`,
+		"...ignoring",
+		"TASK [Ping] *********************************************",
+		`fatal: [web3]: UNREACHABLE! => {`,
+		`    "changed": false,`,
+		`    "msg": "Failed to connect to the host via ssh"`,
+		`}`,
+		"PLAY RECAP *********************************************",
+		"web1                       : ok=2    changed=0    unreachable=0    failed=1    skipped=0",
+		"web2                       : ok=3    changed=1    unreachable=0    failed=0    skipped=0    rescued=0    ignored=1",
+		"web3                       : ok=0    changed=0    unreachable=1    failed=0    skipped=0",
+	} {
+		collector.Line(line)
+	}
+	result := collector.Result()
+
+	failures := result.Failures()
+	if len(failures) != 2 {
+		t.Fatalf("Expected 2 failures but got: %v", failures)
+	}
+	if failures[0].String() != "task 'Install packages' failed on 'web1': No package matching nginx" {
+		t.Fatalf("Unexpected failure description: %s", failures[0])
+	}
+	if failures[1].String() != "task 'Ping' could not reach 'web3': Failed to connect to the host via ssh" {
+		t.Fatalf("Expected the message of the task result printed over many lines but got: %s", failures[1])
+	}
+	if result.TaskResults() != 6 {
+		t.Fatalf("Expected loop items to be merged into one result per host but got %d task results", result.TaskResults())
+	}
+	if result.Count(CounterChanged) != 1 || result.Count(CounterFailed) != 2 {
+		t.Fatalf("Unexpected counts: %d changed, %d failed", result.Count(CounterChanged), result.Count(CounterFailed))
+	}
+	if result.Events[3].Host != "web2" {
+		t.Fatalf("Expected the delegating host but got: %s", result.Events[3].Host)
+	}
+	if result.Stats.Hosts() != 3 || result.Stats.HostsWith(CounterFailed, CounterUnreachable) != 2 {
+		t.Fatalf("Unexpected recap: %v", result.Stats)
+	}
+}
+
+func TestCollectorCallbackJSON(t *testing.T) {
+	collector := NewCollector()
+	for _, line := range []string{
+		"",
+		"{",
+		`    "plays": [{"play": {"name": "web"}, "tasks": [{"task": {"name": "Ping"}, "hosts": {"web1": {"failed": true, "msg": "pong expected"}}}]}],`,
+		`    "stats": {"web1": {"ok": 0, "failures": 1}}`,
+		"}",
+	} {
+		collector.Line(line)
+	}
+	result := collector.Result()
+	if failures := result.Failures(); len(failures) != 1 || failures[0].Message != "pong expected" {
+		t.Fatalf("Expected the failure of the json callback output but got: %v", failures)
+	}
+	if result.Stats["web1"][CounterFailed] != 1 {
+		t.Fatalf("Unexpected recap: %v", result.Stats)
+	}
+}
@@ -0,0 +1,184 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// runnerEvent is a job event of ansible-runner, AWX and Ansible Tower.
+type runnerEvent struct {
+	Counter   int             `json:"counter"`
+	Event     string          `json:"event"`
+	Stdout    string          `json:"stdout"`
+	EventData json.RawMessage `json:"event_data"`
+}
+
+type runnerEventData struct {
+	Play         string                 `json:"play"`
+	Task         string                 `json:"task"`
+	Host         string                 `json:"host"`
+	TaskAction   string                 `json:"task_action"`
+	IgnoreErrors bool                   `json:"ignore_errors"`
+	Res          map[string]interface{} `json:"res"`
+}
+
+// callbackOutput is the output of the json stdout callback of Ansible.
+type callbackOutput struct {
+	Plays []struct {
+		Play struct {
+			Name string `json:"name"`
+		} `json:"play"`
+		Tasks []struct {
+			Task struct {
+				Name string `json:"name"`
+			} `json:"task"`
+			Hosts map[string]map[string]interface{} `json:"hosts"`
+		} `json:"tasks"`
+	} `json:"plays"`
+	Stats map[string]map[string]int `json:"stats"`
+}
+
+// AddRunnerEvent decodes a job event of ansible-runner, AWX or Ansible Tower and adds it to the result.
+// The recap of a playbook_on_stats event is added to the stats. Returns the added event.
+func (r *Result) AddRunnerEvent(data []byte) (*Event, error) {
+	raw := &runnerEvent{}
+	if err := json.Unmarshal(data, raw); err != nil {
+		return nil, fmt.Errorf("job event could not be decoded: %v", err)
+	}
+	event := &Event{Counter: raw.Counter, Type: raw.Event, Stdout: raw.Stdout}
+
+	if len(raw.EventData) > 0 {
+		if raw.Event == TypeStats {
+			stats := make(map[string]interface{})
+			if err := json.Unmarshal(raw.EventData, &stats); err != nil {
+				return nil, fmt.Errorf("job event %d could not be decoded: %v", raw.Counter, err)
+			}
+			for counter, value := range stats {
+				hosts, ok := value.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				for host, count := range hosts {
+					if number, ok := count.(float64); ok {
+						r.addStat(host, counter, int(number))
+					}
+				}
+			}
+		} else {
+			data := &runnerEventData{}
+			if err := json.Unmarshal(raw.EventData, data); err != nil {
+				return nil, fmt.Errorf("job event %d could not be decoded: %v", raw.Counter, err)
+			}
+			event.Play = data.Play
+			event.Task = data.Task
+			event.Host = data.Host
+			event.Action = data.TaskAction
+			event.IgnoreErrors = data.IgnoreErrors
+			event.Changed, _ = data.Res["changed"].(bool)
+			event.Message = resultMessage(data.Res)
+		}
+	}
+
+	r.Events = append(r.Events, event)
+	return event, nil
+}
+
+// ParseCallbackJSON decodes the output of the json stdout callback of Ansible,
+// enabled with ANSIBLE_STDOUT_CALLBACK=json.
+func ParseCallbackJSON(data []byte) (*Result, error) {
+	output := &callbackOutput{}
+	if err := json.Unmarshal(data, output); err != nil {
+		return nil, fmt.Errorf("json callback output could not be decoded: %v", err)
+	}
+	result := NewResult()
+	for _, play := range output.Plays {
+		result.Events = append(result.Events, &Event{Type: TypePlayStart, Play: play.Play.Name})
+		for _, task := range play.Tasks {
+			result.Events = append(result.Events, &Event{Type: TypeTaskStart, Play: play.Play.Name, Task: task.Task.Name})
+			for _, host := range sortedHosts(task.Hosts) {
+				res := task.Hosts[host]
+				event := &Event{Play: play.Play.Name, Task: task.Task.Name, Host: host, Message: resultMessage(res)}
+				event.Changed, _ = res["changed"].(bool)
+				event.Action, _ = res["action"].(string)
+				switch {
+				case isTrue(res["unreachable"]):
+					event.Type = TypeUnreachable
+				case isTrue(res["failed"]):
+					event.Type = TypeFailed
+				case isTrue(res["skipped"]):
+					event.Type = TypeSkipped
+				default:
+					event.Type = TypeOK
+				}
+				result.Events = append(result.Events, event)
+			}
+		}
+	}
+	for host, stats := range output.Stats {
+		for counter, count := range stats {
+			result.addStat(host, counter, count)
+		}
+	}
+	return result, nil
+}
+
+// addStat adds a recap counter of a host, the counters of the job events and the json callback
+// are renamed like in the PLAY RECAP.
+func (r *Result) addStat(host string, counter string, count int) {
+	switch counter {
+	case "failures":
+		counter = CounterFailed
+	case "dark":
+		counter = CounterUnreachable
+	case "processed":
+		return
+	}
+	if _, ok := r.Stats[host]; !ok {
+		r.Stats[host] = make(map[string]int)
+	}
+	r.Stats[host][counter] = count
+}
+
+// resultMessage returns the msg of the task result, the message of the first failed loop item
+// or the standard error, in this order.
+func resultMessage(res map[string]interface{}) string {
+	if res == nil {
+		return ""
+	}
+	if msg, ok := res["msg"]; ok && msg != nil {
+		if text, ok := msg.(string); ok {
+			return strings.TrimSpace(text)
+		}
+		encoded, _ := json.Marshal(msg)
+		return string(encoded)
+	}
+	if items, ok := res["results"].([]interface{}); ok {
+		for _, item := range items {
+			if itemResult, ok := item.(map[string]interface{}); ok && isTrue(itemResult["failed"]) {
+				if message := resultMessage(itemResult); message != "" {
+					return message
+				}
+			}
+		}
+	}
+	if stderr, ok := res["stderr"].(string); ok {
+		return strings.TrimSpace(stderr)
+	}
+	return ""
+}
+
+func isTrue(value interface{}) bool {
+	b, ok := value.(bool)
+	return ok && b
+}
+
+func sortedHosts(hosts map[string]map[string]interface{}) []string {
+	names := make([]string, 0, len(hosts))
+	for name := range hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
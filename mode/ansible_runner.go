@@ -0,0 +1,148 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/events"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+	uuid "github.com/satori/go.uuid"
+)
+
+// runnerArtifactDirectory is relative to the artifact directory, every run of a play
+// is stored in a directory named after its ident.
+const runnerArtifactDirectory = "ansible-runner"
+
+// Status written by ansible-runner when the job timeout canceled the play.
+const runnerStatusTimeout = "timeout"
+
+// ansibleRunner drives a local playbook play with ansible-runner.
+type ansibleRunner struct {
+	privateDataDirectory string
+	artifactDirectory    string
+	ident                string
+	// runCommand executes the ansible-runner command, the local mode sets the command runner of the play,
+	// a command never cancelled by default:
+	runCommand func(o terraform.UIOutput, command types.Commands) error
+}
+
+// newAnsibleRunner creates the private data directory of the play, the play timeout
+// is the job timeout such that ansible-runner cancels the play itself.
+func newAnsibleRunner(play *types.Play, artifactDirectory string, workDirectory string) (*ansibleRunner, error) {
+	privateDataDirectory, err := ioutil.TempDir(workDirectory, "tf-ansible-runner")
+	if err != nil {
+		return nil, err
+	}
+	if play.Timeout() > 0 {
+		if err := os.MkdirAll(filepath.Join(privateDataDirectory, "env"), 0700); err != nil {
+			os.RemoveAll(privateDataDirectory)
+			return nil, err
+		}
+		settings := fmt.Sprintf("job_timeout: %d\n", play.Timeout())
+		if err := ioutil.WriteFile(filepath.Join(privateDataDirectory, "env", "settings"), []byte(settings), 0600); err != nil {
+			os.RemoveAll(privateDataDirectory)
+			return nil, err
+		}
+	}
+	runnerArtifacts, err := artifactPath(artifactDirectory, runnerArtifactDirectory)
+	if err != nil {
+		os.RemoveAll(privateDataDirectory)
+		return nil, err
+	}
+	return &ansibleRunner{
+		privateDataDirectory: privateDataDirectory,
+		artifactDirectory:    runnerArtifacts,
+		ident:                uuid.NewV4().String(),
+		runCommand: func(o terraform.UIOutput, command types.Commands) error {
+			return runLocalCommands(context.Background(), o, command, 0)
+		},
+	}, nil
+}
+
+// args returns the ansible-runner directories of the play command.
+func (r *ansibleRunner) args() types.RunnerArgs {
+	return types.RunnerArgs{
+		PrivateDataDirectory: r.privateDataDirectory,
+		ArtifactDirectory:    r.artifactDirectory,
+		Ident:                r.ident,
+	}
+}
+
+// cleanup removes the private data directory, the artifacts are kept.
+func (r *ansibleRunner) cleanup() {
+	os.RemoveAll(r.privateDataDirectory)
+}
+
+// artifacts returns the directory of the artifacts of this run.
+func (r *ansibleRunner) artifacts() string {
+	return filepath.Join(r.artifactDirectory, r.ident)
+}
+
+// run executes the ansible-runner command and writes the failed task results
+// and a summary of the job events once the play finishes.
+func (r *ansibleRunner) run(o terraform.UIOutput, play *types.Play, command types.Commands) error {
+	err := r.runCommand(o, command)
+
+	result, eventsErr := r.events()
+	if eventsErr != nil {
+		o.Output(fmt.Sprintf("ansible-runner job events could not be read: %v", eventsErr))
+	} else {
+		outputRunnerEvents(o, result)
+	}
+	o.Output(fmt.Sprintf("ansible-runner artifacts written to '%s'", r.artifacts()))
+
+	if err != nil && r.status() == runnerStatusTimeout {
+		return fmt.Errorf("ansible-runner canceled the play after %d seconds: %w", play.Timeout(), err)
+	}
+	return err
+}
+
+// status returns the final status of the run, empty when ansible-runner did not write one.
+func (r *ansibleRunner) status() string {
+	status, err := ioutil.ReadFile(filepath.Join(r.artifacts(), "status"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(status))
+}
+
+// events reads the job events of the run ordered by their counter.
+func (r *ansibleRunner) events() (*events.Result, error) {
+	files, err := filepath.Glob(filepath.Join(r.artifacts(), "job_events", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	result := events.NewResult()
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		event, err := result.AddRunnerEvent(contents)
+		if err != nil {
+			return nil, fmt.Errorf("job event '%s' could not be decoded: %v", filepath.Base(file), err)
+		}
+		if event.Counter == 0 {
+			// events are named <counter>-<uuid>.json:
+			event.Counter, _ = strconv.Atoi(strings.SplitN(filepath.Base(file), "-", 2)[0])
+		}
+	}
+	result.Sort()
+	return result, nil
+}
+
+// outputRunnerEvents writes every failed and unreachable task result and the number of task results by outcome.
+func outputRunnerEvents(o terraform.UIOutput, result *events.Result) {
+	for _, failure := range result.Failures() {
+		o.Output(fmt.Sprintf("ansible-runner: %s", failure))
+	}
+	o.Output(fmt.Sprintf("ansible-runner: %d task results, ok=%d changed=%d failed=%d skipped=%d unreachable=%d",
+		result.TaskResults(), result.Count(events.CounterOK), result.Count(events.CounterChanged),
+		result.Count(events.CounterFailed), result.Count(events.CounterSkipped), result.Count(events.CounterUnreachable)))
+}
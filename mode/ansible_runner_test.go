@@ -0,0 +1,143 @@
+package mode
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+// fakeAnsibleRunner writes the artifacts of a run with a failed task, like ansible-runner does.
+const fakeAnsibleRunner = `#!/bin/sh
+for arg in "$@"; do
+  case "$arg" in
+    --ident=*) ident="${arg#--ident=}" ;;
+    --artifact-dir=*) artifacts="${arg#--artifact-dir=}" ;;
+  esac
+done
+mkdir -p "$artifacts/$ident/job_events"
+echo '{"counter": 2, "event": "runner_on_ok", "event_data": {"host": "web", "task": "Gathering Facts", "res": {"changed": false}}}' > "$artifacts/$ident/job_events/2-a.json"
+echo '{"counter": 3, "event": "runner_on_failed", "event_data": {"host": "web", "task": "Install nginx", "res": {"msg": "No package matching nginx"}}}' > "$artifacts/$ident/job_events/3-b.json"
+echo '{"counter": 1, "event": "playbook_on_start", "event_data": {}}' > "$artifacts/$ident/job_events/1-c.json"
+echo failed > "$artifacts/$ident/status"
+exit 2
+`
+
+func TestAnsibleRunnerCommand(t *testing.T) {
+	artifactDirectory, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(artifactDirectory)
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"playbook": []interface{}{map[string]interface{}{
+			"file_path":             "/path/to/site.yml",
+			"additional_file_paths": []interface{}{"/path/to/verify.yml"},
+			"tags":                  []interface{}{"web"},
+		}},
+		"timeout": 600,
+	})
+	runner, err := newAnsibleRunner(play, artifactDirectory, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer runner.cleanup()
+
+	settings, err := ioutil.ReadFile(filepath.Join(runner.privateDataDirectory, "env", "settings"))
+	if err != nil || string(settings) != "job_timeout: 600\n" {
+		t.Fatalf("Expected the play timeout to be the job timeout but got: '%s', %v", string(settings), err)
+	}
+
+	command, err := play.ToLocalRunnerCommand(types.LocalModeAnsibleArgs{Username: "centos", Port: 22},
+		types.NewAnsibleSSHSettingsFromInterface(nil, false), runner.args())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, expected := range []string{
+		"ansible-runner run '" + runner.privateDataDirectory + "'",
+		"--ident='" + runner.ident + "'",
+		"--artifact-dir='" + filepath.Join(artifactDirectory, runnerArtifactDirectory) + "'",
+		"--playbook='/path/to/site.yml'",
+		`--cmdline='/path/to/verify.yml --tags='\''web'\''`,
+		`--user='\''centos'\''`,
+	} {
+		if !strings.Contains(command.String(), expected) {
+			t.Fatalf("Expected '%s' in the ansible-runner command but got: %s", expected, command)
+		}
+	}
+
+	modulePlay := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"module": []interface{}{map[string]interface{}{
+			"module":   "setup",
+			"one_line": true,
+			"tree":     "",
+		}},
+	})
+	if _, err := modulePlay.ToLocalRunnerCommand(types.LocalModeAnsibleArgs{}, types.NewAnsibleSSHSettingsFromInterface(nil, false), runner.args()); err == nil {
+		t.Fatalf("Expected module plays not to be executed with ansible-runner")
+	}
+
+	runner.cleanup()
+	if _, err := os.Stat(runner.privateDataDirectory); !os.IsNotExist(err) {
+		t.Fatalf("Expected the private data directory to be removed but got: %v", err)
+	}
+}
+
+func TestAnsibleRunnerRunOutputsEvents(t *testing.T) {
+	root, err := ioutil.TempDir("", "ansible-runner")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(root)
+	binary := filepath.Join(root, "ansible-runner")
+	if err := ioutil.WriteFile(binary, []byte(fakeAnsibleRunner), 0755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// the command runs without a shell, the fake ansible-runner is found on the PATH of the provisioner:
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", root+string(os.PathListSeparator)+path)
+	defer os.Setenv("PATH", path)
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"playbook": []interface{}{map[string]interface{}{
+			"file_path": "/path/to/site.yml",
+		}},
+	})
+	runner, err := newAnsibleRunner(play, filepath.Join(root, "artifacts"), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer runner.cleanup()
+	command, err := play.ToLocalRunnerCommand(types.LocalModeAnsibleArgs{Username: "centos", Port: 22},
+		types.NewAnsibleSSHSettingsFromInterface(nil, false), runner.args())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lines := make([]string, 0)
+	output := &terraform.MockUIOutput{OutputFn: func(line string) { lines = append(lines, line) }}
+	err = runner.run(output, play, types.Commands{command})
+	if exitStatusFromError(err) != ansibleExitStatusFailed {
+		t.Fatalf("Expected the exit status of ansible-playbook but got: %v", err)
+	}
+
+	written := strings.Join(lines, "\n")
+	for _, expected := range []string{
+		"ansible-runner: task 'Install nginx' failed on 'web': No package matching nginx",
+		"ansible-runner: 2 task results, ok=1 changed=0 failed=1 skipped=0 unreachable=0",
+		"artifacts written to '" + runner.artifacts() + "'",
+	} {
+		if !strings.Contains(written, expected) {
+			t.Fatalf("Expected '%s' in the output but got: %s", expected, written)
+		}
+	}
+	if runner.status() != "failed" {
+		t.Fatalf("Expected the status of the run but got: '%s'", runner.status())
+	}
+}
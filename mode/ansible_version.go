@@ -0,0 +1,124 @@
+package mode
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+// ansibleVersionPattern matches the version reported by ansible-playbook --version,
+// for example "ansible-playbook 2.9.27" or "ansible-playbook [core 2.15.5]".
+var ansibleVersionPattern = regexp.MustCompile(`(?m)^ansible-playbook \[?(?:core )?([0-9]+(?:\.[0-9]+)*)`)
+
+// parseAnsibleVersion returns the version from the output of ansible-playbook --version.
+func parseAnsibleVersion(output string) (string, error) {
+	match := ansibleVersionPattern.FindStringSubmatch(output)
+	if match == nil {
+		return "", fmt.Errorf("Could not read the Ansible version from: %s", strings.TrimSpace(output))
+	}
+	return match[1], nil
+}
+
+// compareVersions compares dotted numeric versions, missing components are zero.
+// Returns a negative number when a is older than b, zero when equal and a positive number when newer.
+func compareVersions(a, b string) int {
+	left := strings.Split(a, ".")
+	right := strings.Split(b, ".")
+	for i := 0; i < len(left) || i < len(right); i++ {
+		l, r := 0, 0
+		if i < len(left) {
+			l, _ = strconv.Atoi(left[i])
+		}
+		if i < len(right) {
+			r, _ = strconv.Atoi(right[i])
+		}
+		if l != r {
+			return l - r
+		}
+	}
+	return 0
+}
+
+// ansibleVersionInRange tells if the version is at least the minimum and at most the maximum, empty bounds
+// are not checked. The maximum applies to its components only, a maximum of 2.15 allows 2.15.5.
+func ansibleVersionInRange(version, minimum, maximum string) bool {
+	if minimum != "" && compareVersions(version, minimum) < 0 {
+		return false
+	}
+	if maximum != "" {
+		components := strings.Split(version, ".")
+		if limit := len(strings.Split(maximum, ".")); len(components) > limit {
+			components = components[:limit]
+		}
+		if compareVersions(strings.Join(components, "."), maximum) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// checkAnsibleVersion fails, or warns, when the version is out of the range of the run options.
+func checkAnsibleVersion(o terraform.UIOutput, version string, options RunOptions) error {
+	if ansibleVersionInRange(version, options.AnsibleMinVersion, options.AnsibleMaxVersion) {
+		return nil
+	}
+	bounds := make([]string, 0)
+	if options.AnsibleMinVersion != "" {
+		bounds = append(bounds, fmt.Sprintf("at least %s", options.AnsibleMinVersion))
+	}
+	if options.AnsibleMaxVersion != "" {
+		bounds = append(bounds, fmt.Sprintf("at most %s", options.AnsibleMaxVersion))
+	}
+	message := fmt.Sprintf("Ansible %s is not supported by the configuration, required: %s", version, strings.Join(bounds, " and "))
+	if options.OnAnsibleVersionMismatch == types.OnMismatchWarn {
+		o.Output(fmt.Sprintf("WARNING: %s", message))
+		return nil
+	}
+	return fmt.Errorf("%s; upgrade Ansible on the machine running the plays", message)
+}
+
+// ansibleVersionCheck checks the version of every Ansible installation once for all plays of a run,
+// the plays may run concurrently and with different installations.
+type ansibleVersionCheck struct {
+	sync.Mutex
+	options RunOptions
+	results map[string]*ansibleVersionResult
+}
+
+type ansibleVersionResult struct {
+	once sync.Once
+	err  error
+}
+
+func newAnsibleVersionCheck(options RunOptions) *ansibleVersionCheck {
+	return &ansibleVersionCheck{options: options, results: make(map[string]*ansibleVersionResult)}
+}
+
+// check reads the version of the installation with the function and checks it on the first call for
+// the installation, later calls return the result. Nothing is read when the run options have no range.
+func (v *ansibleVersionCheck) check(o terraform.UIOutput, installation string, version func() (string, error)) error {
+	if v.options.AnsibleMinVersion == "" && v.options.AnsibleMaxVersion == "" {
+		return nil
+	}
+	v.Lock()
+	result, ok := v.results[installation]
+	if !ok {
+		result = &ansibleVersionResult{}
+		v.results[installation] = result
+	}
+	v.Unlock()
+	result.once.Do(func() {
+		installed, err := version()
+		if err != nil {
+			result.err = fmt.Errorf("Could not check the Ansible version: %v", err)
+			return
+		}
+		result.err = checkAnsibleVersion(o, installed, v.options)
+	})
+	return result.err
+}
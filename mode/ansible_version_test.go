@@ -0,0 +1,134 @@
+package mode
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+func TestParseAnsibleVersion(t *testing.T) {
+	for output, expected := range map[string]string{
+		"ansible-playbook 2.9.27\n  config file = None\n":                          "2.9.27",
+		"ansible-playbook [core 2.15.5]\n  config file = /etc/ansible/ansible.cfg": "2.15.5",
+		"[WARNING]: unsupported locale\nansible-playbook [core 2.16.0]\n":          "2.16.0",
+	} {
+		version, err := parseAnsibleVersion(output)
+		if err != nil || version != expected {
+			t.Fatalf("Expected version '%s' from %q but got: '%s', %v", expected, output, version, err)
+		}
+	}
+	if _, err := parseAnsibleVersion("sh: ansible-playbook: not found"); err == nil {
+		t.Fatal("Expected an error for output without a version")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"2.9.27", "2.9", 1},
+		{"2.9", "2.9.0", 0},
+		{"2.15.5", "2.9", 1},
+		{"2.8.20", "2.9", -1},
+	} {
+		result := compareVersions(tc.a, tc.b)
+		if (result < 0 && tc.expected >= 0) || (result > 0 && tc.expected <= 0) || (result == 0 && tc.expected != 0) {
+			t.Fatalf("Expected comparing '%s' to '%s' to give %d but got: %d", tc.a, tc.b, tc.expected, result)
+		}
+	}
+}
+
+func TestRemoteEnsureAnsibleExistingInstallation(t *testing.T) {
+	virtualenv, err := ioutil.TempDir("", "ansible-venv")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(virtualenv)
+	if err := os.MkdirAll(filepath.Join(virtualenv, "bin"), 0755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(virtualenv, "bin", "ansible-playbook"),
+		[]byte("#!/bin/sh\necho 'ansible-playbook [core 2.15.5]'\n"), 0755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	newRemoteMode := func(remote map[string]interface{}) *RemoteMode {
+		remote["use_sudo"] = false
+		remote["virtualenv_directory"] = virtualenv
+		data := schema.TestResourceDataRaw(t, map[string]*schema.Schema{
+			"remote": types.NewRemoteSchema(),
+		}, map[string]interface{}{
+			"remote": []interface{}{remote},
+		})
+		return &RemoteMode{
+			o:              new(terraform.MockUIOutput),
+			comm:           &localCommunicator{},
+			remoteSettings: types.NewRemoteSettingsFromInterface(data.GetOk("remote")),
+		}
+	}
+
+	// the installation is skipped, the communicator can not upload the installer:
+	v := newRemoteMode(map[string]interface{}{"ensure_version": "2.9"})
+	if err := v.ensureAnsible(); err != nil {
+		t.Fatalf("Expected the existing installation to be reused but got: %v", err)
+	}
+
+	v = newRemoteMode(map[string]interface{}{"ensure_version": "2.16", "skip_install": true})
+	if err := v.ensureAnsible(); err == nil || !strings.Contains(err.Error(), "does not meet the minimum version 2.16") {
+		t.Fatalf("Expected an error for an outdated installation with skip_install but got: %v", err)
+	}
+}
+
+func TestAnsibleVersionInRange(t *testing.T) {
+	for _, c := range []struct {
+		version, minimum, maximum string
+		expected                  bool
+	}{
+		{"2.9.27", "", "", true},
+		{"2.9.27", "2.12", "", false},
+		{"2.12.0", "2.12", "", true},
+		{"2.15.5", "2.12", "2.15", true},
+		{"2.16.0", "2.12", "2.15", false},
+		{"2.15.5", "", "2.15.4", false},
+	} {
+		if actual := ansibleVersionInRange(c.version, c.minimum, c.maximum); actual != c.expected {
+			t.Fatalf("Expected %s in [%s, %s] to be %v", c.version, c.minimum, c.maximum, c.expected)
+		}
+	}
+}
+
+func TestAnsibleVersionCheckFailsOrWarnsOnce(t *testing.T) {
+	reads := 0
+	version := func() (string, error) {
+		reads++
+		return "2.9.27", nil
+	}
+
+	check := newAnsibleVersionCheck(RunOptions{AnsibleMinVersion: "2.12", OnAnsibleVersionMismatch: types.OnMismatchFail})
+	for i := 0; i < 2; i++ {
+		err := check.check(new(terraform.MockUIOutput), "ansible-playbook --version", version)
+		if err == nil || !strings.Contains(err.Error(), "Ansible 2.9.27 is not supported by the configuration, required: at least 2.12") {
+			t.Fatalf("Expected the old Ansible to fail the run but got: %v", err)
+		}
+	}
+	if reads != 1 {
+		t.Fatalf("Expected the version read once for all plays but got: %d", reads)
+	}
+
+	output := new(terraform.MockUIOutput)
+	check = newAnsibleVersionCheck(RunOptions{AnsibleMinVersion: "2.12", AnsibleMaxVersion: "2.15", OnAnsibleVersionMismatch: types.OnMismatchWarn})
+	if err := check.check(output, "ansible-playbook --version", version); err != nil || !strings.HasPrefix(output.OutputMessage, "WARNING: Ansible 2.9.27") {
+		t.Fatalf("Expected a warning but got: %v, '%s'", err, output.OutputMessage)
+	}
+
+	if err := newAnsibleVersionCheck(RunOptions{}).check(output, "ansible-playbook --version", version); err != nil || reads != 2 {
+		t.Fatalf("Expected no version read without a range but got: %v, %d reads", err, reads)
+	}
+}
@@ -0,0 +1,47 @@
+package mode
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/radekg/terraform-provisioner-ansible/types"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// defaultArtifactDirectory is relative to the Terraform working directory, next to the play hashes.
+const defaultArtifactDirectory = ".terraform/ansible-artifacts"
+
+// remoteArtifactDirectory is relative to the bootstrap directory of the remote provisioner.
+const remoteArtifactDirectory = "artifacts"
+
+// artifactPath resolves a relative output path of a play under the artifact directory,
+// absolute paths are used as given.
+func artifactPath(artifactDirectory string, path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path), nil
+	}
+	if artifactDirectory == "" {
+		artifactDirectory = defaultArtifactDirectory
+	}
+	return filepath.Abs(filepath.Join(artifactDirectory, path))
+}
+
+// prepareModuleTree points the tree of a module play at the artifact directory and creates the directory.
+func prepareModuleTree(o terraform.UIOutput, play *types.Play, artifactDirectory string) error {
+	module, ok := play.Entity().(*types.Module)
+	if !ok || module.Tree() == "" {
+		return nil
+	}
+	treeDir, err := artifactPath(artifactDirectory, module.Tree())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(treeDir, 0755); err != nil {
+		return fmt.Errorf("could not create the tree directory '%s': %v", treeDir, err)
+	}
+	o.Output(fmt.Sprintf("per-host results of the module play are written to '%s'", treeDir))
+	module.SetOverrideTree(treeDir)
+	return nil
+}
@@ -0,0 +1,60 @@
+package mode
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+func TestPrepareModuleTreeUnderArtifactDirectory(t *testing.T) {
+	artifactDirectory, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(artifactDirectory)
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"module": []interface{}{map[string]interface{}{
+			"module":   "setup",
+			"one_line": true,
+			"tree":     "facts/web",
+		}},
+	})
+	if err := prepareModuleTree(new(terraform.MockUIOutput), play, artifactDirectory); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	treeDir := filepath.Join(artifactDirectory, "facts", "web")
+	if info, err := os.Stat(treeDir); err != nil || !info.IsDir() {
+		t.Fatalf("Expected the tree directory to be created but got: %v", err)
+	}
+	command, err := play.ToCommand(types.LocalModeAnsibleArgs{Username: "test"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, expected := range []string{"--one-line", "--tree='" + treeDir + "'"} {
+		if !strings.Contains(command, expected) {
+			t.Fatalf("Expected '%s' in the module command but got: %s", expected, command)
+		}
+	}
+
+	absoluteTree := filepath.Join(artifactDirectory, "absolute")
+	play = test.GetNewDefaultPlay(t, map[string]interface{}{
+		"module": []interface{}{map[string]interface{}{
+			"module":   "setup",
+			"one_line": true,
+			"tree":     absoluteTree,
+		}},
+	})
+	if err := prepareModuleTree(new(terraform.MockUIOutput), play, "/not/used"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if tree := play.Entity().(*types.Module).Tree(); tree != absoluteTree {
+		t.Fatalf("Expected an absolute tree to be used as given but got: %s", tree)
+	}
+}
@@ -0,0 +1,37 @@
+package mode
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// ansiEscapeSequence matches terminal color codes, Ansible output is forced to be colored.
+var ansiEscapeSequence = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// capturingOutput is a UIOutput writing every line to the wrapped output and to a writer.
+type capturingOutput struct {
+	o    terraform.UIOutput
+	w    io.Writer
+	mask func(string) string
+}
+
+func newCapturingOutput(o terraform.UIOutput, w io.Writer) *capturingOutput {
+	return &capturingOutput{o: o, w: w}
+}
+
+// newMaskedCapturingOutput masks every line written to the writer, the wrapped output masks its lines itself.
+func newMaskedCapturingOutput(o terraform.UIOutput, w io.Writer, mask func(string) string) *capturingOutput {
+	return &capturingOutput{o: o, w: w, mask: mask}
+}
+
+// Output writes the line to the wrapped output and, with colors removed, to the writer.
+func (v *capturingOutput) Output(line string) {
+	v.o.Output(line)
+	if v.mask != nil {
+		line = v.mask(line)
+	}
+	fmt.Fprintln(v.w, ansiEscapeSequence.ReplaceAllString(line, ""))
+}
@@ -0,0 +1,41 @@
+package mode
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestCapturingOutputWritesLinesWithoutColors(t *testing.T) {
+	output := new(terraform.MockUIOutput)
+	var buf bytes.Buffer
+
+	o := newCapturingOutput(output, &buf)
+	o.Output("\x1b[0;33mchanged: [10.1.100.34]\x1b[0m")
+	o.Output("--- before: /etc/motd")
+
+	if output.OutputMessage != "--- before: /etc/motd" {
+		t.Fatalf("Expected the line in wrapped output but got: %s", output.OutputMessage)
+	}
+	expected := "changed: [10.1.100.34]\n--- before: /etc/motd\n"
+	if buf.String() != expected {
+		t.Fatalf("Expected captured output '%s' but got: '%s'", expected, buf.String())
+	}
+}
+
+func TestMaskedCapturingOutputMasksCapturedLines(t *testing.T) {
+	var buf bytes.Buffer
+	secrets := newMaskingOutput(new(terraform.MockUIOutput), []string{"s3cr3t"})
+	play := newMaskingOutput(secrets, []string{"v4ult"})
+
+	o := newMaskedCapturingOutput(play, &buf, func(line string) string {
+		return maskSecrets(play, line)
+	})
+	o.Output("+password: s3cr3t, vault: v4ult")
+
+	expected := "+password: ******, vault: ******\n"
+	if buf.String() != expected {
+		t.Fatalf("Expected captured output '%s' but got: '%s'", expected, buf.String())
+	}
+}
@@ -0,0 +1,63 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// WithRunTimeout returns a context done when the run takes longer than the timeout, in seconds.
+// Every step of the run is bounded by it: host key scans, SSH and bastion connections, retries and
+// commands. A timeout of 0 does not bound the run. The returned function releases the context.
+func WithRunTimeout(ctx context.Context, timeout int) (context.Context, func()) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+}
+
+// retryContext calls f until it succeeds or the context is done, waiting for the interval
+// between the attempts. Returns the last error of f when the context is done.
+func retryContext(ctx context.Context, interval time.Duration, f func() error) error {
+	for {
+		err := f()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%v: %v", ctx.Err(), err)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// dialSSH connects to the SSH server, the connection and the handshake are abandoned
+// when the context is done.
+func dialSSH(ctx context.Context, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := (&net.Dialer{Timeout: config.Timeout}).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	handshake := make(chan struct{})
+	defer close(handshake)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-handshake:
+		}
+	}()
+	c, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%v: %v", ctx.Err(), err)
+		}
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
@@ -0,0 +1,88 @@
+package mode
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestWithRunTimeout(t *testing.T) {
+	ctx, cancel := WithRunTimeout(context.Background(), 0)
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatalf("Expected no deadline without a run timeout")
+	}
+
+	ctx, cancel = WithRunTimeout(context.Background(), 60)
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > time.Minute {
+		t.Fatalf("Expected a deadline within a minute but got: %v", deadline)
+	}
+}
+
+func TestRetryContextStopsWhenDone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	attempts := 0
+	err := retryContext(ctx, 10*time.Millisecond, func() error {
+		attempts++
+		return errors.New("host unreachable")
+	})
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded: host unreachable") {
+		t.Fatalf("Expected the deadline and the last error but got: %v", err)
+	}
+	if attempts < 2 {
+		t.Fatalf("Expected the function to be retried but got %d attempts", attempts)
+	}
+
+	attempts = 0
+	err = retryContext(context.Background(), 10*time.Millisecond, func() error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("host unreachable")
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("Expected success after 3 attempts but got: %v, %d attempts", err, attempts)
+	}
+}
+
+func TestDialSSHAbandonsHandshakeWhenDone(t *testing.T) {
+	// the server accepts the connection and never answers:
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	_, err = dialSSH(ctx, listener.Addr().String(), &ssh.ClientConfig{
+		User:            "test-username",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         time.Minute,
+	})
+	if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Fatalf("Expected the handshake to be abandoned at the deadline but got: %v", err)
+	}
+	if time.Since(started) > 10*time.Second {
+		t.Fatalf("Expected the handshake to be abandoned at the deadline but it took %v", time.Since(started))
+	}
+}
@@ -0,0 +1,210 @@
+package mode
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+// containerCommand returns the command running the Ansible command in the execution environment container
+// on the host. The bootstrap directory is mounted at the same path, such that the uploaded paths of the play
+// are valid in the container, the root file system of the host is mounted at the host root for the chroot connection.
+// Returns the command as is when no execution environment image is configured.
+func containerCommand(command string, remoteSettings *types.RemoteSettings) string {
+	if remoteSettings.ContainerImage() == "" {
+		return command
+	}
+	bootstrapDirectory := remoteSettings.BootstrapDirectory()
+	return fmt.Sprintf("%s run --rm --network host --pid host --privileged --volume /:%s --volume \"%s:%s:z\" --workdir \"%s\" --entrypoint /bin/sh %s -c %s",
+		remoteSettings.ContainerEngine(),
+		remoteSettings.ContainerHostRoot(),
+		bootstrapDirectory, bootstrapDirectory,
+		bootstrapDirectory,
+		types.ShellQuote(remoteSettings.ContainerImage()),
+		types.ShellQuote(command))
+}
+
+// containerInventoryHosts connects to the host itself from the execution environment container
+// with the chroot connection into the mounted root file system, other hosts are connected to as configured.
+func containerInventoryHosts(hosts []inventoryTemplateRemoteDataHost, hostRoot string) []inventoryTemplateRemoteDataHost {
+	for i, host := range hosts {
+		if !host.Local {
+			continue
+		}
+		hosts[i] = inventoryTemplateRemoteDataHost{
+			Alias: host.Alias,
+			Vars: append([]string{
+				"ansible_connection=community.general.chroot",
+				fmt.Sprintf("ansible_host=%s", hostRoot),
+			}, host.Vars...),
+		}
+	}
+	return hosts
+}
+
+// localContainerCommand returns the command running the local Ansible commands in the execution environment
+// container on the machine running Terraform. The mounts are mounted at the same paths, such that the paths
+// of the generated inventory, the keys and the playbooks are valid in the container. The mounts of a read-only
+// execution environment are read-only, except of the writable mounts. The commands run in the shell of the container.
+func localContainerCommand(commands types.Commands, executionEnvironment *types.ExecutionEnvironment, mounts []string, writableMounts []string) types.Commands {
+	if !executionEnvironment.IsInUse() {
+		return commands
+	}
+	command := types.NewCommand(executionEnvironment.Engine()).Arg("run").Arg("--rm").Arg("--network").Arg("host")
+	// the temporary files of the play are readable by the user running Terraform only:
+	if uid := os.Getuid(); uid >= 0 {
+		if executionEnvironment.Engine() == "podman" {
+			command.Arg("--userns").Arg("keep-id")
+		} else {
+			command.Arg("--user").Arg(fmt.Sprintf("%d:%d", uid, os.Getgid()))
+		}
+	}
+	command.Arg("--env").Arg("HOME=/tmp")
+	if sshAuthSock := os.Getenv("SSH_AUTH_SOCK"); sshAuthSock != "" {
+		command.Arg("--env").Option("SSH_AUTH_SOCK", sshAuthSock)
+	}
+	for _, mount := range mounts {
+		volume := mount + ":" + mount
+		if executionEnvironment.ReadOnly() {
+			volume = volume + ":ro"
+		}
+		command.Arg("--volume").QuotedArg(volume)
+	}
+	for _, mount := range writableMounts {
+		command.Arg("--volume").QuotedArg(mount + ":" + mount)
+	}
+	for _, volume := range executionEnvironment.Volumes() {
+		command.Arg("--volume").QuotedArg(volume)
+	}
+	// the working directory is created in the container when not mounted, relative paths stay valid:
+	if workingDirectory, err := os.Getwd(); err == nil {
+		command.Arg("--workdir").QuotedArg(workingDirectory)
+	}
+	command.Arg("--entrypoint").Arg("/bin/sh").QuotedArg(executionEnvironment.Image()).Arg("-c").QuotedArg(commands.String())
+	return types.Commands{command}
+}
+
+// localPlayDirectories returns the existing local directories the play reads from and writes to: the work
+// directory of the temporary files, the working directory, the playbook, roles and collections directories, the directories of the
+// variable, inventory, vault password and known hosts files, the artifact directory and the SSH agent socket.
+// These are mounted in the execution environment container and translated for WSL.
+// Directories under another returned directory are not returned again.
+func localPlayDirectories(play *types.Play, ansibleSSHSettings *types.AnsibleSSHSettings, artifactDirectory string, workDirectory string) ([]string, error) {
+	paths, err := playInputDirectories(play, ansibleSSHSettings, workDirectory)
+	if err != nil {
+		return nil, err
+	}
+	if workingDirectory, err := os.Getwd(); err == nil {
+		paths = append(paths, workingDirectory)
+	}
+	// the artifacts written in the container are kept:
+	artifacts, err := localArtifactDirectory(artifactDirectory)
+	if err != nil {
+		return nil, err
+	}
+	return outermostDirectories(append(paths, artifacts))
+}
+
+// dockerPlayDirectories returns the directories mounted read-only in the run_in_docker container: the work
+// directory with the generated files, the playbook, roles and collections directories and the directories
+// of the files referenced by the play. The working directory is not mounted. The artifact directory is
+// returned separately, it is the only directory written in the container.
+func dockerPlayDirectories(play *types.Play, ansibleSSHSettings *types.AnsibleSSHSettings, artifactDirectory string, workDirectory string) ([]string, string, error) {
+	paths, err := playInputDirectories(play, ansibleSSHSettings, workDirectory)
+	if err != nil {
+		return nil, "", err
+	}
+	mounts, err := outermostDirectories(paths)
+	if err != nil {
+		return nil, "", err
+	}
+	artifacts, err := localArtifactDirectory(artifactDirectory)
+	if err != nil {
+		return nil, "", err
+	}
+	absoluteArtifacts, err := filepath.Abs(artifacts)
+	if err != nil {
+		return nil, "", err
+	}
+	return mounts, absoluteArtifacts, nil
+}
+
+// playInputDirectories returns the work directory, the playbook, roles and collections directories and
+// the directories of the variable, inventory, vault password and known hosts files and the SSH agent socket.
+func playInputDirectories(play *types.Play, ansibleSSHSettings *types.AnsibleSSHSettings, workDirectory string) ([]string, error) {
+	if workDirectory == "" {
+		workDirectory = os.TempDir()
+	}
+	paths := []string{workDirectory}
+
+	uploads, err := playDirectoryUploads([]*types.Play{play})
+	if err != nil {
+		return nil, err
+	}
+	for _, upload := range uploads {
+		paths = append(paths, upload.path)
+	}
+	paths = append(paths, play.CollectionsPath()...)
+
+	files := append(append([]string{}, play.ExtraVarsFiles()...), play.ExtraVarsVaultFiles()...)
+	files = append(files, play.InventoryFile(), play.VaultPasswordFile(),
+		ansibleSSHSettings.UserKnownHostsFile(), ansibleSSHSettings.BastionUserKnownHostsFile(),
+		os.Getenv("SSH_AUTH_SOCK"))
+	for _, vaultID := range play.VaultID() {
+		_, source := types.SplitVaultID(vaultID)
+		files = append(files, source)
+	}
+	for _, file := range files {
+		if file != "" {
+			paths = append(paths, filepath.Dir(file))
+		}
+	}
+	return paths, nil
+}
+
+// localArtifactDirectory creates the artifact directory of the local plays.
+func localArtifactDirectory(artifactDirectory string) (string, error) {
+	artifacts, err := artifactPath(artifactDirectory, ".")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(artifacts, 0755); err != nil {
+		return "", fmt.Errorf("could not create the artifact directory '%s': %v", artifacts, err)
+	}
+	return artifacts, nil
+}
+
+// outermostDirectories returns the existing directories as absolute paths, sorted,
+// without the directories under another returned directory.
+func outermostDirectories(paths []string) ([]string, error) {
+	resolved := make([]string, 0, len(paths))
+	for _, path := range paths {
+		absolutePath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(absolutePath); err == nil {
+			resolved = append(resolved, absolutePath)
+		}
+	}
+	sort.Strings(resolved)
+
+	mounts := make([]string, 0, len(resolved))
+	for _, path := range resolved {
+		mounted := false
+		for _, mount := range mounts {
+			if path == mount || strings.HasPrefix(path, strings.TrimSuffix(mount, string(filepath.Separator))+string(filepath.Separator)) {
+				mounted = true
+				break
+			}
+		}
+		if !mounted {
+			mounts = append(mounts, path)
+		}
+	}
+	return mounts, nil
+}
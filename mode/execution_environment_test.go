@@ -0,0 +1,246 @@
+package mode
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+func newExecutionEnvironmentRemoteSettings(t *testing.T, remote map[string]interface{}) *types.RemoteSettings {
+	data := schema.TestResourceDataRaw(t, map[string]*schema.Schema{
+		"remote": types.NewRemoteSchema(),
+	}, map[string]interface{}{
+		"remote": []interface{}{remote},
+	})
+	return types.NewRemoteSettingsFromInterface(data.GetOk("remote"))
+}
+
+func TestContainerCommand(t *testing.T) {
+	command := "ANSIBLE_FORCE_COLOR=true ansible-playbook /var/lib/terraform/tf-ansible-bootstrap/abc/site.yml --limit='web'"
+
+	remoteSettings := newExecutionEnvironmentRemoteSettings(t, map[string]interface{}{
+		"bootstrap_directory": "/var/lib/terraform",
+	})
+	if containerCommand(command, remoteSettings) != command {
+		t.Fatalf("Expected the command to run on the host without an execution environment image")
+	}
+
+	remoteSettings = newExecutionEnvironmentRemoteSettings(t, map[string]interface{}{
+		"bootstrap_directory": "/var/lib/terraform",
+		"container_image":     "quay.io/ansible/creator-ee:v0.22.0",
+	})
+	wrapped := containerCommand(command, remoteSettings)
+	for _, expected := range []string{
+		"podman run --rm --network host --pid host --privileged",
+		"--volume /:/host",
+		"--volume \"/var/lib/terraform/tf-ansible-bootstrap:/var/lib/terraform/tf-ansible-bootstrap:z\"",
+		"--entrypoint /bin/sh 'quay.io/ansible/creator-ee:v0.22.0' -c ",
+		types.ShellQuote(command),
+	} {
+		if !strings.Contains(wrapped, expected) {
+			t.Fatalf("Expected '%s' in the container command but got: %s", expected, wrapped)
+		}
+	}
+
+	remoteSettings = newExecutionEnvironmentRemoteSettings(t, map[string]interface{}{
+		"container_image":  "registry.example.com/ee:latest",
+		"container_engine": "docker",
+	})
+	if wrapped := containerCommand(command, remoteSettings); !strings.HasPrefix(wrapped, "docker run ") {
+		t.Fatalf("Expected the docker engine but got: %s", wrapped)
+	}
+}
+
+func TestContainerInventoryHosts(t *testing.T) {
+	templateData := inventoryTemplateRemoteData{
+		Hosts:  containerInventoryHosts(remoteInventoryHosts([]string{"controller", "10.0.0.11"}, "10.0.0.10", true), "/host"),
+		Groups: []string{"cluster"},
+	}
+	tpl := template.Must(template.New("hosts").Parse(inventoryTemplateRemote))
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, templateData); err != nil {
+		t.Fatalf("Expected template to generate correctly but received: %v", err)
+	}
+	expected := "[cluster]\n" +
+		"localhost ansible_connection=community.general.chroot ansible_host=/host\n" +
+		"controller ansible_connection=community.general.chroot ansible_host=/host\n" +
+		"10.0.0.11\n"
+	if !strings.Contains(buf.String(), expected) {
+		t.Fatalf("Expected the host to be connected to with chroot but got: %s", buf.String())
+	}
+}
+
+func newLocalExecutionEnvironment(t *testing.T, executionEnvironment map[string]interface{}) *types.ExecutionEnvironment {
+	data := schema.TestResourceDataRaw(t, map[string]*schema.Schema{
+		"execution_environment": types.NewExecutionEnvironmentSchema(),
+	}, map[string]interface{}{
+		"execution_environment": []interface{}{executionEnvironment},
+	})
+	return types.NewExecutionEnvironmentFromInterface(data.GetOk("execution_environment"))
+}
+
+func TestLocalContainerCommand(t *testing.T) {
+	commands := types.Commands{types.NewCommand("ansible-playbook").
+		Env("ANSIBLE_FORCE_COLOR", "true").
+		Arg("/srv/playbooks/site.yml").
+		Option("--inventory-file", "/tmp/temporary-ansible-inventory1")}
+	command := commands.String()
+
+	if localContainerCommand(commands, types.NewExecutionEnvironmentFromInterface(nil, false), []string{"/tmp"}, nil).String() != command {
+		t.Fatalf("Expected the command to run on the machine running Terraform without an execution environment")
+	}
+
+	executionEnvironment := newLocalExecutionEnvironment(t, map[string]interface{}{
+		"image":   "quay.io/ansible/creator-ee:v0.22.0",
+		"volumes": []interface{}{"/etc/pki:/etc/pki:ro"},
+	})
+	container := localContainerCommand(commands, executionEnvironment, []string{"/srv/playbooks", "/tmp"}, nil)
+	wrapped := container.String()
+	for _, expected := range []string{
+		"podman run --rm --network host --userns keep-id",
+		"--volume '/srv/playbooks:/srv/playbooks' --volume '/tmp:/tmp' --volume '/etc/pki:/etc/pki:ro'",
+		"--entrypoint /bin/sh 'quay.io/ansible/creator-ee:v0.22.0' -c " + types.ShellQuote(command),
+	} {
+		if !strings.Contains(wrapped, expected) {
+			t.Fatalf("Expected '%s' in the container command but got: %s", expected, wrapped)
+		}
+	}
+	// the engine receives the command line of the container shell as a single argument:
+	if args := container[0].Args(); len(container) != 1 || args[len(args)-1] != command {
+		t.Fatalf("Expected the command line as the last argument of the engine but got: %q", args)
+	}
+
+	executionEnvironment = newLocalExecutionEnvironment(t, map[string]interface{}{
+		"image":  "registry.example.com/ee:latest",
+		"engine": "docker",
+	})
+	if wrapped := localContainerCommand(commands, executionEnvironment, nil, nil).String(); !strings.HasPrefix(wrapped, "docker run --rm --network host --user ") {
+		t.Fatalf("Expected the docker engine to run as the current user but got: %s", wrapped)
+	}
+}
+
+func TestLocalPlayDirectories(t *testing.T) {
+	root, err := ioutil.TempDir("", "execution-environment")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(root)
+	temporaryDirectory := filepath.Join(root, "tmp")
+	project := filepath.Join(root, "project")
+	for _, dir := range []string{temporaryDirectory, filepath.Join(project, "roles"), filepath.Join(project, "vars")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	for _, file := range []string{filepath.Join(project, "site.yml"), filepath.Join(project, "vars", "web.yml")} {
+		if err := ioutil.WriteFile(file, []byte("---\n"), 0644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	previousTemporaryDirectory := os.Getenv("TMPDIR")
+	os.Setenv("TMPDIR", temporaryDirectory)
+	defer os.Setenv("TMPDIR", previousTemporaryDirectory)
+	if sshAuthSock, ok := os.LookupEnv("SSH_AUTH_SOCK"); ok {
+		os.Unsetenv("SSH_AUTH_SOCK")
+		defer os.Setenv("SSH_AUTH_SOCK", sshAuthSock)
+	}
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"playbook": []interface{}{map[string]interface{}{
+			"file_path":  filepath.Join(project, "site.yml"),
+			"roles_path": []interface{}{filepath.Join(project, "roles")},
+		}},
+		"extra_vars_files": []interface{}{filepath.Join(project, "vars", "web.yml")},
+	})
+	mounts, err := localPlayDirectories(play, types.NewAnsibleSSHSettingsFromInterface(nil, false), filepath.Join(root, "artifacts"), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// the roles and the variable files are under the playbook directory, mounted once:
+	workingDirectory, _ := os.Getwd()
+	expected := []string{filepath.Join(root, "artifacts"), project, temporaryDirectory, workingDirectory}
+	sort.Strings(expected)
+	if strings.Join(mounts, " ") != strings.Join(expected, " ") {
+		t.Fatalf("Expected mounts %v but got: %v", expected, mounts)
+	}
+	if info, err := os.Stat(filepath.Join(root, "artifacts")); err != nil || !info.IsDir() {
+		t.Fatalf("Expected the artifact directory to be created but got: %v", err)
+	}
+}
+
+func TestRunInDockerCommand(t *testing.T) {
+	data := schema.TestResourceDataRaw(t, map[string]*schema.Schema{
+		"run_in_docker": types.NewRunInDockerSchema(),
+	}, map[string]interface{}{
+		"run_in_docker": []interface{}{map[string]interface{}{"image": "registry.example.com/ansible:2.15.5"}},
+	})
+	runInDocker := types.NewRunInDockerFromInterface(data.GetOk("run_in_docker"))
+	if !runInDocker.IsInUse() || !runInDocker.ReadOnly() || runInDocker.Engine() != "docker" {
+		t.Fatalf("Expected a read-only docker execution environment but got: %+v", runInDocker)
+	}
+
+	commands := types.Commands{types.NewCommand("ansible-playbook").Env("ANSIBLE_FORCE_COLOR", "true").Arg("/srv/playbooks/site.yml")}
+	command := commands.String()
+	wrapped := localContainerCommand(commands, runInDocker, []string{"/srv/playbooks", "/tmp/tf-ansible-1"}, []string{"/srv/artifacts"}).String()
+	for _, expected := range []string{
+		"docker run --rm --network host --user ",
+		"--volume '/srv/playbooks:/srv/playbooks:ro' --volume '/tmp/tf-ansible-1:/tmp/tf-ansible-1:ro' --volume '/srv/artifacts:/srv/artifacts'",
+		"--entrypoint /bin/sh 'registry.example.com/ansible:2.15.5' -c " + types.ShellQuote(command),
+	} {
+		if !strings.Contains(wrapped, expected) {
+			t.Fatalf("Expected '%s' in the container command but got: %s", expected, wrapped)
+		}
+	}
+}
+
+func TestDockerPlayDirectories(t *testing.T) {
+	root, err := ioutil.TempDir("", "run-in-docker")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(root)
+	workDirectory := filepath.Join(root, "tf-ansible-1")
+	project := filepath.Join(root, "project")
+	for _, dir := range []string{workDirectory, project} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(project, "site.yml"), []byte("---\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if sshAuthSock, ok := os.LookupEnv("SSH_AUTH_SOCK"); ok {
+		os.Unsetenv("SSH_AUTH_SOCK")
+		defer os.Setenv("SSH_AUTH_SOCK", sshAuthSock)
+	}
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"playbook": []interface{}{map[string]interface{}{
+			"file_path": filepath.Join(project, "site.yml"),
+		}},
+	})
+	// the artifacts are written under the playbook directory, mounted writable over the read-only playbook directory:
+	mounts, artifacts, err := dockerPlayDirectories(play, types.NewAnsibleSSHSettingsFromInterface(nil, false), filepath.Join(project, "artifacts"), workDirectory)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// the working directory is not mounted:
+	expected := []string{project, workDirectory}
+	if strings.Join(mounts, " ") != strings.Join(expected, " ") {
+		t.Fatalf("Expected mounts %v but got: %v", expected, mounts)
+	}
+	if artifacts != filepath.Join(project, "artifacts") {
+		t.Fatalf("Expected the artifact directory to be mounted writable but got: %s", artifacts)
+	}
+}
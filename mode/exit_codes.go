@@ -0,0 +1,81 @@
+package mode
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/radekg/terraform-provisioner-ansible/events"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// Exit statuses of ansible and ansible-playbook.
+const (
+	ansibleExitStatusFailed      = 2
+	ansibleExitStatusUnreachable = 4
+)
+
+// maxDescribedFailures is how many failed task results the error of a play lists,
+// the output of a play failing on many hosts has the rest.
+const maxDescribedFailures = 10
+
+// evaluatePlayResult applies the play exit code settings to the result of the play command.
+// Returns nil when the failure is accepted, otherwise an error telling task failures and unreachable hosts apart
+// and listing the failed tasks of the result.
+func evaluatePlayResult(o terraform.UIOutput, play *types.Play, err error, result *events.Result) error {
+	if err == nil {
+		return nil
+	}
+
+	status := exitStatusFromError(err)
+	for _, allowed := range play.AllowedExitCodes() {
+		if status == allowed {
+			o.Output(fmt.Sprintf("play exited with the allowed exit status %d, continuing", status))
+			return nil
+		}
+	}
+
+	if status == ansibleExitStatusUnreachable && play.IgnoreUnreachable() {
+		o.Output("WARNING: some hosts were unreachable, ignore_unreachable is set, continuing")
+		return nil
+	}
+
+	recap := result.Stats
+	if play.MaxFailPercentage() > 0 && recap.Hosts() > 0 &&
+		(status == ansibleExitStatusFailed || status == ansibleExitStatusUnreachable) {
+		failedPercentage := recap.HostsWith(events.CounterFailed, events.CounterUnreachable) * 100 / recap.Hosts()
+		if failedPercentage <= play.MaxFailPercentage() {
+			o.Output(fmt.Sprintf("WARNING: %d%% of hosts failed, within max_fail_percentage of %d%%, continuing",
+				failedPercentage, play.MaxFailPercentage()))
+			return nil
+		}
+	}
+
+	switch status {
+	case ansibleExitStatusFailed:
+		return fmt.Errorf("tasks failed on one or more hosts: %w%s", err, describeFailures(result))
+	case ansibleExitStatusUnreachable:
+		return fmt.Errorf("one or more hosts were unreachable: %w%s", err, describeFailures(result))
+	default:
+		return err
+	}
+}
+
+// describeFailures lists the failed tasks and unreachable hosts of the result, one per line,
+// empty when the output had none. Messages over many lines are indented under their failure.
+func describeFailures(result *events.Result) string {
+	failures := result.Failures()
+	if len(failures) == 0 {
+		return ""
+	}
+	lines := make([]string, 0, maxDescribedFailures+1)
+	for idx, failure := range failures {
+		if idx == maxDescribedFailures {
+			lines = append(lines, fmt.Sprintf("\n  - and %d more, see the output of the play", len(failures)-maxDescribedFailures))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("\n  - %s", strings.Replace(failure.String(), "\n", "\n    ", -1)))
+	}
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,124 @@
+package mode
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/events"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+)
+
+func TestRecapOutputParsesPlayRecap(t *testing.T) {
+	recap := newRecapOutput(new(terraform.MockUIOutput))
+	for _, line := range []string{
+		"TASK [ping] ********",
+		"ok: [web1]",
+		"\x1b[0;33mPLAY RECAP\x1b[0m *********************************************",
+		"web1                       : ok=2    changed=1    unreachable=0    failed=0    skipped=0",
+		"web2                       : ok=0    changed=0    unreachable=1    failed=0    skipped=0",
+		"web3                       : ok=1    changed=0    unreachable=0    failed=1    skipped=0",
+		"",
+	} {
+		recap.Output(line)
+	}
+	stats := recap.Recap()
+	if stats.Hosts() != 3 {
+		t.Fatalf("Expected 3 hosts in the recap but got: %d", stats.Hosts())
+	}
+	if stats["web1"]["changed"] != 1 {
+		t.Fatalf("Expected web1 to have 1 changed task but got: %v", stats["web1"])
+	}
+	if hosts := stats.HostsWith("failed", "unreachable"); hosts != 2 {
+		t.Fatalf("Expected 2 failed or unreachable hosts but got: %d", hosts)
+	}
+}
+
+func TestEvaluatePlayResult(t *testing.T) {
+	recap := events.NewResult()
+	recap.Stats = events.Stats{
+		"web1": {"ok": 2, "failed": 0, "unreachable": 0},
+		"web2": {"ok": 2, "failed": 0, "unreachable": 0},
+		"web3": {"ok": 2, "failed": 0, "unreachable": 0},
+		"web4": {"ok": 0, "failed": 0, "unreachable": 1},
+	}
+	unreachable := newExitStatusError(4, errors.New("Error running command 'ansible-playbook': exit status 4. Output: "))
+	failed := newExitStatusError(2, errors.New("Error running command 'ansible-playbook': exit status 2. Output: "))
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{})
+	if err := evaluatePlayResult(new(terraform.MockUIOutput), play, unreachable, recap); err == nil || !strings.Contains(err.Error(), "unreachable") {
+		t.Fatalf("Expected an unreachable hosts error but got: %v", err)
+	}
+	if err := evaluatePlayResult(new(terraform.MockUIOutput), play, failed, recap); err == nil || !strings.Contains(err.Error(), "tasks failed") {
+		t.Fatalf("Expected a failed tasks error but got: %v", err)
+	}
+	if err := evaluatePlayResult(new(terraform.MockUIOutput), play, failed, recap); exitStatusFromError(err) != 2 {
+		t.Fatalf("Expected the classified error to keep the exit status but got: %v", err)
+	}
+
+	play = test.GetNewDefaultPlay(t, map[string]interface{}{
+		"ignore_unreachable": true,
+		"allowed_exit_codes": []interface{}{3},
+	})
+	if err := evaluatePlayResult(new(terraform.MockUIOutput), play, unreachable, recap); err != nil {
+		t.Fatalf("Expected unreachable hosts to be ignored but got: %v", err)
+	}
+	if err := evaluatePlayResult(new(terraform.MockUIOutput), play, newExitStatusError(3, errors.New("exit status 3")), recap); err != nil {
+		t.Fatalf("Expected the allowed exit code to succeed but got: %v", err)
+	}
+	if err := evaluatePlayResult(new(terraform.MockUIOutput), play, failed, recap); err == nil {
+		t.Fatalf("Expected failed tasks not to be ignored")
+	}
+
+	play = test.GetNewDefaultPlay(t, map[string]interface{}{
+		"max_fail_percentage": 25,
+	})
+	if err := evaluatePlayResult(new(terraform.MockUIOutput), play, unreachable, recap); err != nil {
+		t.Fatalf("Expected 25%% failed hosts to be within max_fail_percentage but got: %v", err)
+	}
+	recap.Stats["web3"]["failed"] = 1
+	if err := evaluatePlayResult(new(terraform.MockUIOutput), play, failed, recap); err == nil {
+		t.Fatalf("Expected 50%% failed hosts to exceed max_fail_percentage")
+	}
+}
+
+func TestEvaluatePlayResultDescribesFailures(t *testing.T) {
+	recap := newRecapOutput(new(terraform.MockUIOutput))
+	for _, line := range []string{
+		"PLAY [web] ********",
+		"TASK [Install nginx] ********",
+		`fatal: [web1]: FAILED! => {"changed": false, "msg": "No package matching 'nginx' found available"}`,
+		"PLAY RECAP ********",
+		"web1                       : ok=1    changed=0    unreachable=0    failed=1    skipped=0",
+	} {
+		recap.Output(line)
+	}
+	failed := newExitStatusError(2, errors.New("Error running command 'ansible-playbook': exit status 2. Output: "))
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{})
+	err := evaluatePlayResult(new(terraform.MockUIOutput), play, failed, recap.Result())
+	if err == nil || !strings.Contains(err.Error(), "task 'Install nginx' failed on 'web1': No package matching 'nginx' found available") {
+		t.Fatalf("Expected the failed task in the error but got: %v", err)
+	}
+	if exitStatusFromError(err) != 2 {
+		t.Fatalf("Expected the error to keep the exit status but got: %v", err)
+	}
+}
+
+func TestDescribeFailuresLimitsFailures(t *testing.T) {
+	result := events.NewResult()
+	for idx := 0; idx < maxDescribedFailures+3; idx++ {
+		result.Events = append(result.Events, &events.Event{Type: events.TypeFailed, Task: "Check config",
+			Host: fmt.Sprintf("web%d", idx), Action: "ansible.builtin.command", Message: "line 1\nline 2"})
+	}
+	description := describeFailures(result)
+	if !strings.Contains(description, "\n  - task 'Check config' (ansible.builtin.command) failed on 'web0': line 1\n    line 2") {
+		t.Fatalf("Expected the message over many lines indented under its failure but got: %s", description)
+	}
+	if strings.Contains(description, fmt.Sprintf("'web%d'", maxDescribedFailures)) ||
+		!strings.HasSuffix(description, "\n  - and 3 more, see the output of the play") {
+		t.Fatalf("Expected %d failures to be listed but got: %s", maxDescribedFailures, description)
+	}
+}
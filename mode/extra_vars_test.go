@@ -0,0 +1,83 @@
+package mode
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/radekg/terraform-provisioner-ansible/test"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+func TestExtraVarsJSONPreservesTypes(t *testing.T) {
+	user := test.GetCurrentUser(t)
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"extra_vars": map[string]interface{}{
+			"flat":    "value",
+			"enabled": "overridden",
+		},
+		"extra_vars_json": `{"enabled": true, "port": 8080, "users": [{"name": "admin"}]}`,
+	})
+
+	contents, err := play.ExtraVarsContents()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(contents, &decoded); err != nil {
+		t.Fatalf("Expected valid JSON but got: %v", err)
+	}
+	if decoded["flat"] != "value" {
+		t.Fatalf("Expected extra_vars to be included but got: %s", string(contents))
+	}
+	if decoded["enabled"] != true || decoded["port"] != float64(8080) {
+		t.Fatalf("Expected extra_vars_json to keep types and take precedence but got: %s", string(contents))
+	}
+
+	play.SetExtraVarsFile("/tmp/extra-vars.json")
+	command, err := play.ToCommand(types.LocalModeAnsibleArgs{Username: user.Username})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(command, "--extra-vars='@/tmp/extra-vars.json'") {
+		t.Fatalf("Expected extra vars to be passed as a file but got: %s", command)
+	}
+}
+
+func TestExtraVarsFilesPrecedeInlineVars(t *testing.T) {
+	user := test.GetCurrentUser(t)
+	varsFile := test.WriteTempVaultIDFile(t, "vars: true\n")
+	defer os.Remove(varsFile)
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"extra_vars":       map[string]interface{}{"inline": "value"},
+		"extra_vars_files": []interface{}{varsFile},
+	})
+	play.SetExtraVarsFile("/tmp/extra-vars.json")
+
+	command, err := play.ToCommand(types.LocalModeAnsibleArgs{Username: user.Username})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fileFlag := strings.Index(command, fmt.Sprintf("--extra-vars='@%s'", varsFile))
+	inlineFlag := strings.Index(command, "--extra-vars='@/tmp/extra-vars.json'")
+	if fileFlag < 0 || inlineFlag < 0 || fileFlag > inlineFlag {
+		t.Fatalf("Expected the extra vars file to be passed before the inline vars but got: %s", command)
+	}
+}
+
+func TestExtraVarsFilePathsAreQuoted(t *testing.T) {
+	user := test.GetCurrentUser(t)
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"extra_vars_files": []interface{}{"/tmp/o'brien/vars.yml"},
+	})
+
+	command, err := play.ToCommand(types.LocalModeAnsibleArgs{Username: user.Username})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(command, `--extra-vars='@/tmp/o'\''brien/vars.yml'`) {
+		t.Fatalf("Expected the extra vars file path to be quoted but got: %s", command)
+	}
+}
@@ -0,0 +1,141 @@
+package mode
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/radekg/terraform-provisioner-ansible/types"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// factsTreeResult is the result of the setup module Ansible writes to the tree for a host.
+type factsTreeResult struct {
+	Facts       map[string]interface{} `json:"ansible_facts"`
+	Failed      bool                   `json:"failed"`
+	Unreachable bool                   `json:"unreachable"`
+	Message     string                 `json:"msg"`
+}
+
+// gatherFacts runs the setup module against the hosts of the play and writes the selected facts
+// to the facts output file. The output of the setup module, all facts of every host, is written
+// with the debug log level only.
+func (v *LocalMode) gatherFacts(o terraform.UIOutput, play *types.Play, artifactDirectory string,
+	factsCommand func(tree string) types.Commands, runAnsibleCommand func(terraform.UIOutput, types.Commands) error) error {
+	tree, err := newFactsTree(artifactDirectory)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tree)
+
+	command := factsCommand(tree)
+	v.log(o, types.LogLevelInfo).Output(fmt.Sprintf("gathering facts: %s", command))
+	if err := runAnsibleCommand(v.log(o, types.LogLevelDebug), command); err != nil {
+		// the tree tells which host failed:
+		if _, treeErr := readFactsTree(tree, nil); treeErr != nil {
+			return treeErr
+		}
+		return fmt.Errorf("facts could not be gathered: %v", err)
+	}
+	hosts, err := readFactsTree(tree, play.Facts())
+	if err != nil {
+		return err
+	}
+	return writeFactsOutputFile(o, play, artifactDirectory, hosts)
+}
+
+// newFactsTree creates the directory the setup module writes the facts of the hosts to,
+// under the artifact directory such that it is written in an execution environment too.
+func newFactsTree(artifactDirectory string) (string, error) {
+	artifacts, err := localArtifactDirectory(artifactDirectory)
+	if err != nil {
+		return "", err
+	}
+	tree, err := ioutil.TempDir(artifacts, "facts")
+	if err != nil {
+		return "", fmt.Errorf("could not create the facts directory: %v", err)
+	}
+	return tree, nil
+}
+
+// readFactsTree reads the facts of every host in the tree, keeping the facts matching the patterns,
+// all facts when there are no patterns. Fails when the facts of a host could not be gathered.
+func readFactsTree(tree string, patterns []string) (map[string]map[string]interface{}, error) {
+	files, err := ioutil.ReadDir(tree)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the facts directory '%s': %v", tree, err)
+	}
+	hosts := make(map[string]map[string]interface{})
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		contents, err := ioutil.ReadFile(filepath.Join(tree, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		result := &factsTreeResult{}
+		if err := json.Unmarshal(contents, result); err != nil {
+			return nil, fmt.Errorf("facts of host '%s' could not be decoded: %v", file.Name(), err)
+		}
+		if result.Failed || result.Unreachable {
+			return nil, fmt.Errorf("facts of host '%s' could not be gathered: %s", file.Name(), result.Message)
+		}
+		facts, err := selectFacts(result.Facts, patterns)
+		if err != nil {
+			return nil, err
+		}
+		hosts[file.Name()] = facts
+	}
+	return hosts, nil
+}
+
+// selectFacts returns the facts with a name matching any of the patterns, all facts without patterns.
+func selectFacts(facts map[string]interface{}, patterns []string) (map[string]interface{}, error) {
+	if len(patterns) == 0 {
+		return facts, nil
+	}
+	selected := make(map[string]interface{})
+	names := make([]string, 0, len(facts))
+	for name := range facts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, pattern := range patterns {
+		for _, name := range names {
+			matched, err := path.Match(pattern, name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid facts pattern '%s': %v", pattern, err)
+			}
+			if matched {
+				selected[name] = facts[name]
+			}
+		}
+	}
+	return selected, nil
+}
+
+// writeFactsOutputFile writes the facts by host to the facts output file of the play as JSON.
+func writeFactsOutputFile(o terraform.UIOutput, play *types.Play, artifactDirectory string, hosts map[string]map[string]interface{}) error {
+	outputFile, err := artifactPath(artifactDirectory, play.FactsOutputFile())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+		return fmt.Errorf("Error creating the directory for '%s': %s", outputFile, err)
+	}
+	contents, err := json.MarshalIndent(hosts, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(outputFile, append(contents, '\n'), 0644); err != nil {
+		return fmt.Errorf("Error writing '%s': %s", outputFile, err)
+	}
+	o.Output(fmt.Sprintf("facts of %d hosts written to '%s'", len(hosts), outputFile))
+	return nil
+}
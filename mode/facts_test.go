@@ -0,0 +1,110 @@
+package mode
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+func TestSelectFacts(t *testing.T) {
+	facts := map[string]interface{}{
+		"ansible_default_ipv4":         map[string]interface{}{"address": "10.0.0.5"},
+		"ansible_distribution":         "Ubuntu",
+		"ansible_distribution_version": "22.04",
+		"ansible_devices":              map[string]interface{}{},
+	}
+	selected, err := selectFacts(facts, []string{"ansible_default_ipv4", "ansible_distribution*"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(selected) != 3 || selected["ansible_devices"] != nil {
+		t.Fatalf("Expected the matching facts only but got: %v", selected)
+	}
+	if all, _ := selectFacts(facts, nil); len(all) != len(facts) {
+		t.Fatalf("Expected all facts without patterns but got: %v", all)
+	}
+	if _, err := selectFacts(facts, []string{"ansible_[default"}); err == nil {
+		t.Fatalf("Expected an invalid pattern to fail")
+	}
+}
+
+func TestGatherFactsWritesOutputFile(t *testing.T) {
+	artifactDirectory, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(artifactDirectory)
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"facts_output_file": "facts/hosts.json",
+		"facts":             []interface{}{"ansible_default_ipv4", "ansible_distribution*"},
+	})
+	local := &LocalMode{o: new(terraform.MockUIOutput)}
+	var tree string
+	err = local.gatherFacts(new(terraform.MockUIOutput), play, artifactDirectory, func(dir string) types.Commands {
+		tree = dir
+		return types.Commands{play.ToLocalFactsCommand(dir, types.LocalModeAnsibleArgs{Username: "test"}, types.NewAnsibleSSHSettingsFromInterface(nil, false))}
+	}, func(o terraform.UIOutput, command types.Commands) error {
+		if !strings.Contains(command.String(), "--module-name='setup'") || !strings.Contains(command.String(), "--tree='"+tree+"'") {
+			t.Fatalf("Expected the setup module writing to the tree but got: %s", command)
+		}
+		return ioutil.WriteFile(filepath.Join(tree, "web-1"), []byte(`{"ansible_facts": {
+			"ansible_default_ipv4": {"address": "10.0.0.5"},
+			"ansible_distribution": "Ubuntu",
+			"ansible_devices": {"sda": {}}
+		}, "changed": false}`), 0644)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(tree); !os.IsNotExist(err) {
+		t.Fatalf("Expected the tree to be removed but got: %v", err)
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(artifactDirectory, "facts", "hosts.json"))
+	if err != nil {
+		t.Fatalf("Expected the facts output file to be written but got: %v", err)
+	}
+	hosts := make(map[string]map[string]interface{})
+	if err := json.Unmarshal(contents, &hosts); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(hosts["web-1"]) != 2 || hosts["web-1"]["ansible_distribution"] != "Ubuntu" {
+		t.Fatalf("Expected the selected facts of web-1 but got: %v", hosts)
+	}
+}
+
+func TestGatherFactsReportsUnreachableHost(t *testing.T) {
+	artifactDirectory, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(artifactDirectory)
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"facts_output_file": "hosts.json",
+		"facts":             []interface{}{},
+	})
+	local := &LocalMode{o: new(terraform.MockUIOutput)}
+	var tree string
+	err = local.gatherFacts(new(terraform.MockUIOutput), play, artifactDirectory, func(dir string) types.Commands {
+		tree = dir
+		return types.Commands{types.NewCommand("ansible").Arg("all").Arg("--module-name=setup")}
+	}, func(o terraform.UIOutput, command types.Commands) error {
+		ioutil.WriteFile(filepath.Join(tree, "web-2"), []byte(`{"msg": "Failed to connect to the host via ssh", "unreachable": true}`), 0644)
+		return &os.PathError{Op: "exec", Path: "ansible", Err: os.ErrInvalid}
+	})
+	if err == nil || !strings.Contains(err.Error(), "'web-2' could not be gathered: Failed to connect") {
+		t.Fatalf("Expected the unreachable host to be reported but got: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(artifactDirectory, "hosts.json")); !os.IsNotExist(err) {
+		t.Fatalf("Expected no facts output file but got: %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package mode
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/radekg/terraform-provisioner-ansible/types"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// checkoutPlaybookRepository clones the playbook git repository at the configured ref
+// to a temporary directory and points the playbook at the file within the checkout.
+// Returns an empty string when the playbook is not sourced from git.
+// The caller is responsible for removing the directory.
+func checkoutPlaybookRepository(o terraform.UIOutput, play *types.Play, workDirectory string) (string, error) {
+	playbook, ok := play.Entity().(*types.Playbook)
+	if !ok || playbook.Repo() == "" {
+		return "", nil
+	}
+
+	repoURL, secret, err := playbookRepositoryURL(playbook)
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := ioutil.TempDir(workDirectory, "ansible-playbook-repo")
+	if err != nil {
+		return "", err
+	}
+
+	ref := playbook.Ref()
+	if ref == "" {
+		ref = "HEAD"
+	}
+	o.Output(fmt.Sprintf("Cloning playbook repository '%s' at '%s' to '%s'...", playbook.Repo(), ref, dir))
+
+	env := os.Environ()
+	if playbook.RepoSSHKeyFile() != "" {
+		keyFile, err := types.ResolvePath(playbook.RepoSSHKeyFile())
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+		env = append(env, fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %s -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new", types.ShellQuote(keyFile)))
+	}
+
+	// a shallow fetch of a single ref works for branches, tags and commits alike:
+	for _, args := range [][]string{
+		{"init", "--quiet", dir},
+		{"-C", dir, "fetch", "--quiet", "--depth", "1", repoURL, ref},
+		{"-C", dir, "checkout", "--quiet", "FETCH_HEAD"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Env = env
+		if out, err := cmd.CombinedOutput(); err != nil {
+			os.RemoveAll(dir)
+			message := fmt.Sprintf("%v: %s", err, strings.TrimSpace(string(out)))
+			if secret != "" {
+				message = strings.Replace(message, secret, "***", -1)
+			}
+			return "", fmt.Errorf("Error cloning playbook repository '%s' at '%s': %s", playbook.Repo(), ref, message)
+		}
+	}
+
+	if err := pointPlaybookAt(playbook, dir, fmt.Sprintf("repository '%s' at '%s'", playbook.Repo(), ref)); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// playbookRepositoryURL returns the clone URL with the token of repo_token_env, if any, and the token itself.
+func playbookRepositoryURL(playbook *types.Playbook) (string, string, error) {
+	if playbook.RepoTokenEnv() == "" {
+		return playbook.Repo(), "", nil
+	}
+	token, ok := os.LookupEnv(playbook.RepoTokenEnv())
+	if !ok || token == "" {
+		return "", "", fmt.Errorf("Playbook repository token environment variable '%s' is not set", playbook.RepoTokenEnv())
+	}
+	parsed, err := url.Parse(playbook.Repo())
+	if err != nil || parsed.Scheme != "https" {
+		return "", "", fmt.Errorf("repo_token_env requires an https repository URL, got: '%s'", playbook.Repo())
+	}
+	parsed.User = url.UserPassword("x-access-token", token)
+	return parsed.String(), token, nil
+}
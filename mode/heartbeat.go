@@ -0,0 +1,88 @@
+package mode
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+// playHeartbeat is how long a play may write nothing before the provisioner reports that the play
+// is still running. Ansible writes nothing while a long task runs, CI systems kill jobs without output.
+var playHeartbeat = time.Minute
+
+// heartbeatOutput reports the play still running when nothing was written for playHeartbeat.
+type heartbeatOutput struct {
+	sync.Mutex
+	o        terraform.UIOutput
+	play     string
+	started  time.Time
+	lastLine time.Time
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// newHeartbeatOutput wraps the output of the play, stop must be called when the play finishes.
+func newHeartbeatOutput(o terraform.UIOutput, play *types.Play) *heartbeatOutput {
+	now := time.Now()
+	v := &heartbeatOutput{o: o, play: playLabel(play), started: now, lastLine: now, done: make(chan struct{})}
+	go v.run()
+	return v
+}
+
+func (v *heartbeatOutput) Output(line string) {
+	v.Lock()
+	defer v.Unlock()
+	v.o.Output(line)
+	v.lastLine = time.Now()
+}
+
+func (v *heartbeatOutput) stop() {
+	v.stopOnce.Do(func() { close(v.done) })
+}
+
+func (v *heartbeatOutput) run() {
+	ticker := time.NewTicker(playHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-v.done:
+			return
+		case now := <-ticker.C:
+			v.heartbeat(now)
+		}
+	}
+}
+
+// heartbeat reports the play still running when it wrote nothing since the last heartbeat.
+func (v *heartbeatOutput) heartbeat(now time.Time) {
+	v.Lock()
+	defer v.Unlock()
+	if now.Sub(v.lastLine) < playHeartbeat {
+		return
+	}
+	v.o.Output(fmt.Sprintf("still running play %s, %s elapsed", v.play, now.Sub(v.started).Round(time.Second)))
+	v.lastLine = now
+}
+
+// playLabel names the play in the output, by its name when set, otherwise by what it runs.
+func playLabel(play *types.Play) string {
+	if play.Name() != "" {
+		return fmt.Sprintf("'%s'", play.Name())
+	}
+	switch entity := play.Entity().(type) {
+	case *types.Playbook:
+		return fmt.Sprintf("'%s'", entity.FilePath())
+	case *types.Module:
+		return fmt.Sprintf("'%s'", strings.Join(entity.Modules(), ","))
+	case *types.Pull:
+		return fmt.Sprintf("'%s'", entity.URL())
+	case *types.GalaxyInstall:
+		return "'galaxy_install'"
+	default:
+		return "''"
+	}
+}
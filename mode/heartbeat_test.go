@@ -0,0 +1,67 @@
+package mode
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+)
+
+func TestHeartbeatReportsSilentPlay(t *testing.T) {
+	defer func(interval time.Duration) { playHeartbeat = interval }(playHeartbeat)
+	playHeartbeat = 100 * time.Millisecond
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{"name": "database"})
+
+	var mu sync.Mutex
+	lines := make([]string, 0)
+	output := &terraform.MockUIOutput{OutputFn: func(line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, line)
+	}}
+	heartbeat := newHeartbeatOutput(output, play)
+	err := runLocalCommand(context.Background(), heartbeat, "sleep 1; echo done")
+	heartbeat.stop()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	written := strings.Join(lines, "\n")
+	if !strings.Contains(written, "still running play 'database', ") || !strings.HasSuffix(written, "done") {
+		t.Fatalf("Expected the silent play to be reported as running but got: %s", written)
+	}
+}
+
+func TestHeartbeatNotReportedForWritingPlay(t *testing.T) {
+	defer func(interval time.Duration) { playHeartbeat = interval }(playHeartbeat)
+	playHeartbeat = 300 * time.Millisecond
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{})
+
+	var mu sync.Mutex
+	lines := make([]string, 0)
+	output := &terraform.MockUIOutput{OutputFn: func(line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, line)
+	}}
+	heartbeat := newHeartbeatOutput(output, play)
+	err := runLocalCommand(context.Background(), heartbeat, "for i in 1 2 3 4 5 6; do echo $i; sleep 0.1; done")
+	heartbeat.stop()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if written := strings.Join(lines, "\n"); strings.Contains(written, "still running") {
+		t.Fatalf("Expected no heartbeat for a play writing output but got: %s", written)
+	}
+}
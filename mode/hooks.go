@@ -0,0 +1,76 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/radekg/terraform-provisioner-ansible/types"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+const (
+	hookEnvVarInventoryFile = "TF_ANSIBLE_INVENTORY_FILE"
+	hookEnvVarHosts         = "TF_ANSIBLE_HOSTS"
+	hookEnvVarGroups        = "TF_ANSIBLE_GROUPS"
+	hookEnvVarPlayStatus    = "TF_ANSIBLE_PLAY_STATUS"
+
+	hookPlayStatusSuccess = "success"
+	hookPlayStatusFailure = "failure"
+)
+
+// hookEnvironment serializes the play details available to hooks to a shell export statement,
+// exported variables can be referenced in the hook command itself.
+func hookEnvironment(play *types.Play, status string) string {
+	environment := map[string]string{
+		hookEnvVarInventoryFile: play.InventoryFile(),
+		hookEnvVarHosts:         strings.Join(play.Hosts(), ","),
+		hookEnvVarGroups:        strings.Join(play.Groups(), ","),
+	}
+	if status != "" {
+		environment[hookEnvVarPlayStatus] = status
+	}
+	names := make([]string, 0, len(environment))
+	for name := range environment {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	assignments := make([]string, 0, len(names))
+	for _, name := range names {
+		assignments = append(assignments, fmt.Sprintf("%s=%s", name, types.ShellQuote(environment[name])))
+	}
+	return fmt.Sprintf("export %s;", strings.Join(assignments, " "))
+}
+
+// runBeforeHooks executes the play before hooks, stops at the first failing hook.
+func runBeforeHooks(ctx context.Context, o terraform.UIOutput, play *types.Play) error {
+	for _, hook := range play.Before() {
+		contextLevelOutput(ctx, o, types.LogLevelInfo).Output(fmt.Sprintf("running before hook: %s", hook))
+		if err := runLocalCommand(ctx, o, fmt.Sprintf("%s %s", hookEnvironment(play, ""), hook)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runAfterHooks executes the play after hooks, regardless of the play result.
+// The play error, if any, takes precedence over hook errors.
+func runAfterHooks(ctx context.Context, o terraform.UIOutput, play *types.Play, playErr error) error {
+	status := hookPlayStatusSuccess
+	if playErr != nil {
+		status = hookPlayStatusFailure
+	}
+	for _, hook := range play.After() {
+		contextLevelOutput(ctx, o, types.LogLevelInfo).Output(fmt.Sprintf("running after hook: %s", hook))
+		if err := runLocalCommand(ctx, o, fmt.Sprintf("%s %s", hookEnvironment(play, status), hook)); err != nil {
+			if playErr != nil {
+				o.Output(fmt.Sprintf("after hook failed: %v", err))
+				return playErr
+			}
+			return err
+		}
+	}
+	return playErr
+}
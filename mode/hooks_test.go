@@ -0,0 +1,61 @@
+package mode
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+)
+
+func TestAfterHooksReceivePlayDetails(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "hooks")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	outputFile := filepath.Join(tempDir, "status")
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"inventory_file": "/tmp/inventory",
+		"after":          []interface{}{"echo \"$TF_ANSIBLE_PLAY_STATUS $TF_ANSIBLE_INVENTORY_FILE $TF_ANSIBLE_HOSTS\" > " + outputFile},
+	})
+
+	playErr := newExitStatusError(2, errors.New("exit status 2"))
+	if err := runAfterHooks(context.Background(), new(terraform.MockUIOutput), play, playErr); err != playErr {
+		t.Fatalf("Expected the play error to be returned but got: %v", err)
+	}
+
+	contents, err := ioutil.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Expected the hook to write the output file but received: %v", err)
+	}
+	expected := "failure /tmp/inventory localhost\n"
+	if string(contents) != expected {
+		t.Fatalf("Expected '%s' but got: '%s'", expected, string(contents))
+	}
+}
+
+func TestBeforeHooksStopAtFirstFailure(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "hooks")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	markerFile := filepath.Join(tempDir, "marker")
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"before": []interface{}{"exit 3", "touch " + markerFile},
+	})
+
+	if err := runBeforeHooks(context.Background(), new(terraform.MockUIOutput), play); exitStatusFromError(err) != 3 {
+		t.Fatalf("Expected the failing before hook to exit with status 3 but got: %v", err)
+	}
+	if _, err := os.Stat(markerFile); !os.IsNotExist(err) {
+		t.Fatalf("Expected hooks after the failing hook not to run")
+	}
+}
@@ -0,0 +1,48 @@
+package mode
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/radekg/terraform-provisioner-ansible/events"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// changedHosts returns a sorted host=changed list of hosts which reported changed tasks.
+func changedHosts(recap events.Stats) []string {
+	hosts := []string{}
+	for host, stats := range recap {
+		if stats["changed"] > 0 {
+			hosts = append(hosts, fmt.Sprintf("%s=%d", host, stats["changed"]))
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// assertNoChanges fails when the play is expected to make no changes but the recap reports changed tasks.
+// When verify_convergence is set, the play is re-run once and only the second run must not report changes.
+func assertNoChanges(o terraform.UIOutput, play *types.Play, recap events.Stats, rerun func() (events.Stats, error)) error {
+	if !play.ExpectNoChanges() {
+		return nil
+	}
+	changed := changedHosts(recap)
+	if len(changed) == 0 {
+		return nil
+	}
+	if play.VerifyConvergence() {
+		o.Output(fmt.Sprintf("play reported changes on: %s, re-running to verify convergence", strings.Join(changed, ", ")))
+		secondRecap, err := rerun()
+		if err != nil {
+			return err
+		}
+		if changed = changedHosts(secondRecap); len(changed) == 0 {
+			return nil
+		}
+		return fmt.Errorf("play did not converge, the second run reported changes on: %s", strings.Join(changed, ", "))
+	}
+	return fmt.Errorf("play is expected to make no changes but reported changes on: %s", strings.Join(changed, ", "))
+}
@@ -0,0 +1,61 @@
+package mode
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/events"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+)
+
+func TestAssertNoChanges(t *testing.T) {
+	changed := events.Stats{
+		"web1": {"ok": 3, "changed": 2},
+		"web2": {"ok": 3, "changed": 0},
+	}
+	converged := events.Stats{
+		"web1": {"ok": 3, "changed": 0},
+		"web2": {"ok": 3, "changed": 0},
+	}
+	reruns := 0
+	rerun := func(recap events.Stats) func() (events.Stats, error) {
+		return func() (events.Stats, error) {
+			reruns++
+			return recap, nil
+		}
+	}
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{})
+	if err := assertNoChanges(new(terraform.MockUIOutput), play, changed, rerun(changed)); err != nil {
+		t.Fatalf("Expected changes to be accepted without expect_no_changes but got: %v", err)
+	}
+
+	play = test.GetNewDefaultPlay(t, map[string]interface{}{
+		"expect_no_changes": true,
+	})
+	if err := assertNoChanges(new(terraform.MockUIOutput), play, converged, rerun(converged)); err != nil {
+		t.Fatalf("Expected no error for a converged play but got: %v", err)
+	}
+	err := assertNoChanges(new(terraform.MockUIOutput), play, changed, rerun(converged))
+	if err == nil || !strings.Contains(err.Error(), "web1=2") {
+		t.Fatalf("Expected an error naming the changed host but got: %v", err)
+	}
+	if reruns != 0 {
+		t.Fatalf("Expected no re-run without verify_convergence but got: %d", reruns)
+	}
+
+	play = test.GetNewDefaultPlay(t, map[string]interface{}{
+		"expect_no_changes":  true,
+		"verify_convergence": true,
+	})
+	if err := assertNoChanges(new(terraform.MockUIOutput), play, changed, rerun(converged)); err != nil {
+		t.Fatalf("Expected the second run to converge but got: %v", err)
+	}
+	if err := assertNoChanges(new(terraform.MockUIOutput), play, changed, rerun(changed)); err == nil {
+		t.Fatalf("Expected an error when the second run reports changes")
+	}
+	if reruns != 2 {
+		t.Fatalf("Expected 2 re-runs but got: %d", reruns)
+	}
+}
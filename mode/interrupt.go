@@ -0,0 +1,57 @@
+package mode
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+type interruptKey struct{}
+
+// interruptState holds the signal which interrupted the run.
+type interruptState struct {
+	sync.Mutex
+	signal os.Signal
+}
+
+// NotifyInterrupt returns a context cancelled when the plugin receives SIGINT or SIGTERM, such that
+// the running commands are interrupted and the run returns with every temporary file removed, instead of
+// the plugin exiting with Ansible still running. The returned function stops the notification, call it when
+// the run returns.
+func NotifyInterrupt(ctx context.Context) (context.Context, func()) {
+	state := &interruptState{}
+	ctx, cancel := context.WithCancel(context.WithValue(ctx, interruptKey{}, state))
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			state.Lock()
+			state.signal = sig
+			state.Unlock()
+			cancel()
+		case <-done:
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+}
+
+// interruptSignal returns the signal forwarded to the commands of a cancelled run: the signal
+// the plugin received, SIGINT when Terraform stopped the provisioner.
+func interruptSignal(ctx context.Context) os.Signal {
+	if state, ok := ctx.Value(interruptKey{}).(*interruptState); ok {
+		state.Lock()
+		defer state.Unlock()
+		if state.signal != nil {
+			return state.signal
+		}
+	}
+	return os.Interrupt
+}
@@ -0,0 +1,46 @@
+//go:build !windows
+// +build !windows
+
+package mode
+
+import (
+	"context"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestNotifyInterruptForwardsSignal(t *testing.T) {
+	ctx, stop := NotifyInterrupt(context.Background())
+	defer stop()
+	time.AfterFunc(200*time.Millisecond, func() {
+		syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	})
+
+	lines := make([]string, 0)
+	output := &terraform.MockUIOutput{OutputFn: func(line string) { lines = append(lines, line) }}
+	started := time.Now()
+	err := runLocalCommand(ctx, output, `trap 'echo "terminated, cleaning up"; exit 143' TERM; while true; do sleep 0.1; done`)
+	if err == nil || !strings.Contains(err.Error(), "has been cancelled") {
+		t.Fatalf("Expected a cancellation error but got: %v", err)
+	}
+	if time.Since(started) > localCommandStopTimeout {
+		t.Fatalf("Expected the command to exit on the forwarded signal")
+	}
+	if interruptSignal(ctx) != syscall.SIGTERM {
+		t.Fatalf("Expected SIGTERM to be forwarded but got: %v", interruptSignal(ctx))
+	}
+	if !strings.Contains(strings.Join(lines, "\n"), "terminated, cleaning up") {
+		t.Fatalf("Expected the output of the interrupted command but got: %v", lines)
+	}
+}
+
+func TestInterruptSignalDefaultsToInterrupt(t *testing.T) {
+	if interruptSignal(context.Background()) != os.Interrupt {
+		t.Fatalf("Expected a stopped Terraform to interrupt the commands")
+	}
+}
@@ -0,0 +1,34 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/radekg/terraform-provisioner-ansible/types"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// Exit status of ansible-lint when rule violations were found.
+const lintViolationsExitStatus = 2
+
+// runLint executes ansible-lint against the playbooks of a playbook play on the machine running Terraform.
+// Rule violations fail the play unless the lint settings ask for warnings only.
+func runLint(ctx context.Context, o terraform.UIOutput, play *types.Play) error {
+	playbook, ok := play.Entity().(*types.Playbook)
+	if !ok || playbook.Lint() == nil || !playbook.Lint().Enabled() {
+		return nil
+	}
+	command := playbook.Lint().ToCommand(playbook.FilePaths(), play.RolesPath())
+	o.Output(fmt.Sprintf("running ansible-lint: %s", command))
+	err := runLocalCommands(ctx, o, types.Commands{command}, 0)
+	if err == nil {
+		return nil
+	}
+	if playbook.Lint().WarnOnly() && exitStatusFromError(err) == lintViolationsExitStatus {
+		o.Output(fmt.Sprintf("ansible-lint reported rule violations in '%s', continuing", strings.Join(playbook.FilePaths(), ", ")))
+		return nil
+	}
+	return fmt.Errorf("ansible-lint failed for '%s': %w", strings.Join(playbook.FilePaths(), ", "), err)
+}
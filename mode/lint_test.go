@@ -0,0 +1,60 @@
+package mode
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+)
+
+func TestLintViolationsFailOrWarn(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "lint")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	playbookFile := test.WriteTempPlaybook(t, tempDir)
+	fakeLint := filepath.Join(tempDir, "fake-ansible-lint")
+	if err := ioutil.WriteFile(fakeLint, []byte("#!/bin/sh\necho \"$@\"\nexit 2\n"), 0755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	output := new(terraform.MockUIOutput)
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"playbook": []interface{}{map[string]interface{}{
+			"file_path": playbookFile,
+			"lint": []interface{}{map[string]interface{}{
+				"binary":    fakeLint,
+				"profile":   "production",
+				"warn_list": []interface{}{"yaml", "name[casing]"},
+			}},
+		}},
+	})
+	err = runLint(context.Background(), output, play)
+	if err == nil || !strings.Contains(err.Error(), "ansible-lint failed") {
+		t.Fatalf("Expected rule violations to fail the play but got: %v", err)
+	}
+	expectedArgs := "--profile=production --warn-list=yaml,name[casing] " + playbookFile
+	if !strings.Contains(err.Error(), expectedArgs) {
+		t.Fatalf("Expected '%s' in the ansible-lint output but got: %v", expectedArgs, err)
+	}
+
+	play = test.GetNewDefaultPlay(t, map[string]interface{}{
+		"playbook": []interface{}{map[string]interface{}{
+			"file_path": playbookFile,
+			"lint": []interface{}{map[string]interface{}{
+				"binary":       fakeLint,
+				"on_violation": "warn",
+			}},
+		}},
+	})
+	if err := runLint(context.Background(), output, play); err != nil {
+		t.Fatalf("Expected rule violations to be reported as warnings but got: %v", err)
+	}
+}
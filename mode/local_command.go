@@ -0,0 +1,329 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	linereader "github.com/mitchellh/go-linereader"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+// localCommandErrorLines is the number of the last output lines of a failed command in the error.
+const localCommandErrorLines = 20
+
+// localCommandStopTimeout is how long an interrupted command may take to exit before it is killed,
+// Ansible stops the running tasks and writes the recap when interrupted.
+var localCommandStopTimeout = 10 * time.Second
+
+// pluginEnvironment are the variables of the plugin handshake with Terraform. These are not
+// passed to the commands, a Terraform executed by a play would take itself for a plugin.
+var pluginEnvironment = []string{
+	"TF_PLUGIN_MAGIC_COOKIE",
+	"PLUGIN_CLIENT_CERT",
+	"PLUGIN_MIN_PORT",
+	"PLUGIN_MAX_PORT",
+	"PLUGIN_PROTOCOL_VERSIONS",
+}
+
+// defaultEnvironmentAllowlist are the variables the local commands get with clean_environment,
+// when no allowlist is configured.
+var defaultEnvironmentAllowlist = []string{
+	"PATH",
+	"HOME",
+	"USER",
+	"LOGNAME",
+	"LANG",
+	"LC_ALL",
+	"TMPDIR",
+	"SSH_AUTH_SOCK",
+	// Windows:
+	"SYSTEMROOT",
+	"COMSPEC",
+}
+
+// runLocalCommand executes the command in a shell on the machine running Terraform, for user-supplied
+// command lines such as hooks. The command and all its children are interrupted when the context is cancelled.
+func runLocalCommand(ctx context.Context, o terraform.UIOutput, command string) error {
+	return runLocalProcess(ctx, o, newShellCommand(ctx, command), command, time.Time{}, 0)
+}
+
+// runLocalCommands executes the Ansible commands one after another on the machine running Terraform,
+// without a shell: the arguments are passed to the programs as they are. The first failing command stops
+// the sequence. The commands are killed when these do not finish within the timeout, zero means no timeout.
+func runLocalCommands(ctx context.Context, o terraform.UIOutput, commands types.Commands, timeout time.Duration) error {
+	deadline := time.Time{}
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for _, command := range commands {
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return fmt.Errorf("Command '%s' has not been started, the commands did not finish within %s", command, timeout)
+		}
+		if err := runLocalProcess(ctx, o, newAnsibleProcessCommand(ctx, command), command.String(), deadline, timeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newAnsibleProcessCommand returns the process of the Ansible command with the environment of the local
+// commands and the variables of the command, the directories of the command are prepended to PATH.
+func newAnsibleProcessCommand(ctx context.Context, command *types.Command) *exec.Cmd {
+	args := command.Args()
+	cmd := newProcessCommand(ctx, args[0], args[1:]...)
+	cmd.Env = ansibleCommandEnvironment(localCommandEnvironment(contextRunOptions(ctx)), command)
+	return cmd
+}
+
+// ansibleCommandEnvironment returns the environment with the variables of the command,
+// these replace the inherited variables of the same name.
+func ansibleCommandEnvironment(environment []string, command *types.Command) []string {
+	for _, variable := range command.Environment() {
+		environment = setEnvironmentVariable(environment, variable)
+	}
+	if directories := command.PathDirectories(); len(directories) > 0 {
+		path := strings.Join(directories, string(os.PathListSeparator))
+		for _, variable := range environment {
+			if name, value := splitEnvironmentVariable(variable); environmentNamesEqual(name, "PATH") && value != "" {
+				path = path + string(os.PathListSeparator) + value
+			}
+		}
+		environment = setEnvironmentVariable(environment, "PATH="+path)
+	}
+	return environment
+}
+
+// setEnvironmentVariable returns the environment with the name=value variable replacing the variable of the name.
+func setEnvironmentVariable(environment []string, variable string) []string {
+	name, _ := splitEnvironmentVariable(variable)
+	updated := make([]string, 0, len(environment)+1)
+	for _, existing := range environment {
+		if existingName, _ := splitEnvironmentVariable(existing); !environmentNamesEqual(existingName, name) {
+			updated = append(updated, existing)
+		}
+	}
+	return append(updated, variable)
+}
+
+func splitEnvironmentVariable(variable string) (string, string) {
+	parts := strings.SplitN(variable, "=", 2)
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// environmentNamesEqual compares the names of environment variables, names are case-insensitive on Windows.
+func environmentNamesEqual(a, b string) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// runLocalProcess executes the program of the command on the machine running Terraform, writing its
+// stdout and stderr as these arrive. The last stderr lines of a failed program are part of the error,
+// the last stdout lines when the program wrote nothing to stderr.
+// The program and all its children are interrupted when the context is cancelled and killed when these
+// do not exit within localCommandStopTimeout, or killed when the program does not finish by the deadline,
+// the zero deadline means no timeout. The error of a killed program reports the timeout of the deadline.
+// Nothing is started once the context is cancelled.
+func runLocalProcess(ctx context.Context, o terraform.UIOutput, cmd *exec.Cmd, command string, deadline time.Time, timeout time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("Command '%s' has not been started: %v", command, err)
+	}
+	if cmd.Env == nil {
+		cmd.Env = localCommandEnvironment(contextRunOptions(ctx))
+	}
+
+	output := &localCommandOutput{o: o}
+	stdout, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to initialize pipe for output: %s", err)
+	}
+	stderr, stderrWriter, err := os.Pipe()
+	if err != nil {
+		stdout.Close()
+		stdoutWriter.Close()
+		return fmt.Errorf("failed to initialize pipe for output: %s", err)
+	}
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
+
+	var copyDone sync.WaitGroup
+	copyDone.Add(2)
+	go output.copy(&copyDone, stdout, false)
+	go output.copy(&copyDone, stderr, true)
+
+	contextLevelOutput(ctx, o, types.LogLevelDebug).Output(fmt.Sprintf("Executing: %q", cmd.Args))
+
+	startErr := cmd.Start()
+	// the child process holds its own copies of the write ends:
+	stdoutWriter.Close()
+	stderrWriter.Close()
+	if startErr != nil {
+		copyDone.Wait()
+		return fmt.Errorf("Error running command '%s': %v", command, startErr)
+	}
+
+	waitCh := make(chan error, 1)
+	go func() {
+		waitCh <- cmd.Wait()
+	}()
+
+	var timeoutCh <-chan time.Time
+	if !deadline.IsZero() {
+		timeoutCh = time.After(time.Until(deadline))
+	}
+
+	for {
+		select {
+		case err = <-waitCh:
+			copyDone.Wait()
+			if err != nil {
+				if tail := output.tail(); tail != "" {
+					return fmt.Errorf("Error running command '%s': %w. Output: %s", command, err, tail)
+				}
+				return fmt.Errorf("Error running command '%s': %w", command, err)
+			}
+			return nil
+		case <-timeoutCh:
+			killLocalProcess(o, cmd, waitCh, &copyDone)
+			return fmt.Errorf("Command '%s' did not finish within %s and has been killed", command, timeout)
+		case <-ctx.Done():
+			interruptLocalProcess(o, cmd, interruptSignal(ctx), waitCh, &copyDone)
+			return fmt.Errorf("Command '%s' has been cancelled: %v", command, ctx.Err())
+		}
+	}
+}
+
+// killLocalProcess kills the program and all its children and waits until the output is written.
+func killLocalProcess(o terraform.UIOutput, cmd *exec.Cmd, waitCh <-chan error, copyDone *sync.WaitGroup) {
+	if killErr := killProcessTree(cmd); killErr != nil {
+		o.Output(fmt.Sprintf("failed to kill the command: %v", killErr))
+	}
+	<-waitCh
+	copyDone.Wait()
+}
+
+// interruptLocalProcess forwards the signal to the program and all its children and waits until the program
+// exits and the output is written. The program and all its children are killed when these do not exit in time,
+// children holding the output open included.
+func interruptLocalProcess(o terraform.UIOutput, cmd *exec.Cmd, sig os.Signal, waitCh <-chan error, copyDone *sync.WaitGroup) {
+	o.Output(fmt.Sprintf("interrupted, waiting up to %s for the command to exit", localCommandStopTimeout))
+	if err := interruptProcessTree(cmd, sig); err != nil {
+		o.Output(fmt.Sprintf("failed to interrupt the command: %v", err))
+	}
+	exited := make(chan struct{})
+	go func() {
+		<-waitCh
+		copyDone.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(localCommandStopTimeout):
+		o.Output("the command did not exit, killing it")
+		if err := killProcessTree(cmd); err != nil {
+			o.Output(fmt.Sprintf("failed to kill the command: %v", err))
+		}
+		<-exited
+	}
+}
+
+// localCommandEnvironment returns the environment of the commands, the environment of Terraform
+// without the plugin handshake. With clean_environment, only the allowed variables are kept.
+func localCommandEnvironment(options RunOptions) []string {
+	allowlist := options.EnvironmentAllowlist
+	if len(allowlist) == 0 {
+		allowlist = defaultEnvironmentAllowlist
+	}
+	environment := make([]string, 0)
+	for _, variable := range os.Environ() {
+		inherited := true
+		for _, name := range pluginEnvironment {
+			if strings.HasPrefix(variable, name+"=") {
+				inherited = false
+				break
+			}
+		}
+		if inherited && options.CleanEnvironment {
+			inherited = environmentAllowed(strings.SplitN(variable, "=", 2)[0], allowlist)
+		}
+		if inherited {
+			environment = append(environment, variable)
+		}
+	}
+	return environment
+}
+
+// environmentAllowed returns true when the variable is in the allowlist, an entry ending with *
+// allows all variables with the prefix. Names are case-insensitive on Windows.
+func environmentAllowed(name string, allowlist []string) bool {
+	if runtime.GOOS == "windows" {
+		name = strings.ToUpper(name)
+	}
+	for _, allowed := range allowlist {
+		if runtime.GOOS == "windows" {
+			allowed = strings.ToUpper(allowed)
+		}
+		if prefix := strings.TrimSuffix(allowed, "*"); prefix != allowed {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// localCommandOutput writes the lines of stdout and stderr of a command, one line at a time,
+// and keeps the last lines of both.
+type localCommandOutput struct {
+	sync.Mutex
+	o      terraform.UIOutput
+	stdout []string
+	stderr []string
+}
+
+func (v *localCommandOutput) copy(done *sync.WaitGroup, r io.ReadCloser, isStderr bool) {
+	defer done.Done()
+	defer r.Close()
+	for line := range linereader.New(r).Ch {
+		v.Lock()
+		v.o.Output(line)
+		if isStderr {
+			v.stderr = appendTail(v.stderr, line)
+		} else {
+			v.stdout = appendTail(v.stdout, line)
+		}
+		v.Unlock()
+	}
+}
+
+func (v *localCommandOutput) tail() string {
+	v.Lock()
+	defer v.Unlock()
+	if len(v.stderr) > 0 {
+		return strings.Join(v.stderr, "\n")
+	}
+	return strings.Join(v.stdout, "\n")
+}
+
+func appendTail(lines []string, line string) []string {
+	lines = append(lines, line)
+	if len(lines) > localCommandErrorLines {
+		return lines[1:]
+	}
+	return lines
+}
@@ -0,0 +1,181 @@
+package mode
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+func TestRunLocalCommandsKillsHungCommand(t *testing.T) {
+	started := time.Now()
+	commands := types.Commands{types.NewCommand("sh").Arg("-c").QuotedArg("sleep 30 & sleep 30")}
+	err := runLocalCommands(context.Background(), new(terraform.MockUIOutput), commands, 200*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "did not finish within 200ms") {
+		t.Fatalf("Expected a timeout error but got: %v", err)
+	}
+	if time.Since(started) > 10*time.Second {
+		t.Fatalf("Expected the command to be killed after the timeout")
+	}
+
+	// the commands share the timeout, a command is not started once it elapsed:
+	commands = types.Commands{
+		types.NewCommand("sleep").Arg("1"),
+		types.NewCommand("echo").Arg("never"),
+	}
+	err = runLocalCommands(context.Background(), new(terraform.MockUIOutput), commands, time.Second)
+	if err == nil || !strings.Contains(err.Error(), "did not finish within 1s") {
+		t.Fatalf("Expected a timeout error but got: %v", err)
+	}
+}
+
+func TestRunLocalCommandsKeepsExitStatus(t *testing.T) {
+	output := new(terraform.MockUIOutput)
+	if err := runLocalCommands(context.Background(), output, types.Commands{types.NewCommand("echo").Arg("hello")}, time.Minute); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if output.OutputMessage != "hello" {
+		t.Fatalf("Expected the command output but got: '%s'", output.OutputMessage)
+	}
+	commands := types.Commands{
+		types.NewCommand("sh").Arg("-c").QuotedArg("exit 4"),
+		types.NewCommand("echo").Arg("never"),
+	}
+	err := runLocalCommands(context.Background(), output, commands, time.Minute)
+	if status := exitStatusFromError(err); status != 4 {
+		t.Fatalf("Expected exit status 4 but got: %d (%v)", status, err)
+	}
+	if output.OutputMessage != "hello" {
+		t.Fatalf("Expected the sequence to stop at the failed command but got: '%s'", output.OutputMessage)
+	}
+}
+
+func TestRunLocalCommandsPassesArgumentVector(t *testing.T) {
+	root, err := ioutil.TempDir("", "local-command")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(root)
+	binary := filepath.Join(root, "ansible-playbook")
+	received := filepath.Join(root, "argv")
+	script := "#!/bin/sh\nprintf '%s\\n' \"$TF_ANSIBLE_TEST_VALUE\" \"$@\" > " + types.ShellQuote(received) + "\n"
+	if err := ioutil.WriteFile(binary, []byte(script), 0755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	value := `it's a "quoted" value; $HOME`
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"playbook": []interface{}{map[string]interface{}{
+			"file_path": "/path/to/site.yml",
+			"tags":      []interface{}{value},
+		}},
+		"ansible_playbook_binary": binary,
+		"limit":                   "web servers",
+	})
+	commands, err := play.ToLocalCommands(types.LocalModeAnsibleArgs{Username: "centos", Port: 22}, types.NewAnsibleSSHSettingsFromInterface(nil, false))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	commands[0].Env("TF_ANSIBLE_TEST_VALUE", value)
+	if err := runLocalCommands(context.Background(), new(terraform.MockUIOutput), commands, time.Minute); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	contents, err := ioutil.ReadFile(received)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	argv := strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n")
+	if argv[0] != value {
+		t.Fatalf("Expected the environment variable as given but got: %q", argv[0])
+	}
+	for _, expected := range []string{"/path/to/site.yml", "--tags=" + value, "--limit=web servers", "--user=centos"} {
+		found := false
+		for _, arg := range argv[1:] {
+			found = found || arg == expected
+		}
+		if !found {
+			t.Fatalf("Expected the argument %q as given but got: %q", expected, argv[1:])
+		}
+	}
+}
+
+func TestRunLocalCommandCancelled(t *testing.T) {
+	defer func(stopTimeout time.Duration) { localCommandStopTimeout = stopTimeout }(localCommandStopTimeout)
+	localCommandStopTimeout = 500 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	started := time.Now()
+	// the background command ignores the interrupt and is killed:
+	err := runLocalCommand(ctx, new(terraform.MockUIOutput), "sleep 30 & sleep 30")
+	if err == nil || !strings.Contains(err.Error(), "has been cancelled") {
+		t.Fatalf("Expected a cancellation error but got: %v", err)
+	}
+	if time.Since(started) > 10*time.Second {
+		t.Fatalf("Expected the command to be killed when the context is cancelled")
+	}
+
+	if err := runLocalCommand(ctx, new(terraform.MockUIOutput), "echo never"); err == nil || !strings.Contains(err.Error(), "has not been started") {
+		t.Fatalf("Expected no command to start once cancelled but got: %v", err)
+	}
+}
+
+func TestRunLocalCommandStreams(t *testing.T) {
+	os.Setenv("TF_PLUGIN_MAGIC_COOKIE", "cookie")
+	defer os.Unsetenv("TF_PLUGIN_MAGIC_COOKIE")
+
+	lines := make([]string, 0)
+	output := &terraform.MockUIOutput{OutputFn: func(line string) { lines = append(lines, line) }}
+	err := runLocalCommand(context.Background(), output, `echo "cookie: ${TF_PLUGIN_MAGIC_COOKIE:-none}"; echo "bad things" >&2; echo "no such file" >&2; exit 2`)
+	if err == nil || !strings.Contains(err.Error(), "exit status 2. Output: bad things\nno such file") {
+		t.Fatalf("Expected the stderr lines in the error but got: %v", err)
+	}
+	written := strings.Join(lines, "\n")
+	if !strings.Contains(written, "cookie: none") || !strings.Contains(written, "bad things") {
+		t.Fatalf("Expected stdout and stderr without the plugin handshake but got: %s", written)
+	}
+
+	// arguments are passed to the program as they are, a shell never interprets these:
+	lines = make([]string, 0)
+	cmd := newProcessCommand(context.Background(), "echo", "$HOME", "'quoted'; rm -rf /")
+	if err := runLocalProcess(context.Background(), output, cmd, "echo", time.Time{}, 0); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if lines[len(lines)-1] != "$HOME 'quoted'; rm -rf /" {
+		t.Fatalf("Expected the arguments as given but got: %v", lines)
+	}
+}
+
+func TestRunLocalCommandCleanEnvironment(t *testing.T) {
+	os.Setenv("ANSIBLE_STDOUT_CALLBACK", "stray")
+	defer os.Unsetenv("ANSIBLE_STDOUT_CALLBACK")
+	os.Setenv("AWS_PROFILE", "ci")
+	defer os.Unsetenv("AWS_PROFILE")
+
+	command := `echo "callback: ${ANSIBLE_STDOUT_CALLBACK:-none}, profile: ${AWS_PROFILE:-none}, home: ${HOME:+set}"`
+	for _, tc := range []struct {
+		options  RunOptions
+		expected string
+	}{
+		{RunOptions{}, "callback: stray, profile: ci, home: set"},
+		{RunOptions{CleanEnvironment: true}, "callback: none, profile: none, home: set"},
+		{RunOptions{CleanEnvironment: true, EnvironmentAllowlist: []string{"PATH", "AWS_*"}}, "callback: none, profile: ci, home: "},
+	} {
+		lines := make([]string, 0)
+		output := &terraform.MockUIOutput{OutputFn: func(line string) { lines = append(lines, line) }}
+		if err := runLocalCommand(tc.options.runContext(), output, command); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if lines[len(lines)-1] != tc.expected {
+			t.Fatalf("Expected '%s' with %+v but got: %v", tc.expected, tc.options, lines)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package mode
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// logFileDirectory is relative to the artifact directory.
+const logFileDirectory = "logs"
+
+// logFileName replaces the characters of a resource name not allowed in file names.
+var logFileName = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// logFileOutput is a UIOutput writing every line to the wrapped output and, timestamped
+// and with colors removed, to the log file of the run.
+type logFileOutput struct {
+	sync.Mutex
+	o    terraform.UIOutput
+	file *os.File
+	err  error
+}
+
+// NewLogFileOutput returns a UIOutput writing the output of the run to a new log file named after the start
+// of the run and the resource in the logs directory under the artifact directory, in addition to the output,
+// when the run options enable the log file. The returned function closes the log file.
+func NewLogFileOutput(o terraform.UIOutput, options RunOptions, resource string) (terraform.UIOutput, func(), error) {
+	if !options.LogToFile {
+		return o, func() {}, nil
+	}
+	directory, err := artifactPath(options.ArtifactDirectory, logFileDirectory)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, nil, fmt.Errorf("could not create the log directory '%s': %v", directory, err)
+	}
+	name := logFileName.ReplaceAllString(resource, "_")
+	if name == "" || name == "." || name == ".." {
+		name = "resource"
+	}
+	// runs of resources named alike starting in the same second get a number:
+	prefix := filepath.Join(directory, fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405Z"), name))
+	path := prefix + ".log"
+	var file *os.File
+	for attempt := 2; ; attempt++ {
+		// the output is masked before it is written, the file is readable by the owner only all the same:
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) || attempt > tempFileAttempts {
+			return nil, nil, fmt.Errorf("could not create the log file '%s': %v", path, err)
+		}
+		path = fmt.Sprintf("%s-%d.log", prefix, attempt)
+	}
+	o.Output(fmt.Sprintf("the output is written to '%s'", path))
+	output := &logFileOutput{o: o, file: file}
+	return output, output.close, nil
+}
+
+// Output implements terraform.UIOutput.
+func (v *logFileOutput) Output(line string) {
+	v.o.Output(line)
+	v.Lock()
+	defer v.Unlock()
+	if v.err != nil {
+		return
+	}
+	if _, v.err = fmt.Fprintf(v.file, "%s %s\n", time.Now().UTC().Format(time.RFC3339), ansiEscapeSequence.ReplaceAllString(line, "")); v.err != nil {
+		v.o.Output(fmt.Sprintf("failed to write the log file, the output is not written to it any longer: %v", v.err))
+	}
+}
+
+func (v *logFileOutput) close() {
+	v.Lock()
+	defer v.Unlock()
+	if err := v.file.Close(); err != nil && v.err == nil {
+		v.o.Output(fmt.Sprintf("failed to close the log file: %v", err))
+	}
+}
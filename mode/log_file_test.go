@@ -0,0 +1,60 @@
+package mode
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestLogFileOutput(t *testing.T) {
+	artifactDirectory, err := ioutil.TempDir("", "log-file")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(artifactDirectory)
+
+	output := new(terraform.MockUIOutput)
+	o, closeLog, err := NewLogFileOutput(output, RunOptions{ArtifactDirectory: artifactDirectory}, "i-0abc")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	closeLog()
+	if o != output {
+		t.Fatalf("Expected no log file unless enabled")
+	}
+
+	o, closeLog, err = NewLogFileOutput(output, RunOptions{ArtifactDirectory: artifactDirectory, LogToFile: true}, "module.web/aws_instance")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	o.Output("\x1b[0;32mok: [web1]\x1b[0m")
+	closeLog()
+	if output.OutputMessage != "\x1b[0;32mok: [web1]\x1b[0m" {
+		t.Fatalf("Expected the line in the output as it is but got: %s", output.OutputMessage)
+	}
+	// a second run of a resource named alike in the same second gets its own file:
+	if _, closeLog, err = NewLogFileOutput(output, RunOptions{ArtifactDirectory: artifactDirectory, LogToFile: true}, "module.web/aws_instance"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	closeLog()
+
+	if files, _ := filepath.Glob(filepath.Join(artifactDirectory, "logs", "*")); len(files) != 2 {
+		t.Fatalf("Expected a log file for every run but got: %v", files)
+	}
+	files, err := filepath.Glob(filepath.Join(artifactDirectory, "logs", "*-module.web_aws_instance.log"))
+	// the first run, the second run may start a second later:
+	if err != nil || len(files) == 0 {
+		t.Fatalf("Expected a log file named after the resource but got: %v %v", files, err)
+	}
+	contents, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasSuffix(string(contents), "Z ok: [web1]\n") {
+		t.Fatalf("Expected the timestamped line without colors but got: %s", string(contents))
+	}
+}
@@ -0,0 +1,37 @@
+package mode
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+// logLevels orders the log levels, a message is written when its level is at most the configured level.
+var logLevels = map[string]int{
+	types.LogLevelQuiet: 0,
+	types.LogLevelInfo:  1,
+	types.LogLevelDebug: 2,
+}
+
+// discardOutput drops the messages above the configured log level.
+type discardOutput struct{}
+
+func (discardOutput) Output(string) {}
+
+// levelOutput returns the output of the provisioner messages of the level, the messages are discarded
+// when the configured log level, info when empty, is lower. The Ansible output is never leveled.
+func levelOutput(o terraform.UIOutput, configured string, level string) terraform.UIOutput {
+	if configured == "" {
+		configured = types.LogLevelInfo
+	}
+	if logLevels[level] > logLevels[configured] {
+		return discardOutput{}
+	}
+	return o
+}
+
+// contextLevelOutput returns the output of the messages of the level, with the log level of the run of the context.
+func contextLevelOutput(ctx context.Context, o terraform.UIOutput, level string) terraform.UIOutput {
+	return levelOutput(o, contextRunOptions(ctx).LogLevel, level)
+}
@@ -0,0 +1,38 @@
+package mode
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+func TestLevelOutput(t *testing.T) {
+	lines := make([]string, 0)
+	output := &terraform.MockUIOutput{OutputFn: func(line string) { lines = append(lines, line) }}
+	for _, configured := range []string{"", types.LogLevelQuiet, types.LogLevelInfo, types.LogLevelDebug} {
+		levelOutput(output, configured, types.LogLevelInfo).Output(configured + " info")
+		levelOutput(output, configured, types.LogLevelDebug).Output(configured + " debug")
+	}
+	expected := []string{" info", "info info", "debug info", "debug debug"}
+	if strings.Join(lines, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expected %v but got: %v", expected, lines)
+	}
+}
+
+func TestLocalCommandLogLevel(t *testing.T) {
+	for level, executing := range map[string]bool{types.LogLevelQuiet: false, types.LogLevelInfo: false, types.LogLevelDebug: true} {
+		lines := make([]string, 0)
+		output := &terraform.MockUIOutput{OutputFn: func(line string) { lines = append(lines, line) }}
+		ctx := RunOptions{LogLevel: level, Context: context.Background()}.runContext()
+		if err := runLocalCommand(ctx, output, "echo done"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		written := strings.Join(lines, "\n")
+		if strings.Contains(written, "Executing: ") != executing || !strings.HasSuffix(written, "done") {
+			t.Fatalf("Expected the executed command to be written with %s: %v, and the output always, but got: %s", level, executing, written)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package mode
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+const maskedValue = "******"
+
+const privateKeyMinimumLine = 8
+
+// maskingOutput is a UIOutput replacing sensitive values before writing to the wrapped output.
+type maskingOutput struct {
+	o        terraform.UIOutput
+	secrets  []string
+	patterns []*regexp.Regexp
+}
+
+func newMaskingOutput(o terraform.UIOutput, secrets []string) *maskingOutput {
+	return newPatternMaskingOutput(o, secrets, nil)
+}
+
+// newPatternMaskingOutput masks the secrets, in the forms these take in the commands and inventories,
+// and every match of the patterns.
+func newPatternMaskingOutput(o terraform.UIOutput, secrets []string, patterns []*regexp.Regexp) *maskingOutput {
+	forms := make(map[string]bool)
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		for _, form := range []string{secret, iniQuote(secret), types.ShellQuote(secret)} {
+			forms[form] = true
+			// the executed arguments are written Go quoted:
+			forms[strings.Trim(strconv.Quote(form), "\"")] = true
+		}
+	}
+	nonEmpty := make([]string, 0, len(forms))
+	for form := range forms {
+		nonEmpty = append(nonEmpty, form)
+	}
+	// a quoted form contains the secret, the longest forms are masked first:
+	sort.Slice(nonEmpty, func(i, j int) bool {
+		if len(nonEmpty[i]) != len(nonEmpty[j]) {
+			return len(nonEmpty[i]) > len(nonEmpty[j])
+		}
+		return nonEmpty[i] < nonEmpty[j]
+	})
+	return &maskingOutput{o: o, secrets: nonEmpty, patterns: patterns}
+}
+
+// NewSecretsOutput returns a UIOutput masking every secret of the connection, the settings and the plays,
+// and every match of the mask patterns of the run options, in all lines written by the provisioner.
+func NewSecretsOutput(o terraform.UIOutput, s *terraform.InstanceState, settings *Settings, plays []*types.Play) terraform.UIOutput {
+	secrets := playSecrets(plays)
+	if s != nil {
+		connInfo := s.Ephemeral.ConnInfo
+		secrets = append(secrets, connInfo["password"], connInfo["bastion_password"])
+		secrets = append(secrets, privateKeySecrets(connInfo["private_key"])...)
+		secrets = append(secrets, privateKeySecrets(connInfo["bastion_private_key"])...)
+	}
+	if settings != nil {
+		if settings.WindowsSettings != nil {
+			secrets = append(secrets, settings.WindowsSettings.BecomePassword())
+			secrets = append(secrets, proxyURLSecrets(settings.WindowsSettings.Proxy())...)
+			for _, host := range settings.WindowsSettings.Hosts() {
+				secrets = append(secrets, host.Password())
+			}
+		}
+		if settings.Remote != nil {
+			secrets = append(secrets, settings.Remote.SudoPassword())
+			secrets = append(secrets, proxySecrets(settings.Remote)...)
+		}
+	}
+	patterns := make([]*regexp.Regexp, 0)
+	if settings != nil {
+		for _, pattern := range settings.RunOptions.MaskPatterns {
+			// the patterns are validated with the configuration:
+			if compiled, err := regexp.Compile(pattern); err == nil {
+				patterns = append(patterns, compiled)
+			}
+		}
+	}
+	return newPatternMaskingOutput(o, secrets, patterns)
+}
+
+// Output writes the line with every secret masked.
+func (v *maskingOutput) Output(line string) {
+	v.o.Output(v.mask(line))
+}
+
+func (v *maskingOutput) mask(line string) string {
+	for _, secret := range v.secrets {
+		line = strings.Replace(line, secret, maskedValue, -1)
+	}
+	for _, pattern := range v.patterns {
+		line = pattern.ReplaceAllString(line, maskedValue)
+	}
+	return line
+}
+
+// maskSecrets masks the line like the masking outputs wrapping each other at the top of the output do,
+// for the text written elsewhere than to the output.
+func maskSecrets(o terraform.UIOutput, line string) string {
+	for {
+		masking, ok := o.(*maskingOutput)
+		if !ok {
+			return line
+		}
+		line = masking.mask(line)
+		o = masking.o
+	}
+}
+
+// MaskError returns the error with the secrets masked when the output is a secrets output,
+// Terraform writes the errors of the provisioner and the provider as these are.
+func MaskError(o terraform.UIOutput, err error) error {
+	if err == nil {
+		return nil
+	}
+	if masked := maskSecrets(o, err.Error()); masked != err.Error() {
+		return errors.New(masked)
+	}
+	return err
+}
+
+func playSecrets(plays []*types.Play) []string {
+	secrets := make([]string, 0)
+	for _, play := range plays {
+		secrets = append(secrets, play.BecomePassword())
+		if galaxyInstall, ok := play.Entity().(*types.GalaxyInstall); ok {
+			secrets = append(secrets, galaxyInstall.Token())
+		}
+		if play.VaultPasswordEnv() != "" {
+			secrets = append(secrets, os.Getenv(play.VaultPasswordEnv()))
+		}
+		// a materialized vault_password_command file holds the password printed by the command:
+		secrets = append(secrets, vaultFileSecret(play.VaultPasswordFile()))
+		for _, vaultID := range play.VaultID() {
+			_, source := types.SplitVaultID(vaultID)
+			secrets = append(secrets, vaultFileSecret(source))
+		}
+	}
+	return secrets
+}
+
+// privateKeySecrets returns the key and every line of the key, the output is written line by line.
+// The armor and header lines, and lines too short to not match unrelated output, are not secrets.
+func privateKeySecrets(key string) []string {
+	if key == "" {
+		return nil
+	}
+	secrets := []string{key}
+	for _, line := range strings.Split(key, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) >= privateKeyMinimumLine && !strings.HasPrefix(line, "-----") && !strings.Contains(line, ":") {
+			secrets = append(secrets, line)
+		}
+	}
+	return secrets
+}
+
+// vaultFileSecret returns the password of a vault password file, an executable file is a script
+// printing the password and the script itself is not a secret.
+func vaultFileSecret(path string) string {
+	if path == "" {
+		return ""
+	}
+	resolved, err := types.ResolvePath(path)
+	if err != nil {
+		return ""
+	}
+	info, err := os.Stat(resolved)
+	if err != nil || !info.Mode().IsRegular() || info.Mode()&0111 != 0 {
+		return ""
+	}
+	contents, err := ioutil.ReadFile(resolved)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimRight(string(contents), "\r\n")
+}
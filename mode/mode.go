@@ -0,0 +1,168 @@
+package mode
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+// DefaultMode is the name of the mode used when no other mode is enabled by the provisioner configuration.
+const DefaultMode = "local"
+
+// Mode is an execution backend of the provisioner.
+type Mode interface {
+	// Validate checks the plays and the settings before anything is executed.
+	Validate(plays []*types.Play, settings *Settings) error
+	// Run executes the plays.
+	Run(plays []*types.Play, settings *Settings) error
+	// Cleanup releases what the mode holds, it is called once Run returns, also when Run fails.
+	Cleanup() error
+}
+
+// Settings holds the provisioner configuration passed to the modes.
+type Settings struct {
+	AnsibleSSHSettings   *types.AnsibleSSHSettings
+	WindowsSettings      *types.WindowsSettings
+	ExecutionEnvironment *types.ExecutionEnvironment
+	WSL                  *types.WSLSettings
+	Remote               *types.RemoteSettings
+	Tower                *types.TowerSettings
+	Kubernetes           *types.KubernetesSettings
+	PullBootstrap        *types.PullBootstrapSettings
+	Aggregate            *types.AggregateSettings
+	RunOptions           RunOptions
+	// Config is the provisioner configuration, modes registered outside of this package
+	// read the attributes of their schema from it.
+	Config *schema.ResourceData
+}
+
+// Factory returns the mode provisioning the resource.
+type Factory func(o terraform.UIOutput, s *terraform.InstanceState, settings *Settings) (Mode, error)
+
+// Definition describes a registered mode.
+type Definition struct {
+	// Name of the mode, also the name of the provisioner attribute enabling the mode.
+	Name string
+	// Schema of the provisioner attribute enabling the mode, nil for the default mode.
+	Schema *schema.Schema
+	// New returns the mode.
+	New Factory
+}
+
+var (
+	registryLock sync.Mutex
+	registry     = make([]*Definition, 0)
+)
+
+func init() {
+	Register(&Definition{
+		Name: DefaultMode,
+		New: func(o terraform.UIOutput, s *terraform.InstanceState, settings *Settings) (Mode, error) {
+			v, err := NewLocalMode(o, s)
+			if err != nil {
+				return nil, err
+			}
+			return v, nil
+		},
+	})
+	Register(&Definition{
+		Name:   "remote",
+		Schema: types.NewRemoteSchema(),
+		New: func(o terraform.UIOutput, s *terraform.InstanceState, settings *Settings) (Mode, error) {
+			v, err := NewRemoteMode(o, s, settings.Remote)
+			if err != nil {
+				return nil, err
+			}
+			return v, nil
+		},
+	})
+	Register(&Definition{
+		Name:   "tower",
+		Schema: types.NewTowerSchema(),
+		New: func(o terraform.UIOutput, s *terraform.InstanceState, settings *Settings) (Mode, error) {
+			v, err := NewTowerMode(o, s, settings.Tower)
+			if err != nil {
+				return nil, err
+			}
+			return v, nil
+		},
+	})
+	Register(&Definition{
+		Name:   "kubernetes",
+		Schema: types.NewKubernetesSchema(),
+		New: func(o terraform.UIOutput, s *terraform.InstanceState, settings *Settings) (Mode, error) {
+			v, err := NewKubernetesMode(o, s, settings.Kubernetes)
+			if err != nil {
+				return nil, err
+			}
+			return v, nil
+		},
+	})
+	Register(&Definition{
+		Name:   "pull_bootstrap",
+		Schema: types.NewPullBootstrapSchema(),
+		New: func(o terraform.UIOutput, s *terraform.InstanceState, settings *Settings) (Mode, error) {
+			v, err := NewPullBootstrapMode(o, s, settings.PullBootstrap)
+			if err != nil {
+				return nil, err
+			}
+			return v, nil
+		},
+	})
+	Register(&Definition{
+		Name:   "aggregate",
+		Schema: types.NewAggregateSchema(),
+		New: func(o terraform.UIOutput, s *terraform.InstanceState, settings *Settings) (Mode, error) {
+			v, err := NewAggregateMode(o, s, settings.Aggregate)
+			if err != nil {
+				return nil, err
+			}
+			return v, nil
+		},
+	})
+}
+
+// Register adds a mode to the registry, a registered mode with the same name is replaced.
+// Modes are registered from the init function of the package implementing them.
+func Register(definition *Definition) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	for idx, registered := range registry {
+		if registered.Name == definition.Name {
+			registry[idx] = definition
+			return
+		}
+	}
+	registry = append(registry, definition)
+}
+
+// Registered returns the registered modes in the order of registration.
+func Registered() []*Definition {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	return append([]*Definition{}, registry...)
+}
+
+// Lookup returns the mode enabled by the provisioner configuration: the first registered mode
+// with its attribute set, the default mode when none is set.
+func Lookup(d *schema.ResourceData) (*Definition, error) {
+	var defaultDefinition *Definition
+	for _, definition := range Registered() {
+		if definition.Schema == nil {
+			if definition.Name == DefaultMode {
+				defaultDefinition = definition
+			}
+			continue
+		}
+		if _, ok := d.GetOk(definition.Name); ok {
+			return definition, nil
+		}
+	}
+	if defaultDefinition == nil {
+		return nil, fmt.Errorf("no mode is enabled by the provisioner configuration and the %s mode is not registered", DefaultMode)
+	}
+	return defaultDefinition, nil
+}
@@ -0,0 +1,300 @@
+package mode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+// AggregateMode registers the connection of a compute resource in a fleet, a null_resource
+// runs the plays once against the generated inventory of all registered members.
+type AggregateMode struct {
+	o        terraform.UIOutput
+	local    *LocalMode
+	settings *types.AggregateSettings
+	store    *aggregateStore
+}
+
+// aggregateMember is the registered connection of a fleet member.
+type aggregateMember struct {
+	Alias      string                 `json:"alias"`
+	Host       string                 `json:"host"`
+	Port       int                    `json:"port"`
+	User       string                 `json:"user"`
+	PrivateKey string                 `json:"private_key,omitempty"`
+	Groups     []string               `json:"groups"`
+	HostVars   map[string]interface{} `json:"host_vars"`
+}
+
+// aggregateStore keeps the members of a fleet, one file per member, such that resources
+// provisioned in parallel register without locking.
+type aggregateStore struct {
+	directory string
+}
+
+// NewAggregateMode returns configured fleet aggregation provisioner.
+func NewAggregateMode(o terraform.UIOutput, s *terraform.InstanceState, settings *types.AggregateSettings) (*AggregateMode, error) {
+	local, err := NewLocalMode(o, s)
+	if err != nil {
+		return nil, err
+	}
+	return &AggregateMode{
+		o:        o,
+		local:    local,
+		settings: settings,
+		store:    newAggregateStore(settings.Directory(), settings.ID()),
+	}, nil
+}
+
+// Validate checks that a member connects over SSH without a bastion and validates the plays of a member.
+// The plays of a null_resource are validated by the local mode once the inventory of the fleet is written.
+func (v *AggregateMode) Validate(plays []*types.Play, settings *Settings) error {
+	if v.settings.ID() == "" {
+		return fmt.Errorf("aggregate.id can not be empty")
+	}
+	if !v.local.ComputeResource() {
+		return nil
+	}
+	if v.local.connInfo.Type != "ssh" {
+		return fmt.Errorf("aggregate members must connect over SSH, got: %s", v.local.connInfo.Type)
+	}
+	if v.local.connInfo.BastionHost != "" {
+		return fmt.Errorf("aggregate members can not connect through a bastion host")
+	}
+	return v.local.Validate(plays, settings)
+}
+
+// Cleanup does nothing, the inventory and the keys of a run are removed when Run returns.
+func (v *AggregateMode) Cleanup() error {
+	return nil
+}
+
+// Run registers a compute resource in the fleet, or removes it in the destroy phase, and runs its plays
+// like the local mode. A null_resource runs the plays against the inventory of the registered members.
+func (v *AggregateMode) Run(plays []*types.Play, settings *Settings) error {
+	if v.local.ComputeResource() {
+		if err := v.register(settings.RunOptions); err != nil {
+			return err
+		}
+		for _, play := range plays {
+			if play.Enabled() {
+				return v.local.Run(plays, settings)
+			}
+		}
+		return nil
+	}
+
+	members, err := v.store.members()
+	if err != nil {
+		return err
+	}
+	if len(members) == 0 {
+		return fmt.Errorf("aggregate '%s' has no registered members, the null_resource must depend on the members", v.settings.ID())
+	}
+	if len(members) < v.settings.MinMembers() {
+		return fmt.Errorf("aggregate '%s' has %d registered members, min_members is %d", v.settings.ID(), len(members), v.settings.MinMembers())
+	}
+
+	// the keys and the inventory of the fleet are written to the work directory of the local run:
+	closeWorkDirectory, err := v.local.openWorkDirectory(settings.RunOptions)
+	if err != nil {
+		return err
+	}
+	defer closeWorkDirectory()
+
+	v.local.logLevel = settings.RunOptions.LogLevel
+	inventoryFile, keyFiles, err := v.writeInventory(members)
+	for _, keyFile := range keyFiles {
+		defer v.local.removeTemporary(removeSecretFile, keyFile)
+	}
+	if err != nil {
+		return err
+	}
+	defer v.local.removeTemporary(removeSecretFile, inventoryFile)
+	v.o.Output(fmt.Sprintf("aggregate '%s': running the plays against %d members", v.settings.ID(), len(members)))
+
+	for _, play := range plays {
+		if play.InventoryFile() == "" {
+			play.SetOverrideInventoryFile(inventoryFile)
+		}
+	}
+	if err := v.local.Validate(plays, settings); err != nil {
+		return err
+	}
+	return v.local.Run(plays, settings)
+}
+
+// register writes the connection of the resource to the fleet, the member is removed in the destroy phase.
+func (v *AggregateMode) register(options RunOptions) error {
+	member := &aggregateMember{
+		Alias:      v.settings.Alias(),
+		Host:       v.local.connInfo.Host,
+		Port:       v.local.connInfo.Port,
+		User:       v.local.connInfo.User,
+		PrivateKey: v.local.connInfo.PrivateKey,
+		Groups:     v.settings.Groups(),
+		HostVars:   v.settings.HostVars(),
+	}
+	if member.Alias == "" {
+		member.Alias = member.Host
+	}
+
+	if options.Phase == types.PhaseDestroy {
+		if dryRun := options.dryRun(); dryRun != "" {
+			v.o.Output(fmt.Sprintf("aggregate '%s': %s, '%s' not removed", v.settings.ID(), dryRun, member.Alias))
+			return nil
+		}
+		v.o.Output(fmt.Sprintf("aggregate '%s': removing '%s'", v.settings.ID(), member.Alias))
+		return v.store.remove(member.Alias)
+	}
+	if dryRun := options.dryRun(); dryRun != "" {
+		v.o.Output(fmt.Sprintf("aggregate '%s': %s, '%s' not registered", v.settings.ID(), dryRun, member.Alias))
+		return nil
+	}
+	v.o.Output(fmt.Sprintf("aggregate '%s': registering '%s' (%s)", v.settings.ID(), member.Alias, member.Host))
+	return v.store.add(member)
+}
+
+// writeInventory writes the private keys of the members and the YAML inventory of the fleet, as JSON.
+// Returns the inventory and the key files, the key files are returned also on error, for removal.
+func (v *AggregateMode) writeInventory(members []*aggregateMember) (string, []string, error) {
+	keyFiles := make(map[string]string)
+	written := make([]string, 0)
+	for _, member := range members {
+		if member.PrivateKey == "" || keyFiles[member.PrivateKey] != "" {
+			continue
+		}
+		keyFile, err := v.local.writePem(v.local.secret(member.PrivateKey))
+		if err != nil {
+			return "", written, err
+		}
+		keyFiles[member.PrivateKey] = keyFile
+		written = append(written, keyFile)
+	}
+
+	contents, err := json.MarshalIndent(aggregateInventory(members, keyFiles), "", "  ")
+	if err != nil {
+		return "", written, err
+	}
+	// the yaml inventory plugin reads files with a .json extension:
+	file, err := writeTempFile(v.local.workDirectory, "tf-ansible-aggregate-*.json", contents, 0600)
+	if err != nil {
+		return "", written, err
+	}
+	v.o.Output(fmt.Sprintf("aggregate '%s': inventory written to '%s'", v.settings.ID(), file))
+	return file, written, nil
+}
+
+// aggregateInventory returns the inventory of the members in the structure of the yaml inventory plugin.
+// The connection of every member is given with host variables, these take precedence over the command line.
+func aggregateInventory(members []*aggregateMember, keyFiles map[string]string) map[string]interface{} {
+	hosts := make(map[string]interface{})
+	groups := make(map[string]interface{})
+	for _, member := range members {
+		hostVars := make(map[string]interface{})
+		for name, value := range member.HostVars {
+			hostVars[name] = value
+		}
+		hostVars["ansible_host"] = member.Host
+		if member.Port > 0 {
+			hostVars["ansible_port"] = member.Port
+		}
+		if member.User != "" {
+			hostVars["ansible_user"] = member.User
+		}
+		if keyFile := keyFiles[member.PrivateKey]; keyFile != "" {
+			hostVars["ansible_ssh_private_key_file"] = keyFile
+		}
+		hosts[member.Alias] = hostVars
+
+		for _, group := range member.Groups {
+			if _, ok := groups[group]; !ok {
+				groups[group] = map[string]interface{}{"hosts": make(map[string]interface{})}
+			}
+			groups[group].(map[string]interface{})["hosts"].(map[string]interface{})[member.Alias] = nil
+		}
+	}
+	return map[string]interface{}{
+		"all": map[string]interface{}{
+			"hosts":    hosts,
+			"children": groups,
+		},
+	}
+}
+
+func newAggregateStore(directory string, id string) *aggregateStore {
+	if absolute, err := filepath.Abs(directory); err == nil {
+		directory = absolute
+	}
+	return &aggregateStore{directory: filepath.Join(directory, id)}
+}
+
+// add writes the member, replacing a member registered with the same alias. The file is readable
+// by the user only, it holds the private key of the member.
+func (v *aggregateStore) add(member *aggregateMember) error {
+	if err := os.MkdirAll(v.directory, 0700); err != nil {
+		return err
+	}
+	contents, err := json.Marshal(member)
+	if err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(v.directory, ".member-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(contents); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	// a null_resource reading the members concurrently never reads a partially written member:
+	return os.Rename(file.Name(), v.memberFile(member.Alias))
+}
+
+// remove deletes the member, removing a member which is not registered is not an error.
+func (v *aggregateStore) remove(alias string) error {
+	if err := os.Remove(v.memberFile(alias)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// members returns the registered members ordered by their alias.
+func (v *aggregateStore) members() ([]*aggregateMember, error) {
+	files, err := filepath.Glob(filepath.Join(v.directory, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	members := make([]*aggregateMember, 0, len(files))
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		member := &aggregateMember{}
+		if err := json.Unmarshal(contents, member); err != nil {
+			return nil, fmt.Errorf("aggregate member '%s' could not be decoded: %v", file, err)
+		}
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Alias < members[j].Alias })
+	return members, nil
+}
+
+// memberFile is named after the hash of the alias, aliases may contain characters invalid in file names.
+func (v *aggregateStore) memberFile(alias string) string {
+	sum := sha256.Sum256([]byte(alias))
+	return filepath.Join(v.directory, hex.EncodeToString(sum[:])+".json")
+}
@@ -0,0 +1,138 @@
+package mode
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+func newAggregateTestMode(t *testing.T, host string, aggregate map[string]interface{}) *AggregateMode {
+	connInfo := map[string]string{"type": "ssh"}
+	if host != "" {
+		connInfo["host"] = host
+		connInfo["user"] = "ubuntu"
+		connInfo["private_key"] = test.TestSSHUserKeyPrivate
+	}
+	instanceState := &terraform.InstanceState{
+		Ephemeral: terraform.EphemeralState{ConnInfo: connInfo},
+	}
+	v, err := NewAggregateMode(new(terraform.MockUIOutput), instanceState, types.NewAggregateSettingsFromMapInterface(aggregate, true))
+	if err != nil {
+		t.Fatalf("Expected aggregate mode but got an error: %v", err)
+	}
+	return v
+}
+
+func newAggregateTestSettings(phase string) *Settings {
+	return &Settings{
+		WSL:        types.NewWSLSettingsFromInterface("", false),
+		RunOptions: RunOptions{Phase: phase},
+	}
+}
+
+func TestAggregateModeRegistersMembers(t *testing.T) {
+	directory, err := ioutil.TempDir("", "aggregate-test")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	for _, member := range []struct {
+		host  string
+		alias string
+	}{
+		{host: "10.0.0.11", alias: "etcd-1"},
+		{host: "10.0.0.12", alias: "etcd-2"},
+		{host: "10.0.0.13"},
+	} {
+		v := newAggregateTestMode(t, member.host, map[string]interface{}{
+			"id":        "etcd",
+			"directory": directory,
+			"alias":     member.alias,
+			"groups":    []interface{}{"etcd"},
+			"host_vars": map[string]interface{}{"etcd_peer": member.host},
+		})
+		if err := v.Validate(nil, newAggregateTestSettings(types.PhaseCreate)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := v.Run(nil, newAggregateTestSettings(types.PhaseCreate)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	// the replaced member registers again with the same alias:
+	replaced := newAggregateTestMode(t, "10.0.0.21", map[string]interface{}{"id": "etcd", "directory": directory, "alias": "etcd-2"})
+	if err := replaced.Run(nil, newAggregateTestSettings(types.PhaseCreate)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	removed := newAggregateTestMode(t, "10.0.0.13", map[string]interface{}{"id": "etcd", "directory": directory})
+	if err := removed.Run(nil, newAggregateTestSettings(types.PhaseDestroy)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	run := newAggregateTestMode(t, "", map[string]interface{}{"id": "etcd", "directory": directory, "min_members": 3})
+	if err := run.Run(nil, newAggregateTestSettings(types.PhaseCreate)); err == nil || !strings.Contains(err.Error(), "2 registered members, min_members is 3") {
+		t.Fatalf("Expected too few members to fail the run but got: %v", err)
+	}
+
+	members, err := run.store.members()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	inventoryFile, keyFiles, err := run.writeInventory(members)
+	for _, keyFile := range keyFiles {
+		defer os.Remove(keyFile)
+	}
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.Remove(inventoryFile)
+	if len(keyFiles) != 1 {
+		t.Fatalf("Expected the shared private key to be written once but got: %v", keyFiles)
+	}
+
+	contents, err := ioutil.ReadFile(inventoryFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	inventory := struct {
+		All struct {
+			Hosts    map[string]map[string]interface{} `json:"hosts"`
+			Children map[string]struct {
+				Hosts map[string]interface{} `json:"hosts"`
+			} `json:"children"`
+		} `json:"all"`
+	}{}
+	if err := json.Unmarshal(contents, &inventory); err != nil {
+		t.Fatalf("Expected a JSON inventory but got: %v", err)
+	}
+	if len(inventory.All.Hosts) != 2 {
+		t.Fatalf("Expected the removed member not to be in the inventory but got: %v", inventory.All.Hosts)
+	}
+	etcd2 := inventory.All.Hosts["etcd-2"]
+	if etcd2["ansible_host"] != "10.0.0.21" || etcd2["ansible_user"] != "ubuntu" || etcd2["ansible_ssh_private_key_file"] != keyFiles[0] {
+		t.Fatalf("Expected the connection of the replaced member but got: %v", etcd2)
+	}
+	if inventory.All.Hosts["etcd-1"]["etcd_peer"] != "10.0.0.11" {
+		t.Fatalf("Expected the host variables of the member but got: %v", inventory.All.Hosts["etcd-1"])
+	}
+	if _, ok := inventory.All.Children["etcd"].Hosts["etcd-1"]; !ok {
+		t.Fatalf("Expected the member in its group but got: %v", inventory.All.Children)
+	}
+
+	bastion := &terraform.InstanceState{
+		Ephemeral: terraform.EphemeralState{ConnInfo: map[string]string{"type": "ssh", "host": "10.0.0.14", "bastion_host": "10.0.0.1"}},
+	}
+	v, err := NewAggregateMode(new(terraform.MockUIOutput), bastion, types.NewAggregateSettingsFromMapInterface(map[string]interface{}{"id": "etcd"}, true))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := v.Validate(nil, newAggregateTestSettings(types.PhaseCreate)); err == nil {
+		t.Fatalf("Expected members behind a bastion host to be rejected")
+	}
+}
@@ -0,0 +1,505 @@
+package mode
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	linereader "github.com/mitchellh/go-linereader"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+const (
+	// kubernetesPackageLimit leaves room for the metadata of the secret holding the package,
+	// the size of a secret is limited to 1 MiB.
+	kubernetesPackageLimit     = 1000 * 1024
+	kubernetesPackageKey       = "play.tar.gz"
+	kubernetesPackageDirectory = "/tf-ansible-package"
+	kubernetesWorkspaceVolume  = "workspace"
+	kubernetesWorkspacePath    = "/tf-ansible-workspace"
+	kubernetesContainerName    = "ansible"
+	kubernetesManagedBy        = "terraform-provisioner-ansible"
+	kubernetesPollInterval     = 2 * time.Second
+)
+
+// KubernetesMode represents Kubernetes provisioner mode. The plays are prepared like in local mode,
+// every Ansible command runs in a Kubernetes Job instead of on the machine running Terraform.
+type KubernetesMode struct {
+	local *LocalMode
+}
+
+// kubernetesJobs creates the Jobs of the Ansible commands and waits for them to finish.
+type kubernetesJobs struct {
+	settings     *types.KubernetesSettings
+	pollInterval time.Duration
+}
+
+// kubernetesPackage holds the files of a play, extracted in the Job pod at the same paths.
+type kubernetesPackage struct {
+	archive []byte
+	mounts  []string
+}
+
+// NewKubernetesMode returns configured Kubernetes provisioner.
+func NewKubernetesMode(o terraform.UIOutput, s *terraform.InstanceState, settings *types.KubernetesSettings) (*KubernetesMode, error) {
+	local, err := NewLocalMode(o, s)
+	if err != nil {
+		return nil, err
+	}
+	local.jobs = &kubernetesJobs{settings: settings, pollInterval: kubernetesPollInterval}
+	return &KubernetesMode{local: local}, nil
+}
+
+// Validate checks that the plays can be executed in Kubernetes Jobs.
+func (v *KubernetesMode) Validate(plays []*types.Play, settings *Settings) error {
+	if err := v.local.Validate(plays, settings); err != nil {
+		return err
+	}
+	ansibleSSHSettings := settings.AnsibleSSHSettings
+	if settings.RunOptions.Executor == types.ExecutorAnsibleRunner {
+		return fmt.Errorf("The ansible-runner executor is not supported in Kubernetes mode")
+	}
+	// the facts are written in the Job pod:
+	for _, play := range plays {
+		if play.FactsOutputFile() != "" {
+			return fmt.Errorf("facts_output_file is not supported in Kubernetes mode")
+		}
+	}
+	// the host keys are not fetched from the machine running Terraform, it may not reach the hosts:
+	if newBastionHostFromConnectionInfo(v.local.connInfo).inUse() {
+		return fmt.Errorf("Bastion hosts are not supported in Kubernetes mode, the Jobs connect to the hosts directly")
+	}
+	if v.local.connInfo.Type != "winrm" && v.local.ComputeResource() &&
+		newTargetHostFromConnectionInfo(v.local.connInfo).hostKey() == "" &&
+		ansibleSSHSettings.UserKnownHostsFile() == "" && !ansibleSSHSettings.InsecureNoStrictHostKeyChecking() {
+		return fmt.Errorf("Kubernetes mode requires connection.host_key, ansible_ssh_settings.user_known_hosts_file or ansible_ssh_settings.insecure_no_strict_host_key_checking")
+	}
+	return nil
+}
+
+// Cleanup does nothing, the Jobs and their secrets are deleted when each command finishes.
+func (v *KubernetesMode) Cleanup() error {
+	return nil
+}
+
+// Run executes the plays in Kubernetes Jobs.
+func (v *KubernetesMode) Run(plays []*types.Play, settings *Settings) error {
+	return v.local.Run(plays, settings)
+}
+
+// newKubernetesPackage archives the files the play reads: the playbook, roles and collections directories,
+// the variable, inventory, vault password and known hosts files and the given files and directories
+// written for the play. Directories named .git and .terraform are not archived.
+func newKubernetesPackage(play *types.Play, ansibleSSHSettings *types.AnsibleSSHSettings, paths []string) (*kubernetesPackage, error) {
+	uploads, err := playDirectoryUploads([]*types.Play{play})
+	if err != nil {
+		return nil, err
+	}
+	for _, upload := range uploads {
+		paths = append(paths, upload.path)
+	}
+	paths = append(paths, play.CollectionsPath()...)
+	paths = append(paths, play.ExtraVarsFiles()...)
+	paths = append(paths, play.ExtraVarsVaultFiles()...)
+	paths = append(paths, play.InventoryFile(), play.VaultPasswordFile(),
+		ansibleSSHSettings.UserKnownHostsFile(), ansibleSSHSettings.BastionUserKnownHostsFile())
+	for _, vaultID := range play.VaultID() {
+		_, source := types.SplitVaultID(vaultID)
+		paths = append(paths, source)
+	}
+
+	entries := make(map[string]os.FileInfo)
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		absolutePath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(absolutePath); err == nil {
+			entries[absolutePath] = info
+		}
+	}
+
+	// directories are mounted as they are, files with their parent directory:
+	mountPoints := make([]string, 0, len(entries))
+	names := make([]string, 0, len(entries))
+	for path, info := range entries {
+		names = append(names, path)
+		if info.IsDir() {
+			mountPoints = append(mountPoints, path)
+		} else {
+			mountPoints = append(mountPoints, filepath.Dir(path))
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(mountPoints)
+	mounts := make([]string, 0, len(mountPoints))
+	for _, path := range mountPoints {
+		mounted := false
+		for _, mount := range mounts {
+			if path == mount || strings.HasPrefix(path, strings.TrimSuffix(mount, "/")+"/") {
+				mounted = true
+				break
+			}
+		}
+		if !mounted {
+			if path == "/" {
+				return nil, fmt.Errorf("the root directory can not be mounted in the Job container")
+			}
+			mounts = append(mounts, path)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeKubernetesPackage(&buf, names); err != nil {
+		return nil, err
+	}
+	if buf.Len() > kubernetesPackageLimit {
+		return nil, fmt.Errorf("the files of the play are %d bytes compressed, more than the %d bytes a Kubernetes secret can hold; move large files out of the playbook directory", buf.Len(), kubernetesPackageLimit)
+	}
+	return &kubernetesPackage{archive: buf.Bytes(), mounts: mounts}, nil
+}
+
+// writeKubernetesPackage writes the files and directories as a gzip compressed tarball,
+// paths are absolute paths without the leading slash.
+func writeKubernetesPackage(w io.Writer, paths []string) error {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+	written := make(map[string]bool)
+
+	for _, root := range paths {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && path != root && (info.Name() == ".git" || info.Name() == ".terraform") {
+				return filepath.SkipDir
+			}
+			if info.Mode()&os.ModeSymlink != 0 {
+				if info, err = os.Stat(path); err != nil {
+					return err
+				}
+			}
+			if (!info.IsDir() && !info.Mode().IsRegular()) || written[path] {
+				return nil
+			}
+			written[path] = true
+			header, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			header.Name = strings.TrimPrefix(filepath.ToSlash(path), "/")
+			if info.IsDir() {
+				header.Name = header.Name + "/"
+			}
+			if err := tarWriter.WriteHeader(header); err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			_, err = io.Copy(tarWriter, file)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+// manifest returns the secret holding the package and the Job running the command. An init container
+// extracts the package to the workspace volume, the directories of the workspace are mounted in the
+// Ansible container at the same paths as on the machine running Terraform.
+func (j *kubernetesJobs) manifest(name string, command string, timeout int, pkg *kubernetesPackage) map[string]interface{} {
+	labels := map[string]interface{}{"app.kubernetes.io/managed-by": kubernetesManagedBy}
+
+	volumes := []interface{}{
+		map[string]interface{}{"name": "package", "secret": map[string]interface{}{"secretName": name}},
+		map[string]interface{}{"name": kubernetesWorkspaceVolume, "emptyDir": map[string]interface{}{}},
+	}
+	volumeMounts := make([]interface{}, 0)
+	for _, mount := range pkg.mounts {
+		volumeMounts = append(volumeMounts, map[string]interface{}{
+			"name":      kubernetesWorkspaceVolume,
+			"mountPath": mount,
+			"subPath":   strings.TrimPrefix(mount, "/"),
+		})
+	}
+	for idx, secretMount := range j.settings.SecretMounts() {
+		volumeName := fmt.Sprintf("secret-%d", idx)
+		volumes = append(volumes, map[string]interface{}{"name": volumeName, "secret": map[string]interface{}{"secretName": secretMount.SecretName()}})
+		volumeMounts = append(volumeMounts, map[string]interface{}{"name": volumeName, "mountPath": secretMount.MountPath(), "readOnly": true})
+	}
+
+	container := map[string]interface{}{
+		"name":         kubernetesContainerName,
+		"image":        j.settings.Image(),
+		"command":      []string{"/bin/sh", "-c", command},
+		"env":          []interface{}{map[string]interface{}{"name": "HOME", "value": "/tmp"}},
+		"volumeMounts": volumeMounts,
+	}
+	if workingDirectory, err := os.Getwd(); err == nil {
+		for _, mount := range pkg.mounts {
+			if workingDirectory == mount || strings.HasPrefix(workingDirectory, mount+"/") {
+				container["workingDir"] = workingDirectory
+				break
+			}
+		}
+	}
+
+	podSpec := map[string]interface{}{
+		"restartPolicy": "Never",
+		"initContainers": []interface{}{map[string]interface{}{
+			"name":    "package",
+			"image":   j.settings.Image(),
+			"command": []string{"/bin/sh", "-c", fmt.Sprintf("tar -xzf %s/%s -C %s", kubernetesPackageDirectory, kubernetesPackageKey, kubernetesWorkspacePath)},
+			"volumeMounts": []interface{}{
+				map[string]interface{}{"name": "package", "mountPath": kubernetesPackageDirectory, "readOnly": true},
+				map[string]interface{}{"name": kubernetesWorkspaceVolume, "mountPath": kubernetesWorkspacePath},
+			},
+		}},
+		"containers": []interface{}{container},
+		"volumes":    volumes,
+	}
+	if j.settings.ServiceAccount() != "" {
+		podSpec["serviceAccountName"] = j.settings.ServiceAccount()
+	}
+
+	jobSpec := map[string]interface{}{
+		"backoffLimit": 0,
+		"template": map[string]interface{}{
+			"metadata": map[string]interface{}{"labels": labels},
+			"spec":     podSpec,
+		},
+	}
+	if timeout > 0 {
+		jobSpec["activeDeadlineSeconds"] = timeout
+	}
+
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"items": []interface{}{
+			map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Secret",
+				"metadata":   map[string]interface{}{"name": name, "labels": labels},
+				"type":       "Opaque",
+				"data":       map[string]interface{}{kubernetesPackageKey: pkg.archive},
+			},
+			map[string]interface{}{
+				"apiVersion": "batch/v1",
+				"kind":       "Job",
+				"metadata":   map[string]interface{}{"name": name, "labels": labels},
+				"spec":       jobSpec,
+			},
+		},
+	}
+}
+
+// run executes the command in a new Job, writes the logs of the Ansible container to the output
+// and returns an error carrying the exit status of the command when the Job fails.
+// The Job is terminated after timeout seconds, zero means no timeout, and when the context is done.
+func (j *kubernetesJobs) run(ctx context.Context, o terraform.UIOutput, command string, timeout int, pkg *kubernetesPackage) error {
+	name := fmt.Sprintf("tf-ansible-%s", strings.Split(uuid.NewV4().String(), "-")[0])
+
+	manifest, err := json.Marshal(j.manifest(name, command, timeout, pkg))
+	if err != nil {
+		return err
+	}
+	if _, err := j.kubectl(ctx, manifest, "create", "--filename=-"); err != nil {
+		return fmt.Errorf("Kubernetes job %s could not be created: %v", name, err)
+	}
+	o.Output(fmt.Sprintf("Kubernetes job %s created in namespace %s", name, j.settings.Namespace()))
+	if j.settings.KeepJobs() {
+		o.Output(fmt.Sprintf("Kubernetes job %s and secret %s are kept", name, name))
+	} else {
+		defer func() {
+			// the Job is deleted when the run is cancelled too:
+			deleteCtx := context.WithValue(context.Background(), runOptionsKey{}, contextRunOptions(ctx))
+			if _, err := j.kubectl(deleteCtx, nil, "delete", "job/"+name, "secret/"+name, "--ignore-not-found", "--wait=false"); err != nil {
+				o.Output(fmt.Sprintf("Kubernetes job %s could not be deleted: %v", name, err))
+			}
+		}()
+	}
+
+	if err := j.streamLogs(ctx, o, name); err != nil {
+		o.Output(fmt.Sprintf("logs of Kubernetes job %s could not be read: %v", name, err))
+	}
+
+	for {
+		status, err := j.jobStatus(ctx, name)
+		if err != nil {
+			return err
+		}
+		if status.Succeeded > 0 {
+			return nil
+		}
+		if status.Failed > 0 || status.failedReason() != "" {
+			if status.failedReason() == "DeadlineExceeded" {
+				return fmt.Errorf("Kubernetes job %s exceeded the timeout of %d seconds", name, timeout)
+			}
+			if exitCode, ok := j.exitCode(ctx, name); ok {
+				return newExitStatusError(exitCode, fmt.Errorf("Kubernetes job %s failed: exit status %d", name, exitCode))
+			}
+			return fmt.Errorf("Kubernetes job %s failed: %s", name, status.failedReason())
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Kubernetes job %s: %v", name, ctx.Err())
+		case <-time.After(j.pollInterval):
+		}
+	}
+}
+
+// streamLogs follows the logs of the Ansible container until the container exits.
+func (j *kubernetesJobs) streamLogs(ctx context.Context, o terraform.UIOutput, name string) error {
+	cmd := exec.CommandContext(ctx, j.settings.Kubectl(), j.args("logs", "--follow", "job/"+name,
+		"--container="+kubernetesContainerName,
+		fmt.Sprintf("--pod-running-timeout=%ds", j.settings.PodRunningTimeout()))...)
+	cmd.Env = localCommandEnvironment(contextRunOptions(ctx))
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	copyDoneCh := make(chan struct{})
+	go func() {
+		defer close(copyDoneCh)
+		for line := range linereader.New(pr).Ch {
+			o.Output(line)
+		}
+	}()
+
+	err := cmd.Run()
+	pw.Close()
+	<-copyDoneCh
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+type kubernetesJobStatus struct {
+	Succeeded  int `json:"succeeded"`
+	Failed     int `json:"failed"`
+	Conditions []struct {
+		Type   string `json:"type"`
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	} `json:"conditions"`
+}
+
+// failedReason returns the reason of the Failed condition, empty when the Job did not fail.
+func (s *kubernetesJobStatus) failedReason() string {
+	for _, condition := range s.Conditions {
+		if condition.Type == "Failed" && condition.Status == "True" {
+			if condition.Reason == "" {
+				return "Failed"
+			}
+			return condition.Reason
+		}
+	}
+	return ""
+}
+
+func (j *kubernetesJobs) jobStatus(ctx context.Context, name string) (*kubernetesJobStatus, error) {
+	out, err := j.kubectl(ctx, nil, "get", "job/"+name, "--output=json")
+	if err != nil {
+		return nil, fmt.Errorf("status of Kubernetes job %s could not be read: %v", name, err)
+	}
+	job := struct {
+		Status *kubernetesJobStatus `json:"status"`
+	}{Status: &kubernetesJobStatus{}}
+	if err := json.Unmarshal(out, &job); err != nil {
+		return nil, fmt.Errorf("status of Kubernetes job %s could not be decoded: %v", name, err)
+	}
+	return job.Status, nil
+}
+
+// exitCode returns the exit code of the terminated Ansible container of the Job pod.
+func (j *kubernetesJobs) exitCode(ctx context.Context, name string) (int, bool) {
+	out, err := j.kubectl(ctx, nil, "get", "pods", "--selector=job-name="+name, "--output=json")
+	if err != nil {
+		return 0, false
+	}
+	pods := struct {
+		Items []struct {
+			Status struct {
+				ContainerStatuses []struct {
+					Name  string `json:"name"`
+					State struct {
+						Terminated *struct {
+							ExitCode int `json:"exitCode"`
+						} `json:"terminated"`
+					} `json:"state"`
+				} `json:"containerStatuses"`
+			} `json:"status"`
+		} `json:"items"`
+	}{}
+	if err := json.Unmarshal(out, &pods); err != nil {
+		return 0, false
+	}
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name == kubernetesContainerName && status.State.Terminated != nil {
+				return status.State.Terminated.ExitCode, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// args prepends the kubeconfig, context and namespace arguments.
+func (j *kubernetesJobs) args(args ...string) []string {
+	global := make([]string, 0)
+	if j.settings.Kubeconfig() != "" {
+		global = append(global, "--kubeconfig="+j.settings.Kubeconfig())
+	}
+	if j.settings.Context() != "" {
+		global = append(global, "--context="+j.settings.Context())
+	}
+	global = append(global, "--namespace="+j.settings.Namespace())
+	return append(global, args...)
+}
+
+// kubectl executes kubectl with the input written to its standard input and returns the standard output.
+// kubectl is started with the environment of the run and killed when the context is done.
+func (j *kubernetesJobs) kubectl(ctx context.Context, input []byte, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, j.settings.Kubectl(), j.args(args...)...)
+	cmd.Env = localCommandEnvironment(contextRunOptions(ctx))
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
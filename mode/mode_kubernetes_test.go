@@ -0,0 +1,197 @@
+package mode
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+// fakeKubectl records the arguments and the created manifest, prints the logs of a failed play
+// and reports the Job as failed with the exit status of ansible-playbook.
+const fakeKubectl = `#!/bin/sh
+dir="$(dirname "$0")"
+echo "$@" >> "$dir/calls"
+case "$*" in
+  *" create "*) cat > "$dir/manifest.json" ;;
+  *" logs "*) echo "PLAY [web] *****"; echo "fatal: [10.0.0.10]: FAILED!" ;;
+  *" get job/"*) echo '{"status": {"failed": 1, "conditions": [{"type": "Failed", "status": "True", "reason": "BackoffLimitExceeded"}]}}' ;;
+  *" get pods "*) echo '{"items": [{"status": {"containerStatuses": [{"name": "ansible", "state": {"terminated": {"exitCode": 2}}}]}}]}' ;;
+esac
+`
+
+func TestKubernetesPackage(t *testing.T) {
+	root, err := ioutil.TempDir("", "kubernetes-package")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(root)
+	for path, contents := range map[string]string{
+		"playbooks/site.yml":              "- hosts: all\n",
+		"playbooks/roles/web/tasks/a.yml": "- ping:\n",
+		"playbooks/.git/HEAD":             "ref: refs/heads/master\n",
+		"vars/web.yml":                    "port: 80\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(root, path)), 0755); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(root, path), []byte(contents), 0644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"playbook": []interface{}{map[string]interface{}{
+			"file_path": filepath.Join(root, "playbooks", "site.yml"),
+		}},
+	})
+	pkg, err := newKubernetesPackage(play, types.NewAnsibleSSHSettingsFromInterface(nil, false), []string{
+		filepath.Join(root, "vars", "web.yml"),
+		filepath.Join(root, "does-not-exist.yml"),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectedMounts := []string{filepath.Join(root, "playbooks"), filepath.Join(root, "vars")}
+	if strings.Join(pkg.mounts, ",") != strings.Join(expectedMounts, ",") {
+		t.Fatalf("Expected mounts %v but got: %v", expectedMounts, pkg.mounts)
+	}
+
+	gzipReader, err := gzip.NewReader(bytes.NewReader(pkg.archive))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	names := make([]string, 0)
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			names = append(names, "/"+header.Name)
+		}
+	}
+	sort.Strings(names)
+	expectedNames := []string{
+		filepath.Join(root, "playbooks", "roles", "web", "tasks", "a.yml"),
+		filepath.Join(root, "playbooks", "site.yml"),
+		filepath.Join(root, "vars", "web.yml"),
+	}
+	if strings.Join(names, ",") != strings.Join(expectedNames, ",") {
+		t.Fatalf("Expected the files %v in the package but got: %v", expectedNames, names)
+	}
+}
+
+func TestKubernetesJobRun(t *testing.T) {
+	root, err := ioutil.TempDir("", "kubectl")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(root)
+	binary := filepath.Join(root, "kubectl")
+	if err := ioutil.WriteFile(binary, []byte(fakeKubectl), 0755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	jobs := &kubernetesJobs{
+		settings: types.NewKubernetesSettingsFromMapInterface(map[string]interface{}{
+			"image":           "quay.io/ansible/ansible-runner:latest",
+			"namespace":       "ansible",
+			"service_account": "ansible",
+			"kubectl":         binary,
+			"secret_mounts": []interface{}{
+				map[string]interface{}{"secret_name": "ssh-keys", "mount_path": "/keys"},
+			},
+		}, true),
+		pollInterval: 10 * time.Millisecond,
+	}
+	pkg := &kubernetesPackage{archive: []byte("package"), mounts: []string{"/work/playbooks"}}
+
+	lines := make([]string, 0)
+	output := &terraform.MockUIOutput{OutputFn: func(line string) { lines = append(lines, line) }}
+	err = jobs.run(context.Background(), output, "ansible-playbook site.yml", 600, pkg)
+	if exitStatusFromError(err) != ansibleExitStatusFailed {
+		t.Fatalf("Expected the exit status of ansible-playbook but got: %v", err)
+	}
+	if !strings.Contains(strings.Join(lines, "\n"), "fatal: [10.0.0.10]: FAILED!") {
+		t.Fatalf("Expected the pod logs in the output but got: %v", lines)
+	}
+
+	calls, err := ioutil.ReadFile(filepath.Join(root, "calls"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, expected := range []string{
+		"--namespace=ansible create --filename=-",
+		"--container=ansible --pod-running-timeout=300s",
+		"--namespace=ansible delete job/tf-ansible-",
+	} {
+		if !strings.Contains(string(calls), expected) {
+			t.Fatalf("Expected '%s' in the kubectl calls but got: %s", expected, string(calls))
+		}
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(root, "manifest.json"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	manifest := struct {
+		Items []struct {
+			Kind string            `json:"kind"`
+			Data map[string][]byte `json:"data"`
+			Spec struct {
+				ActiveDeadlineSeconds int `json:"activeDeadlineSeconds"`
+				Template              struct {
+					Spec struct {
+						ServiceAccountName string `json:"serviceAccountName"`
+						Containers         []struct {
+							Command      []string `json:"command"`
+							VolumeMounts []struct {
+								MountPath string `json:"mountPath"`
+								SubPath   string `json:"subPath"`
+							} `json:"volumeMounts"`
+						} `json:"containers"`
+					} `json:"spec"`
+				} `json:"template"`
+			} `json:"spec"`
+		} `json:"items"`
+	}{}
+	if err := json.Unmarshal(contents, &manifest); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(manifest.Items) != 2 || manifest.Items[0].Kind != "Secret" || manifest.Items[1].Kind != "Job" {
+		t.Fatalf("Expected a secret and a job but got: %s", string(contents))
+	}
+	if string(manifest.Items[0].Data[kubernetesPackageKey]) != "package" {
+		t.Fatalf("Expected the package in the secret but got: %s", string(contents))
+	}
+	job := manifest.Items[1].Spec
+	if job.ActiveDeadlineSeconds != 600 || job.Template.Spec.ServiceAccountName != "ansible" {
+		t.Fatalf("Expected the timeout and the service account in the job but got: %s", string(contents))
+	}
+	container := job.Template.Spec.Containers[0]
+	if strings.Join(container.Command, " ") != "/bin/sh -c ansible-playbook site.yml" ||
+		len(container.VolumeMounts) != 2 ||
+		container.VolumeMounts[0].MountPath != "/work/playbooks" || container.VolumeMounts[0].SubPath != "work/playbooks" ||
+		container.VolumeMounts[1].MountPath != "/keys" {
+		t.Fatalf("Expected the command and the mounts in the job container but got: %s", string(contents))
+	}
+}
@@ -2,17 +2,17 @@ package mode
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"text/template"
 	"time"
 
+	"github.com/radekg/terraform-provisioner-ansible/events"
 	"github.com/radekg/terraform-provisioner-ansible/types"
-	uuid "github.com/satori/go.uuid"
 
-	localExec "github.com/hashicorp/terraform/builtin/provisioners/local-exec"
 	"github.com/hashicorp/terraform/terraform"
 )
 
@@ -25,6 +25,13 @@ type LocalModeByType struct {
 type LocalMode struct {
 	o        terraform.UIOutput
 	connInfo *connectionInfo
+	jobs     *kubernetesJobs
+	// workDirectory holds the temporary files of a run, empty for the system temporary directory.
+	workDirectory string
+	// printOnly keeps the temporary files, private keys and passwords are written as placeholders.
+	printOnly bool
+	// logLevel is how much of the provisioner messages is written, empty for info.
+	logLevel string
 }
 
 type inventoryTemplateLocalDataHost struct {
@@ -37,69 +44,6 @@ type inventoryTemplateLocalData struct {
 	Groups []string
 }
 
-type windowsInventoryTemplateLocalDataHost struct {
-	AnsibleHost    string
-	ConnectionType string
-	Username       string
-	Password       string
-	Port           int
-	NTLM           bool
-	Cacert         string
-}
-
-type windowsInventoryTemplateLocalData struct {
-	Windows []windowsInventoryTemplateLocalDataHost
-}
-
-const windowsInventoryTemplateLocal = `{{$top := . -}}
-[windows]
-{{range .Windows -}}
-{{if ne .AnsibleHost "" -}}
-{{" "}}{{.AnsibleHost -}}
-{{end -}}
-{{printf "\n" -}}
-
-[windows:vars]
-{{if ne .Username "" -}}
-{{" "}}ansible_user={{.Username -}}
-{{printf "\n" -}}
-{{end -}}
-
-{{if ne .Password "" -}}
-{{" "}}ansible_password={{.Password -}}
-{{end -}}
-
-{{if ne .Port 0 }}
-{{" "}}ansible_port={{.Port -}}
-{{printf "\n" -}}
-{{end -}}
-
-{{if ne .ConnectionType "" -}}
-{{" "}}ansible_connection={{.ConnectionType -}}
-{{printf "\n" -}}
-{{end -}}
-
-{{if .NTLM }}
-{{" "}}ansible_winrm_transport={{.NTLM -}}
-{{printf "\n" -}}
-{{end -}}
-
-{{if eq .Cacert "" -}}
-{{" "}}ansible_winrm_server_cert_validation=ignore
-{{printf "\n" -}}
-{{end -}}
-
-{{" "}}ansible_winrm_read_timeout_sec=900
-{{" "}}ansible_winrm_operation_timeout_sec=800
-{{printf "\n" -}}
-
-{{if ne .Cacert "" -}}
-{{" "}}ansible_winrm_ca_trust_path={{.Cacert -}}
-{{printf "\n" -}}
-{{end -}}
-
-{{end}}`
-
 const inventoryTemplateLocal = `{{$top := . -}}
 {{range .Hosts -}}
 {{.Alias -}}
@@ -121,8 +65,6 @@ const inventoryTemplateLocal = `{{$top := . -}}
 
 {{end}}`
 
-const moduleCommand = `ansible all -i in -m wait_for_connection -c 'timeout=600'`
-
 // NewLocalMode returns configured local mode provisioner.
 func NewLocalMode(o terraform.UIOutput, s *terraform.InstanceState) (*LocalMode, error) {
 
@@ -153,17 +95,73 @@ func (v *LocalMode) ComputeResource() bool {
 	}
 }
 
-// Run executes local provisioning process.
-func (v *LocalMode) Run(plays []*types.Play, ansibleSSHSettings *types.AnsibleSSHSettings) error {
-
-	// Validate config for null_resource
-	compute_resource := v.ComputeResource()
-	if !compute_resource {
+// Validate checks that every play of a null_resource names its hosts and the WSL settings.
+func (v *LocalMode) Validate(plays []*types.Play, settings *Settings) error {
+	if !v.ComputeResource() {
 		for _, play := range plays {
-			if len(play.Hosts()) == 0 && play.InventoryFile() == "" {
+			if len(play.Hosts()) == 0 && len(settings.WindowsSettings.Hosts()) == 0 && play.InventoryFile() == "" {
 				return fmt.Errorf("Hosts or Inventory file must be specified on each plays attribute when using null_resource")
 			}
 		}
+	}
+	return settings.WSL.Validate()
+}
+
+// Cleanup does nothing, the temporary files of a play are removed when the play finishes.
+func (v *LocalMode) Cleanup() error {
+	return nil
+}
+
+// Run executes local provisioning process.
+func (v *LocalMode) Run(plays []*types.Play, modeSettings *Settings) error {
+
+	ansibleSSHSettings := modeSettings.AnsibleSSHSettings
+	options := modeSettings.RunOptions
+
+	v.logLevel = options.LogLevel
+
+	closeWorkDirectory, err := v.openWorkDirectory(options)
+	if err != nil {
+		return err
+	}
+	defer closeWorkDirectory()
+
+	// every step of the run ends when the run is cancelled or times out:
+	ctx := options.runContext()
+
+	// vault passwords from a command or the environment are written to temporary files
+	// before the output is masked, the secrets of the plays include the written passwords:
+	materialized := make([]*types.Play, 0)
+	for _, play := range plays {
+		vaultPasswordFile, err := materializeVaultPassword(ctx, play, v.workDirectory)
+		if err != nil {
+			return err
+		}
+		if vaultPasswordFile != "" {
+			play.SetOverrideVaultPasswordPath(vaultPasswordFile)
+			defer v.removeTemporary(removeSecretFile, vaultPasswordFile)
+			materialized = append(materialized, play)
+		}
+	}
+
+	v.o = newMaskingOutput(v.o, playSecrets(plays))
+	// the host key scans are internal details:
+	debug := v.log(v.o, types.LogLevelDebug)
+
+	if v.printOnly {
+		// the kept files hold the placeholder, not the password:
+		for _, play := range materialized {
+			removeSecretFile(play.VaultPasswordFile())
+			vaultPasswordFile, err := writeTempFile(v.workDirectory, "", []byte(printOnlyPlaceholder), 0400)
+			if err != nil {
+				return err
+			}
+			play.SetOverrideVaultPasswordPath(vaultPasswordFile)
+		}
+	}
+
+	compute_resource := v.ComputeResource()
+	if !compute_resource {
 		// Force StrictHostKeyChecking=no for null_resource
 		ansibleSSHSettings.SetOverrideStrictHostKeyChecking()
 	}
@@ -171,21 +169,21 @@ func (v *LocalMode) Run(plays []*types.Play, ansibleSSHSettings *types.AnsibleSS
 	bastionPemFile := ""
 	if v.connInfo.BastionPrivateKey != "" {
 		var err error
-		bastionPemFile, err = v.writePem(v.connInfo.BastionPrivateKey)
+		bastionPemFile, err = v.writePem(v.secret(v.connInfo.BastionPrivateKey))
 		if err != nil {
 			return err
 		}
-		defer os.Remove(bastionPemFile)
+		defer v.removeTemporary(removeSecretFile, bastionPemFile)
 	}
 
 	targetPemFile := ""
 	if v.connInfo.PrivateKey != "" {
 		var err error
-		targetPemFile, err = v.writePem(v.connInfo.PrivateKey)
+		targetPemFile, err = v.writePem(v.secret(v.connInfo.PrivateKey))
 		if err != nil {
 			return err
 		}
-		defer os.Remove(targetPemFile)
+		defer v.removeTemporary(removeSecretFile, targetPemFile)
 	}
 
 	cacertPemFile := ""
@@ -195,7 +193,7 @@ func (v *LocalMode) Run(plays []*types.Play, ansibleSSHSettings *types.AnsibleSS
 		if err != nil {
 			return err
 		}
-		defer os.Remove(cacertPemFile)
+		defer v.removeTemporary(removeSecretFile, cacertPemFile)
 	}
 
 	v.connInfo.Cacert = cacertPemFile
@@ -208,7 +206,7 @@ func (v *LocalMode) Run(plays []*types.Play, ansibleSSHSettings *types.AnsibleSS
 
 	if bastion.inUse() {
 		// wait for bastion:
-		sshClient, err := bastion.connect()
+		sshClient, err := bastion.connect(ctx)
 		if err != nil {
 			return err
 		}
@@ -216,15 +214,15 @@ func (v *LocalMode) Run(plays []*types.Play, ansibleSSHSettings *types.AnsibleSS
 		if !ansibleSSHSettings.InsecureNoStrictHostKeyChecking() {
 			if ansibleSSHSettings.UserKnownHostsFile() == "" {
 				if target.hostKey() == "" {
-					v.o.Output(fmt.Sprintf("Host key not given, executing ssh-keyscan on bastion: %s@%s:%d",
+					debug.Output(fmt.Sprintf("Host key not given, executing ssh-keyscan on bastion: %s@%s:%d",
 						bastion.user(),
 						bastion.host(),
 						bastion.port()))
-					targetKnownHosts, err := newBastionKeyScan(v.o,
+					targetKnownHosts, err := newBastionKeyScan(debug,
 						sshClient,
 						target.host(),
 						target.port(),
-						ansibleSSHSettings.SSHKeyscanSeconds()).scan()
+						ansibleSSHSettings.SSHKeyscanSeconds()).scan(ctx)
 					if err != nil {
 						return err
 					}
@@ -237,7 +235,7 @@ func (v *LocalMode) Run(plays []*types.Play, ansibleSSHSettings *types.AnsibleSS
 					knownHostsTarget = append(knownHostsTarget, fmt.Sprintf("%s %s", target.host(), target.hostKey()))
 				}
 			} else {
-				v.o.Output(fmt.Sprintf("bastion %s@%s:%d will use '%s' as a user known hosts file",
+				debug.Output(fmt.Sprintf("bastion %s@%s:%d will use '%s' as a user known hosts file",
 					bastion.user(),
 					bastion.host(),
 					bastion.port(),
@@ -245,7 +243,7 @@ func (v *LocalMode) Run(plays []*types.Play, ansibleSSHSettings *types.AnsibleSS
 			}
 
 		} else {
-			v.o.Output(fmt.Sprintf("target host StrictHostKeyChecking=no, not verifying host keys on bastion: %s@%s:%d",
+			debug.Output(fmt.Sprintf("target host StrictHostKeyChecking=no, not verifying host keys on bastion: %s@%s:%d",
 				bastion.user(),
 				bastion.host(),
 				bastion.port()))
@@ -253,32 +251,28 @@ func (v *LocalMode) Run(plays []*types.Play, ansibleSSHSettings *types.AnsibleSS
 		knownHostsBastion = append(knownHostsBastion, fmt.Sprintf("%s %s", bastion.host(), bastion.hostKey()))
 	} else if v.connInfo.Type != "winrm" {
 		if !ansibleSSHSettings.InsecureNoStrictHostKeyChecking() {
-			v.o.Output(fmt.Sprintf("InsecureNoStrictHostKeyChecking false"))
+			debug.Output(fmt.Sprintf("InsecureNoStrictHostKeyChecking false"))
 			if compute_resource {
 				if ansibleSSHSettings.UserKnownHostsFile() == "" {
 					if target.hostKey() == "" {
-						v.o.Output(fmt.Sprintf("host key for '%s' not passed", target.host()))
+						debug.Output(fmt.Sprintf("host key for '%s' not passed", target.host()))
 						// fetchHostKey will issue an ssh Dial and update the hostKey() value
 						// as with bastionKeyScan, we might ask for the host key while the instance
 						// is not ready to respond to SSH, we need to retry for a number of times
-						timeoutMs := ansibleSSHSettings.SSHKeyscanSeconds() * 1000
-						timeSpentMs := 0
-						intervalMs := 5000
-
-						for {
-							if err := target.fetchHostKey(); err != nil {
-								v.o.Output(fmt.Sprintf("host key for '%s' not received yet; retrying...", target.host()))
-								time.Sleep(time.Duration(intervalMs) * time.Millisecond)
-								timeSpentMs = timeSpentMs + intervalMs
-								if timeSpentMs > timeoutMs {
-									v.o.Output(fmt.Sprintf("host key for '%s' not received within %d seconds",
-										target.host(),
-										ansibleSSHSettings.SSHKeyscanSeconds()))
-									return err
-								}
-							} else {
-								break
+						scanCtx, cancel := context.WithTimeout(ctx, time.Duration(ansibleSSHSettings.SSHKeyscanSeconds())*time.Second)
+						err := retryContext(scanCtx, keyscanRetryInterval, func() error {
+							err := target.fetchHostKey(scanCtx)
+							if err != nil {
+								debug.Output(fmt.Sprintf("host key for '%s' not received yet; retrying...", target.host()))
 							}
+							return err
+						})
+						cancel()
+						if err != nil {
+							v.o.Output(fmt.Sprintf("host key for '%s' not received within %d seconds",
+								target.host(),
+								ansibleSSHSettings.SSHKeyscanSeconds()))
+							return err
 						}
 						if target.hostKey() == "" {
 							return fmt.Errorf("expected to receive the host key for '%s', but no host key arrived", target.host())
@@ -286,81 +280,384 @@ func (v *LocalMode) Run(plays []*types.Play, ansibleSSHSettings *types.AnsibleSS
 					}
 					knownHostsTarget = append(knownHostsTarget, fmt.Sprintf("%s %s", target.host(), target.hostKey()))
 				} else {
-					v.o.Output(fmt.Sprintf("using '%s' as a known hosts file", ansibleSSHSettings.UserKnownHostsFile()))
+					debug.Output(fmt.Sprintf("using '%s' as a known hosts file", ansibleSSHSettings.UserKnownHostsFile()))
 				}
 			} else {
-				v.o.Output("null_resource, not verifying host keys")
+				debug.Output("null_resource, not verifying host keys")
 				// StrictHostKeyChecking=no set during play execution
 			}
 		} else {
-			v.o.Output("StrictHostKeyChecking=no specified or set for null_resource, not verifying host keys")
+			debug.Output("StrictHostKeyChecking=no specified or set for null_resource, not verifying host keys")
 		}
 	}
 
-	knownHostsFileBastion, err := v.writeKnownHosts(knownHostsBastion)
+	settings := &localRunSettings{
+		ansibleSSHSettings:   ansibleSSHSettings,
+		windowsSettings:      modeSettings.WindowsSettings,
+		bastion:              bastion,
+		bastionPemFile:       bastionPemFile,
+		targetPemFile:        targetPemFile,
+		knownHostsBastion:    knownHostsBastion,
+		knownHostsTarget:     knownHostsTarget,
+		planOnly:             options.PlanOnly,
+		hashStore:            newPlayHashStore(options.HashDirectory),
+		artifactDirectory:    options.ArtifactDirectory,
+		executor:             options.Executor,
+		executionEnvironment: modeSettings.ExecutionEnvironment,
+		wsl:                  modeSettings.WSL,
+		ctx:                  ctx,
+		versionCheck:         newAnsibleVersionCheck(options),
+	}
+
+	nodes, err := newPlayGraph(plays)
 	if err != nil {
 		return err
 	}
-	defer os.Remove(knownHostsFileBastion)
 
-	knownHostsFileTarget, err := v.writeKnownHosts(knownHostsTarget)
+	return v.runPlayGraph(nodes, settings, options.MaxParallel)
+}
+
+// localRunSettings holds the connection details shared by all plays of a local provisioner run.
+type localRunSettings struct {
+	ansibleSSHSettings   *types.AnsibleSSHSettings
+	windowsSettings      *types.WindowsSettings
+	bastion              *bastionHost
+	bastionPemFile       string
+	targetPemFile        string
+	knownHostsBastion    []string
+	knownHostsTarget     []string
+	planOnly             bool
+	hashStore            *playHashStore
+	artifactDirectory    string
+	executor             string
+	executionEnvironment *types.ExecutionEnvironment
+	wsl                  *types.WSLSettings
+	ctx                  context.Context
+	versionCheck         *ansibleVersionCheck
+}
+
+// runPlay executes a single play. Every play gets its own temporary files,
+// these are removed when the play finishes.
+func (v *LocalMode) runPlay(o terraform.UIOutput, play *types.Play, settings *localRunSettings) error {
+
+	heartbeat := newHeartbeatOutput(o, play)
+	defer heartbeat.stop()
+	o = heartbeat
+
+	hashKey := playHashKey(v.connInfo.Host, play)
+
+	sourceDir, err := preparePlaybookSource(o, play, v.workDirectory)
 	if err != nil {
 		return err
 	}
-	defer os.Remove(knownHostsFileTarget)
+	if sourceDir != "" {
+		defer v.removeTemporary(os.RemoveAll, sourceDir)
+	}
 
-	for _, play := range plays {
+	templatesDir, err := renderPlayTemplates(o, play, v.workDirectory)
+	if err != nil {
+		return err
+	}
+	if templatesDir != "" {
+		defer v.removeTemporary(os.RemoveAll, templatesDir)
+	}
+
+	unchanged, inputsHash, err := checkUnchangedPlay(o, settings.hashStore, hashKey, play)
+	if err != nil {
+		return err
+	}
+	if unchanged {
+		v.log(o, types.LogLevelInfo).Output("inputs of the play did not change since the last successful run, skipping the play")
+		return nil
+	}
+
+	if err := prepareModuleTree(o, play, settings.artifactDirectory); err != nil {
+		return err
+	}
+
+	knownHostsFileBastion, err := v.writeKnownHosts(settings.knownHostsBastion)
+	if err != nil {
+		return err
+	}
+	defer v.removeTemporary(os.Remove, knownHostsFileBastion)
+
+	knownHostsFileTarget, err := v.writeKnownHosts(settings.knownHostsTarget)
+	if err != nil {
+		return err
+	}
+	defer v.removeTemporary(os.Remove, knownHostsFileTarget)
+
+	inventoryFile, err := v.writeInventory(play, settings.windowsSettings)
+	if err != nil {
+		o.Output(fmt.Sprintf("%+v", err))
+		return err
+	}
+
+	if inventoryFile != play.InventoryFile() {
+		play.SetOverrideInventoryFile(inventoryFile)
+		defer v.removeTemporary(removeSecretFile, play.InventoryFile())
+	}
+
+	if contents := play.AnsibleCfgContents(); contents != "" {
+		ansibleCfgFile, err := v.writeAnsibleCfg(contents)
+		if err != nil {
+			return err
+		}
+		play.SetAnsibleCfgFile(ansibleCfgFile)
+		defer v.removeTemporary(os.Remove, ansibleCfgFile)
+	}
+
+	if play.Become() && play.BecomePassword() != "" {
+		becomePasswordFile, err := v.writeBecomePassword(v.secret(play.BecomePassword()))
+		if err != nil {
+			return err
+		}
+		play.SetBecomePasswordFile(becomePasswordFile)
+		defer v.removeTemporary(removeSecretFile, becomePasswordFile)
+	}
+
+	if err := checkVaultVarsFiles(play); err != nil {
+		return err
+	}
+
+	extraVars, err := play.ExtraVarsContents()
+	if err != nil {
+		return err
+	}
+	if len(extraVars) > 0 {
+		extraVarsFile, err := v.writeExtraVars(extraVars)
+		if err != nil {
+			return err
+		}
+		play.SetExtraVarsFile(extraVarsFile)
+		defer v.removeTemporary(removeSecretFile, extraVarsFile)
+	}
+
+	// we can't pass bastion instance into this function
+	// we would end up with a circular import
+	ansibleArgs := types.LocalModeAnsibleArgs{
+		Username:              v.connInfo.User,
+		Port:                  v.connInfo.Port,
+		PemFile:               settings.targetPemFile,
+		KnownHostsFile:        knownHostsFileTarget,
+		BastionKnownHostsFile: knownHostsFileBastion,
+		BastionHost:           settings.bastion.host(),
+		BastionPemFile:        settings.bastionPemFile,
+		BastionPort:           settings.bastion.port(),
+		BastionUsername:       settings.bastion.user(),
+	}
+
+	command, err := play.ToLocalCommands(ansibleArgs, settings.ansibleSSHSettings)
+
+	if err != nil {
+		return err
+	}
 
-		if !play.Enabled() {
-			continue
+	// Ansible commands run in the execution environment container when one is configured:
+	containerize := func(command types.Commands) types.Commands {
+		return command
+	}
+	if settings.executionEnvironment.IsInUse() {
+		var mounts, writableMounts []string
+		if settings.executionEnvironment.ReadOnly() {
+			// run_in_docker mounts the inputs of the play only, the artifacts are written:
+			var artifacts string
+			mounts, artifacts, err = dockerPlayDirectories(play, settings.ansibleSSHSettings, settings.artifactDirectory, v.workDirectory)
+			writableMounts = []string{artifacts}
+		} else {
+			mounts, err = localPlayDirectories(play, settings.ansibleSSHSettings, settings.artifactDirectory, v.workDirectory)
+		}
+		if err != nil {
+			return err
+		}
+		containerize = func(command types.Commands) types.Commands {
+			return localContainerCommand(command, settings.executionEnvironment, mounts, writableMounts)
 		}
+	}
 
-		inventoryFile, err := v.writeInventory(play)
+	// and in Kubernetes Jobs in Kubernetes mode:
+	runAnsibleCommand := func(o terraform.UIOutput, command types.Commands) error {
+		return runLocalCommands(settings.ctx, o, command, 0)
+	}
+	runAnsiblePlayCommand := func(o terraform.UIOutput, play *types.Play, command types.Commands) error {
+		return runPlayCommand(settings.ctx, o, play, command)
+	}
+	if v.jobs != nil {
+		pkg, err := newKubernetesPackage(play, settings.ansibleSSHSettings, []string{
+			settings.targetPemFile, v.connInfo.Cacert, knownHostsFileTarget, knownHostsFileBastion,
+			play.AnsibleCfgFile(), play.BecomePasswordFile(), play.ExtraVarsFile(), sourceDir, templatesDir,
+		})
 		if err != nil {
-			v.o.Output(fmt.Sprintf("%+v", err))
 			return err
 		}
+		runAnsibleCommand = func(o terraform.UIOutput, command types.Commands) error {
+			return v.jobs.run(settings.ctx, o, command.String(), 0, pkg)
+		}
+		runAnsiblePlayCommand = func(o terraform.UIOutput, play *types.Play, command types.Commands) error {
+			return v.jobs.run(settings.ctx, o, command.String(), play.Timeout(), pkg)
+		}
+	}
+	// and in WSL or bash.exe when Terraform runs on Windows:
+	if settings.wsl.IsInUse() {
+		directories, err := localPlayDirectories(play, settings.ansibleSSHSettings, settings.artifactDirectory, v.workDirectory)
+		if err != nil {
+			return err
+		}
+		shell := newWSLShell(settings.wsl, directories, []string{settings.targetPemFile, settings.bastionPemFile})
+		runAnsibleCommand = func(o terraform.UIOutput, command types.Commands) error {
+			return shell.run(settings.ctx, o, command.String(), 0)
+		}
+		runAnsiblePlayCommand = func(o terraform.UIOutput, play *types.Play, command types.Commands) error {
+			return shell.run(settings.ctx, o, command.String(), time.Duration(play.Timeout())*time.Second)
+		}
+	}
+
+	if v.printOnly {
+		if play.SyntaxCheck() {
+			if syntaxCheckCommand := play.ToSyntaxCheckCommands(command); syntaxCheckCommand != nil {
+				printCommand(o, "syntax check", containerize(syntaxCheckCommand).String())
+			}
+		}
+		if preflight := v.playPreflight(play); preflight != nil && preflight.Enabled() {
+			printCommand(o, "pre-flight module", containerize(types.Commands{play.ToLocalPreflightCommand(preflight, ansibleArgs, settings.ansibleSSHSettings)}).String())
+		}
+		printCommand(o, "play", containerize(command).String())
+		if play.FactsOutputFile() != "" {
+			tree, err := newFactsTree(settings.artifactDirectory)
+			if err != nil {
+				return err
+			}
+			printCommand(o, "facts", containerize(types.Commands{play.ToLocalFactsCommand(tree, ansibleArgs, settings.ansibleSSHSettings)}).String())
+		}
+		return nil
+	}
 
-		if inventoryFile != play.InventoryFile() {
-			play.SetOverrideInventoryFile(inventoryFile)
-			defer os.Remove(play.InventoryFile())
+	// the version is read where the plays run, in the container, the Job or WSL:
+	versionCommand := containerize(types.Commands{play.ToVersionCommand()})
+	if err := settings.versionCheck.check(o, versionCommand.String(), func() (string, error) {
+		var version bytes.Buffer
+		if err := runAnsibleCommand(newCapturingOutput(o, &version), versionCommand); err != nil {
+			return "", err
 		}
+		return parseAnsibleVersion(version.String())
+	}); err != nil {
+		return err
+	}
+
+	if settings.planOnly {
+		return runPlan(o, play, command, func(planCommand types.Commands) error {
+			return runAnsibleCommand(o, containerize(planCommand))
+		})
+	}
+
+	if err := runBeforeHooks(settings.ctx, o, play); err != nil {
+		return err
+	}
 
-		if v.connInfo.Type == "winrm" {
-			//This is for executing module to to verify windows services are
-			//avaible before executing ansible playbook
-			executeCommand := strings.Replace(moduleCommand, "in", inventoryFile, 1)
-			v.o.Output(fmt.Sprintf("running module to verify windows machine availble: %s", executeCommand))
+	if err := runLint(settings.ctx, o, play); err != nil {
+		return err
+	}
 
-			if err := v.runCommand(executeCommand); err != nil {
+	if play.SyntaxCheck() {
+		if syntaxCheckCommand := play.ToSyntaxCheckCommands(command); syntaxCheckCommand != nil {
+			syntaxCheckCommand = containerize(syntaxCheckCommand)
+			v.log(o, types.LogLevelInfo).Output(fmt.Sprintf("running syntax check: %s", syntaxCheckCommand))
+			if err := runAnsibleCommand(o, syntaxCheckCommand); err != nil {
+				return fmt.Errorf("playbook syntax check failed: %v", err)
+			}
+		}
+	}
+
+	if preflight := v.playPreflight(play); preflight != nil && preflight.Enabled() {
+		preflightCommand := containerize(types.Commands{play.ToLocalPreflightCommand(preflight, ansibleArgs, settings.ansibleSSHSettings)})
+		v.log(o, types.LogLevelInfo).Output(fmt.Sprintf("running pre-flight module: %s", preflightCommand))
+		if err := runAnsibleCommand(o, preflightCommand); err != nil {
+			return err
+		}
+	}
+
+	command = containerize(command)
+	runCommand := func(o terraform.UIOutput) error {
+		return runAnsiblePlayCommand(o, play, command)
+	}
+	if settings.executor == types.ExecutorAnsibleRunner {
+		if _, ok := play.Entity().(*types.Playbook); ok {
+			runner, err := newAnsibleRunner(play, settings.artifactDirectory, v.workDirectory)
+			if err != nil {
 				return err
 			}
+			defer runner.cleanup()
+			runner.runCommand = runAnsibleCommand
+			runnerCommand, err := play.ToLocalRunnerCommand(ansibleArgs, settings.ansibleSSHSettings, runner.args())
+			if err != nil {
+				return err
+			}
+			command = containerize(types.Commands{runnerCommand})
+			runCommand = func(o terraform.UIOutput) error {
+				return runner.run(o, play, command)
+			}
+		} else {
+			v.log(o, types.LogLevelInfo).Output("ansible-runner executes playbook plays only, running the play with the Ansible command line")
 		}
-		// we can't pass bastion instance into this function
-		// we would end up with a circular import
-		command, err := play.ToLocalCommand(types.LocalModeAnsibleArgs{
-			Username:              v.connInfo.User,
-			Port:                  v.connInfo.Port,
-			PemFile:               targetPemFile,
-			KnownHostsFile:        knownHostsFileTarget,
-			BastionKnownHostsFile: knownHostsFileBastion,
-			BastionHost:           bastion.host(),
-			BastionPemFile:        bastionPemFile,
-			BastionPort:           bastion.port(),
-			BastionUsername:       bastion.user(),
-		}, ansibleSSHSettings)
+	}
+
+	v.log(o, types.LogLevelInfo).Output(fmt.Sprintf("running local command: %s", command))
+
+	runOnce := func() (events.Stats, error) {
+		recap := newRecapOutput(o)
+		var err error
+		if play.Diff() && play.DiffOutputFile() != "" {
+			err = v.runCommandCapturing(recap, play, settings.artifactDirectory, runCommand)
+		} else {
+			err = runCommand(recap)
+		}
+		summarizeTaskDurations(o, play, recap.Result())
+		return recap.Recap(), evaluatePlayResult(o, play, err, recap.Result())
+	}
 
+	playErr := runWithRetries(settings.ctx, o, play, func() error {
+		recap, err := runOnce()
 		if err != nil {
 			return err
 		}
-		v.o.Output(fmt.Sprintf("running local command: %s", command))
+		return assertNoChanges(o, play, recap, runOnce)
+	})
 
-		if err := v.runCommand(command); err != nil {
+	playErr = runOnFailurePlay(o, play, playErr, func(rollback *types.Play) error {
+		rollbackCommand, err := rollback.ToLocalCommands(ansibleArgs, settings.ansibleSSHSettings)
+		if err != nil {
 			return err
 		}
+		return runAnsiblePlayCommand(o, rollback, containerize(rollbackCommand))
+	})
+
+	// the facts are written before the after hooks, these may read the file:
+	if playErr == nil && play.FactsOutputFile() != "" {
+		playErr = v.gatherFacts(o, play, settings.artifactDirectory, func(tree string) types.Commands {
+			return containerize(types.Commands{play.ToLocalFactsCommand(tree, ansibleArgs, settings.ansibleSSHSettings)})
+		}, runAnsibleCommand)
 	}
 
-	return nil
+	if err := runAfterHooks(settings.ctx, o, play, playErr); err != nil {
+		return err
+	}
+	return settings.hashStore.Store(hashKey, inputsHash)
+}
+
+// log returns the output of the provisioner messages of the level.
+func (v *LocalMode) log(o terraform.UIOutput, level string) terraform.UIOutput {
+	return levelOutput(o, v.logLevel, level)
+}
+
+// playPreflight returns the pre-flight module of the play, nil when not configured.
+func (v *LocalMode) playPreflight(play *types.Play) *types.Preflight {
+	preflight := play.Preflight()
+	if preflight == nil && v.connInfo.Type == "winrm" {
+		// Windows services may not be available right after the WinRM listener comes up,
+		// always verify the availability unless configured otherwise:
+		preflight = types.NewDefaultPreflight()
+	}
+	return preflight
 }
 
 func (v *LocalMode) writeKnownHosts(knownHosts []string) (string, error) {
@@ -369,53 +666,64 @@ func (v *LocalMode) writeKnownHosts(knownHosts []string) (string, error) {
 		trimmedKnownHosts = append(trimmedKnownHosts, strings.TrimSpace(entry))
 	}
 	knownHostsFileContents := strings.Join(trimmedKnownHosts, "\n")
-	file, err := ioutil.TempFile(os.TempDir(), uuid.NewV4().String())
-	defer file.Close()
-	if err != nil {
-		return "", err
-	}
-	v.o.Output(fmt.Sprintf("Write known hosts %s\n", knownHostsFileContents))
-	if err := ioutil.WriteFile(file.Name(), []byte(fmt.Sprintf("%s\n", knownHostsFileContents)), 0644); err != nil {
-		return "", err
-	}
-	return file.Name(), nil
+	v.log(v.o, types.LogLevelDebug).Output(fmt.Sprintf("Write known hosts %s\n", knownHostsFileContents))
+	return writeTempFile(v.workDirectory, "", []byte(fmt.Sprintf("%s\n", knownHostsFileContents)), 0600)
 }
 
 func (v *LocalMode) writePem(pk string) (string, error) {
 	if pk != "" {
-		file, err := ioutil.TempFile(os.TempDir(), uuid.NewV4().String())
-		defer file.Close()
+		file, err := writeTempFile(v.workDirectory, "", []byte(pk), 0400)
 		if err != nil {
 			return "", err
 		}
+		v.log(v.o, types.LogLevelDebug).Output(fmt.Sprintf("Writing temprary PEM to '%s'...", file))
+		v.log(v.o, types.LogLevelDebug).Output("Ansible inventory written.")
+		return file, nil
+	}
+	return "", nil
+}
 
-		v.o.Output(fmt.Sprintf("Writing temprary PEM to '%s'...", file.Name()))
-		if err := ioutil.WriteFile(file.Name(), []byte(pk), 0400); err != nil {
-			return "", err
-		}
+func (v *LocalMode) writeAnsibleCfg(contents string) (string, error) {
+	file, err := writeTempFile(v.workDirectory, "*.cfg", []byte(contents), 0600)
+	if err != nil {
+		return "", err
+	}
+	v.log(v.o, types.LogLevelDebug).Output(fmt.Sprintf("Writing temporary ansible.cfg to '%s'...", file))
+	return file, nil
+}
 
-		v.o.Output("Ansible inventory written.")
-		return file.Name(), nil
+func (v *LocalMode) writeBecomePassword(password string) (string, error) {
+	file, err := writeTempFile(v.workDirectory, "", []byte(password), 0400)
+	if err != nil {
+		return "", err
 	}
-	return "", nil
+	v.log(v.o, types.LogLevelDebug).Output(fmt.Sprintf("Writing temporary become password file to '%s'...", file))
+	return file, nil
+}
+
+func (v *LocalMode) writeExtraVars(contents []byte) (string, error) {
+	file, err := writeTempFile(v.workDirectory, "*.json", contents, 0400)
+	if err != nil {
+		return "", err
+	}
+	v.log(v.o, types.LogLevelDebug).Output(fmt.Sprintf("Writing temporary extra vars file to '%s'...", file))
+	return file, nil
 }
 
-func (v *LocalMode) writeInventory(play *types.Play) (string, error) {
+func (v *LocalMode) writeInventory(play *types.Play, windowsSettings *types.WindowsSettings) (string, error) {
 	if play.InventoryFile() == "" {
 		var buf bytes.Buffer
-		var templateData inventoryTemplateLocalData
 
-		//winrm struct
-		windowsTemplateData := &windowsInventoryTemplateLocalData{
-			Windows: make([]windowsInventoryTemplateLocalDataHost, 0),
-		}
-
-		//ssh struct
-		templateData = inventoryTemplateLocalData{
-			Hosts:  make([]inventoryTemplateLocalDataHost, 0),
-			Groups: play.Groups(),
-		}
-		if v.connInfo.Type == "ssh" {
+		if v.connInfo.Type == "winrm" || windowsSettings.IsWindowsOverSSH() {
+			err := newWindowsInventoryTemplate().Execute(&buf, v.windowsInventoryTemplateData(play, windowsSettings))
+			if err != nil {
+				return "", fmt.Errorf("Error executing 'windows' template: %s", err)
+			}
+		} else {
+			templateData := inventoryTemplateLocalData{
+				Hosts:  make([]inventoryTemplateLocalDataHost, 0),
+				Groups: play.Groups(),
+			}
 			playHosts := play.Hosts()
 			if v.connInfo.Host != "" {
 				if len(playHosts) > 0 {
@@ -446,73 +754,49 @@ func (v *LocalMode) writeInventory(play *types.Play) (string, error) {
 				}
 
 			}
-		} else if v.connInfo.Type == "winrm" {
-			windowsTemplateData.Windows = append(windowsTemplateData.Windows, windowsInventoryTemplateLocalDataHost{
-				AnsibleHost:    v.connInfo.Host,
-				Username:       v.connInfo.User,
-				Password:       v.connInfo.Password,
-				Port:           v.connInfo.Port,
-				ConnectionType: v.connInfo.Type,
-				NTLM:           v.connInfo.Ntlm,
-				Cacert:         v.connInfo.Cacert,
-			})
-		}
-		var t *template.Template
-		if v.connInfo.Type == "ssh" {
-			t = template.Must(template.New("hosts").Parse(inventoryTemplateLocal))
+			t := template.Must(template.New("hosts").Parse(inventoryTemplateLocal))
 			err := t.Execute(&buf, templateData)
 			if err != nil {
-				fmt.Errorf("Error executing 'linux' template: ", err)
-			}
-		} else if v.connInfo.Type == "winrm" {
-			t = template.Must(template.New("Windows").Parse(windowsInventoryTemplateLocal))
-			err := t.Execute(&buf, windowsTemplateData)
-			if err != nil {
-				fmt.Errorf("Error executing 'windows' template: ", err)
+				return "", fmt.Errorf("Error executing 'linux' template: %s", err)
 			}
 		}
 
-		file, err := ioutil.TempFile(os.TempDir(), "temporary-ansible-inventory")
-		defer file.Close()
+		// a Windows inventory holds the passwords:
+		file, err := writeTempFile(v.workDirectory, "temporary-ansible-inventory*", buf.Bytes(), 0600)
 		if err != nil {
 			return "", err
 		}
-		v.o.Output(fmt.Sprintf("Writing temporary ansible inventory to '%s'...", file.Name()))
-		if err := ioutil.WriteFile(file.Name(), []byte(buf.Bytes()), 0644); err != nil {
-			return "", err
-
-		}
-		v.o.Output("Ansible inventory written.")
-		return file.Name(), nil
+		v.log(v.o, types.LogLevelDebug).Output(fmt.Sprintf("Writing temporary ansible inventory to '%s'...", file))
+		v.log(v.o, types.LogLevelDebug).Output("Ansible inventory written.")
+		return file, nil
 	}
 	return play.InventoryFile(), nil
 }
 
-func (v *LocalMode) runCommand(command string) error {
-	localExecProvisioner := localExec.Provisioner()
-
-	instanceState := &terraform.InstanceState{
-		ID:         command,
-		Attributes: make(map[string]string),
-		Ephemeral: terraform.EphemeralState{
-			ConnInfo: make(map[string]string),
-			Type:     "local-exec",
-		},
-		Meta: map[string]interface{}{
-			"command": command,
-		},
-		Tainted: false,
-	}
-
-	config := &terraform.ResourceConfig{
-		ComputedKeys: make([]string, 0),
-		Raw: map[string]interface{}{
-			"command": command,
-		},
-		Config: map[string]interface{}{
-			"command": command,
-		},
-	}
-
-	return localExecProvisioner.Apply(v.o, instanceState, config)
+// runCommandCapturing runs the play command and writes its output, without colors and with the secrets masked,
+// to the diff output file. A relative path is resolved under the artifact directory.
+func (v *LocalMode) runCommandCapturing(o terraform.UIOutput, play *types.Play, artifactDirectory string, runCommand func(terraform.UIOutput) error) error {
+	outputFile, err := artifactPath(artifactDirectory, play.DiffOutputFile())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+		return fmt.Errorf("Error creating the directory for '%s': %s", outputFile, err)
+	}
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("Error creating '%s': %s", outputFile, err)
+	}
+	defer file.Close()
+
+	o.Output(fmt.Sprintf("capturing the output to: %s", outputFile))
+
+	return runCommand(newMaskedCapturingOutput(o, file, func(line string) string {
+		return maskSecrets(v.o, line)
+	}))
+}
+
+// runPlayCommand runs the play commands, killing these when the play timeout is exceeded.
+func runPlayCommand(ctx context.Context, o terraform.UIOutput, play *types.Play, command types.Commands) error {
+	return runLocalCommands(ctx, o, command, time.Duration(play.Timeout())*time.Second)
 }
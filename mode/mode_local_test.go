@@ -159,9 +159,14 @@ func TestIntegrationLocalModeProvisioning(t *testing.T) {
 		runErr := modeLocal.Run([]*types.Play{
 			test.GetNewPlay(t, playModule, defaultSettings),
 			test.GetNewPlay(t, playPlaybook, defaultSettings),
-		}, types.NewAnsibleSSHSettingsFromInterface("", false /* just take defaults */))
+		}, &Settings{
+			AnsibleSSHSettings:   types.NewAnsibleSSHSettingsFromInterface("", false /* just take defaults */),
+			WindowsSettings:      types.NewWindowsSettingsFromInterface("", false /* just take defaults */),
+			ExecutionEnvironment: types.NewExecutionEnvironmentFromInterface("", false /* just take defaults */),
+			WSL:                  types.NewWSLSettingsFromInterface("", false /* just take defaults */),
+		})
 		if runErr != nil {
-			t.Fatalf("Unexpected error: %v", runErr)
+			t.Errorf("Unexpected error: %v", runErr)
 		}
 	}()
 
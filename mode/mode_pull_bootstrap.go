@@ -0,0 +1,184 @@
+package mode
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	pullBootstrapName          = "tf-ansible-pull"
+	pullBootstrapDirectory     = "/etc/tf-ansible-pull"
+	pullBootstrapScript        = pullBootstrapDirectory + "/pull.sh"
+	pullBootstrapDeployKey     = pullBootstrapDirectory + "/deploy_key"
+	pullBootstrapSystemdUnits  = "/etc/systemd/system"
+	pullBootstrapCronFile      = "/etc/cron.d/" + pullBootstrapName
+	pullBootstrapOnlyIfChanged = "--only-if-changed"
+)
+
+// PullBootstrapMode represents ansible-pull bootstrap provisioner mode. Nothing is pushed to the target,
+// the target is configured to run ansible-pull on a schedule with a systemd timer or a cron job.
+type PullBootstrapMode struct {
+	remote   *RemoteMode
+	settings *types.PullBootstrapSettings
+}
+
+// pullBootstrapFile is a file written to the target.
+type pullBootstrapFile struct {
+	path     string
+	mode     string
+	contents string
+}
+
+// NewPullBootstrapMode returns configured ansible-pull bootstrap provisioner.
+func NewPullBootstrapMode(o terraform.UIOutput, s *terraform.InstanceState, settings *types.PullBootstrapSettings) (*PullBootstrapMode, error) {
+	if connType := s.Ephemeral.ConnInfo["type"]; connType != "ssh" && connType != "" {
+		return nil, fmt.Errorf("ansible-pull bootstrap supports SSH connections only")
+	}
+	// the files are written and the commands executed like in remote mode, with sudo:
+	remote, err := NewRemoteMode(newMaskingOutput(o, []string{settings.DeployKey()}), s, types.NewRemoteSettingsFromInterface(nil, false))
+	if err != nil {
+		return nil, err
+	}
+	return &PullBootstrapMode{remote: remote, settings: settings}, nil
+}
+
+// Validate checks the schedule, the plays are not used in ansible-pull bootstrap mode.
+func (v *PullBootstrapMode) Validate(plays []*types.Play, settings *Settings) error {
+	return v.settings.Validate()
+}
+
+// Cleanup does nothing, the connection is closed when Run returns.
+func (v *PullBootstrapMode) Cleanup() error {
+	return nil
+}
+
+// Run writes the ansible-pull script and the schedule to the target, enables the schedule
+// and, unless disabled, executes the first ansible-pull run.
+func (v *PullBootstrapMode) Run(plays []*types.Play, settings *Settings) error {
+	files := pullBootstrapFiles(v.settings)
+
+	if dryRun := settings.RunOptions.dryRun(); dryRun != "" {
+		for _, file := range files {
+			v.remote.o.Output(fmt.Sprintf("pull bootstrap: %s, '%s' not written", dryRun, file.path))
+		}
+		v.remote.o.Output(fmt.Sprintf("pull bootstrap: %s, %s schedule '%s' of '%s' not enabled",
+			dryRun, v.settings.Scheduler(), v.settings.Schedule(), v.settings.URL()))
+		return nil
+	}
+
+	err := v.remote.retryFunc(settings.RunOptions.runContext(), v.remote.comm.Timeout(), func() error {
+		return v.remote.comm.Connect(v.remote.o)
+	})
+	if err != nil {
+		return err
+	}
+	defer v.remote.comm.Disconnect()
+
+	for _, file := range files {
+		if err := v.writeFile(file); err != nil {
+			return err
+		}
+	}
+
+	if v.settings.Scheduler() == types.PullSchedulerSystemd {
+		v.remote.o.Output(fmt.Sprintf("enabling the %s.timer systemd timer...", pullBootstrapName))
+		if err := v.remote.runCommandSudo(fmt.Sprintf("sh -c %s", types.ShellQuote(
+			fmt.Sprintf("systemctl daemon-reload && systemctl enable --now %s.timer", pullBootstrapName)))); err != nil {
+			return err
+		}
+	}
+
+	if !v.settings.Verify() {
+		v.remote.o.Output("the first ansible-pull run is not verified, the target converges on schedule")
+		return nil
+	}
+
+	v.remote.o.Output(fmt.Sprintf("verifying the first ansible-pull run of '%s'...", v.settings.URL()))
+	if err := v.remote.runCommandSudo(pullBootstrapScript); err != nil {
+		return fmt.Errorf("the first ansible-pull run failed, the schedule stays enabled: %v", err)
+	}
+	return nil
+}
+
+// writeFile uploads the contents to a temporary file readable by the connection user only
+// and installs it at the destination owned by root.
+func (v *PullBootstrapMode) writeFile(file pullBootstrapFile) error {
+	temporaryPath := fmt.Sprintf("/tmp/%s-%s", pullBootstrapName, uuid.NewV4().String())
+	v.remote.o.Output(fmt.Sprintf("writing '%s'...", file.path))
+	if err := v.remote.runCommandNoSudo(fmt.Sprintf("sh -c %s",
+		types.ShellQuote(fmt.Sprintf("umask 077 && : > %s", types.ShellQuote(temporaryPath))))); err != nil {
+		return err
+	}
+	if err := v.remote.comm.Upload(temporaryPath, strings.NewReader(file.contents)); err != nil {
+		return err
+	}
+	return v.remote.runCommandSudo(fmt.Sprintf("sh -c %s", types.ShellQuote(fmt.Sprintf(
+		"mkdir -p %s && install -m %s %s %s; status=$?; rm -f %s; exit $status",
+		types.ShellQuote(path.Dir(file.path)), file.mode,
+		types.ShellQuote(temporaryPath), types.ShellQuote(file.path), types.ShellQuote(temporaryPath)))))
+}
+
+// pullBootstrapFiles returns the ansible-pull script, the deploy key and the schedule.
+func pullBootstrapFiles(settings *types.PullBootstrapSettings) []pullBootstrapFile {
+	files := make([]pullBootstrapFile, 0)
+	if settings.DeployKey() != "" {
+		deployKey := settings.DeployKey()
+		if !strings.HasSuffix(deployKey, "\n") {
+			deployKey = deployKey + "\n"
+		}
+		files = append(files, pullBootstrapFile{path: pullBootstrapDeployKey, mode: "0600", contents: deployKey})
+	}
+	files = append(files, pullBootstrapFile{
+		path: pullBootstrapScript,
+		mode: "0700",
+		contents: fmt.Sprintf("#!/bin/sh\n# Written by terraform-provisioner-ansible, scheduled runs pass %s.\nexec %s\n",
+			pullBootstrapOnlyIfChanged, settings.ToPullCommand(pullBootstrapDeployKey)),
+	})
+
+	if settings.Scheduler() == types.PullSchedulerCron {
+		return append(files, pullBootstrapFile{
+			path: pullBootstrapCronFile,
+			mode: "0644",
+			contents: fmt.Sprintf("# Written by terraform-provisioner-ansible.\n%s root %s %s >> %s 2>&1\n",
+				settings.Schedule(), pullBootstrapScript, pullBootstrapOnlyIfChanged, types.ShellQuote(settings.LogFile())),
+		})
+	}
+
+	return append(files,
+		pullBootstrapFile{
+			path: fmt.Sprintf("%s/%s.service", pullBootstrapSystemdUnits, pullBootstrapName),
+			mode: "0644",
+			contents: strings.Join([]string{
+				"[Unit]",
+				fmt.Sprintf("Description=ansible-pull of %s", settings.URL()),
+				"Wants=network-online.target",
+				"After=network-online.target",
+				"",
+				"[Service]",
+				"Type=oneshot",
+				fmt.Sprintf("ExecStart=%s %s", pullBootstrapScript, pullBootstrapOnlyIfChanged),
+				"",
+			}, "\n"),
+		},
+		pullBootstrapFile{
+			path: fmt.Sprintf("%s/%s.timer", pullBootstrapSystemdUnits, pullBootstrapName),
+			mode: "0644",
+			contents: strings.Join([]string{
+				"[Unit]",
+				fmt.Sprintf("Description=Scheduled ansible-pull of %s", settings.URL()),
+				"",
+				"[Timer]",
+				fmt.Sprintf("OnCalendar=%s", settings.Schedule()),
+				"Persistent=true",
+				"",
+				"[Install]",
+				"WantedBy=timers.target",
+				"",
+			}, "\n"),
+		})
+}
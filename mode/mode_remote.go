@@ -3,6 +3,7 @@ package mode
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
@@ -16,6 +17,7 @@ import (
 	"time"
 
 	linereader "github.com/mitchellh/go-linereader"
+	"github.com/radekg/terraform-provisioner-ansible/events"
 	"github.com/radekg/terraform-provisioner-ansible/types"
 
 	"github.com/hashicorp/terraform/communicator"
@@ -30,6 +32,99 @@ if [ -n "${TAF_DOCKER_CENTOS_LATEST_RUN}" ]; then
   yum update -y && yum install -y which
 fi
 set -euo pipefail
+# install_dependencies installs the OS packages required by a virtualenv or a system wide installation,
+# the argument is either venv or system
+install_dependencies() {
+{{- if .PackagesScript}}
+  /bin/sh "{{ .PackagesScript}}" "$1"
+{{- else}}
+  if command -v apk >/dev/null 2>&1; then
+    if [ "$1" = "venv" ]; then
+      apk add --no-cache python3 py3-pip
+    else
+      apk add --no-cache build-base python3 python3-dev py3-pip libffi-dev openssl-dev curl
+    fi
+  elif command -v dnf >/dev/null 2>&1; then
+    if [ "$1" = "venv" ]; then
+      dnf install -y python3 python3-pip
+    else
+      dnf install -y gcc python3 python3-devel python3-pip curl
+    fi
+  elif [ -f /etc/redhat-release ]; then
+    if [ "$1" = "venv" ]; then
+      yum install -y python3
+    else
+      yum update -y \
+      && yum groupinstall -y "Development Tools" \
+      && yum install -y python-devel curl
+    fi
+  elif command -v zypper >/dev/null 2>&1; then
+    if [ "$1" = "venv" ]; then
+      zypper --non-interactive install python3 python3-pip
+    else
+      zypper --non-interactive install gcc python3 python3-devel python3-pip curl
+    fi
+  elif command -v apt-get >/dev/null 2>&1; then
+    if [ "$1" = "venv" ]; then
+      apt-get update \
+      && apt-get install -y python3-venv
+    else
+      apt-get update \
+      && apt-get install -y build-essential python-dev curl
+    fi
+  elif command -v pkg >/dev/null 2>&1; then
+    pkg install -y python3 curl
+  else
+    echo "No supported package manager found (apk, dnf, yum, zypper, apt-get, pkg), use remote.packages_script_path." >&2
+    exit 1
+  fi
+{{- end}}
+}
+{{- if .OfflineDirectory}}
+# air-gapped installation from the uploaded packages, nothing is downloaded
+{{- if not .Rootless}}
+if ls "{{ .OfflineDirectory}}"/*.rpm >/dev/null 2>&1; then
+  rpm -Uvh --replacepkgs "{{ .OfflineDirectory}}"/*.rpm
+fi
+if ls "{{ .OfflineDirectory}}"/*.deb >/dev/null 2>&1; then
+  dpkg -i "{{ .OfflineDirectory}}"/*.deb
+fi
+{{- end}}
+{{- if .VirtualenvDirectory}}
+if [ ! -x "{{ .VirtualenvDirectory}}/bin/pip" ]; then
+  python3 -m venv "{{ .VirtualenvDirectory}}"
+fi
+PIP="{{ .VirtualenvDirectory}}/bin/pip"
+{{- else}}
+PIP="python3 -m pip"
+{{- end}}
+if ls "{{ .OfflineDirectory}}"/*.whl >/dev/null 2>&1 || ls "{{ .OfflineDirectory}}"/*.tar.gz >/dev/null 2>&1; then
+  $PIP install --no-index --find-links="{{ .OfflineDirectory}}" "{{ .AnsibleVersion}}"{{if .WinRM}} pywinrm{{end}}
+fi
+exit 0
+{{- end}}
+{{- if .VirtualenvDirectory}}
+# install to a dedicated virtualenv, independent of any system wide Ansible
+if [ ! -x "{{ .VirtualenvDirectory}}/bin/pip" ]; then
+  if [ -d /var/lib/cloud/instance ]; then
+    while [ ! -f /var/lib/cloud/instance/boot-finished ]; do
+      sleep 1
+    done
+  fi
+{{- if .Rootless}}
+  # no package manager without root, the virtualenv package is installed for the user when venv is missing
+  mkdir -p "$(dirname "{{ .VirtualenvDirectory}}")"
+  python3 -m venv "{{ .VirtualenvDirectory}}" \
+    || (python3 -m pip install --user virtualenv && python3 -m virtualenv "{{ .VirtualenvDirectory}}")
+{{- else}}
+  install_dependencies venv
+  python3 -m venv "{{ .VirtualenvDirectory}}"
+{{- end}}
+  "{{ .VirtualenvDirectory}}/bin/pip" install --upgrade pip
+fi
+"{{ .VirtualenvDirectory}}/bin/pip" install "{{ .AnsibleVersion}}"{{if .WinRM}} pywinrm{{end}}
+exit 0
+{{- end}}
 if [ -z "$(which ansible-playbook)" ]; then
   # only check the cloud boot finished if the directory exists
   if [ -d /var/lib/cloud/instance ]; then
@@ -37,21 +132,13 @@ if [ -z "$(which ansible-playbook)" ]; then
       sleep 1
     done
   fi
-  # install dependencies
-  if [ -f /etc/redhat-release ]; then
-    yum update -y \
-    && yum groupinstall -y "Development Tools" \
-    && yum install -y python-devel curl
-  else
-    apt-get update \
-    && apt-get install -y build-essential python-dev curl
-  fi
+  install_dependencies system
   # install pip, if necessary
   if [ -z "$(which pip)" ]; then
-    curl https://bootstrap.pypa.io/get-pip.py | python
+    curl https://bootstrap.pypa.io/get-pip.py | "$(command -v python || command -v python3)"
   fi
   # install ansible
-  pip install {{ .AnsibleVersion}}
+  pip install {{ .AnsibleVersion}}{{if .WinRM}} pywinrm{{end}}
 else
   expected_version="{{ .AnsibleVersion}}"
   installed_version=$(ansible-playbook --version | head -n1 | awk '{print $2}')
@@ -66,20 +153,26 @@ else
 fi
 `
 
+type inventoryTemplateRemoteDataHost struct {
+	Alias string
+	Local bool
+	Vars  []string
+}
+
 type inventoryTemplateRemoteData struct {
-	Hosts  []string
+	Hosts  []inventoryTemplateRemoteDataHost
 	Groups []string
 }
 
 const inventoryTemplateRemote = `{{$top := . -}}
 {{range .Hosts -}}
-{{.}} ansible_connection=local
+{{.Alias}}{{if .Local}} ansible_connection=local{{end}}{{range .Vars}} {{.}}{{end}}
 {{end}}
 
 {{range .Groups -}}
 [{{.}}]
 {{range $top.Hosts -}}
-{{.}} ansible_connection=local
+{{.Alias}}{{if .Local}} ansible_connection=local{{end}}{{range .Vars}} {{.}}{{end}}
 {{end}}
 
 {{end}}`
@@ -92,16 +185,26 @@ type RemoteMode struct {
 	comm           communicator.Communicator
 	connInfo       *connectionInfo
 	remoteSettings *types.RemoteSettings
+	// encrypted extra vars files uploaded to the host, removed after provisioning:
+	uploadedVaultFiles []string
+	// vault password, become password and extra vars files uploaded to the host, shredded after provisioning:
+	uploadedSecretFiles []string
+	// logLevel is how much of the provisioner messages is written, empty for info.
+	logLevel string
 }
 
 type ansibleInstaller struct {
-	AnsibleVersion string
+	AnsibleVersion      string
+	VirtualenvDirectory string
+	OfflineDirectory    string
+	Rootless            bool
+	PackagesScript      string
+	WinRM               bool
 }
 
 // NewRemoteMode returns configured remote mode provisioner.
 func NewRemoteMode(o terraform.UIOutput, s *terraform.InstanceState, remoteSettings *types.RemoteSettings) (*RemoteMode, error) {
-	// Get a new communicator
-	comm, err := communicator.New(s)
+	connInfo, err := parseConnectionInfo(s)
 	if err != nil {
 		return nil, err
 	}
@@ -109,13 +212,37 @@ func NewRemoteMode(o terraform.UIOutput, s *terraform.InstanceState, remoteSetti
 	connType := s.Ephemeral.ConnInfo["type"]
 	switch connType {
 	case "ssh", "": // The default connection type is ssh, so if connType is empty use ssh
+		// all uploads and commands are tunneled through the bastion host, if any:
+		s = pinRemoteBastionHostKey(o, s, connInfo)
+	case "winrm":
+		// Ansible does not run on Windows, it is executed in WSL:
+		if remoteSettings.WSLDistribution() == "" {
+			return nil, fmt.Errorf("Remote provisioning of a Windows host over WinRM requires remote.wsl_distribution")
+		}
+		if connInfo.BastionHost != "" {
+			return nil, fmt.Errorf("Bastion hosts are supported for SSH connections only")
+		}
 	default:
-		return nil, fmt.Errorf("Currently, only SSH connection is supported")
+		return nil, fmt.Errorf("Currently, only SSH and WinRM with WSL connections are supported")
 	}
-	connInfo, err := parseConnectionInfo(s)
+
+	// Get a new communicator
+	comm, err := communicator.New(s)
 	if err != nil {
 		return nil, err
 	}
+	if connType == "winrm" {
+		comm = newWSLCommunicator(comm, remoteSettings.WSLDistribution())
+	}
+
+	if remoteSettings.CompressUploads() {
+		comm = newArchivingCommunicator(comm)
+	}
+
+	// checksums of the uploaded files are recorded and verified on the host before anything runs:
+	if remoteSettings.VerifyUploads() {
+		comm = newVerifyingCommunicator(comm)
+	}
 
 	return &RemoteMode{
 		o:              o,
@@ -125,10 +252,48 @@ func NewRemoteMode(o terraform.UIOutput, s *terraform.InstanceState, remoteSetti
 	}, nil
 }
 
-// Run executes remote provisioning process.
-func (v *RemoteMode) Run(plays []*types.Play) error {
+// Validate checks that the plays can be executed on the host.
+func (v *RemoteMode) Validate(plays []*types.Play, settings *Settings) error {
+	if settings.RunOptions.Executor == types.ExecutorAnsibleRunner {
+		return fmt.Errorf("The ansible-runner executor is supported in local mode only")
+	}
+	for _, play := range plays {
+		if play.FactsOutputFile() != "" {
+			return fmt.Errorf("facts_output_file is supported in local mode only")
+		}
+	}
+	return nil
+}
+
+// Cleanup does nothing, the bootstrap directory is removed and the connection closed when Run returns.
+func (v *RemoteMode) Cleanup() error {
+	return nil
+}
+
+// Run executes remote provisioning process. The connection is closed when the context of the run
+// is done, the commands running on the host fail and the provisioning stops.
+func (v *RemoteMode) Run(plays []*types.Play, settings *Settings) error {
+	ctx := settings.RunOptions.runContext()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			v.comm.Disconnect()
+		case <-done:
+		}
+	}()
+	err := v.run(ctx, plays, settings)
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("%v: %v", ctx.Err(), err)
+	}
+	return err
+}
+
+func (v *RemoteMode) run(ctx context.Context, plays []*types.Play, settings *Settings) error {
+	options := settings.RunOptions
 	// Wait and retry until we establish the connection
-	err := v.retryFunc(v.comm.Timeout(), func() error {
+	err := v.retryFunc(ctx, v.comm.Timeout(), func() error {
 		return v.comm.Connect(v.o)
 	})
 	if err != nil {
@@ -136,6 +301,85 @@ func (v *RemoteMode) Run(plays []*types.Play) error {
 	}
 	defer v.comm.Disconnect()
 
+	// vault passwords from a command or the environment are written to temporary files,
+	// these are uploaded to the host with other vault password files and masked like these:
+	for _, play := range plays {
+		vaultPasswordFile, err := materializeVaultPassword(ctx, play, "")
+		if err != nil {
+			return err
+		}
+		if vaultPasswordFile != "" {
+			play.SetOverrideVaultPasswordPath(vaultPasswordFile)
+			defer removeSecretFile(vaultPasswordFile)
+		}
+	}
+
+	v.o = newMaskingOutput(v.o, append(append(playSecrets(plays), v.remoteSettings.SudoPassword()), proxySecrets(v.remoteSettings)...))
+	v.logLevel = options.LogLevel
+
+	hashStore := newPlayHashStore(options.HashDirectory)
+	playHashes := make(map[*types.Play]playHash)
+
+	// ansible-lint checks the playbooks before these are uploaded:
+	for _, play := range plays {
+		if !play.Enabled() {
+			continue
+		}
+		hashKey := playHashKey(v.connInfo.Host, play)
+		sourceDir, err := preparePlaybookSource(v.o, play, "")
+		if err != nil {
+			return err
+		}
+		if sourceDir != "" {
+			defer os.RemoveAll(sourceDir)
+		}
+		templatesDir, err := renderPlayTemplates(v.o, play, "")
+		if err != nil {
+			return err
+		}
+		if templatesDir != "" {
+			defer os.RemoveAll(templatesDir)
+		}
+		unchanged, inputsHash, err := checkUnchangedPlay(v.o, hashStore, hashKey, play)
+		if err != nil {
+			return err
+		}
+		if unchanged {
+			// unchanged plays are neither uploaded nor executed, plays depending on them run:
+			v.log(types.LogLevelInfo).Output("inputs of the play did not change since the last successful run, skipping the play")
+			play.Disable()
+			continue
+		}
+		playHashes[play] = playHash{key: hashKey, inputs: inputsHash}
+		if err := runLint(ctx, v.o, play); err != nil {
+			return err
+		}
+		if err := checkVaultVarsFiles(play); err != nil {
+			return err
+		}
+	}
+
+	// encrypted variable files are removed regardless of the result and skip_cleanup:
+	defer v.removeExtraVarsVaultFiles()
+	// so are the password and extra vars files, shredded before the bootstrap directory is removed:
+	defer v.shredSecretFiles()
+
+	if err := v.prepareBootstrapDirectory(); err != nil {
+		return err
+	}
+
+	// with skip_cleanup, or after a failure, the uploaded data is left on the host for inspection:
+	cleanedUp := false
+	defer func() {
+		if !cleanedUp {
+			v.o.Output(fmt.Sprintf("Bootstrap data has been left on the host '%s', remove it with: %s", v.connInfo.Host, v.cleanupCommand()))
+		}
+	}()
+
+	if err := v.uploadPlayDirectories(plays); err != nil {
+		return err
+	}
+
 	err = v.deployAnsibleData(plays)
 
 	if err != nil {
@@ -143,44 +387,151 @@ func (v *RemoteMode) Run(plays []*types.Play) error {
 		return err
 	}
 
-	if !v.remoteSettings.SkipInstall() {
-		if err := v.installAnsible(v.remoteSettings); err != nil {
+	if err := v.runBootstrapScript(); err != nil {
+		return err
+	}
+
+	if err := v.ensureAnsible(); err != nil {
+		return err
+	}
+
+	if v.remoteSettings.ContainerImage() == "" {
+		if err := newAnsibleVersionCheck(options).check(v.o, "", func() (string, error) {
+			installed, err := v.existingAnsibleVersion()
+			if err == nil && installed == "" {
+				err = fmt.Errorf("Ansible not found on the host")
+			}
+			return installed, err
+		}); err != nil {
 			return err
 		}
 	}
 
-	for _, play := range plays {
-		command, err := play.ToCommand(types.LocalModeAnsibleArgs{Username: v.connInfo.User})
+	if err := v.verifyUploads(); err != nil {
+		return err
+	}
+
+	// the files are uploaded by the connection user, ownership is changed once everything is in place:
+	if owner := v.remoteSettings.BootstrapDirectoryOwner(); owner != "" {
+		v.log(types.LogLevelInfo).Output(fmt.Sprintf("Changing the owner of '%s' to '%s'...", v.remoteSettings.BootstrapDirectory(), owner))
+		if err := v.runCommandSudo(fmt.Sprintf("chown -R %s \"%s\"", types.ShellQuote(owner), v.remoteSettings.BootstrapDirectory())); err != nil {
+			return err
+		}
+	}
+
+	// Ansible in a virtualenv is not on the PATH, the binaries are executed from the virtualenv:
+	if binDirectory := v.remoteSettings.VirtualenvBinDirectory(); binDirectory != "" && v.remoteSettings.ContainerImage() == "" {
+		for _, play := range plays {
+			play.SetOverrideBinDirectory(binDirectory)
+		}
+	}
+
+	orderedPlays, err := orderPlays(plays)
+	if err != nil {
+		return err
+	}
+
+	for _, play := range orderedPlays {
+		commands, err := play.ToCommands(types.LocalModeAnsibleArgs{Username: v.connInfo.User})
 		if err != nil {
 			return err
 		}
-		v.o.Output(fmt.Sprintf("running command: %s", command))
-		if err := v.runCommandSudo(command); err != nil {
+		command := commands.String()
+		// galaxy content is downloaded through the proxy of the bootstrap:
+		if _, ok := play.Entity().(*types.GalaxyInstall); ok {
+			command = proxyCommand(command, v.remoteSettings)
+		}
+		if options.PrintOnly {
+			if play.SyntaxCheck() {
+				if syntaxCheckCommand := play.ToSyntaxCheckCommands(commands); syntaxCheckCommand != nil {
+					printCommand(v.o, "syntax check", v.ansibleCommandLine(syntaxCheckCommand.String()))
+				}
+			}
+			printCommand(v.o, "play", v.ansibleCommandLine(command))
+			continue
+		}
+		if options.PlanOnly {
+			if err := runPlan(v.o, play, commands, func(planCommand types.Commands) error {
+				return v.runAnsibleCommand(planCommand.String())
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := runBeforeHooks(ctx, v.o, play); err != nil {
+			return err
+		}
+		if play.SyntaxCheck() {
+			if syntaxCheckCommand := play.ToSyntaxCheckCommands(commands); syntaxCheckCommand != nil {
+				v.log(types.LogLevelInfo).Output(fmt.Sprintf("running syntax check: %s", syntaxCheckCommand))
+				if err := v.runAnsibleCommand(syntaxCheckCommand.String()); err != nil {
+					return fmt.Errorf("playbook syntax check failed: %v", err)
+				}
+			}
+		}
+		v.log(types.LogLevelInfo).Output(fmt.Sprintf("running command: %s", command))
+		runOnce := func() (events.Stats, error) {
+			// the output is read by the communicator, swap it to collect the recap:
+			o := v.o
+			heartbeat := newHeartbeatOutput(o, play)
+			recap := newRecapOutput(heartbeat)
+			v.o = recap
+			err := v.runPlayCommand(play, command)
+			heartbeat.stop()
+			v.o = o
+			summarizeTaskDurations(v.o, play, recap.Result())
+			return recap.Recap(), evaluatePlayResult(v.o, play, err, recap.Result())
+		}
+		playErr := runWithRetries(ctx, v.o, play, func() error {
+			recap, err := runOnce()
+			if err != nil {
+				return err
+			}
+			return assertNoChanges(v.o, play, recap, runOnce)
+		})
+		playErr = runOnFailurePlay(v.o, play, playErr, func(rollback *types.Play) error {
+			rollbackCommand, err := rollback.ToCommand(types.LocalModeAnsibleArgs{Username: v.connInfo.User})
+			if err != nil {
+				return err
+			}
+			return v.runPlayCommand(rollback, rollbackCommand)
+		})
+		if err := runAfterHooks(ctx, v.o, play, playErr); err != nil {
+			return err
+		}
+		if err := hashStore.Store(playHashes[play].key, playHashes[play].inputs); err != nil {
 			return err
 		}
 	}
 
-	if !v.remoteSettings.SkipCleanup() {
+	if options.PrintOnly {
+		// the printed commands read the uploaded files, only the secret files are removed:
+		v.shredSecretFiles()
+	} else if !v.remoteSettings.SkipCleanup() {
+		v.shredSecretFiles()
 		v.cleanupAfterBootstrap()
+		cleanedUp = true
 	}
 
 	return nil
 
 }
 
-// retryFunc is used to retry a function for a given duration
-func (v *RemoteMode) retryFunc(timeout time.Duration, f func() error) error {
+// retryFunc is used to retry a function for a given duration, or until the context is done
+func (v *RemoteMode) retryFunc(ctx context.Context, timeout time.Duration, f func() error) error {
 	finish := time.After(timeout)
 	for {
 		err := f()
 		if err == nil {
 			return nil
 		}
-		log.Printf("Retryable error: %v", err)
+		log.Printf("Retryable error: %v", MaskError(v.o, err))
 
 		select {
 		case <-finish:
 			return err
+		case <-ctx.Done():
+			return err
 		case <-time.After(3 * time.Second):
 		}
 	}
@@ -202,36 +553,28 @@ func (v *RemoteMode) deployAnsibleData(plays []*types.Play) error {
 		switch entity := play.Entity().(type) {
 		case *types.Playbook:
 
-			playbookPath, err := types.ResolvePath(entity.FilePath())
-			if err != nil {
-				return err
-			}
-
-			// playbook file is at the top level of the module
-			// parse the playbook path's directory and upload the entire directory
-			playbookDir := filepath.Dir(playbookPath)
-			playbookDirHash := v.getMD5Hash(playbookDir)
-
-			remotePlaybookDir := filepath.Join(v.remoteSettings.BootstrapDirectory(), playbookDirHash)
-			remotePlaybookPath := filepath.Join(remotePlaybookDir, filepath.Base(playbookPath))
-
 			if err := v.runCommandNoSudo(fmt.Sprintf("mkdir -p \"%s\"",
 				v.remoteSettings.BootstrapDirectory())); err != nil {
 				return err
 			}
 
-			dirExists, err := v.checkRemoteDirExists(remotePlaybookDir)
+			remotePlaybookPath, err := v.uploadPlaybookDirectory("playbook", entity.FilePath())
 			if err != nil {
 				return err
 			}
-			if dirExists {
-				v.o.Output(fmt.Sprintf("The playbook '%s' directory '%s' has been already uploaded.", entity.FilePath(), playbookDir))
-			} else {
-				v.o.Output(fmt.Sprintf("Uploading the parent directory '%s' of playbook '%s' to '%s'...", playbookDir, entity.FilePath(), remotePlaybookDir))
-				// upload ansible source and playbook to the host
-				if err := v.comm.UploadDir(remotePlaybookDir, playbookDir); err != nil {
-					return err
+			remotePlaybookDir := filepath.Dir(remotePlaybookPath)
+
+			// additional playbooks from other directories are uploaded the same way:
+			if len(entity.AdditionalFilePaths()) > 0 {
+				remoteAdditionalPaths := make([]string, 0)
+				for _, additionalPath := range entity.AdditionalFilePaths() {
+					remoteAdditionalPath, err := v.uploadPlaybookDirectory("playbook", additionalPath)
+					if err != nil {
+						return err
+					}
+					remoteAdditionalPaths = append(remoteAdditionalPaths, remoteAdditionalPath)
 				}
+				entity.SetOverrideAdditionalFilePaths(remoteAdditionalPaths)
 			}
 
 			entity.SetOverrideFilePath(remotePlaybookPath)
@@ -247,12 +590,13 @@ func (v *RemoteMode) deployAnsibleData(plays []*types.Play) error {
 			if len(play.VaultID()) > 0 {
 				overrideVaultIDs := make([]string, 0)
 				for _, vaultID := range play.VaultID() {
-					uploadedVaultIDPath, err := v.uploadVaultPasswordOrIDFile(remotePlaybookDir, vaultID)
+					label, source := types.SplitVaultID(vaultID)
+					uploadedVaultIDPath, err := v.uploadVaultPasswordOrIDFile(remotePlaybookDir, source)
 					if err != nil {
 						return err
 					}
 					if uploadedVaultIDPath != "" {
-						overrideVaultIDs = append(overrideVaultIDs, uploadedVaultIDPath)
+						overrideVaultIDs = append(overrideVaultIDs, types.JoinVaultID(label, uploadedVaultIDPath))
 					}
 				}
 				play.SetOverrideVaultID(overrideVaultIDs)
@@ -264,42 +608,63 @@ func (v *RemoteMode) deployAnsibleData(plays []*types.Play) error {
 				play.SetOverrideVaultPasswordPath(uploadedVaultPasswordFilePath)
 			}
 
+			if err := v.uploadBecomePassword(remotePlaybookDir, play); err != nil {
+				return err
+			}
+
+			if err := v.uploadExtraVars(remotePlaybookDir, play); err != nil {
+				return err
+			}
+
+			if err := v.uploadExtraVarsFiles(remotePlaybookDir, play); err != nil {
+				return err
+			}
+
+			if err := v.uploadExtraVarsVaultFiles(remotePlaybookDir, play); err != nil {
+				return err
+			}
+
+			if err := v.uploadOnFailurePlaybook(play); err != nil {
+				return err
+			}
+
+			if err := v.uploadAnsibleCfg(remotePlaybookDir, play); err != nil {
+				return err
+			}
+
 			// upload roles paths, if any:
 			remoteRolesPath := make([]string, 0)
-			for _, path := range entity.RolesPath() {
+			for _, path := range play.RolesPath() {
 
 				if strings.HasPrefix(path, "galaxy_install:") { // TODO: extract this hard coded value
-					remoteRolesPath = append(remoteRolesPath, strings.TrimPrefix(path, "galaxy_install:"))
+					remoteRolesPath = append(remoteRolesPath, v.galaxyInstallPath(strings.TrimPrefix(path, "galaxy_install:")))
 					continue
 				}
 
-				resolvedPath, err := types.ResolvePath(path)
+				remoteDir, err := v.uploadDirectory("roles path", path)
 				if err != nil {
 					return err
 				}
-				dirHash := v.getMD5Hash(resolvedPath)
-				remoteDir := filepath.Join(v.remoteSettings.BootstrapDirectory(), dirHash)
-				dirExists, err := v.checkRemoteDirExists(remoteDir)
+				remoteRolesPath = append(remoteRolesPath, remoteDir)
+			}
+			entity.SetOverrideRolesPath(remoteRolesPath)
 
-				if err != nil {
-					return err
-				}
-				if dirExists {
-					v.o.Output(fmt.Sprintf("Roles path '%s' has been already uploaded.", resolvedPath))
-				} else {
-					v.o.Output(fmt.Sprintf("Uploading roles path '%s' to '%s'...", resolvedPath, remoteDir))
-					// upload ansible source and playbook to the host
-					if err := v.comm.UploadDir(remoteDir, resolvedPath); err != nil {
+			// upload pre-fetched collections, the directories keep the ansible_collections layout:
+			if len(entity.CollectionsPath()) > 0 {
+				remoteCollectionsPath := make([]string, 0)
+				for _, path := range entity.CollectionsPath() {
+					remoteDir, err := v.uploadDirectory("collections path", path)
+					if err != nil {
 						return err
 					}
+					remoteCollectionsPath = append(remoteCollectionsPath, remoteDir)
 				}
-				remoteRolesPath = append(remoteRolesPath, remoteDir)
+				entity.SetOverrideCollectionsPath(remoteCollectionsPath)
 			}
-			entity.SetOverrideRolesPath(remoteRolesPath)
 
 		case *types.Module:
 
-			moduleDirHash := v.getMD5Hash(entity.Module())
+			moduleDirHash := v.getMD5Hash(strings.Join(entity.Modules(), ","))
 			remoteModuleDir := filepath.Join(v.remoteSettings.BootstrapDirectory(), moduleDirHash)
 
 			if err := v.runCommandNoSudo(fmt.Sprintf("mkdir -p \"%s\"", remoteModuleDir)); err != nil {
@@ -310,12 +675,13 @@ func (v *RemoteMode) deployAnsibleData(plays []*types.Play) error {
 			if len(play.VaultID()) > 0 {
 				overrideVaultIDs := make([]string, 0)
 				for _, vaultID := range play.VaultID() {
-					uploadedVaultIDPath, err := v.uploadVaultPasswordOrIDFile(remoteModuleDir, vaultID)
+					label, source := types.SplitVaultID(vaultID)
+					uploadedVaultIDPath, err := v.uploadVaultPasswordOrIDFile(remoteModuleDir, source)
 					if err != nil {
 						return err
 					}
 					if uploadedVaultIDPath != "" {
-						overrideVaultIDs = append(overrideVaultIDs, uploadedVaultIDPath)
+						overrideVaultIDs = append(overrideVaultIDs, types.JoinVaultID(label, uploadedVaultIDPath))
 					}
 				}
 				play.SetOverrideVaultID(overrideVaultIDs)
@@ -327,6 +693,43 @@ func (v *RemoteMode) deployAnsibleData(plays []*types.Play) error {
 				play.SetOverrideVaultPasswordPath(uploadedVaultPasswordFilePath)
 			}
 
+			if err := v.uploadBecomePassword(remoteModuleDir, play); err != nil {
+				return err
+			}
+
+			if err := v.uploadExtraVars(remoteModuleDir, play); err != nil {
+				return err
+			}
+
+			if err := v.uploadExtraVarsFiles(remoteModuleDir, play); err != nil {
+				return err
+			}
+
+			if err := v.uploadExtraVarsVaultFiles(remoteModuleDir, play); err != nil {
+				return err
+			}
+
+			if err := v.uploadOnFailurePlaybook(play); err != nil {
+				return err
+			}
+
+			if err := v.uploadAnsibleCfg(remoteModuleDir, play); err != nil {
+				return err
+			}
+
+			// per-host results stay on the host, relative trees are placed in the bootstrap directory:
+			if entity.Tree() != "" {
+				remoteTree := entity.Tree()
+				if !filepath.IsAbs(remoteTree) {
+					remoteTree = filepath.Join(v.remoteSettings.BootstrapDirectory(), remoteArtifactDirectory, remoteTree)
+				}
+				if err := v.runCommandNoSudo(fmt.Sprintf("mkdir -p \"%s\"", remoteTree)); err != nil {
+					return err
+				}
+				v.log(types.LogLevelInfo).Output(fmt.Sprintf("per-host results of the module play are written to '%s' on the host", remoteTree))
+				entity.SetOverrideTree(remoteTree)
+			}
+
 			// always create temp inventory:
 			inventoryFile, err := v.writeInventory(remoteModuleDir, play)
 			if err != nil {
@@ -334,39 +737,75 @@ func (v *RemoteMode) deployAnsibleData(plays []*types.Play) error {
 			}
 			play.SetOverrideInventoryFile(inventoryFile)
 
-		case *types.GalaxyInstall:
+		case *types.Pull:
 
-			if err := v.runCommandNoSudo(fmt.Sprintf("mkdir -p \"%s\"",
-				v.remoteSettings.BootstrapDirectory())); err != nil {
+			pullDirHash := v.getMD5Hash(entity.URL())
+			remotePullDir := filepath.Join(v.remoteSettings.BootstrapDirectory(), pullDirHash)
+
+			if err := v.runCommandNoSudo(fmt.Sprintf("mkdir -p \"%s\"", remotePullDir)); err != nil {
 				return err
 			}
 
-			rolesPathDir := entity.RolesPath()
-			if rolesPathDir == "" {
-				rolesPathDir = "galaxy-roles" // TODO: find a method to customize this
+			// the playbook is fetched by ansible-pull on the target, only the become password is needed:
+			if err := v.uploadBecomePassword(remotePullDir, play); err != nil {
+				return err
 			}
-			if !strings.HasPrefix(rolesPathDir, string(os.PathSeparator)) {
-				rolesPathDir = filepath.Join(v.remoteSettings.BootstrapDirectory(), rolesPathDir)
+
+			if err := v.uploadAnsibleCfg(remotePullDir, play); err != nil {
+				return err
 			}
-			entity.SetRolesPath(rolesPathDir)
-			v.o.Output(fmt.Sprintf("galaxy_install roles path used is: '%s'...", entity.RolesPath()))
-			if err := v.runCommandNoSudo(fmt.Sprintf("mkdir -p \"%s\"", entity.RolesPath())); err != nil {
+
+			// always create temp inventory:
+			inventoryFile, err := v.writeInventory(remotePullDir, play)
+			if err != nil {
+				return err
+			}
+			play.SetOverrideInventoryFile(inventoryFile)
+
+		case *types.GalaxyInstall:
+
+			if err := v.runCommandNoSudo(fmt.Sprintf("mkdir -p \"%s\"",
+				v.remoteSettings.BootstrapDirectory())); err != nil {
 				return err
 			}
 
+			if entity.IsCollection() {
+				collectionsPathDir := entity.CollectionsPath()
+				if collectionsPathDir == "" {
+					collectionsPathDir = "galaxy-collections"
+				}
+				collectionsPathDir = v.galaxyInstallPath(collectionsPathDir)
+				entity.SetCollectionsPath(collectionsPathDir)
+				v.log(types.LogLevelDebug).Output(fmt.Sprintf("galaxy_install collections path used is: '%s'...", entity.CollectionsPath()))
+				if err := v.runCommandNoSudo(fmt.Sprintf("mkdir -p \"%s\"", entity.CollectionsPath())); err != nil {
+					return err
+				}
+			} else {
+				rolesPathDir := entity.RolesPath()
+				if rolesPathDir == "" {
+					rolesPathDir = "galaxy-roles" // TODO: find a method to customize this
+				}
+				rolesPathDir = v.galaxyInstallPath(rolesPathDir)
+				entity.SetRolesPath(rolesPathDir)
+				v.log(types.LogLevelDebug).Output(fmt.Sprintf("galaxy_install roles path used is: '%s'...", entity.RolesPath()))
+				if err := v.runCommandNoSudo(fmt.Sprintf("mkdir -p \"%s\"", entity.RolesPath())); err != nil {
+					return err
+				}
+			}
+
 			originalRoleFile := entity.RoleFile()
 			roleFileHash := v.getMD5Hash(entity.RoleFile())
 			roleFileRemotePath := filepath.Join(v.remoteSettings.BootstrapDirectory(), fmt.Sprintf("%s.yml", roleFileHash))
 			entity.SetRoleFile(roleFileRemotePath)
-			v.o.Output(fmt.Sprintf("galaxy_install role file path used is: '%s'...", entity.RoleFile()))
+			v.log(types.LogLevelDebug).Output(fmt.Sprintf("galaxy_install role file path used is: '%s'...", entity.RoleFile()))
 
-			v.o.Output(fmt.Sprintf("reading original role file at: '%s'...", originalRoleFile))
+			v.log(types.LogLevelDebug).Output(fmt.Sprintf("reading original role file at: '%s'...", originalRoleFile))
 			roleFileBytes, readFileError := ioutil.ReadFile(originalRoleFile)
 			if readFileError != nil {
 				return readFileError
 			}
 
-			v.o.Output(fmt.Sprintf("uploading role file to: '%s'...", entity.RoleFile()))
+			v.log(types.LogLevelDebug).Output(fmt.Sprintf("uploading role file to: '%s'...", entity.RoleFile()))
 			if err := v.comm.Upload(roleFileRemotePath, bytes.NewReader(roleFileBytes)); err != nil {
 				return err
 			}
@@ -377,6 +816,65 @@ func (v *RemoteMode) deployAnsibleData(plays []*types.Play) error {
 	return nil
 }
 
+// galaxyInstallPath returns the path galaxy_install content is installed to on the host,
+// a relative path is relative to the bootstrap directory.
+func (v *RemoteMode) galaxyInstallPath(path string) string {
+	if strings.HasPrefix(path, string(os.PathSeparator)) {
+		return path
+	}
+	return filepath.Join(v.remoteSettings.BootstrapDirectory(), path)
+}
+
+// ensureAnsible installs Ansible unless skip_install is set or an existing installation meets ensure_version.
+// With skip_install, an existing installation not meeting ensure_version fails the run.
+func (v *RemoteMode) ensureAnsible() error {
+	if image := v.remoteSettings.ContainerImage(); image != "" {
+		v.log(types.LogLevelInfo).Output(fmt.Sprintf("The plays run in the execution environment image '%s', skipping installation.", image))
+		return nil
+	}
+	if minimum := v.remoteSettings.EnsureVersion(); minimum != "" {
+		installed, err := v.existingAnsibleVersion()
+		if err != nil {
+			return err
+		}
+		if installed != "" && compareVersions(installed, minimum) >= 0 {
+			v.log(types.LogLevelInfo).Output(fmt.Sprintf("Ansible %s found on the host meets the minimum version %s, skipping installation.", installed, minimum))
+			return nil
+		}
+		if v.remoteSettings.SkipInstall() {
+			if installed == "" {
+				return fmt.Errorf("Ansible not found on the host, minimum version %s required", minimum)
+			}
+			return fmt.Errorf("Ansible %s found on the host does not meet the minimum version %s", installed, minimum)
+		}
+		if installed != "" {
+			v.log(types.LogLevelInfo).Output(fmt.Sprintf("Ansible %s found on the host does not meet the minimum version %s.", installed, minimum))
+		}
+	}
+	if v.remoteSettings.SkipInstall() {
+		return nil
+	}
+	return v.installAnsible(v.remoteSettings)
+}
+
+// existingAnsibleVersion returns the version of ansible-playbook on the host, taken from the virtualenv when one is used.
+// Returns an empty string when Ansible is not installed.
+func (v *RemoteMode) existingAnsibleVersion() (string, error) {
+	binary := "ansible-playbook"
+	if binDirectory := v.remoteSettings.VirtualenvBinDirectory(); binDirectory != "" {
+		binary = filepath.Join(binDirectory, binary)
+	}
+	var stdout bytes.Buffer
+	if err := v.runCommandOutput(fmt.Sprintf("/bin/sh -c 'if command -v \"%s\" >/dev/null 2>&1; then \"%s\" --version; fi'",
+		binary, binary), true, &stdout); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(stdout.String()) == "" {
+		return "", nil
+	}
+	return parseAnsibleVersion(stdout.String())
+}
+
 func (v *RemoteMode) installAnsible(remoteSettings *types.RemoteSettings) error {
 
 	var installerScript *bufio.Reader
@@ -389,14 +887,17 @@ func (v *RemoteMode) installAnsible(remoteSettings *types.RemoteSettings) error
 		}
 		defer file.Close()
 
-		v.o.Output(fmt.Sprintf("Installing Ansible using provided installer '%s'...", cleanInstallerPath))
+		v.log(types.LogLevelInfo).Output(fmt.Sprintf("Installing Ansible using provided installer '%s'...", cleanInstallerPath))
 
 		installerScript = bufio.NewReader(file)
 
 	} else {
 
 		embeddedInstaller := &ansibleInstaller{
-			AnsibleVersion: "ansible",
+			AnsibleVersion:      remoteSettings.InstallPackage(),
+			VirtualenvDirectory: remoteSettings.VirtualenvDirectory(),
+			Rootless:            remoteSettings.Rootless(),
+			WinRM:               remoteSettings.WSLDistribution() != "",
 		}
 
 		if remoteSettings.InstallVersion() != "" {
@@ -405,7 +906,21 @@ func (v *RemoteMode) installAnsible(remoteSettings *types.RemoteSettings) error
 				remoteSettings.InstallVersion())
 		}
 
-		v.o.Output(fmt.Sprintf("Installing Ansible '%s' using default installer...", embeddedInstaller.AnsibleVersion))
+		if remoteSettings.PackagesScriptPath() != "" {
+			if err := v.uploadPackagesScript(remoteSettings); err != nil {
+				return err
+			}
+			embeddedInstaller.PackagesScript = remoteSettings.RemotePackagesScriptPath()
+		}
+
+		if remoteSettings.OfflinePackagesDirectory() != "" {
+			if err := v.uploadOfflinePackages(remoteSettings); err != nil {
+				return err
+			}
+			embeddedInstaller.OfflineDirectory = remoteSettings.RemoteOfflinePackagesDirectory()
+		}
+
+		v.log(types.LogLevelInfo).Output(fmt.Sprintf("Installing Ansible '%s' using default installer...", embeddedInstaller.AnsibleVersion))
 
 		t := template.Must(template.New("installer").Parse(installerProgramTemplate))
 		var buf bytes.Buffer
@@ -421,21 +936,80 @@ func (v *RemoteMode) installAnsible(remoteSettings *types.RemoteSettings) error
 		return err
 	}
 
-	v.o.Output(fmt.Sprintf("Uploading Ansible installer program to '%s'...", remoteSettings.RemoteInstallerPath()))
+	v.log(types.LogLevelDebug).Output(fmt.Sprintf("Uploading Ansible installer program to '%s'...", remoteSettings.RemoteInstallerPath()))
 	if err := v.comm.UploadScript(remoteSettings.RemoteInstallerPath(), installerScript); err != nil {
 		return err
 	}
 
-	if err := v.runCommandSudo(fmt.Sprintf("/bin/sh -c '\"%s\" && rm \"%s\"'",
+	if err := v.verifyUploads(); err != nil {
+		return err
+	}
+
+	// the installer is kept for inspection with skip_cleanup:
+	if remoteSettings.SkipCleanup() {
+		if err := v.runCommandSudo(proxyCommand(fmt.Sprintf("/bin/sh -c '\"%s\"'", remoteSettings.RemoteInstallerPath()), remoteSettings)); err != nil {
+			return err
+		}
+	} else if err := v.runCommandSudo(proxyCommand(fmt.Sprintf("/bin/sh -c '\"%s\" && rm \"%s\"'",
 		remoteSettings.RemoteInstallerPath(),
-		remoteSettings.RemoteInstallerPath())); err != nil {
+		remoteSettings.RemoteInstallerPath()), remoteSettings)); err != nil {
 		return err
 	}
 
-	v.o.Output("Ansible installed.")
+	v.log(types.LogLevelInfo).Output("Ansible installed.")
 	return nil
 }
 
+// runBootstrapScript uploads and executes the custom bootstrap script, before Ansible is installed.
+func (v *RemoteMode) runBootstrapScript() error {
+	if v.remoteSettings.BootstrapScriptPath() == "" {
+		return nil
+	}
+	if err := v.uploadScript("bootstrap script", v.remoteSettings.BootstrapScriptPath(), v.remoteSettings.RemoteBootstrapScriptPath()); err != nil {
+		return err
+	}
+	if err := v.verifyUploads(); err != nil {
+		return err
+	}
+	v.log(types.LogLevelInfo).Output(fmt.Sprintf("Executing bootstrap script '%s'...", v.remoteSettings.RemoteBootstrapScriptPath()))
+	return v.runCommandSudo(proxyCommand(fmt.Sprintf("/bin/sh -c '\"%s\"'", v.remoteSettings.RemoteBootstrapScriptPath()), v.remoteSettings))
+}
+
+// uploadPackagesScript uploads the custom script installing the OS dependencies, executed by the default installer.
+func (v *RemoteMode) uploadPackagesScript(remoteSettings *types.RemoteSettings) error {
+	return v.uploadScript("packages script", remoteSettings.PackagesScriptPath(), remoteSettings.RemotePackagesScriptPath())
+}
+
+// uploadScript uploads a local script, the script is made executable.
+func (v *RemoteMode) uploadScript(description string, path string, destination string) error {
+	localPath, err := types.ResolvePath(path)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	v.log(types.LogLevelDebug).Output(fmt.Sprintf("Uploading %s '%s' to '%s'...", description, localPath, destination))
+	return v.comm.UploadScript(destination, file)
+}
+
+// uploadOfflinePackages uploads the pre-downloaded packages for an air-gapped installation.
+func (v *RemoteMode) uploadOfflinePackages(remoteSettings *types.RemoteSettings) error {
+	localDir, err := types.ResolvePath(remoteSettings.OfflinePackagesDirectory())
+	if err != nil {
+		return err
+	}
+	remoteDir := remoteSettings.RemoteOfflinePackagesDirectory()
+	// the directory is created by the upload, stale packages of an earlier run are removed:
+	if err := v.runCommandNoSudo(fmt.Sprintf("rm -rf \"%s\" && mkdir -p \"%s\"", remoteDir, filepath.Dir(remoteDir))); err != nil {
+		return err
+	}
+	v.log(types.LogLevelDebug).Output(fmt.Sprintf("Uploading offline packages '%s' to '%s'...", localDir, remoteDir))
+	return v.comm.UploadDir(remoteDir, localDir)
+}
+
 func (v *RemoteMode) uploadVaultPasswordOrIDFile(destination string, source string) (string, error) {
 
 	if source == "" {
@@ -450,7 +1024,7 @@ func (v *RemoteMode) uploadVaultPasswordOrIDFile(destination string, source stri
 	u1 := uuid.NewV4()
 	targetPath := filepath.Join(destination, fmt.Sprintf(".vault-file-%s", u1))
 
-	v.o.Output(fmt.Sprintf("Uploading ansible vault password file / ID to '%s'...", targetPath))
+	v.log(types.LogLevelDebug).Output(fmt.Sprintf("Uploading ansible vault password file / ID to '%s'...", targetPath))
 
 	file, err := os.Open(source)
 	if err != nil {
@@ -458,27 +1032,268 @@ func (v *RemoteMode) uploadVaultPasswordOrIDFile(destination string, source stri
 	}
 	defer file.Close()
 
-	if err := v.comm.Upload(targetPath, bufio.NewReader(file)); err != nil {
+	if err := v.uploadSecretFile(targetPath, bufio.NewReader(file)); err != nil {
 		return "", err
 	}
 
-	v.o.Output("Ansible vault password file uploaded.")
+	v.log(types.LogLevelDebug).Output("Ansible vault password file uploaded.")
 
 	return targetPath, nil
 }
 
+// uploadSecretFile uploads a secret to a file readable by the owner only, shredded after provisioning.
+func (v *RemoteMode) uploadSecretFile(targetPath string, contents io.Reader) error {
+	// the file is created readable by the owner only before the secret is written to it,
+	// the secret is sent over the upload session, never on a command line:
+	if err := v.runCommandNoSudo(secretFileCreateCommand(targetPath)); err != nil {
+		return err
+	}
+	v.uploadedSecretFiles = append(v.uploadedSecretFiles, targetPath)
+
+	if err := v.comm.Upload(targetPath, contents); err != nil {
+		return err
+	}
+	return v.runCommandNoSudo(fmt.Sprintf("chmod 0400 \"%s\"", targetPath))
+}
+
+// shredSecretFiles overwrites and removes the secret files uploaded to the host.
+func (v *RemoteMode) shredSecretFiles() {
+	for _, secretFile := range v.uploadedSecretFiles {
+		v.log(types.LogLevelDebug).Output(fmt.Sprintf("Shredding secret file '%s'...", secretFile))
+		// the connection user may no longer own the files:
+		if err := v.runCommand(secretFileShredCommand(secretFile), v.remoteSettings.BootstrapDirectoryOwner() != ""); err != nil {
+			v.o.Output(fmt.Sprintf("Failed shredding '%s': %v", secretFile, err))
+		}
+	}
+	v.uploadedSecretFiles = nil
+}
+
+func (v *RemoteMode) uploadAnsibleCfg(destination string, play *types.Play) error {
+
+	contents := play.AnsibleCfgContents()
+	if contents == "" {
+		return nil
+	}
+
+	u1 := uuid.NewV4()
+	targetPath := filepath.Join(destination, fmt.Sprintf(".ansible-%s.cfg", u1))
+
+	v.log(types.LogLevelDebug).Output(fmt.Sprintf("Uploading generated ansible.cfg to '%s'...", targetPath))
+
+	if err := v.comm.Upload(targetPath, strings.NewReader(contents)); err != nil {
+		return err
+	}
+
+	play.SetAnsibleCfgFile(targetPath)
+	return nil
+}
+
+func (v *RemoteMode) uploadBecomePassword(destination string, play *types.Play) error {
+
+	if !play.Become() || play.BecomePassword() == "" {
+		return nil
+	}
+
+	u1 := uuid.NewV4()
+	targetPath := filepath.Join(destination, fmt.Sprintf(".become-password-%s", u1))
+
+	v.log(types.LogLevelDebug).Output(fmt.Sprintf("Uploading become password file to '%s'...", targetPath))
+
+	if err := v.uploadSecretFile(targetPath, strings.NewReader(play.BecomePassword())); err != nil {
+		return err
+	}
+
+	v.log(types.LogLevelDebug).Output("Become password file uploaded.")
+
+	play.SetBecomePasswordFile(targetPath)
+	return nil
+}
+
+func (v *RemoteMode) uploadExtraVars(destination string, play *types.Play) error {
+
+	extraVars, err := play.ExtraVarsContents()
+	if err != nil {
+		return err
+	}
+	if len(extraVars) == 0 {
+		return nil
+	}
+
+	u1 := uuid.NewV4()
+	targetPath := filepath.Join(destination, fmt.Sprintf(".extra-vars-%s.json", u1))
+
+	v.log(types.LogLevelDebug).Output(fmt.Sprintf("Uploading extra vars file to '%s'...", targetPath))
+
+	if err := v.uploadSecretFile(targetPath, bytes.NewReader(extraVars)); err != nil {
+		return err
+	}
+
+	play.SetExtraVarsFile(targetPath)
+	return nil
+}
+
+func (v *RemoteMode) uploadExtraVarsFiles(destination string, play *types.Play) error {
+
+	if len(play.ExtraVarsFiles()) == 0 {
+		return nil
+	}
+
+	remotePaths := make([]string, 0)
+	for _, extraVarsFile := range play.ExtraVarsFiles() {
+		source, err := types.ResolvePath(extraVarsFile)
+		if err != nil {
+			return err
+		}
+
+		u1 := uuid.NewV4()
+		targetPath := filepath.Join(destination, fmt.Sprintf(".extra-vars-%s-%s", u1, filepath.Base(source)))
+
+		v.log(types.LogLevelDebug).Output(fmt.Sprintf("Uploading extra vars file '%s' to '%s'...", extraVarsFile, targetPath))
+
+		file, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		err = v.comm.Upload(targetPath, bufio.NewReader(file))
+		file.Close()
+		if err != nil {
+			return err
+		}
+		remotePaths = append(remotePaths, targetPath)
+	}
+
+	play.SetOverrideExtraVarsFiles(remotePaths)
+	return nil
+}
+
+func (v *RemoteMode) uploadExtraVarsVaultFiles(destination string, play *types.Play) error {
+
+	if len(play.ExtraVarsVaultFiles()) == 0 {
+		return nil
+	}
+
+	remotePaths := make([]string, 0)
+	for _, vaultFile := range play.ExtraVarsVaultFiles() {
+		source, err := types.ResolvePath(vaultFile)
+		if err != nil {
+			return err
+		}
+
+		u1 := uuid.NewV4()
+		targetPath := filepath.Join(destination, fmt.Sprintf(".extra-vars-vault-%s", u1))
+
+		v.log(types.LogLevelDebug).Output(fmt.Sprintf("Uploading encrypted extra vars file '%s' to '%s'...", vaultFile, targetPath))
+
+		file, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		err = v.comm.Upload(targetPath, bufio.NewReader(file))
+		file.Close()
+		if err != nil {
+			return err
+		}
+		remotePaths = append(remotePaths, targetPath)
+		v.uploadedVaultFiles = append(v.uploadedVaultFiles, targetPath)
+
+		if err := v.runCommandNoSudo(fmt.Sprintf("chmod 0400 \"%s\"", targetPath)); err != nil {
+			return err
+		}
+	}
+
+	play.SetOverrideExtraVarsVaultFiles(remotePaths)
+	return nil
+}
+
+func (v *RemoteMode) removeExtraVarsVaultFiles() {
+	for _, vaultFile := range v.uploadedVaultFiles {
+		v.log(types.LogLevelDebug).Output(fmt.Sprintf("Removing encrypted extra vars file '%s'...", vaultFile))
+		if err := v.runCommandNoSudo(fmt.Sprintf("rm -f \"%s\"", vaultFile)); err != nil {
+			v.o.Output(fmt.Sprintf("Failed removing '%s': %v", vaultFile, err))
+		}
+	}
+	v.uploadedVaultFiles = nil
+}
+
+func (v *RemoteMode) uploadOnFailurePlaybook(play *types.Play) error {
+
+	if play.OnFailure() == nil {
+		return nil
+	}
+
+	remotePlaybookPath, err := v.uploadPlaybookDirectory("on_failure playbook", play.OnFailure().FilePath())
+	if err != nil {
+		return err
+	}
+	play.OnFailure().SetOverrideFilePath(remotePlaybookPath)
+	return nil
+}
+
+// uploadDirectory uploads a directory, unless already uploaded, and returns the remote path of the directory.
+func (v *RemoteMode) uploadDirectory(description string, path string) (string, error) {
+	resolvedPath, err := types.ResolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	remoteDir := filepath.Join(v.remoteSettings.BootstrapDirectory(), v.getMD5Hash(resolvedPath))
+	dirExists, err := v.checkRemoteDirExists(remoteDir)
+	if err != nil {
+		return "", err
+	}
+	if dirExists {
+		v.log(types.LogLevelDebug).Output(fmt.Sprintf("The %s '%s' has been already uploaded.", description, resolvedPath))
+	} else {
+		v.log(types.LogLevelDebug).Output(fmt.Sprintf("Uploading %s '%s' to '%s'...", description, resolvedPath, remoteDir))
+		if err := v.comm.UploadDir(remoteDir, resolvedPath); err != nil {
+			return "", err
+		}
+	}
+	return remoteDir, nil
+}
+
+// uploadPlaybookDirectory uploads the entire parent directory of the playbook, unless already uploaded,
+// and returns the remote path of the playbook.
+func (v *RemoteMode) uploadPlaybookDirectory(description string, path string) (string, error) {
+
+	playbookPath, err := types.ResolvePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	// playbook file is at the top level of the module
+	// parse the playbook path's directory and upload the entire directory
+	playbookDir := filepath.Dir(playbookPath)
+	remotePlaybookDir := filepath.Join(v.remoteSettings.BootstrapDirectory(), v.getMD5Hash(playbookDir))
+
+	dirExists, err := v.checkRemoteDirExists(remotePlaybookDir)
+	if err != nil {
+		return "", err
+	}
+	if dirExists {
+		v.log(types.LogLevelDebug).Output(fmt.Sprintf("The %s '%s' directory '%s' has been already uploaded.", description, path, playbookDir))
+	} else {
+		v.log(types.LogLevelDebug).Output(fmt.Sprintf("Uploading the parent directory '%s' of %s '%s' to '%s'...", playbookDir, description, path, remotePlaybookDir))
+		// upload ansible source and playbook to the host
+		if err := v.comm.UploadDir(remotePlaybookDir, playbookDir); err != nil {
+			return "", err
+		}
+	}
+
+	return filepath.Join(remotePlaybookDir, filepath.Base(playbookPath)), nil
+}
+
 func (v *RemoteMode) writeInventory(destination string, play *types.Play) (string, error) {
 
 	if play.InventoryFile() != "" {
 
-		v.o.Output(fmt.Sprintf("Using provided inventory file '%s'...", play.InventoryFile()))
+		v.log(types.LogLevelDebug).Output(fmt.Sprintf("Using provided inventory file '%s'...", play.InventoryFile()))
 		source, err := types.ResolvePath(play.InventoryFile())
 		if err != nil {
 			return "", err
 		}
 		u1 := uuid.NewV4()
 		targetPath := filepath.Join(destination, fmt.Sprintf(".inventory-%s", u1))
-		v.o.Output(fmt.Sprintf("Uploading provided inventory file '%s' to '%s'...", play.InventoryFile(), targetPath))
+		v.log(types.LogLevelDebug).Output(fmt.Sprintf("Uploading provided inventory file '%s' to '%s'...", play.InventoryFile(), targetPath))
 
 		file, err := os.Open(source)
 		if err != nil {
@@ -490,18 +1305,29 @@ func (v *RemoteMode) writeInventory(destination string, play *types.Play) (strin
 			return "", err
 		}
 
-		v.o.Output("Ansible inventory uploaded.")
+		v.log(types.LogLevelDebug).Output("Ansible inventory uploaded.")
 
 		return targetPath, nil
 
 	}
 
 	templateData := inventoryTemplateRemoteData{
-		Hosts:  ensureLocalhostInHosts(play.Hosts()),
+		Hosts:  remoteInventoryHosts(play.Hosts(), v.connInfo.Host, v.remoteSettings.Orchestrate()),
 		Groups: play.Groups(),
 	}
+	if v.remoteSettings.WSLDistribution() != "" {
+		hosts := play.Hosts()
+		if len(hosts) == 0 {
+			hosts = []string{v.connInfo.Host}
+		}
+		templateData.Hosts = wslInventoryHosts(remoteInventoryHosts(hosts, v.connInfo.Host, v.remoteSettings.Orchestrate()), v.connInfo)
+	}
+
+	if v.remoteSettings.ContainerImage() != "" {
+		templateData.Hosts = containerInventoryHosts(templateData.Hosts, v.remoteSettings.ContainerHostRoot())
+	}
 
-	v.o.Output("Generating temporary ansible inventory...")
+	v.log(types.LogLevelDebug).Output("Generating temporary ansible inventory...")
 	t := template.Must(template.New("hosts").Parse(inventoryTemplateRemote))
 	var buf bytes.Buffer
 	err := t.Execute(&buf, templateData)
@@ -512,27 +1338,71 @@ func (v *RemoteMode) writeInventory(destination string, play *types.Play) (strin
 	u1 := uuid.NewV4()
 	targetPath := filepath.Join(destination, fmt.Sprintf(".inventory-%s", u1))
 
-	v.o.Output(fmt.Sprintf("Writing temporary ansible inventory to '%s'...", targetPath))
+	v.log(types.LogLevelDebug).Output(fmt.Sprintf("Writing temporary ansible inventory to '%s'...", targetPath))
 	if err := v.comm.Upload(targetPath, bytes.NewReader(buf.Bytes())); err != nil {
 		return "", err
 	}
 
-	v.o.Output("Ansible inventory written.")
+	v.log(types.LogLevelDebug).Output("Ansible inventory written.")
 	return targetPath, nil
 
 }
 
+// prepareBootstrapDirectory creates the bootstrap directory with the configured permissions.
+func (v *RemoteMode) prepareBootstrapDirectory() error {
+	if err := v.runCommandNoSudo(fmt.Sprintf("mkdir -p \"%s\"", v.remoteSettings.BootstrapDirectory())); err != nil {
+		return err
+	}
+	if mode := v.remoteSettings.BootstrapDirectoryMode(); mode != "" {
+		return v.runCommandNoSudo(fmt.Sprintf("chmod %s \"%s\"", mode, v.remoteSettings.BootstrapDirectory()))
+	}
+	return nil
+}
+
+// verifyUploads checks the files uploaded since the last verification against the local checksums,
+// a corrupted upload fails the provisioning before any uploaded file is used.
+func (v *RemoteMode) verifyUploads() error {
+	verifying, ok := v.comm.(*verifyingCommunicator)
+	if !ok || len(verifying.checksums) == 0 {
+		return nil
+	}
+	count := len(verifying.checksums)
+	manifestPath := filepath.Join(v.remoteSettings.BootstrapDirectory(), uploadChecksumsFile)
+	// the manifest itself is not verified:
+	if err := verifying.Communicator.Upload(manifestPath, strings.NewReader(verifying.manifest())); err != nil {
+		return err
+	}
+	v.log(types.LogLevelDebug).Output(fmt.Sprintf("Verifying checksums of %d uploaded files...", count))
+	if err := v.runCommandNoSudo(fmt.Sprintf("sha256sum --check --quiet \"%s\"", manifestPath)); err != nil {
+		return fmt.Errorf("uploaded files do not match the local files, the upload has been corrupted: %v", err)
+	}
+	return nil
+}
+
+// cleanupCommand returns the command removing the bootstrap data and the installer left on the host.
+func (v *RemoteMode) cleanupCommand() string {
+	command := fmt.Sprintf("rm -rf \"%s\"", v.remoteSettings.BootstrapDirectory())
+	if !v.remoteSettings.SkipInstall() {
+		command = fmt.Sprintf("%s \"%s\"", command, v.remoteSettings.RemoteInstallerPath())
+	}
+	if v.remoteSettings.UseSudo() {
+		command = fmt.Sprintf("sudo %s", command)
+	}
+	return command
+}
+
 func (v *RemoteMode) cleanupAfterBootstrap() {
-	v.o.Output("Cleaning up after bootstrap...")
-	v.runCommandNoSudo(fmt.Sprintf("rm -rf \"%s\"", v.remoteSettings.BootstrapDirectory()))
-	v.o.Output("Cleanup complete.")
+	v.log(types.LogLevelDebug).Output("Cleaning up after bootstrap...")
+	// the connection user may no longer own the files:
+	v.runCommand(fmt.Sprintf("rm -rf \"%s\"", v.remoteSettings.BootstrapDirectory()), v.remoteSettings.BootstrapDirectoryOwner() != "")
+	v.log(types.LogLevelDebug).Output("Cleanup complete.")
 }
 
 func (v *RemoteMode) checkRemoteDirExists(remoteDir string) (bool, error) {
 	magicErrorCode := 50
 	command := fmt.Sprintf("/bin/sh -c 'if [ -d \"%s\" ]; then exit %d; fi'", remoteDir, magicErrorCode)
 	if err := v.runCommandNoSudo(command); err != nil {
-		if strings.Contains(err.Error(), fmt.Sprintf("exited with non-zero exit status: %d,", magicErrorCode)) {
+		if exitStatusFromError(err) == magicErrorCode {
 			// we have found the exact match of the magic error,
 			// directory exists
 			return true, nil
@@ -542,6 +1412,47 @@ func (v *RemoteMode) checkRemoteDirExists(remoteDir string) (bool, error) {
 	return false, nil
 }
 
+// runPlayCommand runs the play command, terminating it on the target when the play timeout is exceeded.
+func (v *RemoteMode) runPlayCommand(play *types.Play, command string) error {
+	if play.Timeout() <= 0 {
+		return v.runAnsibleCommand(command)
+	}
+	timeout := time.Duration(play.Timeout()) * time.Second
+	err := v.runCommandSudo(withRemoteTimeout(containerCommand(command, v.remoteSettings), timeout))
+	if exitStatusFromError(err) == timeoutExitStatus {
+		return fmt.Errorf("Command '%s' did not finish within %s and has been terminated: %w", command, timeout, err)
+	}
+	return err
+}
+
+// sudoCommand prefixes the command with sudo, a password is read by sudo from the standard input
+// of the session, never from the command line.
+func sudoCommand(command string, password string) (string, io.Reader) {
+	if password == "" {
+		return fmt.Sprintf("sudo %s", command), nil
+	}
+	return fmt.Sprintf("sudo -S -p '' %s", command), strings.NewReader(password + "\n")
+}
+
+// runAnsibleCommand runs an Ansible command with sudo, in the execution environment container when configured.
+func (v *RemoteMode) runAnsibleCommand(command string) error {
+	return v.runCommandSudo(containerCommand(command, v.remoteSettings))
+}
+
+// log returns the output of the provisioner messages of the level.
+func (v *RemoteMode) log(level string) terraform.UIOutput {
+	return levelOutput(v.o, v.logLevel, level)
+}
+
+// ansibleCommandLine returns the command line executed on the host for an Ansible command, for print_only.
+func (v *RemoteMode) ansibleCommandLine(command string) string {
+	command = containerCommand(command, v.remoteSettings)
+	if v.remoteSettings.UseSudo() {
+		command, _ = sudoCommand(command, v.remoteSettings.SudoPassword())
+	}
+	return command
+}
+
 func (v *RemoteMode) runCommandSudo(command string) error {
 	return v.runCommand(command, true)
 }
@@ -551,9 +1462,15 @@ func (v *RemoteMode) runCommandNoSudo(command string) error {
 }
 
 func (v *RemoteMode) runCommand(command string, shouldSudo bool) error {
+	return v.runCommandOutput(command, shouldSudo, nil)
+}
+
+// runCommandOutput runs the command, the standard output is written to stdout instead of the provisioner output when given.
+func (v *RemoteMode) runCommandOutput(command string, shouldSudo bool, stdout io.Writer) error {
+	var stdin io.Reader
 	// Unless prevented, prefix the command with sudo
 	if shouldSudo && v.remoteSettings.UseSudo() {
-		command = fmt.Sprintf("sudo %s", command)
+		command, stdin = sudoCommand(command, v.remoteSettings.SudoPassword())
 	}
 
 	outR, outW := io.Pipe()
@@ -565,9 +1482,13 @@ func (v *RemoteMode) runCommand(command string, shouldSudo bool) error {
 
 	cmd := &remote.Cmd{
 		Command: command,
+		Stdin:   stdin,
 		Stdout:  outW,
 		Stderr:  errW,
 	}
+	if stdout != nil {
+		cmd.Stdout = stdout
+	}
 
 	err := v.comm.Start(cmd)
 	if err != nil {
@@ -577,8 +1498,8 @@ func (v *RemoteMode) runCommand(command string, shouldSudo bool) error {
 	err = cmd.Wait()
 	if err != nil {
 		if exitErr, ok := err.(*remote.ExitError); ok {
-			err = fmt.Errorf(
-				"Command '%q' exited with non-zero exit status: %d, reason %+v", cmd.Command, exitErr.ExitStatus, exitErr.Err)
+			err = newExitStatusError(exitErr.ExitStatus, fmt.Errorf(
+				"Command '%q' exited with non-zero exit status: %d, reason %+v", cmd.Command, exitErr.ExitStatus, exitErr.Err))
 		} else {
 			err = fmt.Errorf(
 				"Command '%q' failed, reason: %+v", cmd.Command, err)
@@ -604,6 +1525,52 @@ func (v *RemoteMode) copyOutput(r io.Reader, doneCh chan<- struct{}) {
 	}
 }
 
+// remoteInventoryHosts returns the hosts of the generated inventory, all executed locally on the host.
+// When orchestrating, only localhost, the first host and the host with the connection address are the host itself,
+// the other hosts are connected to over SSH from the host.
+func remoteInventoryHosts(hosts []string, connectionHost string, orchestrate bool) []inventoryTemplateRemoteDataHost {
+	inventoryHosts := make([]inventoryTemplateRemoteDataHost, 0)
+	for _, host := range ensureLocalhostInHosts(hosts) {
+		local := !orchestrate || host == "localhost" || host == connectionHost || (len(hosts) > 0 && host == hosts[0])
+		inventoryHosts = append(inventoryHosts, inventoryTemplateRemoteDataHost{Alias: host, Local: local})
+	}
+	return inventoryHosts
+}
+
+// wslInventoryHosts connects to the Windows host from WSL over WinRM, with the connection settings of the provisioner.
+// Only localhost is WSL itself.
+func wslInventoryHosts(hosts []inventoryTemplateRemoteDataHost, connInfo *connectionInfo) []inventoryTemplateRemoteDataHost {
+	for i, host := range hosts {
+		if !host.Local || host.Alias == "localhost" {
+			continue
+		}
+		vars := []string{
+			fmt.Sprintf("ansible_host=%s", connInfo.Host),
+			"ansible_connection=winrm",
+			fmt.Sprintf("ansible_user=%s", iniQuote(connInfo.User)),
+			fmt.Sprintf("ansible_password=%s", iniQuote(connInfo.Password)),
+		}
+		if connInfo.Port != 0 {
+			vars = append(vars, fmt.Sprintf("ansible_port=%d", connInfo.Port))
+		}
+		if connInfo.Https {
+			vars = append(vars, "ansible_winrm_scheme=https")
+		} else {
+			vars = append(vars, "ansible_winrm_scheme=http")
+		}
+		if connInfo.Ntlm {
+			vars = append(vars, "ansible_winrm_transport=ntlm")
+		} else {
+			vars = append(vars, "ansible_winrm_transport=basic")
+		}
+		if connInfo.Insecure {
+			vars = append(vars, "ansible_winrm_server_cert_validation=ignore")
+		}
+		hosts[i] = inventoryTemplateRemoteDataHost{Alias: host.Alias, Vars: vars}
+	}
+	return hosts
+}
+
 func ensureLocalhostInHosts(hosts []string) []string {
 	found := false
 	for _, host := range hosts {
@@ -3,7 +3,9 @@ package mode
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
@@ -19,7 +21,7 @@ import (
 func TestRemoteInventTemplateGenerates(t *testing.T) {
 	originalHosts := []string{"host1", "host2"}
 	templateData := inventoryTemplateRemoteData{
-		Hosts:  ensureLocalhostInHosts(originalHosts),
+		Hosts:  remoteInventoryHosts(originalHosts, "", false),
 		Groups: []string{"group1", "group2"},
 	}
 
@@ -37,6 +39,183 @@ func TestRemoteInventTemplateGenerates(t *testing.T) {
 	}
 }
 
+func TestRemoteInventoryTemplateOrchestrate(t *testing.T) {
+	templateData := inventoryTemplateRemoteData{
+		Hosts:  remoteInventoryHosts([]string{"controller", "10.0.0.11", "10.0.0.12"}, "10.0.0.10", true),
+		Groups: []string{"cluster"},
+	}
+	tpl := template.Must(template.New("hosts").Parse(inventoryTemplateRemote))
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, templateData); err != nil {
+		t.Fatalf("Expected template to generate correctly but received: %v", err)
+	}
+	expected := "[cluster]\nlocalhost ansible_connection=local\ncontroller ansible_connection=local\n10.0.0.11\n10.0.0.12\n"
+	if !strings.Contains(buf.String(), expected) {
+		t.Fatalf("Expected the other hosts to be connected to over SSH but got: %s", buf.String())
+	}
+}
+
+func TestRemoteInstallerTemplateVirtualenv(t *testing.T) {
+	tpl := template.Must(template.New("installer").Parse(installerProgramTemplate))
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, &ansibleInstaller{AnsibleVersion: "ansible-core==2.15.5", VirtualenvDirectory: "/opt/ansible"}); err != nil {
+		t.Fatalf("Expected template to generate correctly but received: %v", err)
+	}
+	for _, expected := range []string{"python3 -m venv \"/opt/ansible\"", "\"/opt/ansible/bin/pip\" install \"ansible-core==2.15.5\""} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Fatalf("Expected '%s' in the installer but got: %s", expected, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := tpl.Execute(&buf, &ansibleInstaller{AnsibleVersion: "ansible"}); err != nil {
+		t.Fatalf("Expected template to generate correctly but received: %v", err)
+	}
+	if strings.Contains(buf.String(), "python3 -m venv") {
+		t.Fatalf("Expected a system wide installation without a virtualenv but got: %s", buf.String())
+	}
+
+	user := test.GetCurrentUser(t)
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{})
+	play.SetOverrideBinDirectory("/opt/ansible/bin")
+	command, err := play.ToCommand(types.LocalModeAnsibleArgs{Username: user.Username})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(command, " '/opt/ansible/bin/ansible' all --module-name='ping'") {
+		t.Fatalf("Expected Ansible to be executed from the virtualenv but got: %s", command)
+	}
+}
+
+func TestRemoteInstallerTemplatePackageManagers(t *testing.T) {
+	tpl := template.Must(template.New("installer").Parse(installerProgramTemplate))
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, &ansibleInstaller{AnsibleVersion: "ansible", VirtualenvDirectory: "/opt/ansible"}); err != nil {
+		t.Fatalf("Expected template to generate correctly but received: %v", err)
+	}
+	for _, expected := range []string{"apk add --no-cache python3 py3-pip", "dnf install -y", "yum install -y", "zypper --non-interactive install", "apt-get install -y", "pkg install -y", "install_dependencies venv"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Fatalf("Expected '%s' in the installer but got: %s", expected, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := tpl.Execute(&buf, &ansibleInstaller{AnsibleVersion: "ansible", PackagesScript: "/tmp/tf-ansible-bootstrap/tf-ansible-packages"}); err != nil {
+		t.Fatalf("Expected template to generate correctly but received: %v", err)
+	}
+	if !strings.Contains(buf.String(), "/bin/sh \"/tmp/tf-ansible-bootstrap/tf-ansible-packages\" \"$1\"") {
+		t.Fatalf("Expected the packages script to install the dependencies but got: %s", buf.String())
+	}
+	if strings.Contains(buf.String(), "apt-get") {
+		t.Fatalf("Expected the packages script to replace the package manager detection but got: %s", buf.String())
+	}
+}
+
+func TestRemoteInstallerTemplateRootless(t *testing.T) {
+	data := schema.TestResourceDataRaw(t, map[string]*schema.Schema{
+		"remote": types.NewRemoteSchema(),
+	}, map[string]interface{}{
+		"remote": []interface{}{map[string]interface{}{"rootless": true}},
+	})
+	remoteSettings := types.NewRemoteSettingsFromInterface(data.GetOk("remote"))
+	if remoteSettings.UseSudo() {
+		t.Fatal("Expected a rootless installation not to use sudo")
+	}
+	if remoteSettings.VirtualenvBinDirectory() != ".tf-ansible/venv/bin" {
+		t.Fatalf("Expected the default virtualenv in the home directory but got: %s", remoteSettings.VirtualenvBinDirectory())
+	}
+
+	tpl := template.Must(template.New("installer").Parse(installerProgramTemplate))
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, &ansibleInstaller{
+		AnsibleVersion:      "ansible",
+		VirtualenvDirectory: remoteSettings.VirtualenvDirectory(),
+		Rootless:            true,
+	}); err != nil {
+		t.Fatalf("Expected template to generate correctly but received: %v", err)
+	}
+	installer := buf.String()
+	venv := installer[strings.Index(installer, "tf-ansible/venv"):strings.Index(installer, "exit 0")]
+	if !strings.Contains(venv, "python3 -m pip install --user virtualenv") {
+		t.Fatalf("Expected a fallback to a user installation of virtualenv but got: %s", installer)
+	}
+	for _, privileged := range []string{"apt-get", "yum", "sudo"} {
+		if strings.Contains(venv, privileged) {
+			t.Fatalf("Expected the rootless installer not to use '%s' but got: %s", privileged, installer)
+		}
+	}
+}
+
+func TestRemoteInstallerTemplateOffline(t *testing.T) {
+	tpl := template.Must(template.New("installer").Parse(installerProgramTemplate))
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, &ansibleInstaller{
+		AnsibleVersion:      "ansible==8.5.0",
+		VirtualenvDirectory: "/opt/ansible",
+		OfflineDirectory:    "/tmp/tf-ansible-bootstrap/ansible-offline-packages",
+	}); err != nil {
+		t.Fatalf("Expected template to generate correctly but received: %v", err)
+	}
+	installer := buf.String()
+	offline := installer[strings.Index(installer, "air-gapped"):strings.Index(installer, "exit 0")]
+	if !strings.Contains(offline, "--no-index --find-links=\"/tmp/tf-ansible-bootstrap/ansible-offline-packages\" \"ansible==8.5.0\"") {
+		t.Fatalf("Expected an installation from the uploaded packages but got: %s", installer)
+	}
+	for _, online := range []string{"curl", "apt-get", "yum"} {
+		if strings.Contains(offline, online) {
+			t.Fatalf("Expected the offline installer not to use '%s' but got: %s", online, installer)
+		}
+	}
+}
+
+func TestRemoteCleanupCommand(t *testing.T) {
+	newRemoteSettings := func(remote map[string]interface{}) *types.RemoteSettings {
+		data := schema.TestResourceDataRaw(t, map[string]*schema.Schema{
+			"remote": types.NewRemoteSchema(),
+		}, map[string]interface{}{
+			"remote": []interface{}{remote},
+		})
+		return types.NewRemoteSettingsFromInterface(data.GetOk("remote"))
+	}
+
+	v := &RemoteMode{remoteSettings: newRemoteSettings(map[string]interface{}{
+		"skip_cleanup":        true,
+		"bootstrap_directory": "/var/lib/terraform",
+	})}
+	if command := v.cleanupCommand(); command != "sudo rm -rf \"/var/lib/terraform/tf-ansible-bootstrap\" \"/tmp/tf-ansible-installer\"" {
+		t.Fatalf("Unexpected cleanup command: %s", command)
+	}
+
+	v = &RemoteMode{remoteSettings: newRemoteSettings(map[string]interface{}{
+		"skip_cleanup": true,
+		"skip_install": true,
+		"use_sudo":     false,
+	})}
+	if command := v.cleanupCommand(); command != "rm -rf \"/tmp/tf-ansible-bootstrap\"" {
+		t.Fatalf("Unexpected cleanup command: %s", command)
+	}
+}
+
+func TestRemoteSudoCommandPassword(t *testing.T) {
+	command, stdin := sudoCommand("/tmp/tf-ansible-installer", "")
+	if command != "sudo /tmp/tf-ansible-installer" || stdin != nil {
+		t.Fatalf("Expected password-less sudo but got: %s", command)
+	}
+
+	command, stdin = sudoCommand("/tmp/tf-ansible-installer", "s3cr3t")
+	if command != "sudo -S -p '' /tmp/tf-ansible-installer" {
+		t.Fatalf("Expected sudo to read the password from the standard input but got: %s", command)
+	}
+	if strings.Contains(command, "s3cr3t") {
+		t.Fatalf("Expected the password not to be on the command line but got: %s", command)
+	}
+	var buf bytes.Buffer
+	buf.ReadFrom(stdin)
+	if buf.String() != "s3cr3t\n" {
+		t.Fatalf("Expected the password on the standard input but got: %q", buf.String())
+	}
+}
+
 func TestIntegrationRemoteModeProvisioning(t *testing.T) {
 
 	remoteTempDirectory := test.CreateTempAnsibleRemoteTmpDir(t)
@@ -131,25 +310,40 @@ func TestIntegrationRemoteModeProvisioning(t *testing.T) {
 		runErr := modeRemote.Run([]*types.Play{
 			types.NewPlayFromMapInterface(playModule, defaultSettings),
 			types.NewPlayFromMapInterface(playPlaybook, defaultSettings),
-		})
+		}, &Settings{Remote: remoteSettings})
 		if runErr != nil {
-			t.Fatalf("Unexpected error: %v", runErr)
+			t.Errorf("Unexpected error: %v", runErr)
 		}
 	}()
 
+	// prepare the bootstrap directory:
+	test.CommandTest(t, sshServer, fmt.Sprintf("mkdir -p \"%s", bootstrapDirectory))
+
 	// upload ansible data for th first play:
 	test.CommandTest(t, sshServer, fmt.Sprintf("mkdir -p \"%s", bootstrapDirectory))
+	// upload vault ID for the first play, readable by the owner only:
+	test.CommandTest(t, sshServer, fmt.Sprintf("(umask 077 && : > \"%s", bootstrapDirectory))
 	test.CommandTest(t, sshServer, fmt.Sprintf("scp -vt %s", bootstrapDirectory))
-	// upload vault ID for the first play:
+	test.CommandTest(t, sshServer, fmt.Sprintf("chmod 0400 \"%s", bootstrapDirectory))
+	// upload extra vars for the first play, readable by the owner only:
+	test.CommandTest(t, sshServer, fmt.Sprintf("(umask 077 && : > \"%s", bootstrapDirectory))
 	test.CommandTest(t, sshServer, fmt.Sprintf("scp -vt %s", bootstrapDirectory))
+	test.CommandTest(t, sshServer, fmt.Sprintf("chmod 0400 \"%s", bootstrapDirectory))
+	test.CommandTest(t, sshServer, fmt.Sprintf("scp -vt %s", bootstrapDirectory)) // an inventory is written
 
 	// upload ansible data for the second play:
 	test.CommandTest(t, sshServer, fmt.Sprintf("mkdir -p \"%s", bootstrapDirectory))
 	test.CommandTest(t, sshServer, "/bin/sh -c 'if [ -d") // playbook always checks if we have the source playbook dir uploaded
 	test.CommandTest(t, sshServer, fmt.Sprintf("scp -rvt %s", bootstrapDirectory))
 	test.CommandTest(t, sshServer, fmt.Sprintf("scp -vt %s", bootstrapDirectory)) // an inventory is written
-	// upload vault ID for the second play:
+	// upload vault ID for the second play, readable by the owner only:
+	test.CommandTest(t, sshServer, fmt.Sprintf("(umask 077 && : > \"%s", bootstrapDirectory))
+	test.CommandTest(t, sshServer, fmt.Sprintf("scp -vt %s", bootstrapDirectory))
+	test.CommandTest(t, sshServer, fmt.Sprintf("chmod 0400 \"%s", bootstrapDirectory))
+	// upload extra vars for the second play, readable by the owner only:
+	test.CommandTest(t, sshServer, fmt.Sprintf("(umask 077 && : > \"%s", bootstrapDirectory))
 	test.CommandTest(t, sshServer, fmt.Sprintf("scp -vt %s", bootstrapDirectory))
+	test.CommandTest(t, sshServer, fmt.Sprintf("chmod 0400 \"%s", bootstrapDirectory))
 
 	// upload installer:
 	test.CommandTest(t, sshServer, fmt.Sprintf("mkdir -p \"%s", remoteTempDirectory))
@@ -163,9 +357,67 @@ func TestIntegrationRemoteModeProvisioning(t *testing.T) {
 	test.CommandTest(t, sshServer, fmt.Sprintf("sudo ANSIBLE_FORCE_COLOR=true ansible all --module-name='%s'", testModuleName))
 	test.CommandTest(t, sshServer, "sudo ANSIBLE_FORCE_COLOR=true ansible-playbook")
 
+	// shred the vault password and extra vars files of both plays:
+	test.CommandTest(t, sshServer, fmt.Sprintf("/bin/sh -c 'shred -u -z \"%s", bootstrapDirectory))
+	test.CommandTest(t, sshServer, fmt.Sprintf("/bin/sh -c 'shred -u -z \"%s", bootstrapDirectory))
+	test.CommandTest(t, sshServer, fmt.Sprintf("/bin/sh -c 'shred -u -z \"%s", bootstrapDirectory))
+	test.CommandTest(t, sshServer, fmt.Sprintf("/bin/sh -c 'shred -u -z \"%s", bootstrapDirectory))
+
 	// cleanup ansible data:
 	test.CommandTest(t, sshServer, fmt.Sprintf("rm -rf \"%s", bootstrapDirectory))
 
 	wg.Wait()
 
 }
+
+func TestRemoteGalaxyInstallPath(t *testing.T) {
+	data := schema.TestResourceDataRaw(t, map[string]*schema.Schema{
+		"remote": types.NewRemoteSchema(),
+	}, map[string]interface{}{
+		"remote": []interface{}{map[string]interface{}{"bootstrap_directory": "/var/lib/terraform"}},
+	})
+	v := &RemoteMode{remoteSettings: types.NewRemoteSettingsFromInterface(data.GetOk("remote"))}
+	if path := v.galaxyInstallPath("galaxy-roles"); path != "/var/lib/terraform/tf-ansible-bootstrap/galaxy-roles" {
+		t.Fatalf("Expected a relative path under the bootstrap directory but got: %s", path)
+	}
+	if path := v.galaxyInstallPath("/etc/ansible/roles"); path != "/etc/ansible/roles" {
+		t.Fatalf("Expected an absolute path to be used as is but got: %s", path)
+	}
+}
+
+func TestRemoteBootstrapScript(t *testing.T) {
+	bootstrapDirectory, err := ioutil.TempDir("", "bootstrap")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(bootstrapDirectory)
+	if err := os.MkdirAll(filepath.Join(bootstrapDirectory, "tf-ansible-bootstrap"), 0755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	marker := filepath.Join(bootstrapDirectory, "ca-certificates-installed")
+	script := filepath.Join(bootstrapDirectory, "bootstrap.sh")
+	if err := ioutil.WriteFile(script, []byte(fmt.Sprintf("#!/bin/sh\ntouch \"%s\"\n", marker)), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data := schema.TestResourceDataRaw(t, map[string]*schema.Schema{
+		"remote": types.NewRemoteSchema(),
+	}, map[string]interface{}{
+		"remote": []interface{}{map[string]interface{}{
+			"use_sudo":              false,
+			"bootstrap_directory":   bootstrapDirectory,
+			"bootstrap_script_path": script,
+		}},
+	})
+	v := &RemoteMode{
+		o:              new(terraform.MockUIOutput),
+		comm:           &localCommunicator{},
+		remoteSettings: types.NewRemoteSettingsFromInterface(data.GetOk("remote")),
+	}
+	if err := v.runBootstrapScript(); err != nil {
+		t.Fatalf("Expected the bootstrap script to run but got: %v", err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Fatalf("Expected the bootstrap script to be executed on the host but got: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package mode
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+type fakeMode struct{}
+
+func (v *fakeMode) Validate(plays []*types.Play, settings *Settings) error { return nil }
+func (v *fakeMode) Run(plays []*types.Play, settings *Settings) error      { return nil }
+func (v *fakeMode) Cleanup() error                                         { return nil }
+
+func newRegistryTestConfig(t *testing.T, raw map[string]interface{}) *schema.ResourceData {
+	provisionerSchema := make(map[string]*schema.Schema)
+	for _, definition := range Registered() {
+		if definition.Schema != nil {
+			provisionerSchema[definition.Name] = definition.Schema
+		}
+	}
+	return schema.TestResourceDataRaw(t, provisionerSchema, raw)
+}
+
+func TestModeRegistry(t *testing.T) {
+	Register(&Definition{
+		Name: "fake",
+		Schema: &schema.Schema{
+			Type:     schema.TypeSet,
+			Optional: true,
+			MaxItems: 1,
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"endpoint": &schema.Schema{Type: schema.TypeString, Required: true},
+				},
+			},
+		},
+		New: func(o terraform.UIOutput, s *terraform.InstanceState, settings *Settings) (Mode, error) {
+			return &fakeMode{}, nil
+		},
+	})
+
+	names := make(map[string]bool)
+	for _, definition := range Registered() {
+		names[definition.Name] = true
+	}
+	for _, expected := range []string{DefaultMode, "remote", "tower", "kubernetes", "pull_bootstrap", "fake"} {
+		if !names[expected] {
+			t.Fatalf("Expected the %s mode to be registered but got: %v", expected, names)
+		}
+	}
+
+	for _, testCase := range []struct {
+		raw      map[string]interface{}
+		expected string
+	}{
+		{raw: map[string]interface{}{}, expected: DefaultMode},
+		{raw: map[string]interface{}{"remote": []interface{}{map[string]interface{}{"use_sudo": false}}}, expected: "remote"},
+		{raw: map[string]interface{}{"fake": []interface{}{map[string]interface{}{"endpoint": "https://fake"}}}, expected: "fake"},
+	} {
+		definition, err := Lookup(newRegistryTestConfig(t, testCase.raw))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if definition.Name != testCase.expected {
+			t.Fatalf("Expected the %s mode for %v but got: %s", testCase.expected, testCase.raw, definition.Name)
+		}
+	}
+
+	m, err := Registered()[len(Registered())-1].New(nil, nil, &Settings{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := m.(*fakeMode); !ok {
+		t.Fatalf("Expected the registered factory to be used but got: %T", m)
+	}
+}
@@ -0,0 +1,296 @@
+package mode
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/events"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+const (
+	towerAPIPath        = "/api/v2"
+	towerRequestTimeout = 60 * time.Second
+	towerEventsPageSize = 200
+)
+
+// towerFinishedStatuses are the job statuses after which the job does not run anymore.
+var towerFinishedStatuses = map[string]bool{
+	"successful": true,
+	"failed":     true,
+	"error":      true,
+	"canceled":   true,
+}
+
+// TowerMode represents AWX / Ansible Tower provisioner mode.
+type TowerMode struct {
+	o            terraform.UIOutput
+	host         string
+	settings     *types.TowerSettings
+	token        string
+	client       *http.Client
+	pollInterval time.Duration
+}
+
+type towerListResponse struct {
+	Count   int `json:"count"`
+	Results []struct {
+		ID int `json:"id"`
+	} `json:"results"`
+}
+
+type towerLaunchResponse struct {
+	Job           int                    `json:"job"`
+	IgnoredFields map[string]interface{} `json:"ignored_fields"`
+}
+
+type towerJobResponse struct {
+	Status          string `json:"status"`
+	JobExplanation  string `json:"job_explanation"`
+	ResultTraceback string `json:"result_traceback"`
+}
+
+type towerJobEventsResponse struct {
+	Next *string `json:"next"`
+	// Results are decoded by the events package:
+	Results []json.RawMessage `json:"results"`
+}
+
+// NewTowerMode returns configured AWX / Ansible Tower provisioner.
+func NewTowerMode(o terraform.UIOutput, s *terraform.InstanceState, settings *types.TowerSettings) (*TowerMode, error) {
+	token, err := settings.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token == "" && settings.Username() == "" {
+		return nil, fmt.Errorf("Tower token, token_env or username must be set")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if settings.Insecure() {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &TowerMode{
+		o:            newMaskingOutput(o, []string{token, settings.Password()}),
+		host:         s.Ephemeral.ConnInfo["host"],
+		settings:     settings,
+		token:        token,
+		client:       &http.Client{Transport: transport, Timeout: towerRequestTimeout},
+		pollInterval: time.Duration(settings.PollInterval()) * time.Second,
+	}, nil
+}
+
+// Validate does nothing, the plays are not used in tower mode.
+func (v *TowerMode) Validate(plays []*types.Play, settings *Settings) error {
+	return nil
+}
+
+// Cleanup does nothing, a job is canceled by Run when it times out.
+func (v *TowerMode) Cleanup() error {
+	return nil
+}
+
+// Run launches the job template, streams the job events and waits for the job to finish.
+func (v *TowerMode) Run(plays []*types.Play, settings *Settings) error {
+	options := settings.RunOptions
+
+	templateID, err := v.resolveID("job_templates", "job template", v.settings.JobTemplate())
+	if err != nil {
+		return err
+	}
+
+	launch := make(map[string]interface{})
+	if v.settings.Inventory() != "" {
+		inventoryID, err := v.resolveID("inventories", "inventory", v.settings.Inventory())
+		if err != nil {
+			return err
+		}
+		launch["inventory"] = inventoryID
+	}
+	limit := v.settings.Limit()
+	if limit == "" {
+		limit = v.host
+	}
+	if limit != "" {
+		launch["limit"] = limit
+	}
+	extraVars, err := v.settings.ExtraVars()
+	if err != nil {
+		return err
+	}
+	if len(extraVars) > 0 {
+		launch["extra_vars"] = extraVars
+	}
+
+	if dryRun := options.dryRun(); dryRun != "" {
+		v.o.Output(fmt.Sprintf("tower: %s, job template %d (%s) not launched, limit: '%s'",
+			dryRun, templateID, v.settings.JobTemplate(), limit))
+		return nil
+	}
+
+	launched := &towerLaunchResponse{}
+	if err := v.call(http.MethodPost, fmt.Sprintf("/job_templates/%d/launch/", templateID), launch, launched); err != nil {
+		return err
+	}
+	for field := range launched.IgnoredFields {
+		v.o.Output(fmt.Sprintf("tower: '%s' ignored by job template %d, enable prompt on launch to use it", field, templateID))
+	}
+	v.o.Output(fmt.Sprintf("tower: launched job %d from job template %d, limit: '%s'", launched.Job, templateID, limit))
+
+	return v.waitForJob(options.runContext(), launched.Job)
+}
+
+// waitForJob polls the job until it finishes, writing the job events to the output,
+// the job is canceled when it runs for longer than the timeout or when the context is done.
+func (v *TowerMode) waitForJob(ctx context.Context, jobID int) error {
+	var deadline time.Time
+	if v.settings.Timeout() > 0 {
+		deadline = time.Now().Add(time.Duration(v.settings.Timeout()) * time.Second)
+	}
+
+	counter := 0
+	result := events.NewResult()
+	for {
+		job := &towerJobResponse{}
+		if err := v.call(http.MethodGet, fmt.Sprintf("/jobs/%d/", jobID), nil, job); err != nil {
+			return err
+		}
+		// events are read after the status, such that all events of a finished job are written:
+		next, err := v.outputJobEvents(jobID, counter, result)
+		if err != nil {
+			return err
+		}
+		counter = next
+
+		if towerFinishedStatuses[job.Status] {
+			if job.Status != "successful" {
+				return fmt.Errorf("Tower job %d finished with status '%s': %s%s", jobID, job.Status,
+					strings.TrimSpace(job.JobExplanation+" "+job.ResultTraceback), describeFailures(result))
+			}
+			v.o.Output(fmt.Sprintf("tower: job %d successful", jobID))
+			return nil
+		}
+
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			if err := v.call(http.MethodPost, fmt.Sprintf("/jobs/%d/cancel/", jobID), nil, nil); err != nil {
+				v.o.Output(fmt.Sprintf("tower: failed to cancel job %d: %v", jobID, err))
+			}
+			return fmt.Errorf("Tower job %d timed out after %d seconds and was canceled", jobID, v.settings.Timeout())
+		}
+
+		select {
+		case <-ctx.Done():
+			if err := v.call(http.MethodPost, fmt.Sprintf("/jobs/%d/cancel/", jobID), nil, nil); err != nil {
+				v.o.Output(fmt.Sprintf("tower: failed to cancel job %d: %v", jobID, err))
+			}
+			return fmt.Errorf("Tower job %d was canceled: %v", jobID, ctx.Err())
+		case <-time.After(v.pollInterval):
+		}
+	}
+}
+
+// outputJobEvents writes the output of the job events following the counter, adds the events to the result
+// and returns the last counter written.
+func (v *TowerMode) outputJobEvents(jobID int, counter int, result *events.Result) (int, error) {
+	for {
+		page := &towerJobEventsResponse{}
+		path := fmt.Sprintf("/jobs/%d/job_events/?order_by=counter&counter__gt=%d&page_size=%d", jobID, counter, towerEventsPageSize)
+		if err := v.call(http.MethodGet, path, nil, page); err != nil {
+			return counter, err
+		}
+		for _, data := range page.Results {
+			event, err := result.AddRunnerEvent(data)
+			if err != nil {
+				return counter, err
+			}
+			for _, line := range strings.Split(event.Stdout, "\n") {
+				if strings.TrimSpace(line) != "" {
+					v.o.Output(line)
+				}
+			}
+			if event.Counter > counter {
+				counter = event.Counter
+			}
+		}
+		if page.Next == nil || len(page.Results) == 0 {
+			return counter, nil
+		}
+	}
+}
+
+// resolveID returns the ID of the named object, numeric values are used as the ID.
+func (v *TowerMode) resolveID(kind string, description string, nameOrID string) (int, error) {
+	if id, err := strconv.Atoi(nameOrID); err == nil {
+		return id, nil
+	}
+	list := &towerListResponse{}
+	if err := v.call(http.MethodGet, fmt.Sprintf("/%s/?name=%s", kind, url.QueryEscape(nameOrID)), nil, list); err != nil {
+		return 0, err
+	}
+	if list.Count == 0 || len(list.Results) == 0 {
+		return 0, fmt.Errorf("Tower %s '%s' not found", description, nameOrID)
+	}
+	if list.Count > 1 {
+		return 0, fmt.Errorf("Tower %s name '%s' is not unique, use the ID instead", description, nameOrID)
+	}
+	return list.Results[0].ID, nil
+}
+
+// call executes the API request, the response body is decoded into the result when the result is not nil.
+func (v *TowerMode) call(method string, path string, body interface{}, result interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	} else {
+		reader = bytes.NewReader([]byte{})
+	}
+
+	req, err := http.NewRequest(method, v.settings.URL()+towerAPIPath+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if v.token != "" {
+		req.Header.Set("Authorization", "Bearer "+v.token)
+	} else {
+		req.SetBasicAuth(v.settings.Username(), v.settings.Password())
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Tower request %s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("Tower response of %s %s could not be read: %v", method, path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Tower request %s %s failed with status %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	if result != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, result); err != nil {
+			return fmt.Errorf("Tower response of %s %s could not be decoded: %v", method, path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package mode
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+type fakeTower struct {
+	lock      sync.Mutex
+	launched  map[string]interface{}
+	statuses  []string
+	canceled  bool
+	authorize string
+}
+
+func (f *fakeTower) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.authorize = r.Header.Get("Authorization")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/job_templates/":
+		if r.URL.Query().Get("name") != "Deploy web" {
+			fmt.Fprint(w, `{"count": 0, "results": []}`)
+			return
+		}
+		fmt.Fprint(w, `{"count": 1, "results": [{"id": 7}]}`)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/inventories/":
+		fmt.Fprint(w, `{"count": 1, "results": [{"id": 3}]}`)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v2/job_templates/7/launch/":
+		json.NewDecoder(r.Body).Decode(&f.launched)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"job": 42, "ignored_fields": {}}`)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/jobs/42/":
+		status := f.statuses[0]
+		if len(f.statuses) > 1 {
+			f.statuses = f.statuses[1:]
+		}
+		fmt.Fprintf(w, `{"status": "%s", "job_explanation": ""}`, status)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/jobs/42/job_events/":
+		if r.URL.Query().Get("counter__gt") != "0" {
+			fmt.Fprint(w, `{"next": null, "results": []}`)
+			return
+		}
+		fmt.Fprint(w, `{"next": null, "results": [
+			{"counter": 1, "stdout": "PLAY [web] *****"},
+			{"counter": 2, "stdout": ""},
+			{"counter": 3, "stdout": "ok: [10.0.0.10]\nchanged: [10.0.0.10]"},
+			{"counter": 4, "event": "runner_on_failed", "stdout": "fatal: [10.0.0.10]: FAILED!",
+			 "event_data": {"task": "Restart nginx", "host": "10.0.0.10", "res": {"msg": "Unable to restart service nginx"}}}
+		]}`)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v2/jobs/42/cancel/":
+		f.canceled = true
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTowerTestMode(t *testing.T, url string, tower map[string]interface{}) (*TowerMode, *[]string) {
+	tower["url"] = url
+	data := schema.TestResourceDataRaw(t, map[string]*schema.Schema{
+		"tower": types.NewTowerSchema(),
+	}, map[string]interface{}{
+		"tower": []interface{}{tower},
+	})
+	instanceState := &terraform.InstanceState{
+		Ephemeral: terraform.EphemeralState{
+			ConnInfo: map[string]string{"type": "ssh", "host": "10.0.0.10"},
+		},
+	}
+	lines := make([]string, 0)
+	output := &terraform.MockUIOutput{OutputFn: func(line string) { lines = append(lines, line) }}
+	v, err := NewTowerMode(output, instanceState, types.NewTowerSettingsFromInterface(data.GetOk("tower")))
+	if err != nil {
+		t.Fatalf("Expected tower mode but got an error: %v", err)
+	}
+	v.pollInterval = 0
+	return v, &lines
+}
+
+func TestTowerModeLaunchesJobTemplate(t *testing.T) {
+	tower := &fakeTower{statuses: []string{"pending", "running", "successful"}}
+	server := httptest.NewServer(tower)
+	defer server.Close()
+
+	v, lines := newTowerTestMode(t, server.URL+"/", map[string]interface{}{
+		"token":           "tower-token",
+		"job_template":    "Deploy web",
+		"inventory":       "production",
+		"extra_vars":      map[string]interface{}{"release": "1.2.0"},
+		"extra_vars_json": `{"replicas": 3}`,
+	})
+	if err := v.Run(nil, &Settings{}); err != nil {
+		t.Fatalf("Expected the job to succeed but got: %v", err)
+	}
+
+	if tower.authorize != "Bearer tower-token" {
+		t.Fatalf("Expected the token to be used but got: '%s'", tower.authorize)
+	}
+	if tower.launched["limit"] != "10.0.0.10" {
+		t.Fatalf("Expected the job to be limited to the host but got: %v", tower.launched["limit"])
+	}
+	if tower.launched["inventory"] != float64(3) {
+		t.Fatalf("Expected the inventory ID but got: %v", tower.launched["inventory"])
+	}
+	extraVars := tower.launched["extra_vars"].(map[string]interface{})
+	if extraVars["release"] != "1.2.0" || extraVars["replicas"] != float64(3) {
+		t.Fatalf("Expected the extra vars to be sent but got: %v", extraVars)
+	}
+
+	written := strings.Join(*lines, "\n")
+	for _, expected := range []string{"PLAY [web] *****", "ok: [10.0.0.10]", "changed: [10.0.0.10]", "job 42 successful"} {
+		if !strings.Contains(written, expected) {
+			t.Fatalf("Expected '%s' in the output but got: %s", expected, written)
+		}
+	}
+	if strings.Count(written, "PLAY [web]") != 1 {
+		t.Fatalf("Expected every job event to be written once but got: %s", written)
+	}
+}
+
+func TestTowerModeJobFailure(t *testing.T) {
+	tower := &fakeTower{statuses: []string{"running", "failed"}}
+	server := httptest.NewServer(tower)
+	defer server.Close()
+
+	v, _ := newTowerTestMode(t, server.URL, map[string]interface{}{
+		"token":        "tower-token",
+		"job_template": "7",
+		"limit":        "web",
+	})
+	err := v.Run(nil, &Settings{})
+	if err == nil || !strings.Contains(err.Error(), "status 'failed'") {
+		t.Fatalf("Expected the failed job to fail the provisioner but got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "task 'Restart nginx' failed on '10.0.0.10': Unable to restart service nginx") {
+		t.Fatalf("Expected the failed task in the error but got: %v", err)
+	}
+	if tower.launched["limit"] != "web" {
+		t.Fatalf("Expected the configured limit but got: %v", tower.launched["limit"])
+	}
+}
+
+func TestTowerModeTimeoutCancelsJob(t *testing.T) {
+	tower := &fakeTower{statuses: []string{"running"}}
+	server := httptest.NewServer(tower)
+	defer server.Close()
+
+	v, _ := newTowerTestMode(t, server.URL, map[string]interface{}{
+		"username":     "admin",
+		"password":     "secret",
+		"job_template": "7",
+		"timeout":      1,
+	})
+	v.pollInterval = 100 * time.Millisecond
+	if err := v.Run(nil, &Settings{}); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("Expected the job to time out but got: %v", err)
+	}
+	if !tower.canceled {
+		t.Fatalf("Expected the job to be canceled")
+	}
+	if !strings.HasPrefix(tower.authorize, "Basic ") {
+		t.Fatalf("Expected basic authentication but got: '%s'", tower.authorize)
+	}
+}
+
+func TestTowerModePlanOnly(t *testing.T) {
+	tower := &fakeTower{}
+	server := httptest.NewServer(tower)
+	defer server.Close()
+
+	v, _ := newTowerTestMode(t, server.URL, map[string]interface{}{
+		"token":        "tower-token",
+		"job_template": "Deploy web",
+	})
+	if err := v.Run(nil, &Settings{RunOptions: RunOptions{PlanOnly: true}}); err != nil {
+		t.Fatalf("Expected plan only to succeed but got: %v", err)
+	}
+	if tower.launched != nil {
+		t.Fatalf("Expected no job to be launched with plan only")
+	}
+
+	v, _ = newTowerTestMode(t, server.URL, map[string]interface{}{
+		"token":        "tower-token",
+		"job_template": "Unknown",
+	})
+	if err := v.Run(nil, &Settings{RunOptions: RunOptions{PlanOnly: true}}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("Expected an unknown job template to fail but got: %v", err)
+	}
+}
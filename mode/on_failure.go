@@ -0,0 +1,26 @@
+package mode
+
+import (
+	"fmt"
+
+	"github.com/radekg/terraform-provisioner-ansible/types"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// runOnFailurePlay executes the rollback playbook of a failed play using the given runner.
+// The play error is always returned, a failing rollback playbook is reported only.
+func runOnFailurePlay(o terraform.UIOutput, play *types.Play, playErr error, run func(rollback *types.Play) error) error {
+	if playErr == nil {
+		return nil
+	}
+	rollback := play.OnFailurePlay()
+	if rollback == nil {
+		return playErr
+	}
+	o.Output(fmt.Sprintf("play failed, running on_failure playbook '%s'", play.OnFailure().FilePath()))
+	if err := run(rollback); err != nil {
+		o.Output(fmt.Sprintf("on_failure playbook failed: %v", err))
+	}
+	return playErr
+}
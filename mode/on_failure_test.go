@@ -0,0 +1,67 @@
+package mode
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+func TestRunOnFailurePlay(t *testing.T) {
+	rollbackPlaybook := test.WriteTempVaultIDFile(t, "- hosts: all\n")
+	defer os.Remove(rollbackPlaybook)
+	onFailure := schema.TestResourceDataRaw(t, map[string]*schema.Schema{
+		"on_failure": types.NewOnFailureSchema(),
+	}, map[string]interface{}{
+		"on_failure": []interface{}{
+			map[string]interface{}{
+				"file_path":  rollbackPlaybook,
+				"extra_vars": map[string]interface{}{"reason": "rollback"},
+			},
+		},
+	})
+
+	user := test.GetCurrentUser(t)
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"inventory_file": "/tmp/inventory",
+		"extra_vars":     map[string]interface{}{"environment": "staging"},
+		"before":         []interface{}{"true"},
+		"retries":        3,
+		"on_failure":     onFailure.Get("on_failure").(*schema.Set),
+	})
+
+	var rollbackCommand string
+	run := func(rollback *types.Play) error {
+		command, err := rollback.ToCommand(types.LocalModeAnsibleArgs{Username: user.Username})
+		if err != nil {
+			return err
+		}
+		rollbackCommand = command
+		if len(rollback.Before()) > 0 || rollback.Retries() > 0 {
+			t.Fatalf("Expected hooks and retries not to apply to the rollback play")
+		}
+		return errors.New("rollback failed")
+	}
+
+	if err := runOnFailurePlay(new(terraform.MockUIOutput), play, nil, run); err != nil {
+		t.Fatalf("Expected no error for a successful play but got: %v", err)
+	}
+	if rollbackCommand != "" {
+		t.Fatalf("Expected the rollback playbook not to run for a successful play")
+	}
+
+	playErr := newExitStatusError(2, errors.New("exit status 2"))
+	if err := runOnFailurePlay(new(terraform.MockUIOutput), play, playErr, run); err != playErr {
+		t.Fatalf("Expected the play error to be returned but got: %v", err)
+	}
+	for _, expected := range []string{rollbackPlaybook, "--inventory-file='/tmp/inventory'", `"environment":"staging"`, `"reason":"rollback"`} {
+		if !strings.Contains(rollbackCommand, expected) {
+			t.Fatalf("Expected the rollback command to contain '%s' but got: %s", expected, rollbackCommand)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package mode
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/radekg/terraform-provisioner-ansible/types"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// playNode is an enabled play with the indexes of the plays it has to wait for.
+type playNode struct {
+	play         *types.Play
+	label        string
+	dependencies []int
+}
+
+// newPlayGraph builds the execution graph of enabled plays.
+// A play with depends_on waits for the named plays only. Otherwise, the list order applies:
+// a play waits for all preceding plays, consecutive parallel plays wait for the plays before the first of them.
+func newPlayGraph(plays []*types.Play) ([]*playNode, error) {
+	nodes := make([]*playNode, 0)
+	names := make(map[string]int)
+	disabled := make(map[string]bool)
+
+	for idx, play := range plays {
+		if play.Name() != "" {
+			if _, ok := names[play.Name()]; ok || disabled[play.Name()] {
+				return nil, fmt.Errorf("play name '%s' is not unique", play.Name())
+			}
+		}
+		if !play.Enabled() {
+			if play.Name() != "" {
+				disabled[play.Name()] = true
+			}
+			continue
+		}
+		label := fmt.Sprintf("play %d", idx+1)
+		if play.Name() != "" {
+			label = play.Name()
+			names[play.Name()] = len(nodes)
+		}
+		nodes = append(nodes, &playNode{play: play, label: label})
+	}
+
+	groupStart := 0
+	for idx, node := range nodes {
+		switch {
+		case len(node.play.DependsOn()) > 0:
+			for _, name := range node.play.DependsOn() {
+				if disabled[name] {
+					// disabled plays are skipped, there is nothing to wait for
+					continue
+				}
+				dependency, ok := names[name]
+				if !ok {
+					return nil, fmt.Errorf("%s depends on an unknown play '%s'", node.label, name)
+				}
+				node.dependencies = append(node.dependencies, dependency)
+			}
+			groupStart = idx + 1
+		case node.play.Parallel():
+			for dependency := 0; dependency < groupStart; dependency++ {
+				node.dependencies = append(node.dependencies, dependency)
+			}
+		default:
+			for dependency := 0; dependency < idx; dependency++ {
+				node.dependencies = append(node.dependencies, dependency)
+			}
+			groupStart = idx + 1
+		}
+	}
+
+	if _, err := sortPlayGraph(nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// sortPlayGraph returns the plays in an order satisfying the dependencies,
+// the list order is kept wherever possible.
+func sortPlayGraph(nodes []*playNode) ([]*types.Play, error) {
+	sorted := make([]*types.Play, 0, len(nodes))
+	done := make([]bool, len(nodes))
+	for len(sorted) < len(nodes) {
+		progress := false
+		for idx, node := range nodes {
+			if done[idx] || !dependenciesDone(node, done) {
+				continue
+			}
+			done[idx] = true
+			sorted = append(sorted, node.play)
+			progress = true
+			break
+		}
+		if !progress {
+			cycle := make([]string, 0)
+			for idx, node := range nodes {
+				if !done[idx] {
+					cycle = append(cycle, node.label)
+				}
+			}
+			return nil, fmt.Errorf("plays have circular dependencies: %s", strings.Join(cycle, ", "))
+		}
+	}
+	return sorted, nil
+}
+
+// orderPlays returns enabled plays in the execution order, used when plays are executed one by one.
+func orderPlays(plays []*types.Play) ([]*types.Play, error) {
+	nodes, err := newPlayGraph(plays)
+	if err != nil {
+		return nil, err
+	}
+	return sortPlayGraph(nodes)
+}
+
+func dependenciesDone(node *playNode, done []bool) bool {
+	for _, dependency := range node.dependencies {
+		if !done[dependency] {
+			return false
+		}
+	}
+	return true
+}
+
+type playResult struct {
+	index int
+	err   error
+}
+
+// runPlayGraph executes every play as soon as all plays it depends on have succeeded,
+// at most maxParallel at a time, 0 means no limit. Once a play fails, no further plays are started;
+// plays already running are awaited and all errors are reported.
+func (v *LocalMode) runPlayGraph(nodes []*playNode, settings *localRunSettings, maxParallel int) error {
+	if maxParallel <= 0 {
+		maxParallel = len(nodes)
+	}
+
+	started := make([]bool, len(nodes))
+	done := make([]bool, len(nodes))
+	results := make(chan playResult)
+	running := 0
+	errs := make([]error, 0)
+	failed := make([]string, 0)
+
+	for {
+		if len(errs) == 0 {
+			for idx, node := range nodes {
+				if running >= maxParallel {
+					break
+				}
+				if started[idx] || !dependenciesDone(node, done) {
+					continue
+				}
+				started[idx] = true
+				running++
+				// with more than one play, the lines of every play are tagged with the play:
+				o := v.o
+				if len(nodes) > 1 {
+					o = newPrefixedOutput(v.o, fmt.Sprintf("[%s] ", node.label))
+				}
+				go func(idx int, node *playNode, o terraform.UIOutput) {
+					results <- playResult{index: idx, err: v.runPlay(o, node.play, settings)}
+				}(idx, node, o)
+			}
+		}
+
+		if running == 0 {
+			break
+		}
+
+		result := <-results
+		running--
+		if result.err != nil {
+			errs = append(errs, result.err)
+			failed = append(failed, nodes[result.index].label)
+			if len(errs) == 1 && running > 0 {
+				v.o.Output(fmt.Sprintf("%s failed, waiting for %d running plays to finish...", nodes[result.index].label, running))
+			}
+			continue
+		}
+		done[result.index] = true
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		messages := make([]string, 0, len(errs))
+		for idx, err := range errs {
+			messages = append(messages, fmt.Sprintf("[%s] %v", failed[idx], err))
+		}
+		return fmt.Errorf("%d plays failed:\n%s", len(errs), strings.Join(messages, "\n"))
+	}
+}
+
+// prefixedOutput prefixes every line with a static string,
+// lines of different plays can be told apart, also when running concurrently.
+type prefixedOutput struct {
+	o      terraform.UIOutput
+	prefix string
+}
+
+func newPrefixedOutput(o terraform.UIOutput, prefix string) terraform.UIOutput {
+	return &prefixedOutput{o: o, prefix: prefix}
+}
+
+// Output implements terraform.UIOutput.
+func (v *prefixedOutput) Output(line string) {
+	v.o.Output(fmt.Sprintf("%s%s", v.prefix, line))
+}
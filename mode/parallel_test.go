@@ -0,0 +1,84 @@
+package mode
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+func TestPlayGraphKeepsListOrderAndParallelGroups(t *testing.T) {
+	nodes, err := newPlayGraph([]*types.Play{
+		test.GetNewDefaultPlay(t, map[string]interface{}{}),
+		test.GetNewDefaultPlay(t, map[string]interface{}{"parallel": true}),
+		test.GetNewDefaultPlay(t, map[string]interface{}{"parallel": true}),
+		test.GetNewDefaultPlay(t, map[string]interface{}{"parallel": true, "enabled": false}),
+		test.GetNewDefaultPlay(t, map[string]interface{}{"parallel": true}),
+		test.GetNewDefaultPlay(t, map[string]interface{}{}),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := [][]int{{}, {0}, {0}, {0}, {0, 1, 2, 3}}
+	if len(nodes) != len(expected) {
+		t.Fatalf("Expected %d enabled plays but got: %d", len(expected), len(nodes))
+	}
+	for idx, dependencies := range expected {
+		if fmt.Sprintf("%v", nodes[idx].dependencies) != fmt.Sprintf("%v", dependencies) {
+			t.Fatalf("Expected play %d to depend on %v but got: %v", idx, dependencies, nodes[idx].dependencies)
+		}
+	}
+	if nodes[3].label != "play 5" {
+		t.Fatalf("Expected labels to follow the configured play numbers but got: %s", nodes[3].label)
+	}
+}
+
+func TestOrderPlaysFollowsDependsOn(t *testing.T) {
+	plays, err := orderPlays([]*types.Play{
+		test.GetNewDefaultPlay(t, map[string]interface{}{"name": "db"}),
+		test.GetNewDefaultPlay(t, map[string]interface{}{"name": "app", "depends_on": []interface{}{"db", "cache"}}),
+		test.GetNewDefaultPlay(t, map[string]interface{}{"name": "cache", "depends_on": []interface{}{"db"}}),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	names := make([]string, 0)
+	for _, play := range plays {
+		names = append(names, play.Name())
+	}
+	if strings.Join(names, ",") != "db,cache,app" {
+		t.Fatalf("Expected plays ordered by dependencies but got: %v", names)
+	}
+}
+
+func TestPlayGraphRejectsInvalidDependencies(t *testing.T) {
+	for expected, plays := range map[string][]*types.Play{
+		"unknown play 'missing'": {
+			test.GetNewDefaultPlay(t, map[string]interface{}{"name": "app", "depends_on": []interface{}{"missing"}}),
+		},
+		"circular dependencies: a, b": {
+			test.GetNewDefaultPlay(t, map[string]interface{}{"name": "a", "depends_on": []interface{}{"b"}}),
+			test.GetNewDefaultPlay(t, map[string]interface{}{"name": "b", "depends_on": []interface{}{"a"}}),
+		},
+		"'a' is not unique": {
+			test.GetNewDefaultPlay(t, map[string]interface{}{"name": "a"}),
+			test.GetNewDefaultPlay(t, map[string]interface{}{"name": "a"}),
+		},
+	} {
+		if _, err := newPlayGraph(plays); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Expected an error containing '%s' but got: %v", expected, err)
+		}
+	}
+}
+
+func TestPrefixedOutput(t *testing.T) {
+	output := new(terraform.MockUIOutput)
+	newPrefixedOutput(output, "[play 2] ").Output("ok: [localhost]")
+	if output.OutputMessage != "[play 2] ok: [localhost]" {
+		t.Fatalf("Expected a prefixed line but got: '%s'", output.OutputMessage)
+	}
+}
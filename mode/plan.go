@@ -0,0 +1,20 @@
+package mode
+
+import (
+	"fmt"
+
+	"github.com/radekg/terraform-provisioner-ansible/types"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// runPlan lists hosts and tasks the play command would touch, nothing is executed on the hosts.
+func runPlan(o terraform.UIOutput, play *types.Play, command types.Commands, run func(types.Commands) error) error {
+	planCommand := play.ToPlanCommands(command)
+	if planCommand == nil {
+		o.Output("plan_only: galaxy_install, pull and module sequence plays can not be listed, skipping")
+		return nil
+	}
+	o.Output(fmt.Sprintf("plan_only: listing hosts and tasks: %s", planCommand))
+	return run(planCommand)
+}
@@ -0,0 +1,212 @@
+package mode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/radekg/terraform-provisioner-ansible/types"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// defaultPlayHashDirectory is relative to the Terraform working directory, next to the Terraform plugins and modules.
+const defaultPlayHashDirectory = ".terraform/ansible-play-hashes"
+
+// playHashKey identifies the play provisioning a target across runs, also after the resource was tainted.
+// Must be computed before the playbook is pointed at a temporary or remote location.
+func playHashKey(target string, play *types.Play) string {
+	identity := play.Name()
+	if identity == "" {
+		switch entity := play.Entity().(type) {
+		case *types.Playbook:
+			identity = fmt.Sprintf("playbook:%s:%s:%s:%s", entity.FilePath(), entity.Repo(), entity.BundleURL(), entity.Path())
+		case *types.Module:
+			identity = fmt.Sprintf("module:%s", strings.Join(entity.Modules(), ","))
+		default:
+			identity = fmt.Sprintf("%T", entity)
+		}
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s", target, identity)))
+	return hex.EncodeToString(sum[:])
+}
+
+// playInputsHash hashes everything the result of the play depends on: hosts and the inventory,
+// the extra vars and variable files, the playbook directory tree, roles and the module arguments.
+// Returns an empty string for plays which are not hashed, these are always executed.
+// The excluded directory, the hash store, is not hashed when it is within the playbook directory.
+func playInputsHash(play *types.Play, excluded string) (string, error) {
+	digest := sha256.New()
+
+	fmt.Fprintf(digest, "hosts:%s\ngroups:%s\nlimit:%s\nbecome:%v:%s\ncheck:%v\n",
+		strings.Join(play.Hosts(), ","), strings.Join(play.Groups(), ","), play.Limit(),
+		play.Become(), play.BecomeUser(), play.Check())
+
+	if play.InventoryFile() != "" {
+		if err := hashPath(digest, excluded, play.InventoryFile()); err != nil {
+			return "", err
+		}
+	}
+
+	extraVars, err := play.ExtraVarsContents()
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(digest, "extra_vars:%s\n", string(extraVars))
+	for _, path := range append(append([]string{}, play.ExtraVarsFiles()...), play.ExtraVarsVaultFiles()...) {
+		if err := hashPath(digest, excluded, path); err != nil {
+			return "", err
+		}
+	}
+
+	switch entity := play.Entity().(type) {
+	case *types.Playbook:
+		fmt.Fprintf(digest, "tags:%s\nskip_tags:%s\nstart_at_task:%s\n",
+			strings.Join(entity.Tags(), ","), strings.Join(entity.SkipTags(), ","), entity.StartAtTask())
+		playbookPath, err := types.ResolvePath(entity.FilePath())
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(digest, "playbook:%s\n", filepath.Base(playbookPath))
+		if err := hashPath(digest, excluded, filepath.Dir(playbookPath)); err != nil {
+			return "", err
+		}
+		for _, additionalPath := range entity.AdditionalFilePaths() {
+			resolved, err := types.ResolvePath(additionalPath)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(digest, "additional:%s\n", filepath.Base(resolved))
+			if err := hashPath(digest, excluded, filepath.Dir(resolved)); err != nil {
+				return "", err
+			}
+		}
+		for _, rolesPath := range entity.RolesPath() {
+			if err := hashPath(digest, excluded, rolesPath); err != nil {
+				return "", err
+			}
+		}
+		for _, collectionsPath := range entity.CollectionsPath() {
+			if err := hashPath(digest, excluded, collectionsPath); err != nil {
+				return "", err
+			}
+		}
+	case *types.Module:
+		for _, step := range entity.Steps() {
+			fmt.Fprintf(digest, "module:%s\nargs:%s\n", step.Module(), types.ModuleArgs(step.Args()))
+		}
+	default:
+		return "", nil
+	}
+
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+// hashPath hashes a file or a directory tree, with paths relative to the given path,
+// such that the same contents at a different location hash the same.
+// Git metadata, the Terraform working directory and the excluded directory are skipped.
+func hashPath(digest hash.Hash, excluded string, path string) error {
+	resolved, err := types.ResolvePath(path)
+	if err != nil {
+		return err
+	}
+	files := make([]string, 0)
+	err = filepath.Walk(resolved, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && (info.Name() == ".git" || info.Name() == ".terraform" || file == excluded) {
+			return filepath.SkipDir
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		relative, _ := filepath.Rel(resolved, file)
+		fmt.Fprintf(digest, "file:%s\n", filepath.ToSlash(relative))
+		in, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(digest, in)
+		in.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// playHash is the key and the inputs hash of a play to store after a successful run.
+type playHash struct {
+	key    string
+	inputs string
+}
+
+// playHashStore persists the input hashes of successfully executed plays.
+type playHashStore struct {
+	directory string
+}
+
+func newPlayHashStore(directory string) *playHashStore {
+	if directory == "" {
+		directory = defaultPlayHashDirectory
+	}
+	if absolute, err := filepath.Abs(directory); err == nil {
+		directory = absolute
+	}
+	return &playHashStore{directory: directory}
+}
+
+// Unchanged returns true when the stored hash for the key equals the given hash.
+func (v *playHashStore) Unchanged(key, inputsHash string) bool {
+	if inputsHash == "" {
+		return false
+	}
+	stored, err := ioutil.ReadFile(filepath.Join(v.directory, key))
+	return err == nil && strings.TrimSpace(string(stored)) == inputsHash
+}
+
+// Store persists the hash for the key.
+func (v *playHashStore) Store(key, inputsHash string) error {
+	if inputsHash == "" {
+		return nil
+	}
+	if err := os.MkdirAll(v.directory, 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(v.directory, key), []byte(inputsHash+"\n"), 0600)
+}
+
+// checkUnchangedPlay returns true when the play is to be skipped because its inputs did not change
+// since the last successful run, and the hash to store after a successful run.
+func checkUnchangedPlay(o terraform.UIOutput, store *playHashStore, key string, play *types.Play) (bool, string, error) {
+	if !play.SkipUnchanged() {
+		return false, "", nil
+	}
+	inputsHash, err := playInputsHash(play, store.directory)
+	if err != nil {
+		return false, "", err
+	}
+	if play.Force() {
+		o.Output("force is set, executing the play regardless of unchanged inputs")
+		return false, inputsHash, nil
+	}
+	if store.Unchanged(key, inputsHash) {
+		return true, inputsHash, nil
+	}
+	return false, inputsHash, nil
+}
@@ -0,0 +1,102 @@
+package mode
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+)
+
+func TestPlayInputsHashDetectsChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "play-hash")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for path, contents := range map[string]string{
+		"a/site.yml":                    "- hosts: all\n",
+		"a/roles/web/tasks/main.yml":    "- ping:\n",
+		"copy/site.yml":                 "- hosts: all\n",
+		"copy/roles/web/tasks/main.yml": "- ping:\n",
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(path)), 0755); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, path), []byte(contents), 0644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	newPlay := func(playbook string) (string, string) {
+		play := test.GetNewDefaultPlay(t, map[string]interface{}{
+			"playbook":       []interface{}{map[string]interface{}{"file_path": playbook}},
+			"skip_unchanged": true,
+		})
+		inputsHash, err := playInputsHash(play, "")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return playHashKey("10.0.0.5", play), inputsHash
+	}
+
+	key, original := newPlay(filepath.Join(dir, "a/site.yml"))
+	if _, copied := newPlay(filepath.Join(dir, "copy/site.yml")); copied != original {
+		t.Fatalf("Expected the same contents at a different location to hash the same")
+	}
+
+	store := newPlayHashStore(filepath.Join(dir, "hashes"))
+	if store.Unchanged(key, original) {
+		t.Fatalf("Expected a play without a stored hash to be changed")
+	}
+	if err := store.Store(key, original); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !store.Unchanged(key, original) {
+		t.Fatalf("Expected the stored hash to match")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "a/roles/web/tasks/main.yml"), []byte("- setup:\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, changed := newPlay(filepath.Join(dir, "a/site.yml")); store.Unchanged(key, changed) {
+		t.Fatalf("Expected a role change to change the hash")
+	}
+}
+
+func TestCheckUnchangedPlayForce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "play-hash")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	playbook := filepath.Join(dir, "site.yml")
+	if err := ioutil.WriteFile(playbook, []byte("- hosts: all\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	store := newPlayHashStore(filepath.Join(dir, "hashes"))
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"playbook":       []interface{}{map[string]interface{}{"file_path": playbook}},
+		"skip_unchanged": true,
+	})
+	key := playHashKey("10.0.0.5", play)
+	unchanged, inputsHash, err := checkUnchangedPlay(new(terraform.MockUIOutput), store, key, play)
+	if err != nil || unchanged {
+		t.Fatalf("Expected the first run to execute the play but got: %v, %v", unchanged, err)
+	}
+	store.Store(key, inputsHash)
+	if unchanged, _, _ := checkUnchangedPlay(new(terraform.MockUIOutput), store, key, play); !unchanged {
+		t.Fatalf("Expected the second run to skip the play")
+	}
+
+	play = test.GetNewDefaultPlay(t, map[string]interface{}{
+		"playbook":       []interface{}{map[string]interface{}{"file_path": playbook}},
+		"skip_unchanged": true,
+		"force":          true,
+	})
+	if unchanged, _, _ := checkUnchangedPlay(new(terraform.MockUIOutput), store, key, play); unchanged {
+		t.Fatalf("Expected force to execute the play")
+	}
+}
@@ -0,0 +1,33 @@
+package mode
+
+import (
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/events"
+)
+
+// recapOutput is a UIOutput passing every line to the wrapped output
+// and collecting the events and the PLAY RECAP of ansible-playbook.
+type recapOutput struct {
+	o         terraform.UIOutput
+	collector *events.Collector
+}
+
+func newRecapOutput(o terraform.UIOutput) *recapOutput {
+	return &recapOutput{o: o, collector: events.NewCollector()}
+}
+
+// Output implements terraform.UIOutput.
+func (v *recapOutput) Output(line string) {
+	v.o.Output(line)
+	v.collector.Line(line)
+}
+
+// Recap returns the collected PLAY RECAP, empty when the output did not contain one.
+func (v *recapOutput) Recap() events.Stats {
+	return v.collector.Result().Stats
+}
+
+// Result returns the collected events and PLAY RECAP.
+func (v *recapOutput) Result() *events.Result {
+	return v.collector.Result()
+}
@@ -0,0 +1,233 @@
+package mode
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/radekg/terraform-provisioner-ansible/types"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// fetchPlaybookBundle downloads the playbook bundle, verifies the checksum and extracts it
+// to a temporary directory, then points the playbook at the file within the bundle.
+// Returns an empty string when the playbook is not sourced from a bundle.
+// The caller is responsible for removing the directory.
+func fetchPlaybookBundle(o terraform.UIOutput, play *types.Play, workDirectory string) (string, error) {
+	playbook, ok := play.Entity().(*types.Playbook)
+	if !ok || playbook.BundleURL() == "" {
+		return "", nil
+	}
+
+	dir, err := ioutil.TempDir(workDirectory, "ansible-playbook-bundle")
+	if err != nil {
+		return "", err
+	}
+
+	archive := filepath.Join(dir, ".bundle")
+	o.Output(fmt.Sprintf("Downloading playbook bundle '%s'...", playbook.BundleURL()))
+	if err := downloadPlaybookBundle(playbook.BundleURL(), archive); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	if playbook.BundleChecksum() != "" {
+		if err := verifyPlaybookBundleChecksum(archive, playbook.BundleChecksum()); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+
+	contents := filepath.Join(dir, "bundle")
+	o.Output(fmt.Sprintf("Extracting playbook bundle to '%s'...", contents))
+	if err := extractPlaybookBundle(archive, playbook.BundleURL(), contents); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	if err := pointPlaybookAt(playbook, contents, fmt.Sprintf("bundle '%s'", playbook.BundleURL())); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// downloadPlaybookBundle fetches an http(s) URL directly, s3:// and gs:// URLs with the aws and gsutil
+// command line tools, such that the credentials configured on the machine running Terraform apply.
+func downloadPlaybookBundle(bundleURL, destination string) error {
+	var cmd *exec.Cmd
+	switch {
+	case strings.HasPrefix(bundleURL, "s3://"):
+		cmd = exec.Command("aws", "s3", "cp", "--only-show-errors", bundleURL, destination)
+	case strings.HasPrefix(bundleURL, "gs://"):
+		cmd = exec.Command("gsutil", "-q", "cp", bundleURL, destination)
+	default:
+		return downloadPlaybookBundleHTTP(bundleURL, destination)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Error downloading playbook bundle '%s': %v: %s", bundleURL, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func downloadPlaybookBundleHTTP(bundleURL, destination string) error {
+	response, err := http.Get(bundleURL)
+	if err != nil {
+		return fmt.Errorf("Error downloading playbook bundle '%s': %v", bundleURL, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("Error downloading playbook bundle '%s': %s", bundleURL, response.Status)
+	}
+	file, err := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, response.Body); err != nil {
+		return fmt.Errorf("Error downloading playbook bundle '%s': %v", bundleURL, err)
+	}
+	return nil
+}
+
+// verifyPlaybookBundleChecksum compares the file digest with a sha256:<hex> or sha512:<hex> checksum.
+func verifyPlaybookBundleChecksum(path, checksum string) error {
+	algorithm, expected := types.SplitChecksum(checksum)
+	var digest hash.Hash
+	switch algorithm {
+	case "sha512":
+		digest = sha512.New()
+	default:
+		digest = sha256.New()
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := io.Copy(digest, file); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(digest.Sum(nil)); !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("playbook bundle checksum mismatch, expected %s:%s, got %s:%s", algorithm, expected, algorithm, actual)
+	}
+	return nil
+}
+
+// extractPlaybookBundle extracts a .zip or a .tar.gz / .tgz archive, the format is established from the URL.
+func extractPlaybookBundle(archive, bundleURL, destination string) error {
+	if err := os.MkdirAll(destination, 0700); err != nil {
+		return err
+	}
+	name := strings.ToLower(strings.SplitN(bundleURL, "?", 2)[0])
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return extractZipBundle(archive, destination)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return extractTarGzBundle(archive, destination)
+	default:
+		return fmt.Errorf("unsupported playbook bundle format '%s', expected .tar.gz, .tgz or .zip", bundleURL)
+	}
+}
+
+// bundleEntryPath returns the extraction path of an archive entry, rejects entries outside of the destination.
+func bundleEntryPath(destination, name string) (string, error) {
+	target := filepath.Join(destination, name)
+	if target != destination && !strings.HasPrefix(target, destination+string(os.PathSeparator)) {
+		return "", fmt.Errorf("playbook bundle entry '%s' points outside of the bundle", name)
+	}
+	return target, nil
+}
+
+func writeBundleFile(target string, mode os.FileMode, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode|0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(file, r)
+	return err
+}
+
+func extractTarGzBundle(archive, destination string) error {
+	file, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("Error reading playbook bundle: %v", err)
+	}
+	defer gzipReader.Close()
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Error reading playbook bundle: %v", err)
+		}
+		target, err := bundleEntryPath(destination, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := writeBundleFile(target, os.FileMode(header.Mode).Perm(), tarReader); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func extractZipBundle(archive, destination string) error {
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return fmt.Errorf("Error reading playbook bundle: %v", err)
+	}
+	defer reader.Close()
+	for _, entry := range reader.File {
+		target, err := bundleEntryPath(destination, entry.Name)
+		if err != nil {
+			return err
+		}
+		if entry.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return err
+			}
+			continue
+		}
+		contents, err := entry.Open()
+		if err != nil {
+			return err
+		}
+		err = writeBundleFile(target, entry.Mode().Perm(), contents)
+		contents.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package mode
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+func newTarGzBundle(t *testing.T, files map[string]string) []byte {
+	buf := new(bytes.Buffer)
+	gzipWriter := gzip.NewWriter(buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, contents := range files {
+		if err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := tarWriter.Write([]byte(contents)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	tarWriter.Close()
+	gzipWriter.Close()
+	return buf.Bytes()
+}
+
+func TestFetchPlaybookBundleVerifiesChecksum(t *testing.T) {
+	bundle := newTarGzBundle(t, map[string]string{"playbooks/deploy.yml": "- hosts: all\n"})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bundle)
+	}))
+	defer server.Close()
+	digest := sha256.Sum256(bundle)
+	checksum := "sha256:" + hex.EncodeToString(digest[:])
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"playbook": []interface{}{map[string]interface{}{
+			"bundle_url":      server.URL + "/playbooks-1.4.0.tar.gz",
+			"bundle_checksum": checksum,
+			"path":            "playbooks/deploy.yml",
+		}},
+	})
+	dir, err := preparePlaybookSource(new(terraform.MockUIOutput), play, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	playbookPath := play.Entity().(*types.Playbook).FilePath()
+	if !strings.HasPrefix(playbookPath, dir) || filepath.Base(playbookPath) != "deploy.yml" {
+		t.Fatalf("Expected the playbook to point at the extracted bundle but got: %s", playbookPath)
+	}
+	if _, err := os.Stat(playbookPath); err != nil {
+		t.Fatalf("Expected the playbook to be extracted but got: %v", err)
+	}
+
+	play = test.GetNewDefaultPlay(t, map[string]interface{}{
+		"playbook": []interface{}{map[string]interface{}{
+			"bundle_url":      server.URL + "/playbooks-1.4.0.tar.gz",
+			"bundle_checksum": "sha256:" + strings.Repeat("0", 64),
+			"path":            "playbooks/deploy.yml",
+		}},
+	})
+	if _, err := preparePlaybookSource(new(terraform.MockUIOutput), play, ""); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Expected a checksum mismatch but got: %v", err)
+	}
+}
+
+func TestExtractPlaybookBundleRejectsEntriesOutsideOfBundle(t *testing.T) {
+	bundle := newTarGzBundle(t, map[string]string{"../escape.yml": "- hosts: all\n"})
+	dir, err := ioutil.TempDir("", "bundle")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	archive := filepath.Join(dir, "bundle.tar.gz")
+	if err := ioutil.WriteFile(archive, bundle, 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := extractPlaybookBundle(archive, "https://example.com/bundle.tar.gz", filepath.Join(dir, "out")); err == nil {
+		t.Fatalf("Expected an error for an entry outside of the bundle")
+	}
+}
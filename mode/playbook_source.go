@@ -0,0 +1,44 @@
+package mode
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/radekg/terraform-provisioner-ansible/types"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// preparePlaybookSource makes a playbook sourced from a git repository or a bundle available locally.
+// Returns the temporary directory holding the playbook, created in the work directory, empty for the
+// system temporary directory, and empty for playbooks given with file_path.
+// The caller is responsible for removing the directory.
+func preparePlaybookSource(o terraform.UIOutput, play *types.Play, workDirectory string) (string, error) {
+	playbook, ok := play.Entity().(*types.Playbook)
+	if !ok {
+		return "", nil
+	}
+	if playbook.BundleURL() != "" {
+		return fetchPlaybookBundle(o, play, workDirectory)
+	}
+	return checkoutPlaybookRepository(o, play, workDirectory)
+}
+
+// pointPlaybookAt points the playbook and the additional playbooks at the files within the checkout
+// or the extracted bundle root, these paths are relative to the root.
+func pointPlaybookAt(playbook *types.Playbook, root string, source string) error {
+	paths := make([]string, 0)
+	for _, relative := range append([]string{playbook.Path()}, playbook.AdditionalFilePaths()...) {
+		path := filepath.Join(root, filepath.Clean(relative))
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("playbook '%s' does not exist in %s", relative, source)
+		}
+		paths = append(paths, path)
+	}
+	playbook.SetOverrideFilePath(paths[0])
+	if len(paths) > 1 {
+		playbook.SetOverrideAdditionalFilePaths(paths[1:])
+	}
+	return nil
+}
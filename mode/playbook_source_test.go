@@ -0,0 +1,84 @@
+package mode
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/radekg/terraform-provisioner-ansible/test"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+func TestPointPlaybookAtAdditionalPlaybooks(t *testing.T) {
+	root, err := ioutil.TempDir("", "playbook-source")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(root)
+	for _, name := range []string{"site.yml", "verify.yml"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte("---\n"), 0644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"playbook": []interface{}{map[string]interface{}{
+			"repo":                  "https://example.com/playbooks.git",
+			"additional_file_paths": []interface{}{"verify.yml"},
+		}},
+	})
+	playbook := play.Entity().(*types.Playbook)
+	if err := pointPlaybookAt(playbook, root, "the test directory"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{filepath.Join(root, "site.yml"), filepath.Join(root, "verify.yml")}
+	if strings.Join(playbook.FilePaths(), " ") != strings.Join(expected, " ") {
+		t.Fatalf("Expected playbooks %v but got: %v", expected, playbook.FilePaths())
+	}
+
+	command, err := play.ToCommand(types.LocalModeAnsibleArgs{Username: "test"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(command, "ansible-playbook "+strings.Join(expected, " ")) {
+		t.Fatalf("Expected all playbooks in a single invocation but got: %s", command)
+	}
+
+	play = test.GetNewDefaultPlay(t, map[string]interface{}{
+		"playbook": []interface{}{map[string]interface{}{
+			"repo":                  "https://example.com/playbooks.git",
+			"additional_file_paths": []interface{}{"missing.yml"},
+		}},
+	})
+	if err := pointPlaybookAt(play.Entity().(*types.Playbook), root, "the test directory"); err == nil || !strings.Contains(err.Error(), "missing.yml") {
+		t.Fatalf("Expected a missing additional playbook error but got: %v", err)
+	}
+}
+
+func TestPlaybookCollectionsPathPrecedesPlayCollectionsPath(t *testing.T) {
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"playbook": []interface{}{map[string]interface{}{
+			"file_path":        "/path/to/site.yml",
+			"collections_path": []interface{}{"/path/to/prefetched/collections"},
+		}},
+		"collections_path": []interface{}{"/usr/share/ansible/collections"},
+	})
+	command, err := play.ToCommand(types.LocalModeAnsibleArgs{Username: "test"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(command, "ANSIBLE_COLLECTIONS_PATH='/path/to/prefetched/collections:/usr/share/ansible/collections'") {
+		t.Fatalf("Expected the playbook collections before the play collections but got: %s", command)
+	}
+
+	play.Entity().(*types.Playbook).SetOverrideCollectionsPath([]string{"/tmp/tf-ansible-bootstrap/uploaded"})
+	command, err = play.ToCommand(types.LocalModeAnsibleArgs{Username: "test"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(command, "ANSIBLE_COLLECTIONS_PATH='/tmp/tf-ansible-bootstrap/uploaded:/usr/share/ansible/collections'") {
+		t.Fatalf("Expected the uploaded collections to be used but got: %s", command)
+	}
+}
@@ -0,0 +1,24 @@
+package mode
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// printOnlyPlaceholder is written instead of private keys and passwords with print_only,
+// replace it with the secret to execute the printed commands by hand.
+const printOnlyPlaceholder = "print_only placeholder, replace with the secret"
+
+// secret returns the placeholder instead of a secret written to a file with print_only.
+func (v *LocalMode) secret(secret string) string {
+	if v.printOnly && secret != "" {
+		return printOnlyPlaceholder
+	}
+	return secret
+}
+
+// printCommand writes a command of a play instead of executing it, for print_only.
+func printCommand(o terraform.UIOutput, description string, command string) {
+	o.Output(fmt.Sprintf("print_only: %s: %s", description, command))
+}
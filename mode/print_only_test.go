@@ -0,0 +1,70 @@
+package mode
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+func TestLocalModePrintOnly(t *testing.T) {
+	workDirectory, err := ioutil.TempDir("", "print-only")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(workDirectory)
+
+	lines := make([]string, 0)
+	output := &terraform.MockUIOutput{OutputFn: func(line string) { lines = append(lines, line) }}
+	local, err := NewLocalMode(output, &terraform.InstanceState{
+		Ephemeral: terraform.EphemeralState{ConnInfo: map[string]string{"type": "ssh", "private_key": test.TestSSHUserKeyPrivate}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{})
+	// the commands are printed, Ansible is never executed:
+	play.SetOverrideBinDirectory(filepath.Join(workDirectory, "missing"))
+	if err := local.Run([]*types.Play{play}, &Settings{
+		AnsibleSSHSettings:   types.NewAnsibleSSHSettingsFromInterface(nil, false),
+		WindowsSettings:      types.NewWindowsSettingsFromInterface(nil, false),
+		ExecutionEnvironment: types.NewExecutionEnvironmentFromInterface(nil, false),
+		WSL:                  types.NewWSLSettingsFromInterface(nil, false),
+		RunOptions:           RunOptions{PrintOnly: true, WorkDirectory: workDirectory},
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	written := strings.Join(lines, "\n")
+	if !strings.Contains(written, "print_only: play: ") || !strings.Contains(written, "print_only: the files read by the printed commands are kept in ") {
+		t.Fatalf("Expected the command of the play and the kept files to be printed but got: %s", written)
+	}
+
+	// the files read by the command are kept, the private key as a placeholder:
+	files, err := filepath.Glob(filepath.Join(workDirectory, "tf-ansible-*", "*"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("Expected the files of the play to be kept but got: %v %v", files, err)
+	}
+	placeholders := 0
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if strings.Contains(string(contents), test.TestSSHUserKeyPrivate) {
+			t.Fatalf("Expected no secret in the kept file '%s'", file)
+		}
+		if string(contents) == printOnlyPlaceholder {
+			placeholders++
+		}
+	}
+	if placeholders != 1 {
+		t.Fatalf("Expected the private key to be written as a placeholder but got %d placeholders in: %v", placeholders, files)
+	}
+}
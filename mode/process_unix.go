@@ -0,0 +1,40 @@
+//go:build !windows
+// +build !windows
+
+package mode
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// newShellCommand returns a command executing the command line in a shell,
+// in its own process group so the command can be killed with all its children.
+func newShellCommand(ctx context.Context, command string) *exec.Cmd {
+	return newProcessCommand(ctx, "/bin/sh", "-c", command)
+}
+
+// newProcessCommand returns a command executing the program with the arguments, without a shell,
+// in its own process group. The command is not killed by the context, runLocalProcess interrupts
+// the process group first and kills it when it does not exit.
+func newProcessCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return cmd
+}
+
+// interruptProcessTree sends the signal to the process group of a started command.
+func interruptProcessTree(cmd *exec.Cmd, sig os.Signal) error {
+	unixSignal, ok := sig.(syscall.Signal)
+	if !ok {
+		unixSignal = syscall.SIGINT
+	}
+	return syscall.Kill(-cmd.Process.Pid, unixSignal)
+}
+
+// killProcessTree kills the process group of a started command.
+func killProcessTree(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,32 @@
+//go:build windows
+// +build windows
+
+package mode
+
+import (
+	"context"
+	"os"
+	"os/exec"
+)
+
+// newShellCommand returns a command executing the command line in a shell.
+func newShellCommand(ctx context.Context, command string) *exec.Cmd {
+	return newProcessCommand(ctx, "cmd", "/C", command)
+}
+
+// newProcessCommand returns a command executing the program with the arguments, without a shell.
+// The command is not killed by the context, runLocalProcess stops it.
+func newProcessCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	return exec.Command(name, args...)
+}
+
+// interruptProcessTree kills a started command, signals can not be sent to processes on Windows.
+func interruptProcessTree(cmd *exec.Cmd, sig os.Signal) error {
+	return cmd.Process.Kill()
+}
+
+// killProcessTree kills a started command. Windows has no process groups,
+// children of the command are not killed.
+func killProcessTree(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
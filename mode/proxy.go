@@ -0,0 +1,53 @@
+package mode
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+// proxyCommand runs the command with the proxy environment of the bootstrap, both the lower and the upper case
+// variables are set because tools differ in which they read. The environment is set for the command only,
+// such that plays other than galaxy_install do not inherit it.
+func proxyCommand(command string, remoteSettings *types.RemoteSettings) string {
+	variables := make([]string, 0)
+	for _, proxy := range []struct {
+		name  string
+		value string
+	}{
+		{name: "http_proxy", value: remoteSettings.HTTPProxy()},
+		{name: "https_proxy", value: remoteSettings.HTTPSProxy()},
+		{name: "no_proxy", value: remoteSettings.NoProxy()},
+	} {
+		if proxy.value == "" {
+			continue
+		}
+		variables = append(variables,
+			fmt.Sprintf("%s=%s", proxy.name, types.ShellQuote(proxy.value)),
+			fmt.Sprintf("%s=%s", strings.ToUpper(proxy.name), types.ShellQuote(proxy.value)))
+	}
+	if len(variables) == 0 {
+		return command
+	}
+	return fmt.Sprintf("env %s %s", strings.Join(variables, " "), command)
+}
+
+// proxySecrets returns the passwords of the proxy URLs, masked in the output.
+func proxySecrets(remoteSettings *types.RemoteSettings) []string {
+	return proxyURLSecrets(remoteSettings.HTTPProxy(), remoteSettings.HTTPSProxy())
+}
+
+// proxyURLSecrets returns the passwords of the proxy URLs.
+func proxyURLSecrets(proxies ...string) []string {
+	secrets := make([]string, 0)
+	for _, proxy := range proxies {
+		if parsed, err := url.Parse(proxy); err == nil && parsed.User != nil {
+			if password, ok := parsed.User.Password(); ok {
+				secrets = append(secrets, password)
+			}
+		}
+	}
+	return secrets
+}
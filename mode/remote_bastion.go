@@ -0,0 +1,37 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// pinRemoteBastionHostKey connects to the bastion host the same way as local mode does and returns
+// the instance state with the received bastion host key, such that every session of the remote mode
+// communicator, the uploads and the commands, is tunneled through the same bastion host.
+// The instance state is returned unchanged when no bastion is used, the bastion host key is given
+// or the bastion can not be connected to yet, the communicator then connects as configured.
+func pinRemoteBastionHostKey(o terraform.UIOutput, s *terraform.InstanceState, connInfo *connectionInfo) *terraform.InstanceState {
+	bastion := newBastionHostFromConnectionInfo(connInfo)
+	if !bastion.inUse() || bastion.hostKey() != "" {
+		return s
+	}
+	// the remote mode is not running yet, the connection is bounded by the connection timeout only:
+	sshClient, err := bastion.connect(context.Background())
+	if err != nil {
+		o.Output(fmt.Sprintf("bastion %s@%s:%d host key not given and not received: %v",
+			bastion.user(), bastion.host(), bastion.port(), err))
+		return s
+	}
+	sshClient.Close()
+
+	hostKey := strings.TrimSpace(bastion.hostKey())
+	o.Output(fmt.Sprintf("bastion %s@%s:%d host key not given, using the received host key for all connections: %s",
+		bastion.user(), bastion.host(), bastion.port(), hostKey))
+
+	pinned := s.DeepCopy()
+	pinned.Ephemeral.ConnInfo["bastion_host_key"] = hostKey
+	return pinned
+}
@@ -0,0 +1,58 @@
+package mode
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+)
+
+func TestRemoteBastionHostKeyIsPinned(t *testing.T) {
+	instanceState := test.GetNewSSHInstanceState(t, "test-username")
+	output := new(terraform.MockUIOutput)
+	sshServer := test.GetConfiguredAndRunningSSHServer(t, "remote-bastion-host", false, instanceState, output)
+	defer sshServer.Stop()
+
+	// the test server is the bastion host:
+	instanceState.Ephemeral.ConnInfo["bastion_host"] = instanceState.Ephemeral.ConnInfo["host"]
+	instanceState.Ephemeral.ConnInfo["bastion_port"] = instanceState.Ephemeral.ConnInfo["port"]
+
+	connInfo, err := parseConnectionInfo(instanceState)
+	if err != nil {
+		t.Fatalf("Expected connection info but got an error: %v", err)
+	}
+	pinned := pinRemoteBastionHostKey(output, instanceState, connInfo)
+	if pinned.Ephemeral.ConnInfo["bastion_host_key"] != strings.Join(strings.Fields(test.TestSSHHostKeyPublic)[:2], " ") {
+		t.Fatalf("Expected the bastion host key to be pinned but got: '%s'", pinned.Ephemeral.ConnInfo["bastion_host_key"])
+	}
+	if _, ok := instanceState.Ephemeral.ConnInfo["bastion_host_key"]; ok {
+		t.Fatalf("Expected the original instance state to be unchanged")
+	}
+
+	// a given bastion host key is used as is:
+	instanceState.Ephemeral.ConnInfo["bastion_host_key"] = test.TestSSHHostKeyPublic
+	connInfo, _ = parseConnectionInfo(instanceState)
+	if pinRemoteBastionHostKey(output, instanceState, connInfo) != instanceState {
+		t.Fatalf("Expected the given bastion host key to be used")
+	}
+}
+
+func TestRemoteBastionWinRMNotSupported(t *testing.T) {
+	instanceState := &terraform.InstanceState{
+		Ephemeral: terraform.EphemeralState{
+			ConnInfo: map[string]string{
+				"type":         "winrm",
+				"user":         "Administrator",
+				"password":     "password",
+				"host":         "10.0.0.20",
+				"port":         "5986",
+				"bastion_host": "10.0.0.1",
+			},
+		},
+	}
+	remoteSettings := newExecutionEnvironmentRemoteSettings(t, map[string]interface{}{"wsl_distribution": "Ubuntu-22.04"})
+	if _, err := NewRemoteMode(new(terraform.MockUIOutput), instanceState, remoteSettings); err == nil || !strings.Contains(err.Error(), "SSH connections only") {
+		t.Fatalf("Expected an error for a bastion host with WinRM but got: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package mode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/radekg/terraform-provisioner-ansible/types"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// exitStatusError is the error of a command exiting with a non-zero exit status on the host,
+// in a container or in a Kubernetes job. The local commands fail with *exec.ExitError.
+type exitStatusError struct {
+	status int
+	err    error
+}
+
+func newExitStatusError(status int, err error) error {
+	return &exitStatusError{status: status, err: err}
+}
+
+func (e *exitStatusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitStatusError) Unwrap() error {
+	return e.err
+}
+
+// exitStatusFromError returns the exit status of a failed command carried by the error or any error it wraps,
+// returns -1 when the error does not carry an exit status.
+func exitStatusFromError(err error) int {
+	if err == nil {
+		return 0
+	}
+	var statusErr *exitStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.status
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// isRetryable decides if the play command failure should be retried.
+func isRetryable(play *types.Play, err error) bool {
+	if len(play.RetryOnExitCodes()) == 0 {
+		return true
+	}
+	status := exitStatusFromError(err)
+	for _, code := range play.RetryOnExitCodes() {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+// runWithRetries runs the play command, retrying failures according to the play retry policy.
+// No more attempts are made when the context is done.
+func runWithRetries(ctx context.Context, o terraform.UIOutput, play *types.Play, run func() error) error {
+	err := run()
+	for attempt := 1; err != nil && attempt <= play.Retries(); attempt++ {
+		if !isRetryable(play, err) {
+			return err
+		}
+		o.Output(fmt.Sprintf("play failed with exit status %d, retrying in %d seconds, attempt %d of %d...",
+			exitStatusFromError(err), play.RetryDelay(), attempt, play.Retries()))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(play.RetryDelay()) * time.Second):
+		}
+		err = run()
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package mode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+)
+
+func TestExitStatusFromError(t *testing.T) {
+	localErr := exec.Command("/bin/sh", "-c", "exit 4").Run()
+	for _, tc := range []struct {
+		err      error
+		expected int
+	}{
+		{fmt.Errorf("Error running command 'ansible-playbook': %w. Output: ", localErr), 4},
+		{fmt.Errorf("tasks failed on one or more hosts: %w", newExitStatusError(2, errors.New("Command 'ansible-playbook' exited with non-zero exit status: 2"))), 2},
+		{errors.New("Command 'ansible-playbook' failed, reason: exit status 2"), -1},
+		{nil, 0},
+	} {
+		if status := exitStatusFromError(tc.err); status != tc.expected {
+			t.Fatalf("Expected exit status %d for '%v' but got: %d", tc.expected, tc.err, status)
+		}
+	}
+}
+
+func TestRunWithRetriesRetriesOnListedExitCodes(t *testing.T) {
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"retries":             2,
+		"retry_delay":         0,
+		"retry_on_exit_codes": []interface{}{4},
+	})
+
+	attempts := 0
+	err := runWithRetries(context.Background(), new(terraform.MockUIOutput), play, func() error {
+		attempts++
+		if attempts < 3 {
+			return newExitStatusError(4, errors.New("Error running command: exit status 4"))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected the command to succeed after retries but got: %v", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("Expected 3 attempts but got: %d", attempts)
+	}
+
+	attempts = 0
+	err = runWithRetries(context.Background(), new(terraform.MockUIOutput), play, func() error {
+		attempts++
+		return newExitStatusError(2, errors.New("Error running command: exit status 2"))
+	})
+	if err == nil {
+		t.Fatalf("Expected an error for an exit code not listed")
+	}
+	if attempts != 1 {
+		t.Fatalf("Expected a single attempt for an exit code not listed but got: %d", attempts)
+	}
+}
@@ -0,0 +1,78 @@
+package mode
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// runLockDirectory is the directory of the lock files, in the work directory.
+const runLockDirectory = "tf-ansible-locks"
+
+// defaultRunLockName is the lock of runs with max_concurrent_runs and no lock_name.
+const defaultRunLockName = "default"
+
+// runLockPollInterval is how often a run waiting for a slot of its lock tries again.
+var runLockPollInterval = time.Second
+
+// AcquireRunLock waits for a free slot of the lock of the run options, when the run has a lock or a limit, such that
+// at most MaxConcurrentRuns runs of all provisioners and resources with the same lock run at a time.
+// Every slot is a file lock in the work directory, held until the returned function is called,
+// or until the plugin exits. Returns an error when the run is cancelled while waiting.
+func AcquireRunLock(o terraform.UIOutput, options RunOptions) (func(), error) {
+	if options.LockName == "" && options.MaxConcurrentRuns == 0 {
+		return func() {}, nil
+	}
+	name := options.LockName
+	if name == "" {
+		name = defaultRunLockName
+	}
+	slots := options.MaxConcurrentRuns
+	if slots < 1 {
+		slots = 1
+	}
+	base := options.WorkDirectory
+	if base == "" {
+		base = os.TempDir()
+	}
+	directory := filepath.Join(base, runLockDirectory)
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, fmt.Errorf("could not create the lock directory '%s': %v", directory, err)
+	}
+
+	ctx := options.runContext()
+	waiting := false
+	for {
+		for slot := 0; slot < slots; slot++ {
+			lock, err := tryLockFile(filepath.Join(directory, fmt.Sprintf("%s.%d.lock", name, slot)))
+			if err != nil {
+				return nil, fmt.Errorf("could not lock '%s': %v", name, err)
+			}
+			if lock != nil {
+				o.Output(fmt.Sprintf("acquired run lock '%s', slot %d of %d", name, slot+1, slots))
+				return releaseRunLock(o, name, lock), nil
+			}
+		}
+		if !waiting {
+			o.Output(fmt.Sprintf("waiting for run lock '%s', %d concurrent runs", name, slots))
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("cancelled while waiting for run lock '%s': %v", name, ctx.Err())
+		case <-time.After(runLockPollInterval):
+		}
+	}
+}
+
+func releaseRunLock(o terraform.UIOutput, name string, lock io.Closer) func() {
+	return func() {
+		if err := lock.Close(); err != nil {
+			o.Output(fmt.Sprintf("failed to release run lock '%s': %v", name, err))
+		}
+	}
+}
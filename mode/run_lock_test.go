@@ -0,0 +1,89 @@
+package mode
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestAcquireRunLock(t *testing.T) {
+	defer func(interval time.Duration) { runLockPollInterval = interval }(runLockPollInterval)
+	runLockPollInterval = 10 * time.Millisecond
+
+	workDirectory, err := ioutil.TempDir("", "run-lock")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(workDirectory)
+	options := RunOptions{WorkDirectory: workDirectory, LockName: "bastion", MaxConcurrentRuns: 2}
+
+	// two runs hold the two slots:
+	releases := make([]func(), 0)
+	for run := 0; run < 2; run++ {
+		release, err := AcquireRunLock(new(terraform.MockUIOutput), options)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		releases = append(releases, release)
+	}
+
+	// the third run waits until a slot is released:
+	acquired := make(chan func(), 1)
+	output := new(terraform.MockUIOutput)
+	go func() {
+		release, err := AcquireRunLock(output, options)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		acquired <- release
+	}()
+	select {
+	case <-acquired:
+		t.Fatalf("Expected the third run to wait for a slot")
+	case <-time.After(200 * time.Millisecond):
+	}
+	releases[0]()
+	select {
+	case release := <-acquired:
+		release()
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the third run to get the released slot")
+	}
+	if !strings.Contains(output.OutputMessage, "acquired run lock 'bastion', slot 1 of 2") {
+		t.Fatalf("Expected the released slot to be acquired but got: %s", output.OutputMessage)
+	}
+
+	// another lock is independent:
+	release, err := AcquireRunLock(new(terraform.MockUIOutput), RunOptions{WorkDirectory: workDirectory, LockName: "other"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	release()
+
+	// a cancelled run stops waiting:
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	blocked := RunOptions{WorkDirectory: workDirectory, LockName: "bastion", MaxConcurrentRuns: 1, Context: ctx}
+	held, err := AcquireRunLock(new(terraform.MockUIOutput), RunOptions{WorkDirectory: workDirectory, LockName: "bastion", MaxConcurrentRuns: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer held()
+	if _, err := AcquireRunLock(new(terraform.MockUIOutput), blocked); err == nil || !strings.Contains(err.Error(), "cancelled while waiting") {
+		t.Fatalf("Expected the cancelled run to stop waiting but got: %v", err)
+	}
+	releases[1]()
+}
+
+func TestAcquireRunLockWithoutLock(t *testing.T) {
+	release, err := AcquireRunLock(new(terraform.MockUIOutput), RunOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	release()
+}
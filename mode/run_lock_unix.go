@@ -0,0 +1,28 @@
+//go:build !windows
+// +build !windows
+
+package mode
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// tryLockFile takes an exclusive lock of the file, created when missing, without waiting.
+// Returns nil when another process holds the lock. The lock is released when the file is closed,
+// or when the process exits.
+func tryLockFile(path string) (io.Closer, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return file, nil
+}
@@ -0,0 +1,32 @@
+//go:build windows
+// +build windows
+
+package mode
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// errorSharingViolation is returned when another process has the file open.
+const errorSharingViolation syscall.Errno = 32
+
+// tryLockFile opens the file, created when missing, without sharing it with other processes.
+// Returns nil when another process has the file open. The lock is released when the file is closed,
+// or when the process exits.
+func tryLockFile(path string) (io.Closer, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil,
+		syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		if err == errorSharingViolation {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return os.NewFile(uintptr(handle), path), nil
+}
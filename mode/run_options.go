@@ -0,0 +1,89 @@
+package mode
+
+import "context"
+
+// RunOptions holds provisioner level settings applying to all plays of a run.
+type RunOptions struct {
+	// MaxParallel is the maximum number of plays executed concurrently, 0 means no limit.
+	MaxParallel int
+	// PlanOnly lists hosts and tasks of every play instead of executing them.
+	PlanOnly bool
+	// PrintOnly writes the files of every play and prints the commands executing the play, without
+	// executing Ansible. The files are kept, private keys and passwords are written as placeholders.
+	PrintOnly bool
+	// HashDirectory is where input hashes of plays with skip_unchanged are stored,
+	// empty for the default location.
+	HashDirectory string
+	// ArtifactDirectory is where relative output paths of plays are resolved,
+	// empty for the default location.
+	ArtifactDirectory string
+	// WorkDirectory is where the temporary files of the local plays, keys, inventories and known hosts,
+	// are written to, in a directory accessible by the owner only, removed after the run.
+	// Empty for the system temporary directory.
+	WorkDirectory string
+	// LogToFile writes the output of the run to a log file under the artifact directory,
+	// in addition to the output.
+	LogToFile bool
+	// Executor is the program local playbook plays are executed with,
+	// empty for ansible-playbook.
+	Executor string
+	// MaskPatterns are regular expressions masked in every output line, in addition to the secrets
+	// of the configuration.
+	MaskPatterns []string
+	// AnsibleMinVersion and AnsibleMaxVersion are the range of Ansible versions the plays run with,
+	// empty for no bound. The maximum applies to its components only.
+	AnsibleMinVersion string
+	AnsibleMaxVersion string
+	// OnAnsibleVersionMismatch is fail or warn, what happens when the version is out of the range.
+	OnAnsibleVersionMismatch string
+	// LockName is the name of the run lock, runs with the same lock run one at a time,
+	// MaxConcurrentRuns at a time when greater than 1. Empty for a run without a lock.
+	LockName          string
+	MaxConcurrentRuns int
+	// CleanEnvironment starts the local commands with the variables of EnvironmentAllowlist only,
+	// instead of the environment of Terraform. An empty allowlist is the default allowlist.
+	CleanEnvironment     bool
+	EnvironmentAllowlist []string
+	// LogLevel is how much of the provisioner messages is written, quiet, info or debug,
+	// empty for info. The Ansible output is always written.
+	LogLevel string
+	// RunTimeout bounds the whole run, in seconds, the Context is done when the run takes longer.
+	// Zero for a run without a timeout.
+	RunTimeout int
+	// Phase is the provisioner phase, create or destroy.
+	Phase string
+	// Context is cancelled when Terraform stops the provisioner or the run timeout is exceeded,
+	// the commands executed on the machine running Terraform are killed, the connections are closed.
+	// Nil for a run never cancelled.
+	Context context.Context
+}
+
+// runOptionsKey is the context key of the options of a run, read by the local commands.
+type runOptionsKey struct{}
+
+// runContext returns the context of the run, carrying the options for the local commands.
+func (v RunOptions) runContext() context.Context {
+	ctx := v.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, runOptionsKey{}, v)
+}
+
+// contextRunOptions returns the options of the run of the context, empty options for a context of no run.
+func contextRunOptions(ctx context.Context) RunOptions {
+	options, _ := ctx.Value(runOptionsKey{}).(RunOptions)
+	return options
+}
+
+// dryRun returns plan_only or print_only when the plays are not executed, empty otherwise.
+func (v RunOptions) dryRun() string {
+	switch {
+	case v.PrintOnly:
+		return "print_only"
+	case v.PlanOnly:
+		return "plan_only"
+	default:
+		return ""
+	}
+}
@@ -1,6 +1,7 @@
 package mode
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -53,7 +54,7 @@ func (v *bastionHost) receiveHostKey(hostKey string) {
 	v.connInfo.BastionHostKey = hostKey
 }
 
-func (v *bastionHost) connect() (*ssh.Client, error) {
+func (v *bastionHost) connect(ctx context.Context) (*ssh.Client, error) {
 	configurator := &sshConfigurator{
 		provider: v,
 	}
@@ -61,5 +62,5 @@ func (v *bastionHost) connect() (*ssh.Client, error) {
 	if err != nil {
 		return nil, err
 	}
-	return ssh.Dial("tcp", fmt.Sprintf("%s:%d", v.host(), v.port()), sshConfig)
+	return dialSSH(ctx, fmt.Sprintf("%s:%d", v.host(), v.port()), sshConfig)
 }
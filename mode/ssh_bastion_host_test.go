@@ -1,6 +1,7 @@
 package mode
 
 import (
+	"context"
 	"testing"
 
 	"github.com/hashicorp/terraform/terraform"
@@ -66,7 +67,7 @@ func TestBastionHostConfiguration(t *testing.T) {
 		t.Fatal("Expected values to match", bh.hostKey(), connInfo.BastionHostKey)
 	}
 
-	sshClient, err := bh.connect()
+	sshClient, err := bh.connect(context.Background())
 	if err != nil {
 		t.Fatal("Expected sshClient but reeceived an error", err)
 	}
@@ -2,6 +2,7 @@ package mode
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"path/filepath"
@@ -18,6 +19,10 @@ const (
 	homeSSHDirectory = "~/.ssh"
 )
 
+// keyscanRetryInterval is how long to wait between host key scans, the host may not
+// reply to SSH requests yet.
+var keyscanRetryInterval = 5 * time.Second
+
 type cleanup func()
 
 type bastionKeyScan struct {
@@ -120,7 +125,9 @@ func (b *bastionKeyScan) execute(command string) error {
 	return commandResult
 }
 
-func (b *bastionKeyScan) scan() (string, error) {
+// scan executes ssh-keyscan on the bastion until it succeeds, for at most the keyscan timeout,
+// and not after the context is done.
+func (b *bastionKeyScan) scan(ctx context.Context) (string, error) {
 
 	b.output(fmt.Sprintf("ensuring the existence of '%s'...", homeSSHDirectory))
 	if err := b.execute(
@@ -133,10 +140,6 @@ func (b *bastionKeyScan) scan() (string, error) {
 	u1 := uuid.NewV4()
 	targetPath := filepath.Join(b.quotedSSHKnownFileDir(), u1.String())
 
-	timeoutMs := b.sshKeyscanTimeout * 1000
-	timeSpentMs := 0
-	intervalMs := 5000
-
 	sshKeyScanCommand := fmt.Sprintf("ssh_keyscan_result=$(ssh-keyscan -T %d -p %d %s 2>/dev/null | grep %s) && echo -e \"${ssh_keyscan_result}\" > \"%s\"",
 		b.sshKeyscanTimeout,
 		b.port,
@@ -149,20 +152,19 @@ func (b *bastionKeyScan) scan() (string, error) {
 	// until then, we may be getting "no route to host",
 	// in such case the keyscan would fail regardless of timeout
 	// we need to repeat until we succeed or time out
-	for {
+	scanCtx, cancel := context.WithTimeout(ctx, time.Duration(b.sshKeyscanTimeout)*time.Second)
+	defer cancel()
+	if err := retryContext(scanCtx, keyscanRetryInterval, func() error {
 		keyScanError := b.execute(sshKeyScanCommand)
-		if keyScanError == nil {
-			break
-		}
-		b.output(fmt.Sprintf("ssh-keyscan hasn't succeeded yet (last error: %s); retrying...", keyScanError))
-		time.Sleep(time.Duration(intervalMs) * time.Millisecond)
-		timeSpentMs = timeSpentMs + intervalMs
-		if timeSpentMs > timeoutMs {
-			return "", b.makeError(
-				fmt.Sprintf(
-					"failed receive target ssh key for %s:%d within time specified period of %d seconds.",
-					b.host, b.port, b.sshKeyscanTimeout), nil)
+		if keyScanError != nil {
+			b.output(fmt.Sprintf("ssh-keyscan hasn't succeeded yet (last error: %s); retrying...", keyScanError))
 		}
+		return keyScanError
+	}); err != nil {
+		return "", b.makeError(
+			fmt.Sprintf(
+				"failed receive target ssh key for %s:%d within time specified period of %d seconds: %v",
+				b.host, b.port, b.sshKeyscanTimeout, err), nil)
 	}
 
 	// read and remove the temporary known hosts file:
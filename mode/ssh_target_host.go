@@ -1,11 +1,9 @@
 package mode
 
 import (
+	"context"
 	"fmt"
 	"time"
-	
-
-	"golang.org/x/crypto/ssh"
 )
 
 type targetHost struct {
@@ -50,7 +48,7 @@ func (v *targetHost) receiveHostKey(hostKey string) {
 	v.connInfo.HostKey = hostKey
 }
 
-func (v *targetHost) fetchHostKey() error {
+func (v *targetHost) fetchHostKey(ctx context.Context) error {
 
 	var returnError error
 
@@ -67,7 +65,7 @@ func (v *targetHost) fetchHostKey() error {
 	if err != nil {
 		return err
 	}
-	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", v.host(), v.port()), sshConfig)
+	client, err := dialSSH(ctx, fmt.Sprintf("%s:%d", v.host(), v.port()), sshConfig)
 	if err != nil {
 		return err
 	}
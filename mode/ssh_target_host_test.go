@@ -1,6 +1,7 @@
 package mode
 
 import (
+	"context"
 	"testing"
 
 	"github.com/hashicorp/terraform/terraform"
@@ -60,7 +61,7 @@ func TestTargetHostConfiguration(t *testing.T) {
 		t.Fatal("Expected values to match", th.hostKey(), connInfo.HostKey)
 	}
 
-	fetchErr := th.fetchHostKey()
+	fetchErr := th.fetchHostKey(context.Background())
 	if fetchErr != nil {
 		t.Fatal("Expected fetchHostKey to succeed.", fetchErr)
 	}
@@ -0,0 +1,32 @@
+package mode
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/events"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+// profiledTasks is how many of the slowest tasks the summary of a play lists.
+const profiledTasks = 5
+
+// summarizeTaskDurations writes the slowest tasks of a play with profile_tasks enabled, as timed
+// by the profile_tasks callback, and the run time of the timer callback. Writes nothing when
+// the output had no task summary, for example with the json stdout callback.
+func summarizeTaskDurations(o terraform.UIOutput, play *types.Play, result *events.Result) {
+	if !play.ProfileTasks() || len(result.TaskDurations) == 0 {
+		return
+	}
+	if result.Duration > 0 {
+		o.Output(fmt.Sprintf("play took %s, the slowest tasks:", result.Duration))
+	} else {
+		o.Output("the slowest tasks of the play:")
+	}
+	for idx, task := range result.TaskDurations {
+		if idx == profiledTasks {
+			break
+		}
+		o.Output(fmt.Sprintf("  %10s  %s", task.Duration, task.Task))
+	}
+}
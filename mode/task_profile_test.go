@@ -0,0 +1,61 @@
+package mode
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+func TestSummarizeTaskDurations(t *testing.T) {
+	var buf bytes.Buffer
+	recap := newRecapOutput(newCapturingOutput(new(terraform.MockUIOutput), &buf))
+	lines := []string{
+		"PLAY RECAP ********",
+		"web1                       : ok=7    changed=2    unreachable=0    failed=0    skipped=0",
+		"",
+		"Saturday 17 October 2026  10:12:03 +0000 (0:00:00.512)       0:12:03.120 *****",
+		"===============================================================================",
+		"Install packages ----------------------------------------------------- 512.40s",
+		"nginx : Render configuration ------------------------------------------ 98.02s",
+	}
+	for idx := 0; idx < profiledTasks; idx++ {
+		lines = append(lines, "Wait for the service ---------------------------------------------------- 1.00s")
+	}
+	for _, line := range append(lines, "Playbook run took 0 days, 0 hours, 12 minutes, 3 seconds") {
+		recap.Output(line)
+	}
+	result := recap.Result()
+	if len(result.TaskDurations) != profiledTasks+2 || result.TaskDurations[1].Task != "nginx : Render configuration" {
+		t.Fatalf("Expected the task summary of profile_tasks but got: %+v", result.TaskDurations)
+	}
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{})
+	buf.Reset()
+	summarizeTaskDurations(newCapturingOutput(new(terraform.MockUIOutput), &buf), play, result)
+	if buf.Len() > 0 {
+		t.Fatalf("Expected no summary without profile_tasks but got: %s", buf.String())
+	}
+
+	play = test.GetNewDefaultPlay(t, map[string]interface{}{"profile_tasks": true})
+	command, err := play.ToCommand(types.LocalModeAnsibleArgs{})
+	if err != nil {
+		t.Fatalf("Unexpected error while building the command: %v", err)
+	}
+	if !strings.Contains(command, "ANSIBLE_CALLBACKS_ENABLED=profile_tasks,timer ANSIBLE_CALLBACK_WHITELIST=profile_tasks,timer ") {
+		t.Fatalf("Expected the profile_tasks and timer callbacks to be enabled but got: %s", command)
+	}
+	summarizeTaskDurations(newCapturingOutput(new(terraform.MockUIOutput), &buf), play, result)
+	summary := buf.String()
+	for _, expected := range []string{"play took 12m3s, the slowest tasks:", "8m32.4s  Install packages", "1m38.02s  nginx : Render configuration"} {
+		if !strings.Contains(summary, expected) {
+			t.Fatalf("Expected '%s' in the summary but got: %s", expected, summary)
+		}
+	}
+	if strings.Count(summary, "Wait for the service") != profiledTasks-2 {
+		t.Fatalf("Expected the %d slowest tasks in the summary but got: %s", profiledTasks, summary)
+	}
+}
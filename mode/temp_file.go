@@ -0,0 +1,64 @@
+package mode
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// tempFileAttempts is how many random names are tried before giving up creating a temporary file.
+const tempFileAttempts = 100
+
+// writeTempFile writes the contents to a new file in the directory, empty for the system temporary
+// directory. The file is created exclusively, with its final permissions, before the contents are
+// written, other users never get a chance to read the contents. The last * in the pattern is replaced
+// with a random string, a pattern without * gets the random string appended.
+func writeTempFile(directory string, pattern string, contents []byte, perm os.FileMode) (string, error) {
+	if directory == "" {
+		directory = os.TempDir()
+	}
+	prefix, suffix := pattern, ""
+	if idx := strings.LastIndex(pattern, "*"); idx > -1 {
+		prefix, suffix = pattern[:idx], pattern[idx+1:]
+	}
+	for attempt := 0; attempt < tempFileAttempts; attempt++ {
+		name := filepath.Join(directory, prefix+uuid.NewV4().String()+suffix)
+		file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = file.Write(contents)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			removeSecretFile(name)
+			return "", err
+		}
+		return name, nil
+	}
+	return "", fmt.Errorf("could not create a temporary file in '%s' after %d attempts", directory, tempFileAttempts)
+}
+
+// removeSecretFile overwrites the contents of a temporary file holding key material or passwords
+// with zeros before removing it, the secret does not outlive the file on the disk.
+// Never call it with a file given by the user.
+func removeSecretFile(path string) error {
+	if info, err := os.Lstat(path); err == nil && info.Mode().IsRegular() {
+		// the file may be read-only for its owner:
+		if err := os.Chmod(path, 0600); err == nil {
+			if file, err := os.OpenFile(path, os.O_WRONLY, 0); err == nil {
+				file.Write(make([]byte, info.Size()))
+				file.Sync()
+				file.Close()
+			}
+		}
+	}
+	return os.Remove(path)
+}
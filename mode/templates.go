@@ -0,0 +1,165 @@
+package mode
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/radekg/terraform-provisioner-ansible/types"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// renderPlayTemplates renders the play template files with the template variables to a temporary working directory.
+// A playbook directory is copied to the working directory as a whole, such that relative references keep working,
+// and the playbook is pointed at the copy. Template extra vars files are replaced with the rendered copies.
+// Returns an empty string when the play has no template files. The caller is responsible for removing the directory.
+func renderPlayTemplates(o terraform.UIOutput, play *types.Play, workDirectory string) (string, error) {
+	if len(play.TemplateFiles()) == 0 {
+		return "", nil
+	}
+
+	workDir, err := ioutil.TempDir(workDirectory, "ansible-templates")
+	if err != nil {
+		return "", err
+	}
+
+	playbookDir := ""
+	renderedPlaybookDir := filepath.Join(workDir, "playbook")
+	if playbook, ok := play.Entity().(*types.Playbook); ok {
+		playbookPath, err := types.ResolvePath(playbook.FilePath())
+		if err != nil {
+			os.RemoveAll(workDir)
+			return "", err
+		}
+		playbookDir = filepath.Dir(playbookPath)
+		o.Output(fmt.Sprintf("Copying playbook directory '%s' to '%s' for rendering templates...", playbookDir, renderedPlaybookDir))
+		if err := copyDirectory(playbookDir, renderedPlaybookDir); err != nil {
+			os.RemoveAll(workDir)
+			return "", err
+		}
+		playbook.SetOverrideFilePath(filepath.Join(renderedPlaybookDir, filepath.Base(playbookPath)))
+		// additional playbooks from the playbook directory are executed from the copy:
+		additional := make([]string, 0)
+		for _, additionalPath := range playbook.AdditionalFilePaths() {
+			if resolved, err := types.ResolvePath(additionalPath); err == nil && strings.HasPrefix(resolved, playbookDir+string(os.PathSeparator)) {
+				additionalPath = filepath.Join(renderedPlaybookDir, strings.TrimPrefix(resolved, playbookDir))
+			}
+			additional = append(additional, additionalPath)
+		}
+		if len(additional) > 0 {
+			playbook.SetOverrideAdditionalFilePaths(additional)
+		}
+	}
+
+	extraVarsFiles := append([]string{}, play.ExtraVarsFiles()...)
+	extraVarsFilesRendered := false
+
+	for _, templateFile := range play.TemplateFiles() {
+		if !filepath.IsAbs(templateFile) && playbookDir != "" && !strings.HasPrefix(templateFile, "~") {
+			templateFile = filepath.Join(playbookDir, templateFile)
+		}
+		source, err := types.ResolvePath(templateFile)
+		if err != nil {
+			os.RemoveAll(workDir)
+			return "", fmt.Errorf("template file '%s' does not exist", templateFile)
+		}
+
+		target := ""
+		if playbookDir != "" && strings.HasPrefix(source, playbookDir+string(os.PathSeparator)) {
+			target = filepath.Join(renderedPlaybookDir, strings.TrimPrefix(source, playbookDir))
+		} else {
+			for idx, extraVarsFile := range extraVarsFiles {
+				if resolved, err := types.ResolvePath(extraVarsFile); err == nil && resolved == source {
+					target = filepath.Join(workDir, "vars", fmt.Sprintf("%d-%s", idx, filepath.Base(source)))
+					extraVarsFiles[idx] = target
+					extraVarsFilesRendered = true
+				}
+			}
+		}
+		if target == "" {
+			os.RemoveAll(workDir)
+			return "", fmt.Errorf("template file '%s' is neither within the playbook directory nor one of extra_vars_files", templateFile)
+		}
+
+		o.Output(fmt.Sprintf("Rendering template '%s' to '%s'...", source, target))
+		if err := renderTemplateFile(play, source, target); err != nil {
+			os.RemoveAll(workDir)
+			return "", err
+		}
+	}
+
+	if extraVarsFilesRendered {
+		play.SetOverrideExtraVarsFiles(extraVarsFiles)
+	}
+	return workDir, nil
+}
+
+func renderTemplateFile(play *types.Play, source, target string) error {
+	contents, err := ioutil.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	left, right := play.TemplateDelimiters()
+	tpl, err := template.New(filepath.Base(source)).Delims(left, right).Option("missingkey=error").Parse(string(contents))
+	if err != nil {
+		return fmt.Errorf("Error parsing template '%s': %v", source, err)
+	}
+	stat, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, stat.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := tpl.Execute(file, play.TemplateVars()); err != nil {
+		return fmt.Errorf("Error rendering template '%s': %v", source, err)
+	}
+	return nil
+}
+
+// copyDirectory copies a directory tree, preserving file modes and symbolic links.
+func copyDirectory(source, destination string) error {
+	return filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destination, relative)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			in, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer in.Close()
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+			_, err = io.Copy(out, in)
+			return err
+		}
+	})
+}
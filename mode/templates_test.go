@@ -0,0 +1,80 @@
+package mode
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+func TestRenderPlayTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	playbookDir := filepath.Join(dir, "playbooks")
+	if err := os.MkdirAll(filepath.Join(playbookDir, "group_vars"), 0755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	files := map[string]string{
+		filepath.Join(playbookDir, "site.yml"):           "- hosts: all\n",
+		filepath.Join(playbookDir, "group_vars/all.yml"): "db_host: [[ .db_host ]]\nport: \"{{ port }}\"\n",
+		filepath.Join(dir, "outputs.yml"):                "endpoint: [[ .endpoint ]]\n",
+	}
+	for path, contents := range files {
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	outputsFile := filepath.Join(dir, "outputs.yml")
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"playbook": []interface{}{map[string]interface{}{
+			"file_path": filepath.Join(playbookDir, "site.yml"),
+		}},
+		"template_files":   []interface{}{"group_vars/all.yml", outputsFile},
+		"template_vars":    map[string]interface{}{"db_host": "10.0.0.5", "endpoint": "https://api.example.com"},
+		"extra_vars_files": []interface{}{outputsFile},
+	})
+	workDir, err := renderPlayTemplates(new(terraform.MockUIOutput), play, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	playbookPath := play.Entity().(*types.Playbook).FilePath()
+	if !strings.HasPrefix(playbookPath, workDir) {
+		t.Fatalf("Expected the playbook to point at the working directory but got: %s", playbookPath)
+	}
+	rendered, err := ioutil.ReadFile(filepath.Join(filepath.Dir(playbookPath), "group_vars/all.yml"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(rendered) != "db_host: 10.0.0.5\nport: \"{{ port }}\"\n" {
+		t.Fatalf("Expected the template to be rendered leaving Jinja2 untouched but got: %s", string(rendered))
+	}
+	if len(play.ExtraVarsFiles()) != 1 || !strings.HasPrefix(play.ExtraVarsFiles()[0], workDir) {
+		t.Fatalf("Expected the extra vars file to be replaced with the rendered copy but got: %v", play.ExtraVarsFiles())
+	}
+	original, _ := ioutil.ReadFile(filepath.Join(playbookDir, "group_vars/all.yml"))
+	if !strings.Contains(string(original), "[[ .db_host ]]") {
+		t.Fatalf("Expected the original template to be left untouched")
+	}
+
+	play = test.GetNewDefaultPlay(t, map[string]interface{}{
+		"playbook": []interface{}{map[string]interface{}{
+			"file_path": filepath.Join(playbookDir, "site.yml"),
+		}},
+		"template_files": []interface{}{"group_vars/all.yml"},
+	})
+	if workDir, err := renderPlayTemplates(new(terraform.MockUIOutput), play, ""); err == nil {
+		os.RemoveAll(workDir)
+		t.Fatalf("Expected an error for a missing template variable")
+	}
+}
@@ -0,0 +1,17 @@
+package mode
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+// Exit status of GNU timeout when the command timed out.
+const timeoutExitStatus = 124
+
+// withRemoteTimeout wraps the command with GNU timeout, the command is terminated
+// on the target when it does not finish within the timeout.
+func withRemoteTimeout(command string, timeout time.Duration) string {
+	return fmt.Sprintf("timeout --kill-after=30 %d /bin/sh -c %s", int(timeout.Seconds()), types.ShellQuote(command))
+}
@@ -0,0 +1,13 @@
+package mode
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWithRemoteTimeout(t *testing.T) {
+	expected := "timeout --kill-after=30 600 /bin/sh -c 'ANSIBLE_FORCE_COLOR=true ansible-playbook '\\''/tmp/play.yml'\\'''"
+	if command := withRemoteTimeout("ANSIBLE_FORCE_COLOR=true ansible-playbook '/tmp/play.yml'", 10*time.Minute); command != expected {
+		t.Fatalf("Expected '%s' but got: '%s'", expected, command)
+	}
+}
@@ -0,0 +1,114 @@
+package mode
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/terraform/communicator"
+	"github.com/hashicorp/terraform/communicator/remote"
+)
+
+// archivingCommunicator uploads directories as a single compressed tarball extracted on the host,
+// instead of a file by file transfer.
+type archivingCommunicator struct {
+	communicator.Communicator
+}
+
+func newArchivingCommunicator(comm communicator.Communicator) *archivingCommunicator {
+	return &archivingCommunicator{Communicator: comm}
+}
+
+// UploadDir uploads the contents of the source directory to the destination directory.
+func (c *archivingCommunicator) UploadDir(dst string, src string) error {
+	archive, err := ioutil.TempFile("", "tf-ansible-upload")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	if err := writeDirectoryArchive(archive, src); err != nil {
+		return fmt.Errorf("could not archive '%s': %v", src, err)
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	remoteArchive := fmt.Sprintf("%s.tar.gz", dst)
+	if err := c.Communicator.Upload(remoteArchive, archive); err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	cmd := &remote.Cmd{
+		Command: fmt.Sprintf("mkdir -p \"%s\" && tar -xzf \"%s\" -C \"%s\" && rm -f \"%s\"", dst, remoteArchive, dst, remoteArchive),
+		Stdout:  ioutil.Discard,
+		Stderr:  &stderr,
+	}
+	if err := c.Start(cmd); err != nil {
+		return err
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("could not extract '%s': %v, %s", remoteArchive, err, stderr.String())
+	}
+	return nil
+}
+
+// writeDirectoryArchive writes the contents of a directory as a gzip compressed tarball,
+// paths are relative to the directory, symlinks are archived as the files these point at.
+func writeDirectoryArchive(w io.Writer, src string) error {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(src, path)
+		if err != nil || relative == "." {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if info, err = os.Stat(path); err != nil {
+				return err
+			}
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relative)
+		if info.IsDir() {
+			header.Name = header.Name + "/"
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tarWriter, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
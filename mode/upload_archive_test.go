@@ -0,0 +1,76 @@
+package mode
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform/communicator/remote"
+)
+
+// Start runs the command on the local machine.
+func (c *localCommunicator) Start(cmd *remote.Cmd) error {
+	cmd.Init()
+	command := exec.Command("/bin/sh", "-c", cmd.Command)
+	command.Stdout = cmd.Stdout
+	command.Stderr = cmd.Stderr
+	go func() {
+		err := command.Run()
+		cmd.SetExitStatus(exitStatusFromError(err), err)
+	}()
+	return nil
+}
+
+func TestArchivingCommunicatorUploadDir(t *testing.T) {
+	if _, err := exec.LookPath("tar"); err != nil {
+		t.Skip("tar is not installed")
+	}
+	local, err := ioutil.TempDir("", "archive-local")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(local)
+	remoteDir, err := ioutil.TempDir("", "archive-remote")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(remoteDir)
+
+	if err := os.MkdirAll(filepath.Join(local, "roles", "web", "tasks"), 0755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	files := map[string]string{
+		"site.yml":                   "---\n",
+		"roles/web/tasks/main.yml":   "- debug: {}\n",
+		"roles/web/tasks/linked.yml": "",
+	}
+	for name, contents := range files {
+		if contents == "" {
+			continue
+		}
+		if err := ioutil.WriteFile(filepath.Join(local, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(local, "roles", "web", "tasks", "main.yml"), filepath.Join(local, "roles", "web", "tasks", "linked.yml")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	files["roles/web/tasks/linked.yml"] = files["roles/web/tasks/main.yml"]
+
+	target := filepath.Join(remoteDir, "playbook")
+	comm := newArchivingCommunicator(&localCommunicator{})
+	if err := comm.UploadDir(target, local); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for name, contents := range files {
+		uploaded, err := ioutil.ReadFile(filepath.Join(target, name))
+		if err != nil || string(uploaded) != contents {
+			t.Fatalf("Expected '%s' to be extracted with contents %q but got: %q, %v", name, contents, uploaded, err)
+		}
+	}
+	if _, err := os.Stat(target + ".tar.gz"); !os.IsNotExist(err) {
+		t.Fatalf("Expected the archive to be removed after the extraction but got: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package mode
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+// directoryUpload is a local directory uploaded to the bootstrap directory.
+type directoryUpload struct {
+	description string
+	path        string
+}
+
+// playDirectoryUploads returns the distinct directories uploaded for the plays: the parent directories
+// of the playbooks, the roles and the collections paths. Files written to the bootstrap directory
+// by the provisioner are not included.
+func playDirectoryUploads(plays []*types.Play) ([]directoryUpload, error) {
+	uploads := make([]directoryUpload, 0)
+	seen := make(map[string]bool)
+	add := func(description string, path string) error {
+		resolvedPath, err := types.ResolvePath(path)
+		if err != nil {
+			return err
+		}
+		if !seen[resolvedPath] {
+			seen[resolvedPath] = true
+			uploads = append(uploads, directoryUpload{description: description, path: resolvedPath})
+		}
+		return nil
+	}
+	addPlaybook := func(description string, path string) error {
+		playbookPath, err := types.ResolvePath(path)
+		if err != nil {
+			return err
+		}
+		return add(description, filepath.Dir(playbookPath))
+	}
+
+	for _, play := range plays {
+		if !play.Enabled() {
+			continue
+		}
+		entity, ok := play.Entity().(*types.Playbook)
+		if !ok {
+			continue
+		}
+		for _, path := range entity.FilePaths() {
+			if err := addPlaybook("playbook directory", path); err != nil {
+				return nil, err
+			}
+		}
+		if play.OnFailure() != nil {
+			if err := addPlaybook("on_failure playbook directory", play.OnFailure().FilePath()); err != nil {
+				return nil, err
+			}
+		}
+		for _, path := range play.RolesPath() {
+			if strings.HasPrefix(path, "galaxy_install:") {
+				continue
+			}
+			if err := add("roles path", path); err != nil {
+				return nil, err
+			}
+		}
+		for _, path := range entity.CollectionsPath() {
+			if err := add("collections path", path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return uploads, nil
+}
+
+// uploadPlayDirectories uploads the directories of the plays over concurrent SSH sessions, limited to
+// upload_concurrency at a time. The plays find the directories already uploaded when the remaining files
+// are placed next to them.
+func (v *RemoteMode) uploadPlayDirectories(plays []*types.Play) error {
+	concurrency := v.remoteSettings.UploadConcurrency()
+	if concurrency <= 1 {
+		return nil
+	}
+	uploads, err := playDirectoryUploads(plays)
+	if err != nil {
+		return err
+	}
+	if len(uploads) < 2 {
+		return nil
+	}
+
+	v.o.Output(fmt.Sprintf("Uploading %d directories, %d at a time...", len(uploads), concurrency))
+	errs := make([]error, len(uploads))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for idx, upload := range uploads {
+		wg.Add(1)
+		go func(idx int, upload directoryUpload) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			_, errs[idx] = v.uploadDirectory(upload.description, upload.path)
+		}(idx, upload)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
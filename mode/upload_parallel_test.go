@@ -0,0 +1,98 @@
+package mode
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+func TestUploadPlayDirectoriesConcurrently(t *testing.T) {
+	local, err := ioutil.TempDir("", "parallel-local")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(local)
+	bootstrapDirectory, err := ioutil.TempDir("", "parallel-remote")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(bootstrapDirectory)
+
+	for _, name := range []string{"site/site.yml", "verify/verify.yml", "roles/common/tasks/main.yml", "collections/ansible_collections/ns/col/galaxy.yml"} {
+		path := filepath.Join(local, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte("---\n"), 0644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	plays := []*types.Play{
+		test.GetNewDefaultPlay(t, map[string]interface{}{
+			"playbook": []interface{}{map[string]interface{}{
+				"file_path":             filepath.Join(local, "site", "site.yml"),
+				"additional_file_paths": []interface{}{filepath.Join(local, "verify", "verify.yml")},
+				"roles_path":            []interface{}{filepath.Join(local, "roles"), "galaxy_install:galaxy-roles"},
+				"collections_path":      []interface{}{filepath.Join(local, "collections")},
+			}},
+		}),
+		// the same playbook directory is uploaded once:
+		test.GetNewDefaultPlay(t, map[string]interface{}{
+			"playbook": []interface{}{map[string]interface{}{
+				"file_path": filepath.Join(local, "site", "site.yml"),
+			}},
+		}),
+	}
+
+	uploads, err := playDirectoryUploads(plays)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(uploads) != 4 {
+		t.Fatalf("Expected 4 distinct directories but got: %v", uploads)
+	}
+
+	data := schema.TestResourceDataRaw(t, map[string]*schema.Schema{
+		"remote": types.NewRemoteSchema(),
+	}, map[string]interface{}{
+		"remote": []interface{}{map[string]interface{}{
+			"use_sudo":            false,
+			"bootstrap_directory": bootstrapDirectory,
+			"upload_concurrency":  3,
+		}},
+	})
+	v := &RemoteMode{
+		o:              new(terraform.MockUIOutput),
+		comm:           &localCommunicator{},
+		remoteSettings: types.NewRemoteSettingsFromInterface(data.GetOk("remote")),
+	}
+	if err := os.MkdirAll(v.remoteSettings.BootstrapDirectory(), 0755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := v.uploadPlayDirectories(plays); err != nil {
+		t.Fatalf("Expected the directories to be uploaded but got: %v", err)
+	}
+
+	// the plays find their directories uploaded:
+	remotePlaybookPath, err := v.uploadPlaybookDirectory("playbook", filepath.Join(local, "site", "site.yml"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(remotePlaybookPath); err != nil {
+		t.Fatalf("Expected the playbook to be uploaded but got: %v", err)
+	}
+	remoteRolesPath, err := v.uploadDirectory("roles path", filepath.Join(local, "roles"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(remoteRolesPath, "common", "tasks", "main.yml")); err != nil {
+		t.Fatalf("Expected the roles to be uploaded but got: %v", err)
+	}
+}
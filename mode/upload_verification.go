@@ -0,0 +1,125 @@
+package mode
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/terraform/communicator"
+	"github.com/hashicorp/terraform/communicator/ssh"
+)
+
+// uploadChecksumsFile is written to the bootstrap directory and checked with sha256sum on the host.
+const uploadChecksumsFile = ".upload-checksums"
+
+// verifyingCommunicator records the checksums of all uploaded files, such that these can be verified on the host.
+// Uploads may run concurrently.
+type verifyingCommunicator struct {
+	communicator.Communicator
+	checksums map[string]string
+	lock      sync.Mutex
+}
+
+func newVerifyingCommunicator(comm communicator.Communicator) *verifyingCommunicator {
+	return &verifyingCommunicator{
+		Communicator: comm,
+		checksums:    make(map[string]string),
+	}
+}
+
+// Upload uploads a single file and records its checksum.
+func (c *verifyingCommunicator) Upload(path string, input io.Reader) error {
+	digest := sha256.New()
+	if err := c.Communicator.Upload(path, io.TeeReader(input, digest)); err != nil {
+		return err
+	}
+	c.record(path, hex.EncodeToString(digest.Sum(nil)))
+	return nil
+}
+
+// UploadScript uploads a script and records its checksum, the default shebang is added here,
+// such that the checksum covers the uploaded contents.
+func (c *verifyingCommunicator) UploadScript(path string, input io.Reader) error {
+	var script bytes.Buffer
+	if _, err := script.ReadFrom(input); err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(script.Bytes(), []byte("#!")) {
+		script = *bytes.NewBuffer(append([]byte(ssh.DefaultShebang), script.Bytes()...))
+	}
+	sum := sha256.Sum256(script.Bytes())
+	if err := c.Communicator.UploadScript(path, &script); err != nil {
+		return err
+	}
+	c.record(path, hex.EncodeToString(sum[:]))
+	return nil
+}
+
+// UploadDir uploads a directory and records the checksums of the regular files within.
+// The destination must not exist, the contents of the source end up in the destination.
+func (c *verifyingCommunicator) UploadDir(dst string, src string) error {
+	if err := c.Communicator.UploadDir(dst, src); err != nil {
+		return err
+	}
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		relative, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		checksum, err := fileChecksum(path)
+		if err != nil {
+			return err
+		}
+		c.record(filepath.Join(dst, relative), checksum)
+		return nil
+	})
+}
+
+func (c *verifyingCommunicator) record(path string, checksum string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.checksums[path] = checksum
+}
+
+// manifest returns the recorded checksums in the sha256sum format and forgets them.
+func (c *verifyingCommunicator) manifest() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	paths := make([]string, 0)
+	for path := range c.checksums {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	lines := make([]string, 0)
+	for _, path := range paths {
+		lines = append(lines, fmt.Sprintf("%s  %s\n", c.checksums[path], path))
+	}
+	c.checksums = make(map[string]string)
+	return strings.Join(lines, "")
+}
+
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	digest := sha256.New()
+	if _, err := io.Copy(digest, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
@@ -0,0 +1,101 @@
+package mode
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/communicator"
+)
+
+// localCommunicator uploads to the local file system.
+type localCommunicator struct {
+	communicator.Communicator
+	corrupt bool
+}
+
+func (c *localCommunicator) Upload(path string, input io.Reader) error {
+	contents, err := ioutil.ReadAll(input)
+	if err != nil {
+		return err
+	}
+	if c.corrupt {
+		contents = append(contents, '!')
+	}
+	return ioutil.WriteFile(path, contents, 0644)
+}
+
+func (c *localCommunicator) UploadScript(path string, input io.Reader) error {
+	if err := c.Upload(path, input); err != nil {
+		return err
+	}
+	// like the SSH communicator, scripts are made executable:
+	return os.Chmod(path, 0755)
+}
+
+func (c *localCommunicator) UploadDir(dst string, src string) error {
+	return copyDirectory(src, dst)
+}
+
+func TestVerifyingCommunicatorManifest(t *testing.T) {
+	if _, err := exec.LookPath("sha256sum"); err != nil {
+		t.Skip("sha256sum is not installed")
+	}
+	local, err := ioutil.TempDir("", "uploads-local")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(local)
+	remote, err := ioutil.TempDir("", "uploads-remote")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(remote)
+
+	if err := os.MkdirAll(filepath.Join(local, "playbook", "roles"), 0755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for name, contents := range map[string]string{"site.yml": "---\n", "roles/main.yml": "- debug: {}\n"} {
+		if err := ioutil.WriteFile(filepath.Join(local, "playbook", name), []byte(contents), 0644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	verify := func(corrupt bool) error {
+		comm := newVerifyingCommunicator(&localCommunicator{corrupt: corrupt})
+		target := filepath.Join(remote, "playbook")
+		os.RemoveAll(target)
+		if err := comm.UploadDir(target, filepath.Join(local, "playbook")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := comm.Upload(filepath.Join(remote, "extra-vars.json"), strings.NewReader("{}")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := comm.UploadScript(filepath.Join(remote, "installer"), strings.NewReader("echo install")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		manifest := comm.manifest()
+		if strings.Count(manifest, "\n") != 4 {
+			t.Fatalf("Expected checksums of 4 files but got: %s", manifest)
+		}
+		if len(comm.checksums) != 0 {
+			t.Fatalf("Expected the checksums to be forgotten after the manifest was created")
+		}
+		manifestPath := filepath.Join(remote, uploadChecksumsFile)
+		if err := ioutil.WriteFile(manifestPath, []byte(manifest), 0644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return exec.Command("sha256sum", "--check", "--quiet", manifestPath).Run()
+	}
+
+	if err := verify(false); err != nil {
+		t.Fatalf("Expected the uploaded files to match but got: %v", err)
+	}
+	if err := verify(true); err == nil {
+		t.Fatalf("Expected corrupted uploads to be detected")
+	}
+}
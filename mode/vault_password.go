@@ -0,0 +1,62 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+// materializeVaultPassword writes the vault password of a play, read from the output
+// of vault_password_command or from the vault_password_env environment variable,
+// to a temporary file readable by the owner only, in the work directory, empty for the system
+// temporary directory. Returns an empty string when the play uses neither.
+// The command runs with the environment of the local commands and ends with the context.
+// The caller is responsible for removing the file.
+func materializeVaultPassword(ctx context.Context, play *types.Play, workDirectory string) (string, error) {
+
+	var password string
+
+	if play.VaultPasswordCommand() != "" {
+		command, err := types.ResolvePath(play.VaultPasswordCommand())
+		if err != nil {
+			return "", err
+		}
+		cmd := exec.CommandContext(ctx, command)
+		cmd.Env = localCommandEnvironment(contextRunOptions(ctx))
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("Error executing vault password command '%s': %s", command, err)
+		}
+		password = strings.TrimRight(string(out), "\r\n")
+	} else if play.VaultPasswordEnv() != "" {
+		val, ok := os.LookupEnv(play.VaultPasswordEnv())
+		if !ok || val == "" {
+			return "", fmt.Errorf("Vault password environment variable '%s' is not set", play.VaultPasswordEnv())
+		}
+		password = val
+	} else {
+		return "", nil
+	}
+
+	if password == "" {
+		return "", fmt.Errorf("Vault password command '%s' returned an empty password", play.VaultPasswordCommand())
+	}
+
+	return writeTempFile(workDirectory, "", []byte(password), 0400)
+}
+
+// secretFileCreateCommand returns the command creating an empty file readable and writable by the owner only,
+// a secret uploaded to it is never readable by other users of the host.
+func secretFileCreateCommand(path string) string {
+	return fmt.Sprintf("(umask 077 && : > \"%s\")", path)
+}
+
+// secretFileShredCommand returns the command overwriting and removing a secret file,
+// the file is removed when shred is not available on the host.
+func secretFileShredCommand(path string) string {
+	return fmt.Sprintf("/bin/sh -c 'shred -u -z \"%s\" 2>/dev/null || rm -f \"%s\"'", path, path)
+}
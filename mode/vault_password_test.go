@@ -0,0 +1,210 @@
+package mode
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/test"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+func TestVaultPasswordFromEnvironmentIsMaterialized(t *testing.T) {
+	os.Setenv("TF_ANSIBLE_TEST_VAULT_PASSWORD", "env-password")
+	defer os.Unsetenv("TF_ANSIBLE_TEST_VAULT_PASSWORD")
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"vault_password_env": "TF_ANSIBLE_TEST_VAULT_PASSWORD",
+	})
+
+	path, err := materializeVaultPassword(context.Background(), play, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.Remove(path)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected the vault password file to exist but received: %v", err)
+	}
+	if info.Mode().Perm() != 0400 {
+		t.Fatalf("Expected the vault password file mode 0400 but got: %v", info.Mode().Perm())
+	}
+	contents, _ := ioutil.ReadFile(path)
+	if string(contents) != "env-password" {
+		t.Fatalf("Expected the vault password in the file but got: '%s'", string(contents))
+	}
+}
+
+func TestVaultPasswordFromCommandIsMaterialized(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-password-command")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "vault-password.sh")
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\necho command-password\n"), 0700); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"vault_password_command": script,
+	})
+
+	path, err := materializeVaultPassword(context.Background(), play, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.Remove(path)
+
+	contents, _ := ioutil.ReadFile(path)
+	if string(contents) != "command-password" {
+		t.Fatalf("Expected the vault password in the file but got: '%s'", string(contents))
+	}
+
+	play.SetOverrideVaultPasswordPath(path)
+	output := new(terraform.MockUIOutput)
+	newMaskingOutput(output, playSecrets([]*types.Play{play})).Output("vault password: command-password")
+	if output.OutputMessage != "vault password: ******" {
+		t.Fatalf("Expected the vault password masked but got: '%s'", output.OutputMessage)
+	}
+}
+
+func TestVaultPasswordCommandRunsWithTheRunEnvironment(t *testing.T) {
+	os.Setenv("TF_ANSIBLE_TEST_VAULT_SECRET", "leaked")
+	defer os.Unsetenv("TF_ANSIBLE_TEST_VAULT_SECRET")
+	dir, err := ioutil.TempDir("", "vault-password-command")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "vault-password.sh")
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\necho \"password-${TF_ANSIBLE_TEST_VAULT_SECRET}\"\n"), 0700); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"vault_password_command": script,
+	})
+
+	ctx := RunOptions{CleanEnvironment: true}.runContext()
+	path, err := materializeVaultPassword(ctx, play, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.Remove(path)
+
+	contents, _ := ioutil.ReadFile(path)
+	if string(contents) != "password-" {
+		t.Fatalf("Expected the command to run with the clean environment but got: '%s'", string(contents))
+	}
+}
+
+func TestVaultPasswordFromUnsetEnvironmentFails(t *testing.T) {
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"vault_password_env": "TF_ANSIBLE_TEST_VAULT_PASSWORD_UNSET",
+	})
+
+	if _, err := materializeVaultPassword(context.Background(), play, ""); err == nil {
+		t.Fatalf("Expected an error for an unset environment variable")
+	}
+}
+
+func TestVaultPasswordRemoteUploadAndShred(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-password-remote")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "vault-password")
+	if err := ioutil.WriteFile(source, []byte("vault-password"), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data := schema.TestResourceDataRaw(t, map[string]*schema.Schema{
+		"remote": types.NewRemoteSchema(),
+	}, map[string]interface{}{
+		"remote": []interface{}{map[string]interface{}{"use_sudo": false}},
+	})
+	v := &RemoteMode{
+		o:              new(terraform.MockUIOutput),
+		comm:           &localCommunicator{},
+		remoteSettings: types.NewRemoteSettingsFromInterface(data.GetOk("remote")),
+	}
+
+	path, err := v.uploadVaultPasswordOrIDFile(dir, source)
+	if err != nil {
+		t.Fatalf("Expected the vault password file to be uploaded but got: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected the vault password file to exist but received: %v", err)
+	}
+	if info.Mode().Perm() != 0400 {
+		t.Fatalf("Expected the uploaded vault password file mode 0400 but got: %v", info.Mode().Perm())
+	}
+	contents, _ := ioutil.ReadFile(path)
+	if string(contents) != "vault-password" {
+		t.Fatalf("Expected the vault password in the uploaded file but got: '%s'", string(contents))
+	}
+
+	v.shredSecretFiles()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected the vault password file to be shredded but received: %v", err)
+	}
+}
+
+func TestBecomePasswordAndExtraVarsRemoteUploadAndShred(t *testing.T) {
+	dir, err := ioutil.TempDir("", "become-password-remote")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := schema.TestResourceDataRaw(t, map[string]*schema.Schema{
+		"remote": types.NewRemoteSchema(),
+	}, map[string]interface{}{
+		"remote": []interface{}{map[string]interface{}{"use_sudo": false}},
+	})
+	v := &RemoteMode{
+		o:              new(terraform.MockUIOutput),
+		comm:           &localCommunicator{},
+		remoteSettings: types.NewRemoteSettingsFromInterface(data.GetOk("remote")),
+	}
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"become":          true,
+		"become_password": "bec0me-pa55",
+		"extra_vars":      map[string]interface{}{"db_password": "db-pa55"},
+	})
+
+	if err := v.uploadBecomePassword(dir, play); err != nil {
+		t.Fatalf("Expected the become password file to be uploaded but got: %v", err)
+	}
+	if err := v.uploadExtraVars(dir, play); err != nil {
+		t.Fatalf("Expected the extra vars file to be uploaded but got: %v", err)
+	}
+	if len(v.uploadedSecretFiles) != 2 {
+		t.Fatalf("Expected both files tracked for shredding but got: %v", v.uploadedSecretFiles)
+	}
+	for _, path := range v.uploadedSecretFiles {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Expected the uploaded file to exist but received: %v", err)
+		}
+		if info.Mode().Perm() != 0400 {
+			t.Fatalf("Expected the uploaded file mode 0400 but got: %v", info.Mode().Perm())
+		}
+	}
+
+	paths := v.uploadedSecretFiles
+	v.shredSecretFiles()
+	for _, path := range paths {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("Expected the uploaded file to be shredded but received: %v", err)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package mode
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+const ansibleVaultHeader = "$ANSIBLE_VAULT;"
+
+// checkVaultVarsFiles verifies the encrypted extra vars files of the play are ansible-vault encrypted
+// and the play has the vault credentials to decrypt them, such that plain text secrets are never uploaded
+// by mistake and a missing password fails before anything is executed.
+func checkVaultVarsFiles(play *types.Play) error {
+	if len(play.ExtraVarsVaultFiles()) == 0 {
+		return nil
+	}
+	if !play.HasVaultCredentials() {
+		return fmt.Errorf("extra_vars_vault_files require one of vault_id, vault_password_file, vault_password_command or vault_password_env")
+	}
+	for _, vaultFile := range play.ExtraVarsVaultFiles() {
+		path, err := types.ResolvePath(vaultFile)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		header, _ := bufio.NewReader(file).ReadString('\n')
+		file.Close()
+		if !strings.HasPrefix(header, ansibleVaultHeader) {
+			return fmt.Errorf("extra vars file '%s' is not encrypted with ansible-vault", vaultFile)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package mode
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/radekg/terraform-provisioner-ansible/test"
+)
+
+func TestCheckVaultVarsFiles(t *testing.T) {
+	encrypted := test.WriteTempVaultIDFile(t, "$ANSIBLE_VAULT;1.1;AES256\n6162636465666768\n")
+	defer os.Remove(encrypted)
+	plain := test.WriteTempVaultIDFile(t, "password: secret\n")
+	defer os.Remove(plain)
+	vaultPasswordFile := test.WriteTempVaultIDFile(t, "vault-password")
+	defer os.Remove(vaultPasswordFile)
+
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{
+		"extra_vars_vault_files": []interface{}{encrypted},
+	})
+	if err := checkVaultVarsFiles(play); err == nil || !strings.Contains(err.Error(), "require one of") {
+		t.Fatalf("Expected an error for missing vault credentials but got: %v", err)
+	}
+
+	play = test.GetNewDefaultPlay(t, map[string]interface{}{
+		"extra_vars_vault_files": []interface{}{encrypted, plain},
+		"vault_password_file":    vaultPasswordFile,
+	})
+	if err := checkVaultVarsFiles(play); err == nil || !strings.Contains(err.Error(), "not encrypted") {
+		t.Fatalf("Expected an error for a plain text file but got: %v", err)
+	}
+
+	play = test.GetNewDefaultPlay(t, map[string]interface{}{
+		"extra_vars_vault_files": []interface{}{encrypted},
+		"vault_password_file":    vaultPasswordFile,
+	})
+	if err := checkVaultVarsFiles(play); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,271 @@
+package mode
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+type windowsInventoryTemplateLocalDataHost struct {
+	AnsibleHost string
+	Username    string
+	Password    string
+	Port        int
+}
+
+type windowsInventoryTemplateLocalData struct {
+	Windows           []windowsInventoryTemplateLocalDataHost
+	ConnectionType    string
+	ShellType         string
+	Username          string
+	Password          string
+	Port              int
+	NTLM              bool
+	Kerberos          bool
+	KinitMode         string
+	MessageEncryption string
+	Https             bool
+	Scheme            string
+	Proxy             string
+	Cacert            string
+	Become            bool
+	BecomeMethod      string
+	BecomeUser        string
+	BecomePassword    string
+}
+
+const windowsInventoryTemplateLocal = `{{$top := . -}}
+[windows]
+{{range .Windows -}}
+{{.AnsibleHost -}}
+{{if ne .Username "" -}}
+{{" "}}ansible_user={{iniQuote .Username -}}
+{{end -}}
+{{if ne .Password "" -}}
+{{" "}}ansible_password={{iniQuote .Password -}}
+{{end -}}
+{{if ne .Port 0 -}}
+{{" "}}ansible_port={{.Port -}}
+{{end -}}
+{{printf "\n" -}}
+{{end}}
+[windows:vars]
+{{if ne .Username "" -}}
+{{" "}}ansible_user={{iniQuote .Username -}}
+{{printf "\n" -}}
+{{end -}}
+
+{{if ne .Password "" -}}
+{{" "}}ansible_password={{iniQuote .Password -}}
+{{printf "\n" -}}
+{{end -}}
+
+{{if ne .Port 0 -}}
+{{" "}}ansible_port={{.Port -}}
+{{printf "\n" -}}
+{{end -}}
+
+{{if ne .ConnectionType "" -}}
+{{" "}}ansible_connection={{.ConnectionType -}}
+{{printf "\n" -}}
+{{end -}}
+
+{{if ne .ShellType "" -}}
+{{" "}}ansible_shell_type={{.ShellType -}}
+{{printf "\n" -}}
+{{end -}}
+
+{{if .Become -}}
+{{" "}}ansible_become=yes
+{{" "}}ansible_become_method={{.BecomeMethod}}
+{{if ne .BecomeUser "" -}}
+{{" "}}ansible_become_user={{iniQuote .BecomeUser}}
+{{end -}}
+{{if ne .BecomePassword "" -}}
+{{" "}}ansible_become_password={{iniQuote .BecomePassword}}
+{{end -}}
+{{printf "\n" -}}
+{{end -}}
+
+{{if eq .ConnectionType "winrm" -}}
+
+{{if .Kerberos -}}
+{{" "}}ansible_winrm_transport=kerberos
+{{if ne .KinitMode "" -}}
+{{" "}}ansible_winrm_kinit_mode={{.KinitMode}}
+{{end -}}
+{{else if .NTLM -}}
+{{" "}}ansible_winrm_transport=ntlm
+{{end -}}
+
+{{if ne .MessageEncryption "" -}}
+{{" "}}ansible_winrm_message_encryption={{.MessageEncryption}}
+{{end -}}
+
+{{if ne .Scheme "" -}}
+{{" "}}ansible_winrm_scheme={{.Scheme}}
+{{end -}}
+
+{{if ne .Proxy "" -}}
+{{" "}}ansible_winrm_proxy={{iniQuote .Proxy}}
+{{end -}}
+
+{{if eq .Cacert "" -}}
+{{" "}}ansible_winrm_server_cert_validation=ignore
+{{end -}}
+
+{{" "}}ansible_winrm_read_timeout_sec=900
+{{" "}}ansible_winrm_operation_timeout_sec=800
+{{printf "\n" -}}
+
+{{if ne .Cacert "" -}}
+{{" "}}ansible_winrm_ca_trust_path={{iniQuote .Cacert -}}
+{{printf "\n" -}}
+{{end -}}
+
+{{end -}}
+
+{{if eq .ConnectionType "psrp" -}}
+
+{{if .Kerberos -}}
+{{" "}}ansible_psrp_auth=kerberos
+{{else if .NTLM -}}
+{{" "}}ansible_psrp_auth=ntlm
+{{else -}}
+{{" "}}ansible_psrp_auth=negotiate
+{{end -}}
+
+{{if ne .Scheme "" -}}
+{{" "}}ansible_psrp_protocol={{.Scheme}}
+{{else if .Https -}}
+{{" "}}ansible_psrp_protocol=https
+{{else -}}
+{{" "}}ansible_psrp_protocol=http
+{{end -}}
+
+{{if eq .Cacert "" -}}
+{{" "}}ansible_psrp_cert_validation=ignore
+{{else -}}
+{{" "}}ansible_psrp_ca_path={{iniQuote .Cacert}}
+{{end -}}
+
+{{if ne .Proxy "" -}}
+{{" "}}ansible_psrp_proxy={{iniQuote .Proxy}}
+{{end -}}
+
+{{" "}}ansible_psrp_read_timeout=900
+{{" "}}ansible_psrp_operation_timeout=800
+{{printf "\n" -}}
+
+{{end -}}
+`
+
+// iniSpecialCharacters are characters which can not appear unquoted in an inventory value.
+const iniSpecialCharacters = "\\\"' \t#;="
+
+func newWindowsInventoryTemplate() *template.Template {
+	return template.Must(template.New("Windows").Funcs(template.FuncMap{
+		"iniQuote": iniQuote,
+	}).Parse(windowsInventoryTemplateLocal))
+}
+
+// windowsInventoryTemplateData builds the Windows inventory for a play.
+// When attached to a compute resource, the inventory contains the connection host only.
+// For null_resource, the inventory contains windows_settings.hosts, each with its own
+// credentials, followed by plays.hosts, which use the connection credentials.
+func (v *LocalMode) windowsInventoryTemplateData(play *types.Play, windowsSettings *types.WindowsSettings) *windowsInventoryTemplateLocalData {
+
+	connectionType := v.connInfo.Type
+	if connectionType == "winrm" && windowsSettings.ConnectionType() != "" {
+		connectionType = windowsSettings.ConnectionType()
+	}
+
+	templateData := &windowsInventoryTemplateLocalData{
+		Windows:        make([]windowsInventoryTemplateLocalDataHost, 0),
+		ConnectionType: connectionType,
+		Username:       windowsUsername(v.connInfo.User, windowsSettings.Kerberos()),
+		Password:       v.secret(v.connInfo.Password),
+		Port:           v.connInfo.Port,
+		Become:         windowsSettings.Become(),
+		BecomeMethod:   windowsSettings.BecomeMethod(),
+		BecomeUser:     windowsSettings.BecomeUser(),
+		BecomePassword: v.secret(windowsSettings.BecomePassword()),
+	}
+
+	if v.connInfo.Type == "ssh" {
+		// Windows host reachable over OpenSSH:
+		templateData.ShellType = windowsSettings.ShellType()
+	} else {
+		templateData.NTLM = v.connInfo.Ntlm
+		templateData.Kerberos = windowsSettings.Kerberos()
+		templateData.KinitMode = windowsSettings.KinitMode()
+		templateData.MessageEncryption = windowsSettings.MessageEncryption()
+		templateData.Https = v.connInfo.Https
+		templateData.Scheme = windowsSettings.Scheme()
+		templateData.Proxy = windowsSettings.Proxy()
+		templateData.Cacert = v.connInfo.Cacert
+		if windowsSettings.CATrustPath() != "" {
+			templateData.Cacert = windowsSettings.CATrustPath()
+		}
+	}
+
+	if v.connInfo.Host != "" {
+		templateData.Windows = append(templateData.Windows, windowsInventoryTemplateLocalDataHost{
+			AnsibleHost: v.connInfo.Host,
+		})
+		return templateData
+	}
+
+	// Path for null resource, which does not use v.connInfo.Host
+	for _, host := range windowsSettings.Hosts() {
+		username := host.User()
+		if username != "" {
+			username = windowsUsername(username, windowsSettings.Kerberos())
+		}
+		templateData.Windows = append(templateData.Windows, windowsInventoryTemplateLocalDataHost{
+			AnsibleHost: host.Address(),
+			Username:    username,
+			Password:    v.secret(host.Password()),
+			Port:        host.Port(),
+		})
+	}
+	for _, host := range play.Hosts() {
+		if host != "" {
+			templateData.Windows = append(templateData.Windows, windowsInventoryTemplateLocalDataHost{
+				AnsibleHost: host,
+			})
+		}
+	}
+
+	return templateData
+}
+
+// iniQuote quotes an inventory value when required. Ansible parses quoted values
+// the same way in host lines and in [group:vars] sections, so a quoted DOMAIN\user
+// survives both.
+func iniQuote(value string) string {
+	if !strings.ContainsAny(value, iniSpecialCharacters) {
+		return value
+	}
+	escaped := strings.Replace(value, "\\", "\\\\", -1)
+	escaped = strings.Replace(escaped, "\"", "\\\"", -1)
+	return fmt.Sprintf("\"%s\"", escaped)
+}
+
+// windowsUsername normalizes a domain account name.
+// Kerberos requires the user@REALM form with an upper case realm,
+// DOMAIN\user is converted to user@DOMAIN in such case.
+func windowsUsername(username string, kerberos bool) string {
+	if !kerberos {
+		return username
+	}
+	if idx := strings.Index(username, "\\"); idx > -1 {
+		return fmt.Sprintf("%s@%s", username[idx+1:], strings.ToUpper(username[:idx]))
+	}
+	if idx := strings.LastIndex(username, "@"); idx > -1 {
+		return fmt.Sprintf("%s@%s", username[:idx], strings.ToUpper(username[idx+1:]))
+	}
+	return username
+}
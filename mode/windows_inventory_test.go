@@ -0,0 +1,257 @@
+package mode
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/radekg/terraform-provisioner-ansible/test"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+func TestWindowsInventoryTemplateGeneratesForOpenSSH(t *testing.T) {
+
+	templateData := windowsInventoryTemplateLocalData{
+		Windows: []windowsInventoryTemplateLocalDataHost{
+			windowsInventoryTemplateLocalDataHost{
+				AnsibleHost: "10.1.100.34",
+			},
+		},
+		ConnectionType: "ssh",
+		ShellType:      "powershell",
+		Username:       "Administrator",
+		Port:           22,
+	}
+
+	tpl := newWindowsInventoryTemplate()
+	var buf bytes.Buffer
+	err := tpl.Execute(&buf, templateData)
+	if err != nil {
+		t.Fatalf("Expected template to generate correctly but received: %v", err)
+	}
+	templateBody := buf.String()
+	for _, expected := range []string{"ansible_connection=ssh", "ansible_shell_type=powershell", "ansible_user=Administrator"} {
+		if strings.Index(templateBody, expected) < 0 {
+			t.Fatalf("Expected '%s' in generated template but got:\n%s", expected, templateBody)
+		}
+	}
+	if strings.Index(templateBody, "ansible_winrm_") > -1 {
+		t.Fatalf("Did not expect WinRM settings in generated template but got:\n%s", templateBody)
+	}
+}
+
+func TestWindowsInventoryTemplateGeneratesForPSRP(t *testing.T) {
+
+	templateData := windowsInventoryTemplateLocalData{
+		Windows: []windowsInventoryTemplateLocalDataHost{
+			windowsInventoryTemplateLocalDataHost{
+				AnsibleHost: "10.1.100.34",
+			},
+		},
+		ConnectionType: "psrp",
+		Username:       "Administrator",
+		Port:           5986,
+		NTLM:           true,
+		Https:          true,
+	}
+
+	tpl := newWindowsInventoryTemplate()
+	var buf bytes.Buffer
+	err := tpl.Execute(&buf, templateData)
+	if err != nil {
+		t.Fatalf("Expected template to generate correctly but received: %v", err)
+	}
+	templateBody := buf.String()
+	for _, expected := range []string{"ansible_connection=psrp", "ansible_psrp_auth=ntlm", "ansible_psrp_protocol=https", "ansible_psrp_cert_validation=ignore"} {
+		if strings.Index(templateBody, expected) < 0 {
+			t.Fatalf("Expected '%s' in generated template but got:\n%s", expected, templateBody)
+		}
+	}
+	if strings.Index(templateBody, "ansible_winrm_") > -1 {
+		t.Fatalf("Did not expect WinRM settings in generated template but got:\n%s", templateBody)
+	}
+}
+
+func TestWindowsInventoryTemplateGeneratesWithBecome(t *testing.T) {
+
+	templateData := windowsInventoryTemplateLocalData{
+		Windows: []windowsInventoryTemplateLocalDataHost{
+			windowsInventoryTemplateLocalDataHost{
+				AnsibleHost: "10.1.100.34",
+			},
+		},
+		ConnectionType: "winrm",
+		Username:       "Administrator",
+		Become:         true,
+		BecomeMethod:   "runas",
+		BecomeUser:     "svc-installer",
+		BecomePassword: "secret",
+	}
+
+	tpl := newWindowsInventoryTemplate()
+	var buf bytes.Buffer
+	err := tpl.Execute(&buf, templateData)
+	if err != nil {
+		t.Fatalf("Expected template to generate correctly but received: %v", err)
+	}
+	templateBody := buf.String()
+	for _, expected := range []string{"ansible_become=yes", "ansible_become_method=runas", "ansible_become_user=svc-installer", "ansible_become_password=secret"} {
+		if strings.Index(templateBody, expected) < 0 {
+			t.Fatalf("Expected '%s' in generated template but got:\n%s", expected, templateBody)
+		}
+	}
+}
+
+func TestWindowsInventoryTemplateQuotesDomainUser(t *testing.T) {
+
+	templateData := windowsInventoryTemplateLocalData{
+		Windows: []windowsInventoryTemplateLocalDataHost{
+			windowsInventoryTemplateLocalDataHost{
+				AnsibleHost: "10.1.100.34",
+			},
+		},
+		ConnectionType: "winrm",
+		Username:       "CORP\\Administrator",
+		Password:       "pass word",
+	}
+
+	tpl := newWindowsInventoryTemplate()
+	var buf bytes.Buffer
+	err := tpl.Execute(&buf, templateData)
+	if err != nil {
+		t.Fatalf("Expected template to generate correctly but received: %v", err)
+	}
+	templateBody := buf.String()
+	for _, expected := range []string{"ansible_user=\"CORP\\\\Administrator\"", "ansible_password=\"pass word\""} {
+		if strings.Index(templateBody, expected) < 0 {
+			t.Fatalf("Expected '%s' in generated template but got:\n%s", expected, templateBody)
+		}
+	}
+}
+
+func TestWindowsUsernameForKerberos(t *testing.T) {
+	cases := map[string]string{
+		"Administrator":          "Administrator",
+		"CORP\\Administrator":    "Administrator@CORP",
+		"administrator@corp.com": "administrator@CORP.COM",
+	}
+	for input, expected := range cases {
+		if result := windowsUsername(input, true); result != expected {
+			t.Fatalf("Expected '%s' for '%s' but got '%s'", expected, input, result)
+		}
+		if result := windowsUsername(input, false); result != input {
+			t.Fatalf("Expected '%s' to be left intact without Kerberos but got '%s'", input, result)
+		}
+	}
+}
+
+func TestWindowsInventoryTemplateGeneratesMessageEncryption(t *testing.T) {
+
+	templateData := windowsInventoryTemplateLocalData{
+		Windows: []windowsInventoryTemplateLocalDataHost{
+			windowsInventoryTemplateLocalDataHost{
+				AnsibleHost: "10.1.100.34",
+			},
+		},
+		ConnectionType:    "winrm",
+		MessageEncryption: "never",
+	}
+
+	tpl := newWindowsInventoryTemplate()
+	var buf bytes.Buffer
+	err := tpl.Execute(&buf, templateData)
+	if err != nil {
+		t.Fatalf("Expected template to generate correctly but received: %v", err)
+	}
+	templateBody := buf.String()
+	if strings.Index(templateBody, "ansible_winrm_message_encryption=never") < 0 {
+		t.Fatalf("Expected message encryption in generated template but got:\n%s", templateBody)
+	}
+}
+
+func TestWindowsInventoryTemplateGeneratesMultipleHosts(t *testing.T) {
+
+	templateData := windowsInventoryTemplateLocalData{
+		Windows: []windowsInventoryTemplateLocalDataHost{
+			windowsInventoryTemplateLocalDataHost{
+				AnsibleHost: "10.1.100.34",
+				Username:    "CORP\\svc-one",
+				Password:    "secret1",
+				Port:        5986,
+			},
+			windowsInventoryTemplateLocalDataHost{
+				AnsibleHost: "10.1.100.35",
+			},
+		},
+		ConnectionType: "winrm",
+		Username:       "Administrator",
+		Password:       "shared",
+	}
+
+	tpl := newWindowsInventoryTemplate()
+	var buf bytes.Buffer
+	err := tpl.Execute(&buf, templateData)
+	if err != nil {
+		t.Fatalf("Expected template to generate correctly but received: %v", err)
+	}
+	templateBody := buf.String()
+	expected := "[windows]\n10.1.100.34 ansible_user=\"CORP\\\\svc-one\" ansible_password=secret1 ansible_port=5986\n10.1.100.35\n"
+	if strings.Index(templateBody, expected) < 0 {
+		t.Fatalf("Expected hosts with their own credentials in generated template but got:\n%s", templateBody)
+	}
+	if strings.Index(templateBody, "[windows:vars]\n ansible_user=Administrator\n ansible_password=shared\n") < 0 {
+		t.Fatalf("Expected shared credentials in generated template but got:\n%s", templateBody)
+	}
+}
+
+func TestWindowsInventoryTemplateGeneratesWithProxyAndCATrustPath(t *testing.T) {
+
+	templateData := windowsInventoryTemplateLocalData{
+		Windows: []windowsInventoryTemplateLocalDataHost{
+			windowsInventoryTemplateLocalDataHost{
+				AnsibleHost: "10.1.100.34",
+			},
+		},
+		ConnectionType: "winrm",
+		Username:       "Administrator",
+		Port:           5986,
+		NTLM:           true,
+		Scheme:         "https",
+		Proxy:          "http://proxy.corp:3128",
+		Cacert:         "/etc/pki/corp-ca.pem",
+	}
+
+	tpl := newWindowsInventoryTemplate()
+	var buf bytes.Buffer
+	err := tpl.Execute(&buf, templateData)
+	if err != nil {
+		t.Fatalf("Expected template to generate correctly but received: %v", err)
+	}
+	templateBody := buf.String()
+	for _, expected := range []string{"ansible_winrm_scheme=https", "ansible_winrm_proxy=http://proxy.corp:3128", "ansible_winrm_ca_trust_path=/etc/pki/corp-ca.pem"} {
+		if strings.Index(templateBody, expected) < 0 {
+			t.Fatalf("Expected '%s' in generated template but got:\n%s", expected, templateBody)
+		}
+	}
+	if strings.Index(templateBody, "ansible_winrm_server_cert_validation=ignore") > -1 {
+		t.Fatalf("Did not expect certificate validation to be disabled but got:\n%s", templateBody)
+	}
+}
+
+func TestWindowsInventoryPrintOnlyWritesPlaceholders(t *testing.T) {
+	local := &LocalMode{
+		connInfo:  &connectionInfo{Type: "winrm", User: "Administrator", Password: "Adm1n-pa55", Host: "10.1.100.34", Port: 5986},
+		printOnly: true,
+	}
+	play := test.GetNewDefaultPlay(t, map[string]interface{}{})
+
+	tpl := newWindowsInventoryTemplate()
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, local.windowsInventoryTemplateData(play, types.NewWindowsSettingsFromInterface(nil, false))); err != nil {
+		t.Fatalf("Expected template to generate correctly but received: %v", err)
+	}
+	templateBody := buf.String()
+	if strings.Contains(templateBody, "Adm1n-pa55") || !strings.Contains(templateBody, printOnlyPlaceholder) {
+		t.Fatalf("Expected the placeholder instead of the password in the kept inventory but got:\n%s", templateBody)
+	}
+}
@@ -0,0 +1,58 @@
+package mode
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// newWorkDirectory creates the directory of the temporary files of a run, accessible by the owner only,
+// in the base directory, or in the system temporary directory when the base is empty.
+// The caller is responsible for removing the directory.
+func newWorkDirectory(base string) (string, error) {
+	if base != "" {
+		if err := os.MkdirAll(base, 0700); err != nil {
+			return "", err
+		}
+	}
+	dir, err := ioutil.TempDir(base, "tf-ansible-")
+	if err != nil {
+		return "", err
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// openWorkDirectory creates the work directory of the local mode, unless already created.
+// The returned function removes the directory and all temporary files in it, it does nothing
+// when the directory was created before. With print_only, the directory and the files are kept.
+func (v *LocalMode) openWorkDirectory(options RunOptions) (func(), error) {
+	if v.workDirectory != "" {
+		return func() {}, nil
+	}
+	dir, err := newWorkDirectory(options.WorkDirectory)
+	if err != nil {
+		return nil, err
+	}
+	v.workDirectory = dir
+	v.printOnly = options.PrintOnly
+	return func() {
+		if v.printOnly {
+			v.o.Output(fmt.Sprintf("print_only: the files read by the printed commands are kept in '%s', remove the directory when done", dir))
+		} else {
+			os.RemoveAll(dir)
+		}
+		v.workDirectory = ""
+	}, nil
+}
+
+// removeTemporary removes a temporary file or directory of the run with the remove function.
+// Nothing is removed with print_only, the printed commands read the files.
+func (v *LocalMode) removeTemporary(remove func(string) error, path string) {
+	if !v.printOnly {
+		remove(path)
+	}
+}
@@ -0,0 +1,49 @@
+package mode
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestWorkDirectoryIsPrivateAndRemoved(t *testing.T) {
+	root, err := ioutil.TempDir("", "work-dir")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	local := &LocalMode{o: new(terraform.MockUIOutput)}
+	closeWorkDirectory, err := local.openWorkDirectory(RunOptions{WorkDirectory: filepath.Join(root, "ci", "ansible")})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	info, err := os.Stat(local.workDirectory)
+	if err != nil || info.Mode().Perm() != 0700 || filepath.Dir(filepath.Dir(local.workDirectory)) != filepath.Join(root, "ci") {
+		t.Fatalf("Expected a directory accessible by the owner only in the work_dir but got: %s %v", local.workDirectory, err)
+	}
+
+	cfgFile, err := local.writeAnsibleCfg("[defaults]\n")
+	if err != nil || filepath.Dir(cfgFile) != local.workDirectory {
+		t.Fatalf("Expected the temporary file in the work directory but got: %s %v", cfgFile, err)
+	}
+
+	// a directory already open is kept for the outer caller:
+	closeNested, err := local.openWorkDirectory(RunOptions{WorkDirectory: root})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	closeNested()
+	if _, err := os.Stat(cfgFile); err != nil {
+		t.Fatalf("Expected the work directory to be kept but got: %v", err)
+	}
+
+	workDirectory := local.workDirectory
+	closeWorkDirectory()
+	if _, err := os.Stat(workDirectory); !os.IsNotExist(err) {
+		t.Fatalf("Expected the work directory to be removed but got: %v", err)
+	}
+}
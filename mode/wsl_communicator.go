@@ -0,0 +1,80 @@
+package mode
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hashicorp/terraform/communicator"
+	"github.com/hashicorp/terraform/communicator/remote"
+)
+
+// wslCommunicator runs the commands of the remote provisioner in a WSL distribution of a Windows host
+// connected to over WinRM. The uploads are written to the Windows file system, the destinations are given
+// as the /mnt/<drive> paths visible in WSL and translated to Windows paths.
+type wslCommunicator struct {
+	communicator.Communicator
+	distribution string
+}
+
+func newWSLCommunicator(comm communicator.Communicator, distribution string) *wslCommunicator {
+	return &wslCommunicator{Communicator: comm, distribution: distribution}
+}
+
+// Start executes the command with /bin/sh as root of the distribution.
+func (c *wslCommunicator) Start(cmd *remote.Cmd) error {
+	command := cmd.Command
+	cmd.Command = wslCommand(c.distribution, command)
+	// the command is read before Start returns, errors report the original command:
+	defer func() { cmd.Command = command }()
+	return c.Communicator.Start(cmd)
+}
+
+// Upload writes the file to the Windows path of the destination.
+func (c *wslCommunicator) Upload(path string, input io.Reader) error {
+	destination, err := windowsPath(path)
+	if err != nil {
+		return err
+	}
+	return c.Communicator.Upload(destination, input)
+}
+
+// UploadScript writes the script to the Windows path of the destination,
+// files on Windows drives are executable in WSL.
+func (c *wslCommunicator) UploadScript(path string, input io.Reader) error {
+	destination, err := windowsPath(path)
+	if err != nil {
+		return err
+	}
+	return c.Communicator.UploadScript(destination, input)
+}
+
+// UploadDir copies the directory to the Windows path of the destination.
+func (c *wslCommunicator) UploadDir(dst string, src string) error {
+	destination, err := windowsPath(dst)
+	if err != nil {
+		return err
+	}
+	return c.Communicator.UploadDir(destination, src)
+}
+
+// wslCommand returns the cmd.exe command executing the shell command in the distribution.
+// The command is base64 encoded, such that it is not interpreted by cmd.exe.
+func wslCommand(distribution string, command string) string {
+	return fmt.Sprintf("wsl.exe --distribution \"%s\" --user root --exec /bin/sh -c \"echo %s | base64 -d | /bin/sh\"",
+		distribution, base64.StdEncoding.EncodeToString([]byte(command)))
+}
+
+// windowsPath translates a /mnt/<drive> path of WSL to the Windows path.
+func windowsPath(path string) (string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/mnt/"), "/", 2)
+	if !strings.HasPrefix(path, "/mnt/") || len(parts[0]) != 1 {
+		return "", fmt.Errorf("path '%s' is not on a Windows drive, paths on a Windows host must be under /mnt/<drive>", path)
+	}
+	windows := fmt.Sprintf("%s:\\", strings.ToUpper(parts[0]))
+	if len(parts) == 2 {
+		windows = windows + strings.Replace(parts[1], "/", "\\", -1)
+	}
+	return windows, nil
+}
@@ -0,0 +1,104 @@
+package mode
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/hashicorp/terraform/communicator"
+	"github.com/hashicorp/terraform/communicator/remote"
+)
+
+// recordingCommunicator records the commands and the upload destinations.
+type recordingCommunicator struct {
+	communicator.Communicator
+	commands     []string
+	destinations []string
+}
+
+func (c *recordingCommunicator) Start(cmd *remote.Cmd) error {
+	cmd.Init()
+	c.commands = append(c.commands, cmd.Command)
+	cmd.SetExitStatus(0, nil)
+	return nil
+}
+
+func (c *recordingCommunicator) UploadDir(dst string, src string) error {
+	c.destinations = append(c.destinations, dst)
+	return nil
+}
+
+func TestWindowsPath(t *testing.T) {
+	for path, expected := range map[string]string{
+		"/mnt/c/Windows/Temp/tf-ansible-bootstrap": "C:\\Windows\\Temp\\tf-ansible-bootstrap",
+		"/mnt/d": "D:\\",
+	} {
+		if windows, err := windowsPath(path); err != nil || windows != expected {
+			t.Fatalf("Expected '%s' for '%s' but got: '%s', %v", expected, path, windows, err)
+		}
+	}
+	if _, err := windowsPath("/tmp/tf-ansible-bootstrap"); err == nil {
+		t.Fatal("Expected an error for a path outside of the Windows drives")
+	}
+}
+
+func TestWSLCommunicator(t *testing.T) {
+	recording := &recordingCommunicator{}
+	comm := newWSLCommunicator(recording, "Ubuntu-22.04")
+
+	command := "mkdir -p \"/mnt/c/Windows/Temp/tf-ansible-bootstrap\" && echo 'done'"
+	cmd := &remote.Cmd{Command: command}
+	if err := comm.Start(cmd); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cmd.Command != command {
+		t.Fatalf("Expected the command to be restored for error messages but got: %s", cmd.Command)
+	}
+	executed := recording.commands[0]
+	prefix := "wsl.exe --distribution \"Ubuntu-22.04\" --user root --exec /bin/sh -c \"echo "
+	if !strings.HasPrefix(executed, prefix) {
+		t.Fatalf("Expected the command to be executed in WSL but got: %s", executed)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(executed, prefix), " | base64 -d | /bin/sh\""))
+	if err != nil || string(decoded) != command {
+		t.Fatalf("Expected the encoded command '%s' but got: '%s', %v", command, decoded, err)
+	}
+
+	if err := comm.UploadDir("/mnt/c/Windows/Temp/tf-ansible-bootstrap/roles", "/local/roles"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if recording.destinations[0] != "C:\\Windows\\Temp\\tf-ansible-bootstrap\\roles" {
+		t.Fatalf("Expected the upload to the Windows path but got: %s", recording.destinations[0])
+	}
+}
+
+func TestWSLInventoryTemplate(t *testing.T) {
+	templateData := inventoryTemplateRemoteData{
+		Hosts: wslInventoryHosts(remoteInventoryHosts([]string{"10.0.0.20"}, "10.0.0.20", false), &connectionInfo{
+			Host:     "10.0.0.20",
+			User:     "Administrator",
+			Password: "p@ss word",
+			Port:     5986,
+			Https:    true,
+			Ntlm:     true,
+			Insecure: true,
+		}),
+	}
+	tpl := template.Must(template.New("hosts").Parse(inventoryTemplateRemote))
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, templateData); err != nil {
+		t.Fatalf("Expected template to generate correctly but received: %v", err)
+	}
+	expected := []string{
+		"localhost ansible_connection=local\n",
+		"10.0.0.20 ansible_host=10.0.0.20 ansible_connection=winrm ansible_user=Administrator ansible_password=",
+		"ansible_port=5986 ansible_winrm_scheme=https ansible_winrm_transport=ntlm ansible_winrm_server_cert_validation=ignore\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(buf.String(), line) {
+			t.Fatalf("Expected '%s' in the inventory but got: %s", line, buf.String())
+		}
+	}
+}
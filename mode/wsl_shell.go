@@ -0,0 +1,159 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+	uuid "github.com/satori/go.uuid"
+)
+
+// windowsDrivePath matches an absolute path on a Windows drive, with either separator.
+var windowsDrivePath = regexp.MustCompile(`^([A-Za-z]):(?:[\\/](.*))?$`)
+
+// wslShell runs the Ansible commands of the local mode in a WSL distribution, or in a configured bash.exe,
+// when Terraform runs on Windows. The Windows paths of the play in the command are translated to the paths
+// of the drives under the mount root. The private keys are copied to a directory readable by the user only:
+// files on Windows drives are readable by everyone in WSL and ssh refuses such keys.
+type wslShell struct {
+	settings     *types.WSLSettings
+	directories  []string
+	keys         []string
+	keyDirectory string
+}
+
+// newWSLShell returns the shell of a play. The paths under the directories are translated,
+// the keys are the private key files of the play.
+func newWSLShell(settings *types.WSLSettings, directories []string, keys []string) *wslShell {
+	// the longest directory is translated first, such that nested directories translate as a whole:
+	directories = append([]string{}, directories...)
+	sort.Slice(directories, func(i, j int) bool { return len(directories[i]) > len(directories[j]) })
+	keyFiles := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key != "" {
+			keyFiles = append(keyFiles, key)
+		}
+	}
+	return &wslShell{
+		settings:     settings,
+		directories:  directories,
+		keys:         keyFiles,
+		keyDirectory: fmt.Sprintf("/tmp/tf-ansible-keys-%s", uuid.NewV4().String()),
+	}
+}
+
+// run executes the command in the shell. The command runs with GNU timeout in the shell when the timeout
+// is given, killing wsl.exe does not stop the processes of the distribution.
+func (s *wslShell) run(ctx context.Context, o terraform.UIOutput, command string, timeout time.Duration) error {
+	name, args := s.program()
+	cmd := newProcessCommand(ctx, name, append(args, s.script(command, timeout))...)
+	err := runLocalProcess(ctx, o, cmd, command, time.Time{}, 0)
+	if timeout > 0 && exitStatusFromError(err) == timeoutExitStatus {
+		return fmt.Errorf("Command '%s' did not finish within %s and has been terminated: %w", command, timeout, err)
+	}
+	return err
+}
+
+// program returns the program and the arguments executing a shell script given as the last argument.
+// The script is passed as a single argument, it is never interpreted by cmd.exe.
+func (s *wslShell) program() (string, []string) {
+	if s.settings.BashPath() != "" {
+		return s.settings.BashPath(), []string{"-c"}
+	}
+	args := make([]string, 0)
+	if s.settings.Distribution() != "" {
+		args = append(args, "--distribution", s.settings.Distribution())
+	}
+	if s.settings.User() != "" {
+		args = append(args, "--user", s.settings.User())
+	}
+	return "wsl.exe", append(args, "--exec", "/bin/sh", "-c")
+}
+
+// script returns the shell script copying the keys and executing the translated command.
+// The copies of the keys are removed when the script exits.
+func (s *wslShell) script(command string, timeout time.Duration) string {
+	command = s.translate(command)
+	if timeout > 0 {
+		command = withRemoteTimeout(command, timeout)
+	}
+	if len(s.keys) == 0 {
+		return command
+	}
+	copies := []string{"umask 077", fmt.Sprintf("mkdir -p %s", types.ShellQuote(s.keyDirectory))}
+	for _, key := range s.keys {
+		copies = append(copies, fmt.Sprintf("cp %s %s",
+			types.ShellQuote(wslPath(key, s.settings.MountRoot())), types.ShellQuote(s.keyPath(key))))
+	}
+	return fmt.Sprintf("trap %s EXIT && ( %s ) && %s",
+		types.ShellQuote(fmt.Sprintf("rm -rf %s", types.ShellQuote(s.keyDirectory))),
+		strings.Join(copies, " && "),
+		command)
+}
+
+// translate replaces the keys with their copies and the Windows paths under the directories
+// of the play with the paths in the shell. A path ends at a quote or a whitespace.
+func (s *wslShell) translate(command string) string {
+	for _, key := range s.keys {
+		for _, variant := range pathVariants(key) {
+			command = strings.Replace(command, variant, s.keyPath(key), -1)
+		}
+	}
+	var translated strings.Builder
+	for idx := 0; idx < len(command); {
+		end := idx
+		for _, directory := range s.directories {
+			for _, variant := range pathVariants(directory) {
+				if strings.HasPrefix(command[idx:], variant) {
+					end = idx + len(variant)
+					break
+				}
+			}
+			if end > idx {
+				break
+			}
+		}
+		if end == idx {
+			translated.WriteByte(command[idx])
+			idx++
+			continue
+		}
+		for end < len(command) && !strings.ContainsRune(" \t\n'\"", rune(command[end])) {
+			end++
+		}
+		translated.WriteString(wslPath(command[idx:end], s.settings.MountRoot()))
+		idx = end
+	}
+	return translated.String()
+}
+
+// keyPath returns the path of the copy of the key in the shell.
+func (s *wslShell) keyPath(key string) string {
+	return path.Join(s.keyDirectory, filepath.Base(strings.Replace(key, `\`, "/", -1)))
+}
+
+// pathVariants returns the path with backslashes and with forward slashes, Windows accepts both.
+func pathVariants(localPath string) []string {
+	forward := strings.Replace(localPath, `\`, "/", -1)
+	if forward == localPath {
+		return []string{localPath}
+	}
+	return []string{localPath, forward}
+}
+
+// wslPath translates a path on a Windows drive to the path under the mount root, C:\Users becomes
+// /mnt/c/Users with the default mount root. Other paths are returned with forward slashes.
+func wslPath(localPath string, mountRoot string) string {
+	matches := windowsDrivePath.FindStringSubmatch(localPath)
+	if matches == nil {
+		return strings.Replace(localPath, `\`, "/", -1)
+	}
+	return path.Join(mountRoot, strings.ToLower(matches[1]), strings.Replace(matches[2], `\`, "/", -1))
+}
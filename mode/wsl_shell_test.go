@@ -0,0 +1,92 @@
+package mode
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+func TestWSLShellTranslatesPaths(t *testing.T) {
+	shell := newWSLShell(types.NewWSLSettingsFromMapInterface(map[string]interface{}{
+		"distribution": "Ubuntu-22.04",
+		"user":         "ops",
+	}, true), []string{
+		`C:\Users\Jane Doe\AppData\Local\Temp`,
+		`D:\ansible`,
+	}, []string{`C:\Users\Jane Doe\AppData\Local\Temp\tf-ansible-pem123`, ""})
+
+	command := `ANSIBLE_FORCE_COLOR=true ansible-playbook --inventory-file='C:\Users\Jane Doe\AppData\Local\Temp\tf-ansible-inventory456'` +
+		` --private-key='C:\Users\Jane Doe\AppData\Local\Temp\tf-ansible-pem123' "D:/ansible/site.yml" --limit=web`
+	expected := `ANSIBLE_FORCE_COLOR=true ansible-playbook --inventory-file='/mnt/c/Users/Jane Doe/AppData/Local/Temp/tf-ansible-inventory456'` +
+		` --private-key='` + shell.keyDirectory + `/tf-ansible-pem123' "/mnt/d/ansible/site.yml" --limit=web`
+	if translated := shell.translate(command); translated != expected {
+		t.Fatalf("Expected the translated command:\n%s\nbut got:\n%s", expected, translated)
+	}
+
+	name, args := shell.program()
+	if name != "wsl.exe" || strings.Join(args, " ") != "--distribution Ubuntu-22.04 --user ops --exec /bin/sh -c" {
+		t.Fatalf("Unexpected program: %s %v", name, args)
+	}
+
+	script := shell.script("ansible-playbook site.yml", 0)
+	expectedCopy := "cp '/mnt/c/Users/Jane Doe/AppData/Local/Temp/tf-ansible-pem123' '" + shell.keyDirectory + "/tf-ansible-pem123'"
+	if !strings.Contains(script, "umask 077") || !strings.Contains(script, expectedCopy) ||
+		!strings.HasSuffix(script, " && ansible-playbook site.yml") {
+		t.Fatalf("Expected the keys to be copied before the command but got: %s", script)
+	}
+
+	if path := wslPath(`E:\`, "/"); path != "/e" {
+		t.Fatalf("Expected the drive under the configured mount root but got: %s", path)
+	}
+}
+
+func TestWSLShellRunCopiesKeys(t *testing.T) {
+	temporaryDirectory, err := ioutil.TempDir("", "wsl-shell-test")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(temporaryDirectory)
+	key := filepath.Join(temporaryDirectory, "tf-ansible-pem")
+	if err := ioutil.WriteFile(key, []byte("private key"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	settings := types.NewWSLSettingsFromMapInterface(map[string]interface{}{"bash_path": "/bin/sh"}, true)
+	if err := settings.Validate(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	shell := newWSLShell(settings, []string{temporaryDirectory}, []string{key})
+
+	lines := make([]string, 0)
+	output := &terraform.MockUIOutput{OutputFn: func(line string) { lines = append(lines, line) }}
+	if err := shell.run(context.Background(), output, "ls -l '"+key+"' && cat '"+key+"'", 0); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	written := strings.Join(lines, "\n")
+	if !strings.Contains(written, "-rw-------") || !strings.Contains(written, "private key") {
+		t.Fatalf("Expected a copy of the key readable by the user only but got: %s", written)
+	}
+	if _, err := os.Stat(shell.keyDirectory); !os.IsNotExist(err) {
+		t.Fatalf("Expected the copies of the keys to be removed but got: %v", err)
+	}
+
+	err = shell.run(context.Background(), new(terraform.MockUIOutput), "sleep 5", time.Second)
+	if err == nil || !strings.Contains(err.Error(), "did not finish within 1s") {
+		t.Fatalf("Expected a timeout error but got: %v", err)
+	}
+
+	invalid := types.NewWSLSettingsFromMapInterface(map[string]interface{}{
+		"bash_path":    `C:\Windows\System32\bash.exe`,
+		"distribution": "Ubuntu-22.04",
+	}, true)
+	if err := invalid.Validate(); err == nil {
+		t.Fatalf("Expected bash_path with a distribution to be rejected")
+	}
+}
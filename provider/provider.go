@@ -0,0 +1,237 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/mode"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+// Provider returns the companion provider of the provisioner. The resources of the provider run
+// the plays with the local mode, like the provisioner on a null_resource, such that the plays run
+// again when the configuration changes and the destroy plays run when the resource is destroyed.
+func Provider() terraform.ResourceProvider {
+	return &schema.Provider{
+		ResourcesMap: map[string]*schema.Resource{
+			"ansible_playbook": resourcePlaybook(),
+			"ansible_adhoc":    resourceAdhoc(),
+		},
+	}
+}
+
+// logOutput writes the Ansible output to the Terraform log, the output of a provider
+// is not written to the Terraform output.
+type logOutput struct {
+	resource string
+}
+
+func (o *logOutput) Output(line string) {
+	for _, l := range strings.Split(strings.TrimRight(line, "\n"), "\n") {
+		log.Printf("[INFO] %s: %s", o.resource, l)
+	}
+}
+
+// runOptionsSchema returns the run options shared by the resources.
+func runOptionsSchema() map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"defaults":             types.NewDefaultsSchema(),
+		"ansible_ssh_settings": types.NewAnsibleSSHSettingsSchema(),
+		"triggers": &schema.Schema{
+			Type:     schema.TypeMap,
+			Optional: true,
+		},
+		"max_parallel": &schema.Schema{
+			Type:     schema.TypeInt,
+			Optional: true,
+		},
+		"artifact_dir": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"work_dir": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"lock_name": &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			ValidateFunc: types.VfLockName,
+		},
+		"max_concurrent_runs": &schema.Schema{
+			Type:         schema.TypeInt,
+			Optional:     true,
+			ValidateFunc: types.VfPositiveInt,
+		},
+		"ansible_min_version": &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			ValidateFunc: types.VfAnsibleVersion,
+		},
+		"ansible_max_version": &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			ValidateFunc: types.VfAnsibleVersion,
+		},
+		"on_ansible_version_mismatch": &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			Default:      types.OnMismatchFail,
+			ValidateFunc: types.VfOnMismatch,
+		},
+		"log_to_file": &schema.Schema{
+			Type:     schema.TypeBool,
+			Optional: true,
+		},
+		"clean_environment": &schema.Schema{
+			Type:     schema.TypeBool,
+			Optional: true,
+		},
+		"environment_allowlist": &schema.Schema{
+			Type:     schema.TypeList,
+			Elem:     &schema.Schema{Type: schema.TypeString, ValidateFunc: types.VfEnvironmentAllowlist},
+			Optional: true,
+		},
+		"log_level": &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			Default:      types.LogLevelInfo,
+			ValidateFunc: types.VfLogLevel,
+		},
+		"run_timeout": &schema.Schema{
+			Type:         schema.TypeInt,
+			Optional:     true,
+			ValidateFunc: types.VfNonNegativeInt,
+		},
+		"executor": &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			Default:      types.ExecutorAnsiblePlaybook,
+			ValidateFunc: types.VfExecutor,
+		},
+		"mask_patterns": &schema.Schema{
+			Type:     schema.TypeList,
+			Elem:     &schema.Schema{Type: schema.TypeString, ValidateFunc: types.VfRegexp},
+			Optional: true,
+		},
+	}
+}
+
+// runPlays runs the plays of the phase with the local mode, the plays of other phases are disabled.
+func runPlays(resource string, d *schema.ResourceData, plays []*types.Play, phase string) error {
+	enabled := 0
+	for _, play := range plays {
+		if play.Entity() == nil {
+			return fmt.Errorf("%s: galaxy_install, playbook, module or pull must be set", resource)
+		}
+		if !play.RunsInPhase(phase) {
+			play.Disable()
+		}
+		if play.Enabled() {
+			enabled++
+		}
+	}
+	if enabled == 0 {
+		log.Printf("[INFO] %s: no plays in the %s phase", resource, phase)
+		return nil
+	}
+
+	// the commands are interrupted when the plugin receives SIGINT or SIGTERM:
+	ctx, stopInterrupt := mode.NotifyInterrupt(context.Background())
+	defer stopInterrupt()
+	runOptions := mode.RunOptions{Phase: phase}
+	if val, ok := d.GetOk("max_parallel"); ok {
+		runOptions.MaxParallel = val.(int)
+	}
+	if val, ok := d.GetOk("artifact_dir"); ok {
+		runOptions.ArtifactDirectory = val.(string)
+	}
+	if val, ok := d.GetOk("work_dir"); ok {
+		runOptions.WorkDirectory = val.(string)
+	}
+	if val, ok := d.GetOk("lock_name"); ok {
+		runOptions.LockName = val.(string)
+	}
+	if val, ok := d.GetOk("max_concurrent_runs"); ok {
+		runOptions.MaxConcurrentRuns = val.(int)
+	}
+	if val, ok := d.GetOk("ansible_min_version"); ok {
+		runOptions.AnsibleMinVersion = val.(string)
+	}
+	if val, ok := d.GetOk("ansible_max_version"); ok {
+		runOptions.AnsibleMaxVersion = val.(string)
+	}
+	runOptions.OnAnsibleVersionMismatch = d.Get("on_ansible_version_mismatch").(string)
+	if val, ok := d.GetOk("log_to_file"); ok {
+		runOptions.LogToFile = val.(bool)
+	}
+	if val, ok := d.GetOk("clean_environment"); ok {
+		runOptions.CleanEnvironment = val.(bool)
+	}
+	if val, ok := d.GetOk("environment_allowlist"); ok {
+		for _, name := range val.([]interface{}) {
+			runOptions.EnvironmentAllowlist = append(runOptions.EnvironmentAllowlist, name.(string))
+		}
+	}
+	if val, ok := d.GetOk("log_level"); ok {
+		runOptions.LogLevel = val.(string)
+	}
+	if val, ok := d.GetOk("run_timeout"); ok {
+		runOptions.RunTimeout = val.(int)
+	}
+	if val, ok := d.GetOk("executor"); ok {
+		runOptions.Executor = val.(string)
+	}
+	if val, ok := d.GetOk("mask_patterns"); ok {
+		for _, pattern := range val.([]interface{}) {
+			runOptions.MaskPatterns = append(runOptions.MaskPatterns, pattern.(string))
+		}
+	}
+	// and when the run takes longer than run_timeout:
+	ctx, cancelTimeout := mode.WithRunTimeout(ctx, runOptions.RunTimeout)
+	defer cancelTimeout()
+	runOptions.Context = ctx
+	settings := &mode.Settings{
+		AnsibleSSHSettings:   types.NewAnsibleSSHSettingsFromInterface(d.GetOk("ansible_ssh_settings")),
+		WindowsSettings:      types.NewWindowsSettingsFromInterface(nil, false),
+		ExecutionEnvironment: types.NewExecutionEnvironmentFromInterface(nil, false),
+		WSL:                  types.NewWSLSettingsFromInterface(nil, false),
+		RunOptions:           runOptions,
+		Config:               d,
+	}
+
+	logName := resource
+	if d.Id() != "" {
+		logName = fmt.Sprintf("%s-%s", resource, d.Id())
+	}
+	logFile, closeLog, err := mode.NewLogFileOutput(&logOutput{resource: resource}, runOptions, logName)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	o := mode.NewSecretsOutput(logFile, nil, settings, plays)
+	// the resource has no connection, the plays run like on a null_resource:
+	m, err := mode.NewLocalMode(o, &terraform.InstanceState{
+		Ephemeral: terraform.EphemeralState{ConnInfo: map[string]string{"type": "ssh"}},
+	})
+	if err != nil {
+		return err
+	}
+	if err := m.Validate(plays, settings); err != nil {
+		return fmt.Errorf("%s: %v", resource, err)
+	}
+	release, err := mode.AcquireRunLock(o, runOptions)
+	if err != nil {
+		return fmt.Errorf("%s: %v", resource, err)
+	}
+	defer release()
+	if err := m.Run(plays, settings); err != nil {
+		// the secrets are masked in the error too:
+		return mode.MaskError(o, fmt.Errorf("%s: %v", resource, err))
+	}
+	return nil
+}
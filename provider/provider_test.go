@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+)
+
+func TestProvider(t *testing.T) {
+	if err := Provider().(*schema.Provider).InternalValidate(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestPlaybookResourceDecodesPlays(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourcePlaybook().Schema, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"hosts": []interface{}{"10.0.0.11"},
+				"playbook": []interface{}{
+					map[string]interface{}{"file_path": "/tmp/site.yml"},
+				},
+			},
+			map[string]interface{}{
+				"hosts": []interface{}{"10.0.0.11"},
+				"phase": types.PhaseDestroy,
+				"playbook": []interface{}{
+					map[string]interface{}{"file_path": "/tmp/decommission.yml"},
+				},
+			},
+		},
+		"triggers": map[string]interface{}{"release": "1.2.0"},
+	})
+	plays := decodePlays(d)
+	if len(plays) != 2 {
+		t.Fatalf("Expected 2 plays but got: %d", len(plays))
+	}
+	if !plays[0].RunsInPhase(types.PhaseCreate) || plays[0].RunsInPhase(types.PhaseDestroy) {
+		t.Fatalf("Expected the first play to run when the resource is created or updated")
+	}
+	if playbook, ok := plays[1].Entity().(*types.Playbook); !ok || playbook.FilePath() != "/tmp/decommission.yml" || !plays[1].RunsInPhase(types.PhaseDestroy) {
+		t.Fatalf("Expected the destroy play but got: %+v", plays[1].Entity())
+	}
+}
+
+func TestAdhocResourceDecodesModule(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceAdhoc().Schema, map[string]interface{}{
+		"hosts":       []interface{}{"10.0.0.11", "10.0.0.12"},
+		"become":      true,
+		"become_user": "postgres",
+		"module": []interface{}{
+			map[string]interface{}{
+				"module": "service",
+				"args":   map[string]interface{}{"name": "postgresql", "state": "restarted"},
+			},
+		},
+	})
+	play := decodeAdhocPlay(d)
+	module, ok := play.Entity().(*types.Module)
+	if !ok {
+		t.Fatalf("Expected a module play but got: %+v", play.Entity())
+	}
+	if module.Module() != "service" || module.Args()["state"] != "restarted" {
+		t.Fatalf("Unexpected module: %s %v", module.Module(), module.Args())
+	}
+	if len(play.Hosts()) != 2 || !play.Become() || play.BecomeUser() != "postgres" || !play.RunsInPhase(types.PhaseCreate) {
+		t.Fatalf("Unexpected play: hosts %v, become %v as %s", play.Hosts(), play.Become(), play.BecomeUser())
+	}
+}
@@ -0,0 +1,93 @@
+package provider
+
+import (
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+	uuid "github.com/satori/go.uuid"
+)
+
+// adhocExcluded are the play entities the ansible_adhoc resource does not take,
+// the resource always runs a module.
+var adhocExcluded = []string{"playbook", "galaxy_install", "pull"}
+
+// adhocOrdering are the play attributes ordering the plays of a provisioner, a resource runs
+// a single play and depends_on is reserved by Terraform.
+var adhocOrdering = []string{"depends_on", "before", "after"}
+
+// resourceAdhoc returns the ansible_adhoc resource, a single module play given with the attributes
+// of a provisioner play on the resource itself. The module runs like the plays of ansible_playbook.
+func resourceAdhoc() *schema.Resource {
+	resourceSchema := runOptionsSchema()
+	for name, attribute := range adhocPlaySchema() {
+		resourceSchema[name] = attribute
+	}
+	return &schema.Resource{
+		Schema: resourceSchema,
+		Create: resourceAdhocCreate,
+		Read:   resourcePlaybookRead,
+		Update: resourceAdhocUpdate,
+		Delete: resourceAdhocDelete,
+	}
+}
+
+// adhocPlaySchema returns the attributes of a provisioner play, without the entities other than
+// the module, and without the ordering attributes, the module is required.
+func adhocPlaySchema() map[string]*schema.Schema {
+	adhocSchema := make(map[string]*schema.Schema)
+	for name, attribute := range types.NewPlaySchema().Elem.(*schema.Resource).Schema {
+		// the attributes of a play are at the top level of the resource, the resource never computes
+		// an attribute, a computed attribute would be unknown in every plan:
+		copied := *attribute
+		copied.Computed = false
+		copied.ConflictsWith = make([]string, 0, len(attribute.ConflictsWith))
+		for _, conflict := range attribute.ConflictsWith {
+			copied.ConflictsWith = append(copied.ConflictsWith, strings.TrimPrefix(conflict, "plays."))
+		}
+		adhocSchema[name] = &copied
+	}
+	for _, name := range append(adhocExcluded, adhocOrdering...) {
+		delete(adhocSchema, name)
+	}
+	module := *adhocSchema["module"]
+	module.Optional = false
+	module.Required = true
+	module.MaxItems = 1
+	module.ConflictsWith = nil
+	adhocSchema["module"] = &module
+	return adhocSchema
+}
+
+func resourceAdhocCreate(d *schema.ResourceData, meta interface{}) error {
+	if err := runPlays("ansible_adhoc", d, []*types.Play{decodeAdhocPlay(d)}, types.PhaseCreate); err != nil {
+		return err
+	}
+	d.SetId(uuid.NewV4().String())
+	return nil
+}
+
+func resourceAdhocUpdate(d *schema.ResourceData, meta interface{}) error {
+	return runPlays("ansible_adhoc", d, []*types.Play{decodeAdhocPlay(d)}, types.PhaseCreate)
+}
+
+func resourceAdhocDelete(d *schema.ResourceData, meta interface{}) error {
+	if err := runPlays("ansible_adhoc", d, []*types.Play{decodeAdhocPlay(d)}, types.PhaseDestroy); err != nil {
+		return err
+	}
+	d.SetId("")
+	return nil
+}
+
+// decodeAdhocPlay reads the play from the attributes of the resource, the excluded entities are empty.
+func decodeAdhocPlay(d *schema.ResourceData) *types.Play {
+	playSchema := types.NewPlaySchema().Elem.(*schema.Resource).Schema
+	vals := make(map[string]interface{})
+	for name := range adhocPlaySchema() {
+		vals[name] = d.Get(name)
+	}
+	for _, name := range adhocExcluded {
+		vals[name] = schema.NewSet(schema.HashResource(playSchema[name].Elem.(*schema.Resource)), nil)
+	}
+	return types.NewPlayFromMapInterface(vals, types.NewDefaultsFromInterface(d.GetOk("defaults")))
+}
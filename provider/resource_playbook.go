@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/radekg/terraform-provisioner-ansible/types"
+	uuid "github.com/satori/go.uuid"
+)
+
+// resourcePlaybook returns the ansible_playbook resource. The plays take the attributes
+// of the provisioner plays, the plays of the create phase run when the resource is created
+// and when its configuration or triggers change, the plays of the destroy phase run when
+// the resource is destroyed.
+func resourcePlaybook() *schema.Resource {
+	resourceSchema := runOptionsSchema()
+	plays := types.NewPlaySchema()
+	plays.Optional = false
+	plays.Computed = false
+	plays.Required = true
+	resourceSchema["plays"] = plays
+	return &schema.Resource{
+		Schema: resourceSchema,
+		Create: resourcePlaybookCreate,
+		Read:   resourcePlaybookRead,
+		Update: resourcePlaybookUpdate,
+		Delete: resourcePlaybookDelete,
+	}
+}
+
+func resourcePlaybookCreate(d *schema.ResourceData, meta interface{}) error {
+	if err := runPlays("ansible_playbook", d, decodePlays(d), types.PhaseCreate); err != nil {
+		return err
+	}
+	d.SetId(uuid.NewV4().String())
+	return nil
+}
+
+// resourcePlaybookRead keeps the state, the plays have no remote state to read.
+func resourcePlaybookRead(d *schema.ResourceData, meta interface{}) error {
+	return nil
+}
+
+func resourcePlaybookUpdate(d *schema.ResourceData, meta interface{}) error {
+	return runPlays("ansible_playbook", d, decodePlays(d), types.PhaseCreate)
+}
+
+func resourcePlaybookDelete(d *schema.ResourceData, meta interface{}) error {
+	if err := runPlays("ansible_playbook", d, decodePlays(d), types.PhaseDestroy); err != nil {
+		return err
+	}
+	d.SetId("")
+	return nil
+}
+
+// decodePlays reads the plays like the provisioner does.
+func decodePlays(d *schema.ResourceData) []*types.Play {
+	defaults := types.NewDefaultsFromInterface(d.GetOk("defaults"))
+	plays := make([]*types.Play, 0)
+	playSchema := types.NewPlaySchema()
+	for _, iface := range d.Get("plays").([]interface{}) {
+		plays = append(plays, types.NewPlayFromInterface(schema.NewSet(schema.HashResource(playSchema.Elem.(*schema.Resource)), []interface{}{iface}), defaults))
+	}
+	return plays
+}
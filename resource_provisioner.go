@@ -19,21 +19,132 @@ const (
 )
 
 type provisioner struct {
-	defaults           *types.Defaults
-	plays              []*types.Play
-	ansibleSSHSettings *types.AnsibleSSHSettings
-	remote             *types.RemoteSettings
+	defaults             *types.Defaults
+	plays                []*types.Play
+	ansibleSSHSettings   *types.AnsibleSSHSettings
+	windowsSettings      *types.WindowsSettings
+	executionEnvironment *types.ExecutionEnvironment
+	wsl                  *types.WSLSettings
+	remote               *types.RemoteSettings
+	tower                *types.TowerSettings
+	kubernetes           *types.KubernetesSettings
+	pullBootstrap        *types.PullBootstrapSettings
+	aggregate            *types.AggregateSettings
+	runOptions           mode.RunOptions
 }
 
 // Provisioner describes this provisioner configuration.
 func Provisioner() terraform.ResourceProvisioner {
-	return &schema.Provisioner{
-		Schema: map[string]*schema.Schema{
-			"plays":                types.NewPlaySchema(),
-			"defaults":             types.NewDefaultsSchema(),
-			"remote":               types.NewRemoteSchema(),
-			"ansible_ssh_settings": types.NewAnsibleSSHSettingsSchema(),
+	provisionerSchema := map[string]*schema.Schema{
+		"plays":                 types.NewPlaySchema(),
+		"defaults":              types.NewDefaultsSchema(),
+		"ansible_ssh_settings":  types.NewAnsibleSSHSettingsSchema(),
+		"windows_settings":      types.NewWindowsSettingsSchema(),
+		"execution_environment": types.NewExecutionEnvironmentSchema(),
+		"run_in_docker":         types.NewRunInDockerSchema(),
+		"wsl":                   types.NewWSLSchema(),
+		"max_parallel": &schema.Schema{
+			Type:     schema.TypeInt,
+			Optional: true,
+		},
+		"plan_only": &schema.Schema{
+			Type:          schema.TypeBool,
+			Optional:      true,
+			ConflictsWith: []string{"print_only"},
+		},
+		"print_only": &schema.Schema{
+			Type:          schema.TypeBool,
+			Optional:      true,
+			ConflictsWith: []string{"plan_only"},
+		},
+		"hash_directory": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"artifact_dir": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"work_dir": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"lock_name": &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			ValidateFunc: types.VfLockName,
+		},
+		"max_concurrent_runs": &schema.Schema{
+			Type:         schema.TypeInt,
+			Optional:     true,
+			ValidateFunc: types.VfPositiveInt,
+		},
+		"ansible_min_version": &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			ValidateFunc: types.VfAnsibleVersion,
+		},
+		"ansible_max_version": &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			ValidateFunc: types.VfAnsibleVersion,
+		},
+		"on_ansible_version_mismatch": &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			Default:      types.OnMismatchFail,
+			ValidateFunc: types.VfOnMismatch,
 		},
+		"log_to_file": &schema.Schema{
+			Type:     schema.TypeBool,
+			Optional: true,
+		},
+		"clean_environment": &schema.Schema{
+			Type:     schema.TypeBool,
+			Optional: true,
+		},
+		"environment_allowlist": &schema.Schema{
+			Type:     schema.TypeList,
+			Elem:     &schema.Schema{Type: schema.TypeString, ValidateFunc: types.VfEnvironmentAllowlist},
+			Optional: true,
+		},
+		"log_level": &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			Default:      types.LogLevelInfo,
+			ValidateFunc: types.VfLogLevel,
+		},
+		"run_timeout": &schema.Schema{
+			Type:         schema.TypeInt,
+			Optional:     true,
+			ValidateFunc: types.VfNonNegativeInt,
+		},
+		"executor": &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			Default:      types.ExecutorAnsiblePlaybook,
+			ValidateFunc: types.VfExecutor,
+		},
+		"mask_patterns": &schema.Schema{
+			Type:     schema.TypeList,
+			Elem:     &schema.Schema{Type: schema.TypeString, ValidateFunc: types.VfRegexp},
+			Optional: true,
+		},
+		"phase": &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			Default:      types.PhaseCreate,
+			ValidateFunc: types.VfProvisionerPhase,
+		},
+	}
+	// every registered mode, other than the default one, is enabled by its own attribute:
+	for _, definition := range mode.Registered() {
+		if definition.Schema != nil {
+			provisionerSchema[definition.Name] = definition.Schema
+		}
+	}
+	return &schema.Provisioner{
+		Schema:       provisionerSchema,
 		ValidateFunc: validateFn,
 		ApplyFunc:    applyFn,
 	}
@@ -74,33 +185,47 @@ func validateFn(c *terraform.ResourceConfig) (ws []string, es []error) {
 			vPlay := rawVPlay.(map[string]interface{})
 
 			currentErrorCount := len(es)
+			// playbook source errors are reported like the schema errors, the play is still counted:
+			var sourceErrors []error
 
 			vPlaybook, playHasPlaybook := vPlay["playbook"]
-			_, playHasModule := vPlay["module"]
+			vModule, playHasModule := vPlay["module"]
 			_, playHasGalaxyInstall := vPlay["galaxy_install"]
+			_, playHasPull := vPlay["pull"]
 
-			if types.HasMoreThanOneTrue([]bool{playHasPlaybook, playHasModule, playHasGalaxyInstall}...) {
-				es = append(es, fmt.Errorf("play can have only one of: galaxy_install, playbook or module"))
-			} else if !playHasPlaybook && !playHasModule && !playHasGalaxyInstall {
-				es = append(es, fmt.Errorf("galaxy_install, playbook or module must be set"))
+			if types.HasMoreThanOneTrue([]bool{playHasPlaybook, playHasModule, playHasGalaxyInstall, playHasPull}...) {
+				es = append(es, fmt.Errorf("play can have only one of: galaxy_install, playbook, module or pull"))
+			} else if !playHasPlaybook && !playHasModule && !playHasGalaxyInstall && !playHasPull {
+				es = append(es, fmt.Errorf("galaxy_install, playbook, module or pull must be set"))
 			} else {
 
 				if playHasPlaybook {
 
 					var rolesPath []interface{}
 					var hasRolesPath bool
+					var vPlaybookMap map[string]interface{}
 
 					switch computedTfVersion {
 					case terraform012:
 						vPlaybookTyped := vPlaybook.([]interface{})
-						rolesPath, hasRolesPath = vPlaybookTyped[0].(map[string]interface{})["roles_path"].([]interface{})
+						vPlaybookMap = vPlaybookTyped[0].(map[string]interface{})
 					case terraform011:
 						vPlaybookTyped := vPlaybook.([]map[string]interface{})
-						rolesPath, hasRolesPath = vPlaybookTyped[0]["roles_path"].([]interface{})
+						vPlaybookMap = vPlaybookTyped[0]
 					default:
 						es = append(es, fmt.Errorf("unsupported Terrafrom version detected: %d", computedTfVersion))
 						return ws, es // return early
 					}
+					rolesPath, hasRolesPath = vPlaybookMap["roles_path"].([]interface{})
+
+					_, playbookHasFilePath := vPlaybookMap["file_path"]
+					_, playbookHasRepo := vPlaybookMap["repo"]
+					_, playbookHasBundle := vPlaybookMap["bundle_url"]
+					if types.HasMoreThanOneTrue(playbookHasFilePath, playbookHasRepo, playbookHasBundle) {
+						sourceErrors = append(sourceErrors, fmt.Errorf("playbook can have only one of: file_path, repo or bundle_url"))
+					} else if !playbookHasFilePath && !playbookHasRepo && !playbookHasBundle {
+						sourceErrors = append(sourceErrors, fmt.Errorf("playbook file_path, repo or bundle_url must be set"))
+					}
 
 					if hasRolesPath {
 						for _, singlePath := range rolesPath {
@@ -116,11 +241,32 @@ func validateFn(c *terraform.ResourceConfig) (ws []string, es []error) {
 					}
 				}
 
+				if playHasModule {
+
+					var vModuleMap map[string]interface{}
+
+					switch computedTfVersion {
+					case terraform012:
+						vModuleMap = vModule.([]interface{})[0].(map[string]interface{})
+					case terraform011:
+						vModuleMap = vModule.([]map[string]interface{})[0]
+					}
+
+					_, moduleHasModule := vModuleMap["module"]
+					_, moduleHasSequence := vModuleMap["sequence"]
+					if moduleHasModule && moduleHasSequence {
+						sourceErrors = append(sourceErrors, fmt.Errorf("module can have only one of: module or sequence"))
+					} else if !moduleHasModule && !moduleHasSequence {
+						sourceErrors = append(sourceErrors, fmt.Errorf("module module or sequence must be set"))
+					}
+				}
+
 			}
 
 			if currentErrorCount == len(es) {
 				validPlaysCount++
 			}
+			es = append(es, sourceErrors...)
 		}
 
 		if validPlaysCount == 0 {
@@ -134,10 +280,10 @@ func validateFn(c *terraform.ResourceConfig) (ws []string, es []error) {
 	return ws, es
 }
 
-func applyFn(ctx context.Context) error {
+func applyFn(ctx context.Context) (err error) {
 
 	o := ctx.Value(schema.ProvOutputKey).(terraform.UIOutput)
-	s := ctx.Value(schema.ProvRawStateKey).(*terraform.InstanceState)
+	s := withDefaultConnectionType(ctx.Value(schema.ProvRawStateKey).(*terraform.InstanceState))
 	d := ctx.Value(schema.ProvConfigDataKey).(*schema.ResourceData)
 
 	// Decode the provisioner config
@@ -146,30 +292,164 @@ func applyFn(ctx context.Context) error {
 		return err
 	}
 
-	if p.remote.IsRemoteInUse() {
-		remoteMode, err := mode.NewRemoteMode(o, s, p.remote)
-		if err != nil {
-			o.Output(fmt.Sprintf("%+v", err))
-			return err
-		}
-		return remoteMode.Run(p.plays)
+	definition, err := mode.Lookup(d)
+	if err != nil {
+		return err
+	}
+
+	// the commands are interrupted when Terraform is stopped or the plugin receives SIGINT or SIGTERM,
+	// the temporary files are removed before the plugin exits:
+	ctx, stopInterrupt := mode.NotifyInterrupt(ctx)
+	defer stopInterrupt()
+	// and when the run takes longer than run_timeout:
+	ctx, cancelTimeout := mode.WithRunTimeout(ctx, p.runOptions.RunTimeout)
+	defer cancelTimeout()
+	p.runOptions.Context = ctx
+
+	settings := &mode.Settings{
+		AnsibleSSHSettings:   p.ansibleSSHSettings,
+		WindowsSettings:      p.windowsSettings,
+		ExecutionEnvironment: p.executionEnvironment,
+		WSL:                  p.wsl,
+		Remote:               p.remote,
+		Tower:                p.tower,
+		Kubernetes:           p.kubernetes,
+		PullBootstrap:        p.pullBootstrap,
+		Aggregate:            p.aggregate,
+		RunOptions:           p.runOptions,
+		Config:               d,
 	}
 
-	localMode, err := mode.NewLocalMode(o, s)
+	// the log file is named after the resource, or the host when the resource has no ID yet:
+	resource := s.ID
+	if resource == "" {
+		resource = s.Ephemeral.ConnInfo["host"]
+	}
+	o, closeLog, err := mode.NewLogFileOutput(o, p.runOptions, resource)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	// every line written by the provisioner and Ansible is masked, in the log file too:
+	o = mode.NewSecretsOutput(o, s, settings, p.plays)
+	// and in the errors written by Terraform:
+	defer func() {
+		err = mode.MaskError(o, err)
+	}()
+
+	// the lock is held until the mode is cleaned up:
+	release, err := mode.AcquireRunLock(o, p.runOptions)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	m, err := definition.New(o, s, settings)
 	if err != nil {
 		o.Output(fmt.Sprintf("%+v", err))
 		return err
 	}
-	return localMode.Run(p.plays, p.ansibleSSHSettings)
+	defer func() {
+		if err := m.Cleanup(); err != nil {
+			o.Output(fmt.Sprintf("%s mode cleanup failed: %+v", definition.Name, err))
+		}
+	}()
 
+	if err := m.Validate(p.plays, settings); err != nil {
+		return err
+	}
+	return m.Run(p.plays, settings)
+
+}
+
+// withDefaultConnectionType sets the connection type to ssh when the resource has no connection block.
+// Terraform 0.12 defaults the type, Terraform 0.13 and later pass no connection at all, a provisioner
+// on a null_resource or terraform_data has no connection.
+func withDefaultConnectionType(s *terraform.InstanceState) *terraform.InstanceState {
+	if s.Ephemeral.ConnInfo == nil {
+		s.Ephemeral.ConnInfo = make(map[string]string)
+	}
+	if s.Ephemeral.ConnInfo["type"] == "" {
+		s.Ephemeral.ConnInfo["type"] = "ssh"
+	}
+	return s
 }
 
 func decodeConfig(d *schema.ResourceData) (*provisioner, error) {
 
 	vRemoteSettings := types.NewRemoteSettingsFromInterface(d.GetOk("remote"))
+	vTowerSettings := types.NewTowerSettingsFromInterface(d.GetOk("tower"))
+	vKubernetesSettings := types.NewKubernetesSettingsFromInterface(d.GetOk("kubernetes"))
+	vPullBootstrapSettings := types.NewPullBootstrapSettingsFromInterface(d.GetOk("pull_bootstrap"))
+	vAggregateSettings := types.NewAggregateSettingsFromInterface(d.GetOk("aggregate"))
 	vAnsibleSSHSettings := types.NewAnsibleSSHSettingsFromInterface(d.GetOk("ansible_ssh_settings"))
+	vWindowsSettings := types.NewWindowsSettingsFromInterface(d.GetOk("windows_settings"))
+	vExecutionEnvironment := types.NewExecutionEnvironmentFromInterface(d.GetOk("execution_environment"))
+	if val, ok := d.GetOk("run_in_docker"); ok {
+		vExecutionEnvironment = types.NewRunInDockerFromInterface(val, ok)
+	}
+	vWSLSettings := types.NewWSLSettingsFromInterface(d.GetOk("wsl"))
 	vDefaults := types.NewDefaultsFromInterface(d.GetOk("defaults"))
 
+	runOptions := mode.RunOptions{}
+	if val, ok := d.GetOk("max_parallel"); ok {
+		runOptions.MaxParallel = val.(int)
+	}
+	if val, ok := d.GetOk("plan_only"); ok {
+		runOptions.PlanOnly = val.(bool)
+	}
+	if val, ok := d.GetOk("print_only"); ok {
+		runOptions.PrintOnly = val.(bool)
+	}
+	if val, ok := d.GetOk("hash_directory"); ok {
+		runOptions.HashDirectory = val.(string)
+	}
+	if val, ok := d.GetOk("artifact_dir"); ok {
+		runOptions.ArtifactDirectory = val.(string)
+	}
+	if val, ok := d.GetOk("work_dir"); ok {
+		runOptions.WorkDirectory = val.(string)
+	}
+	if val, ok := d.GetOk("lock_name"); ok {
+		runOptions.LockName = val.(string)
+	}
+	if val, ok := d.GetOk("max_concurrent_runs"); ok {
+		runOptions.MaxConcurrentRuns = val.(int)
+	}
+	if val, ok := d.GetOk("ansible_min_version"); ok {
+		runOptions.AnsibleMinVersion = val.(string)
+	}
+	if val, ok := d.GetOk("ansible_max_version"); ok {
+		runOptions.AnsibleMaxVersion = val.(string)
+	}
+	runOptions.OnAnsibleVersionMismatch = d.Get("on_ansible_version_mismatch").(string)
+	if val, ok := d.GetOk("log_to_file"); ok {
+		runOptions.LogToFile = val.(bool)
+	}
+	if val, ok := d.GetOk("clean_environment"); ok {
+		runOptions.CleanEnvironment = val.(bool)
+	}
+	if val, ok := d.GetOk("environment_allowlist"); ok {
+		for _, name := range val.([]interface{}) {
+			runOptions.EnvironmentAllowlist = append(runOptions.EnvironmentAllowlist, name.(string))
+		}
+	}
+	if val, ok := d.GetOk("log_level"); ok {
+		runOptions.LogLevel = val.(string)
+	}
+	if val, ok := d.GetOk("run_timeout"); ok {
+		runOptions.RunTimeout = val.(int)
+	}
+	if val, ok := d.GetOk("executor"); ok {
+		runOptions.Executor = val.(string)
+	}
+	if val, ok := d.GetOk("mask_patterns"); ok {
+		for _, pattern := range val.([]interface{}) {
+			runOptions.MaskPatterns = append(runOptions.MaskPatterns, pattern.(string))
+		}
+	}
+
 	plays := make([]*types.Play, 0)
 	if rawPlays, ok := d.GetOk("plays"); ok {
 		playSchema := types.NewPlaySchema()
@@ -177,10 +457,27 @@ func decodeConfig(d *schema.ResourceData) (*provisioner, error) {
 			plays = append(plays, types.NewPlayFromInterface(schema.NewSet(schema.HashResource(playSchema.Elem.(*schema.Resource)), []interface{}{iface}), vDefaults))
 		}
 	}
+	// plays not running in the current phase are disabled, such that depends_on keeps working:
+	phase := d.Get("phase").(string)
+	runOptions.Phase = phase
+	for _, play := range plays {
+		if !play.RunsInPhase(phase) {
+			play.Disable()
+		}
+	}
+
 	return &provisioner{
-		defaults:           vDefaults,
-		remote:             vRemoteSettings,
-		ansibleSSHSettings: vAnsibleSSHSettings,
-		plays:              plays,
+		defaults:             vDefaults,
+		remote:               vRemoteSettings,
+		tower:                vTowerSettings,
+		kubernetes:           vKubernetesSettings,
+		pullBootstrap:        vPullBootstrapSettings,
+		aggregate:            vAggregateSettings,
+		ansibleSSHSettings:   vAnsibleSSHSettings,
+		windowsSettings:      vWindowsSettings,
+		executionEnvironment: vExecutionEnvironment,
+		wsl:                  vWSLSettings,
+		plays:                plays,
+		runOptions:           runOptions,
 	}, nil
 }
@@ -3,11 +3,13 @@ package main
 import (
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/terraform/config"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
+	"github.com/radekg/terraform-provisioner-ansible/types"
 )
 
 var vaultPasswordFile string
@@ -109,7 +111,9 @@ func TestGoodAndCompleteRemoteConfig(t *testing.T) {
 						"roles_path":     []interface{}{"${path.module}/path/to/a/role/directory"},
 						"force_handlers": false,
 						"skip_tags":      []string{"tag2"},
+						"flush_cache":    true,
 						"start_at_task":  "test task",
+						"step":           false,
 						"tags":           []string{"tag1", "tag2"},
 					},
 				},
@@ -329,6 +333,149 @@ func TestConfigWithInvalidValueTypeFailes(t *testing.T) {
 	}
 }
 
+func TestExtraArgsRejectManagedFlags(t *testing.T) {
+	c := testConfig(t, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"module": []interface{}{
+					map[string]interface{}{
+						"module": "some-module",
+					},
+				},
+				"hosts":      []interface{}{"localhost"},
+				"extra_args": []interface{}{"--inventory-file=/tmp/hosts", "--timeout=30"},
+			},
+		},
+	})
+	_, errs := Provisioner().Validate(c)
+	if len(errs) != 1 {
+		t.Fatalf("Expected 1 error but got: %v", errs)
+	}
+}
+
+func TestInvalidMaskPatternFails(t *testing.T) {
+	c := testConfig(t, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"module": []interface{}{
+					map[string]interface{}{
+						"module": "some-module",
+					},
+				},
+				"hosts": []interface{}{"localhost"},
+			},
+		},
+		"mask_patterns": []interface{}{"password=\\S+", "token=(["},
+	})
+	_, errs := Provisioner().Validate(c)
+	if len(errs) != 1 {
+		t.Fatalf("Expected 1 error but got: %v", errs)
+	}
+}
+
+func TestInvalidRunLockFails(t *testing.T) {
+	c := testConfig(t, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"module": []interface{}{
+					map[string]interface{}{
+						"module": "some-module",
+					},
+				},
+				"hosts": []interface{}{"localhost"},
+			},
+		},
+		"lock_name":           "../bastion",
+		"max_concurrent_runs": 0,
+	})
+	_, errs := Provisioner().Validate(c)
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 errors but got: %v", errs)
+	}
+}
+
+func TestInvalidLogLevelFails(t *testing.T) {
+	c := testConfig(t, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"module": []interface{}{
+					map[string]interface{}{
+						"module": "some-module",
+					},
+				},
+				"hosts": []interface{}{"localhost"},
+			},
+		},
+		"log_level": "verbose",
+	})
+	_, errs := Provisioner().Validate(c)
+	if len(errs) != 1 {
+		t.Fatalf("Expected 1 error but got: %v", errs)
+	}
+}
+
+func TestInvalidRunTimeoutFails(t *testing.T) {
+	c := testConfig(t, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"module": []interface{}{
+					map[string]interface{}{
+						"module": "some-module",
+					},
+				},
+				"hosts": []interface{}{"localhost"},
+			},
+		},
+		"run_timeout": -1,
+	})
+	_, errs := Provisioner().Validate(c)
+	if len(errs) != 1 {
+		t.Fatalf("Expected 1 error but got: %v", errs)
+	}
+}
+
+func TestInvalidEnvironmentAllowlistFails(t *testing.T) {
+	c := testConfig(t, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"module": []interface{}{
+					map[string]interface{}{
+						"module": "some-module",
+					},
+				},
+				"hosts": []interface{}{"localhost"},
+			},
+		},
+		"clean_environment":     true,
+		"environment_allowlist": []interface{}{"PATH", "AWS-*", "*"},
+	})
+	_, errs := Provisioner().Validate(c)
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 errors but got: %v", errs)
+	}
+}
+
+func TestPrintOnlyConflictsWithPlanOnly(t *testing.T) {
+	c := testConfig(t, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"module": []interface{}{
+					map[string]interface{}{
+						"module": "some-module",
+					},
+				},
+				"hosts": []interface{}{"localhost"},
+			},
+		},
+		"plan_only":  true,
+		"print_only": true,
+	})
+	_, errs := Provisioner().Validate(c)
+	if len(errs) == 0 {
+		t.Fatalf("Expected print_only to conflict with plan_only")
+	}
+}
+
 func TestConfigProvisionerParserDecoder(t *testing.T) {
 	c := map[string]interface{}{
 		"plays": []interface{}{
@@ -397,10 +544,833 @@ func TestConfigProvisionerParserDecoder(t *testing.T) {
 	}
 }
 
-func testConfig(t *testing.T, c map[string]interface{}) *terraform.ResourceConfig {
-	r, err := config.NewRawConfig(c)
+func TestConfigProvisionerPreflight(t *testing.T) {
+	p := decodeTestConfig(t, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"playbook": []interface{}{
+					map[string]interface{}{
+						"file_path": playbookFile,
+					},
+				},
+				"hosts": []interface{}{"host.to.play"},
+			},
+			map[string]interface{}{
+				"module": []interface{}{
+					map[string]interface{}{
+						"module": "some-module",
+					},
+				},
+				"hosts": []interface{}{"host.to.play"},
+				"preflight": []interface{}{
+					map[string]interface{}{
+						"module": "ping",
+					},
+				},
+			},
+		},
+	})
+
+	if p.plays[0].Preflight() != nil {
+		t.Fatalf("Expected no pre-flight hook for the playbook play")
+	}
+	preflight := p.plays[1].Preflight()
+	if preflight == nil || !preflight.Enabled() || preflight.Module() != "ping" {
+		t.Fatalf("Expected an enabled ping pre-flight hook for the module play but got: %+v", preflight)
+	}
+}
+
+func TestConfigProvisionerCheckMode(t *testing.T) {
+	p := decodeTestConfig(t, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"playbook": []interface{}{
+					map[string]interface{}{
+						"file_path": playbookFile,
+					},
+				},
+				"hosts":      []interface{}{"host.to.play"},
+				"check_mode": true,
+			},
+		},
+	})
+
+	if !p.plays[0].Check() {
+		t.Fatalf("Expected check mode for the playbook play")
+	}
+}
+
+func TestConfigProvisionerBecomePassword(t *testing.T) {
+	p := decodeTestConfig(t, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"playbook": []interface{}{
+					map[string]interface{}{
+						"file_path": playbookFile,
+					},
+				},
+				"hosts":           []interface{}{"host.to.play"},
+				"become":          true,
+				"become_password": "secret",
+			},
+		},
+	})
+
+	if p.plays[0].BecomePassword() != "secret" {
+		t.Fatalf("Expected become password for the playbook play")
+	}
+}
+
+func TestConfigProvisionerExtraArgs(t *testing.T) {
+	p := decodeTestConfig(t, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"module": []interface{}{
+					map[string]interface{}{
+						"module": "some-module",
+					},
+				},
+				"hosts":      []interface{}{"host.to.play"},
+				"extra_args": []interface{}{"--timeout", "it's 30"},
+			},
+		},
+	})
+
+	command, err := p.plays[0].ToCommand(types.LocalModeAnsibleArgs{})
 	if err != nil {
-		t.Fatalf("config error: %s", err)
+		t.Fatalf("Unexpected error while building the command: %+v", err)
+	}
+	if expected := "'--timeout' 'it'\\''s 30'"; !strings.Contains(command, expected) {
+		t.Fatalf("Expected '%s' in command but got: %s", expected, command)
+	}
+}
+
+func TestConfigProvisionerEnvironment(t *testing.T) {
+	p := decodeTestConfig(t, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"module": []interface{}{
+					map[string]interface{}{
+						"module": "some-module",
+					},
+				},
+				"hosts":       []interface{}{"host.to.play"},
+				"environment": map[string]interface{}{"LC_ALL": "C", "ANSIBLE_TIMEOUT": "30"},
+			},
+		},
+	})
+
+	command, err := p.plays[0].ToCommand(types.LocalModeAnsibleArgs{})
+	if err != nil {
+		t.Fatalf("Unexpected error while building the command: %+v", err)
+	}
+	if expected := "ANSIBLE_TIMEOUT='30' LC_ALL='C' ansible"; !strings.Contains(command, expected) {
+		t.Fatalf("Expected '%s' in command but got: %s", expected, command)
+	}
+}
+
+func TestConfigProvisionerAnsibleCfg(t *testing.T) {
+	p := decodeTestConfig(t, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"module": []interface{}{
+					map[string]interface{}{
+						"module": "some-module",
+					},
+				},
+				"hosts": []interface{}{"host.to.play"},
+				"ansible_cfg": []interface{}{
+					map[string]interface{}{
+						"section": "defaults",
+						"options": map[string]interface{}{"timeout": "30", "retry_files_enabled": "False"},
+					},
+					map[string]interface{}{
+						"section": "ssh_connection",
+						"options": map[string]interface{}{"pipelining": "True"},
+					},
+				},
+			},
+		},
+	})
+
+	expectedAnsibleCfg := "[defaults]\nretry_files_enabled = False\ntimeout = 30\n\n[ssh_connection]\npipelining = True\n\n"
+	if p.plays[0].AnsibleCfgContents() != expectedAnsibleCfg {
+		t.Fatalf("Expected generated ansible.cfg:\n%s\nbut got:\n%s", expectedAnsibleCfg, p.plays[0].AnsibleCfgContents())
+	}
+	p.plays[0].SetAnsibleCfgFile("/tmp/ansible.cfg")
+
+	command, err := p.plays[0].ToCommand(types.LocalModeAnsibleArgs{})
+	if err != nil {
+		t.Fatalf("Unexpected error while building the command: %+v", err)
+	}
+	if expected := "ANSIBLE_CONFIG='/tmp/ansible.cfg' "; !strings.Contains(command, expected) {
+		t.Fatalf("Expected '%s' in command but got: %s", expected, command)
+	}
+}
+
+func TestConfigProvisionerStrategy(t *testing.T) {
+	p := decodeTestConfig(t, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"module": []interface{}{
+					map[string]interface{}{
+						"module": "some-module",
+					},
+				},
+				"hosts":    []interface{}{"host.to.play"},
+				"strategy": "free",
+			},
+		},
+	})
+
+	command, err := p.plays[0].ToCommand(types.LocalModeAnsibleArgs{})
+	if err != nil {
+		t.Fatalf("Unexpected error while building the command: %+v", err)
+	}
+	if expected := "ANSIBLE_STRATEGY=free "; !strings.Contains(command, expected) {
+		t.Fatalf("Expected '%s' in command but got: %s", expected, command)
+	}
+}
+
+func TestConfigProvisionerModuleArgs(t *testing.T) {
+	p := decodeTestConfig(t, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"module": []interface{}{
+					map[string]interface{}{
+						"module":    "some-module",
+						"args":      map[string]interface{}{"msg": "hello world"},
+						"args_json": `{"data": {"key": "value"}}`,
+					},
+				},
+				"hosts": []interface{}{"host.to.play"},
+			},
+		},
+	})
+
+	command, err := p.plays[0].ToCommand(types.LocalModeAnsibleArgs{})
+	if err != nil {
+		t.Fatalf("Unexpected error while building the command: %+v", err)
+	}
+	if expected := `--args='data="{\"key\":\"value\"}" msg="hello world"'`; !strings.Contains(command, expected) {
+		t.Fatalf("Expected '%s' in command but got: %s", expected, command)
+	}
+}
+
+func TestConfigProvisionerVaultID(t *testing.T) {
+	p := decodeTestConfig(t, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"module": []interface{}{
+					map[string]interface{}{
+						"module": "some-module",
+					},
+				},
+				"hosts": []interface{}{"host.to.play"},
+				"vault_id": []interface{}{
+					"dev@" + vaultPasswordFile,
+					"prod@" + alternativeVaultPasswordFile,
+				},
+			},
+		},
+	})
+
+	command, err := p.plays[0].ToCommand(types.LocalModeAnsibleArgs{})
+	if err != nil {
+		t.Fatalf("Unexpected error while building the command: %+v", err)
+	}
+	for _, expected := range []string{"--vault-id='dev@" + vaultPasswordFile + "'", "--vault-id='prod@" + alternativeVaultPasswordFile + "'"} {
+		if !strings.Contains(command, expected) {
+			t.Fatalf("Expected '%s' in command but got: %s", expected, command)
+		}
+	}
+}
+
+func TestConfigProvisionerDefaultsApplyToPlays(t *testing.T) {
+	p := decodeTestConfig(t, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"playbook": []interface{}{
+					map[string]interface{}{
+						"file_path": playbookFile,
+					},
+				},
+				"hosts": []interface{}{"host.to.play"},
+			},
+			map[string]interface{}{
+				"module": []interface{}{
+					map[string]interface{}{
+						"module": "some-module",
+					},
+				},
+				"hosts": []interface{}{"host.to.play"},
+			},
+		},
+		"defaults": []interface{}{
+			map[string]interface{}{
+				"forks":           10,
+				"roles_path":      []interface{}{"/tmp/roles"},
+				"stdout_callback": "yaml",
+				"syntax_check":    true,
+			},
+		},
+	})
+
+	if len(p.plays[0].RolesPath()) != 1 || p.plays[0].RolesPath()[0] != "/tmp/roles" {
+		t.Fatalf("Expected roles path from defaults but got: %v", p.plays[0].RolesPath())
+	}
+	if p.plays[0].Forks() != 10 {
+		t.Fatalf("Expected forks from defaults but got: %d", p.plays[0].Forks())
+	}
+	if !p.plays[0].SyntaxCheck() || p.plays[0].ToSyntaxCheckCommands(types.Commands{types.NewCommand("ansible-playbook")}).String() != "ansible-playbook --syntax-check" {
+		t.Fatalf("Expected a syntax check for the playbook play from defaults")
+	}
+	if p.plays[1].ToSyntaxCheckCommands(types.Commands{types.NewCommand("ansible")}) != nil {
+		t.Fatalf("Expected no syntax check for the module play")
+	}
+	command, err := p.plays[1].ToCommand(types.LocalModeAnsibleArgs{})
+	if err != nil {
+		t.Fatalf("Unexpected error while building the command: %+v", err)
+	}
+	if expected := "ANSIBLE_STDOUT_CALLBACK=yaml ANSIBLE_LOAD_CALLBACK_PLUGINS=1 ansible"; !strings.Contains(command, expected) {
+		t.Fatalf("Expected '%s' in command but got: %s", expected, command)
+	}
+}
+
+func TestConfigProvisionerPlanOnly(t *testing.T) {
+	p := decodeTestConfig(t, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"playbook": []interface{}{
+					map[string]interface{}{
+						"file_path": playbookFile,
+					},
+				},
+				"hosts": []interface{}{"host.to.play"},
+			},
+			map[string]interface{}{
+				"module": []interface{}{
+					map[string]interface{}{
+						"module": "some-module",
+					},
+				},
+				"hosts": []interface{}{"host.to.play"},
+			},
+			map[string]interface{}{
+				"galaxy_install": []interface{}{
+					map[string]interface{}{
+						"role_file": galaxyInstallRequirementsFile,
+					},
+				},
+			},
+		},
+		"max_parallel": 2,
+		"plan_only":    true,
+	})
+
+	if p.runOptions.MaxParallel != 2 || !p.runOptions.PlanOnly {
+		t.Fatalf("Expected run options from the configuration but got: %+v", p.runOptions)
+	}
+	if p.plays[0].ToPlanCommands(types.Commands{types.NewCommand("ansible-playbook")}).String() != "ansible-playbook --list-hosts --list-tasks" ||
+		p.plays[1].ToPlanCommands(types.Commands{types.NewCommand("ansible")}).String() != "ansible --list-hosts" ||
+		p.plays[2].ToPlanCommands(types.Commands{types.NewCommand("ansible-galaxy")}) != nil {
+		t.Fatalf("Expected plan commands for playbook and module plays only")
+	}
+}
+
+func TestConfigProvisionerGalaxyInstallCollectionsPath(t *testing.T) {
+	p := decodeTestConfig(t, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"galaxy_install": []interface{}{
+					map[string]interface{}{
+						"type":             "collection",
+						"role_file":        galaxyInstallRequirementsFile,
+						"collections_path": "/tmp/collections",
+					},
+				},
+				"collections_path": []interface{}{"/tmp/collections"},
+			},
+		},
+	})
+
+	command, err := p.plays[0].ToCommand(types.LocalModeAnsibleArgs{})
+	if err != nil {
+		t.Fatalf("Unexpected error while building the command: %+v", err)
+	}
+	expected := "ANSIBLE_COLLECTIONS_PATH='/tmp/collections' ANSIBLE_COLLECTIONS_PATHS='/tmp/collections' ansible-galaxy collection install --requirements-file='" + galaxyInstallRequirementsFile + "' --collections-path='/tmp/collections'"
+	if !strings.HasSuffix(command, expected) {
+		t.Fatalf("Expected '%s' in command but got: %s", expected, command)
+	}
+}
+
+func TestConfigProvisionerWindowsHosts(t *testing.T) {
+	p := decodeTestConfig(t, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"playbook": []interface{}{
+					map[string]interface{}{
+						"file_path": playbookFile,
+					},
+				},
+				"hosts": []interface{}{"host.to.play"},
+			},
+		},
+		"windows_settings": []interface{}{
+			map[string]interface{}{
+				"connection_type": "psrp",
+				"hosts": []interface{}{
+					map[string]interface{}{
+						"address":  "10.1.100.34",
+						"user":     "CORP\\svc-one",
+						"password": "secret",
+					},
+				},
+			},
+		},
+	})
+
+	hosts := p.windowsSettings.Hosts()
+	if p.windowsSettings.ConnectionType() != "psrp" || len(hosts) != 1 || hosts[0].User() != "CORP\\svc-one" || hosts[0].Password() != "secret" {
+		t.Fatalf("Expected the Windows hosts from the configuration but got: %+v", hosts)
+	}
+}
+
+func TestConfigProvisionerPullPlay(t *testing.T) {
+	c := map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"pull": []interface{}{
+					map[string]interface{}{
+						"url":           "https://github.com/example/ansible.git",
+						"checkout":      "main",
+						"playbook_file": "site.yml",
+						"schedule":      "*/15 * * * *",
+					},
+				},
+				"hosts":  []interface{}{"host.to.play"},
+				"become": true,
+			},
+		},
+	}
+
+	warn, errs := Provisioner().Validate(testConfig(t, c))
+	if len(warn) > 0 {
+		t.Fatalf("Warnings: %+v", warn)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("Errors: %+v", errs)
+	}
+
+	p, err := decodeConfig(
+		schema.TestResourceDataRaw(t, Provisioner().(*schema.Provisioner).Schema, c),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error while decoding the configuration: %+v", err)
+	}
+
+	if _, ok := p.plays[0].Entity().(*types.Pull); !ok {
+		t.Fatalf("Expected a pull play but got: %T", p.plays[0].Entity())
+	}
+
+	command, err := p.plays[0].ToLocalCommand(types.LocalModeAnsibleArgs{Username: "centos", Port: 22}, p.ansibleSSHSettings)
+	if err != nil {
+		t.Fatalf("Unexpected error while building the command: %+v", err)
+	}
+	commands := strings.Split(command, " && ")
+	if len(commands) != 2 {
+		t.Fatalf("Expected the cron and the immediate run commands but got: %s", command)
+	}
+	for _, expected := range []string{"--module-name='cron'", "minute=*/15", "--only-if-changed", "--become", "--ssh-extra-args="} {
+		if !strings.Contains(commands[0], expected) {
+			t.Fatalf("Expected '%s' in the cron command but got: %s", expected, commands[0])
+		}
+	}
+	for _, expected := range []string{"--module-name='shell'", "ansible-pull --url='\\''https://github.com/example/ansible.git'\\'' --checkout='\\''main'\\''", "--ssh-extra-args="} {
+		if !strings.Contains(commands[1], expected) {
+			t.Fatalf("Expected '%s' in the immediate run command but got: %s", expected, commands[1])
+		}
+	}
+	if strings.Contains(commands[1], "--only-if-changed") {
+		t.Fatalf("Expected the immediate run to apply unconditionally but got: %s", commands[1])
+	}
+}
+
+func TestConfigProvisionerModuleSequence(t *testing.T) {
+	c := map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"module": []interface{}{
+					map[string]interface{}{
+						"sequence": []interface{}{
+							map[string]interface{}{
+								"module": "hostname",
+								"args":   map[string]interface{}{"name": "web-1"},
+							},
+							map[string]interface{}{
+								"module":    "user",
+								"args_json": `{"name": "deploy", "groups": ["wheel"]}`,
+							},
+						},
+					},
+				},
+				"hosts":  []interface{}{"host.to.play"},
+				"become": true,
+			},
+		},
+	}
+
+	warn, errs := Provisioner().Validate(testConfig(t, c))
+	if len(warn) > 0 {
+		t.Fatalf("Warnings: %+v", warn)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("Errors: %+v", errs)
+	}
+
+	p, err := decodeConfig(
+		schema.TestResourceDataRaw(t, Provisioner().(*schema.Provisioner).Schema, c),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error while decoding the configuration: %+v", err)
+	}
+
+	command, err := p.plays[0].ToLocalCommand(types.LocalModeAnsibleArgs{Username: "centos", Port: 22}, p.ansibleSSHSettings)
+	if err != nil {
+		t.Fatalf("Unexpected error while building the command: %+v", err)
+	}
+	commands := strings.Split(command, " && ")
+	if len(commands) != 2 {
+		t.Fatalf("Expected a command for every module of the sequence but got: %s", command)
+	}
+	for _, expected := range []string{"--module-name='hostname'", "name=web-1", "--become", "--ssh-extra-args="} {
+		if !strings.Contains(commands[0], expected) {
+			t.Fatalf("Expected '%s' in the first command but got: %s", expected, commands[0])
+		}
+	}
+	for _, expected := range []string{"--module-name='user'", "name=deploy", "--become", "--ssh-extra-args="} {
+		if !strings.Contains(commands[1], expected) {
+			t.Fatalf("Expected '%s' in the second command but got: %s", expected, commands[1])
+		}
+	}
+	sequence, err := p.plays[0].ToLocalCommands(types.LocalModeAnsibleArgs{Username: "centos", Port: 22}, p.ansibleSSHSettings)
+	if err != nil {
+		t.Fatalf("Unexpected error while building the commands: %+v", err)
+	}
+	if len(sequence) != 2 || p.plays[0].ToPlanCommands(sequence) != nil {
+		t.Fatalf("Expected a module sequence not to be listed")
+	}
+
+	c["plays"].([]interface{})[0].(map[string]interface{})["module"].([]interface{})[0].(map[string]interface{})["module"] = "ping"
+	_, errs = Provisioner().Validate(testConfig(t, c))
+	if len(errs) != 1 {
+		t.Fatalf("Expected 1 error for a module with a sequence but got: %+v", errs)
+	}
+}
+
+func TestConfigProvisionerModuleBackgroundWithoutPolling(t *testing.T) {
+	c := map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"module": []interface{}{
+					map[string]interface{}{
+						"module":     "shell",
+						"args":       map[string]interface{}{"cmd": "/usr/local/bin/restore-database"},
+						"background": 14400,
+						"poll":       0,
+					},
+				},
+				"hosts": []interface{}{"host.to.play"},
+			},
+		},
+	}
+
+	warn, errs := Provisioner().Validate(testConfig(t, c))
+	if len(warn) > 0 {
+		t.Fatalf("Warnings: %+v", warn)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("Errors: %+v", errs)
+	}
+
+	p, err := decodeConfig(
+		schema.TestResourceDataRaw(t, Provisioner().(*schema.Provisioner).Schema, c),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error while decoding the configuration: %+v", err)
+	}
+	command, err := p.plays[0].ToCommand(types.LocalModeAnsibleArgs{Username: "centos"})
+	if err != nil {
+		t.Fatalf("Unexpected error while building the command: %+v", err)
+	}
+	if !strings.Contains(command, "--background=14400 --poll=0") {
+		t.Fatalf("Expected the background job not to be polled but got: %s", command)
+	}
+
+	c["plays"].([]interface{})[0].(map[string]interface{})["module"].([]interface{})[0].(map[string]interface{})["poll"] = -1
+	if _, errs := Provisioner().Validate(testConfig(t, c)); len(errs) != 1 {
+		t.Fatalf("Expected 1 error for a negative poll but got: %+v", errs)
+	}
+}
+
+func TestRemoteBootstrapDirectoryPermissions(t *testing.T) {
+	c := map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"module": []interface{}{
+					map[string]interface{}{
+						"module": "ping",
+					},
+				},
+			},
+		},
+		"remote": []interface{}{
+			map[string]interface{}{
+				"bootstrap_directory":       "/var/lib/terraform",
+				"bootstrap_directory_mode":  "0700",
+				"bootstrap_directory_owner": "root:root",
+			},
+		},
+	}
+
+	warn, errs := Provisioner().Validate(testConfig(t, c))
+	if len(warn) > 0 {
+		t.Fatalf("Warnings: %+v", warn)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("Errors: %+v", errs)
+	}
+
+	p, err := decodeConfig(
+		schema.TestResourceDataRaw(t, Provisioner().(*schema.Provisioner).Schema, c),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error while decoding the configuration: %+v", err)
+	}
+	if p.remote.BootstrapDirectory() != "/var/lib/terraform/tf-ansible-bootstrap" ||
+		p.remote.BootstrapDirectoryMode() != "0700" ||
+		p.remote.BootstrapDirectoryOwner() != "root:root" {
+		t.Fatalf("Unexpected bootstrap directory settings: %+v", p.remote)
+	}
+
+	for _, mode := range []string{"rwx", "0800", "17777"} {
+		c["remote"].([]interface{})[0].(map[string]interface{})["bootstrap_directory_mode"] = mode
+		if _, errs := Provisioner().Validate(testConfig(t, c)); len(errs) != 1 {
+			t.Fatalf("Expected 1 error for mode '%s' but got: %+v", mode, errs)
+		}
+	}
+}
+
+func testConfig(t *testing.T, c map[string]interface{}) *terraform.ResourceConfig {
+	r, err := config.NewRawConfig(c)
+	if err != nil {
+		t.Fatalf("config error: %s", err)
+	}
+	return terraform.NewResourceConfig(r)
+}
+
+// decodeTestConfig validates the configuration and returns the decoded provisioner.
+func decodeTestConfig(t *testing.T, c map[string]interface{}) *provisioner {
+	warn, errs := Provisioner().Validate(testConfig(t, c))
+	if len(warn) > 0 {
+		t.Fatalf("Warnings: %+v", warn)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("Errors: %+v", errs)
+	}
+	p, err := decodeConfig(schema.TestResourceDataRaw(t, Provisioner().(*schema.Provisioner).Schema, c))
+	if err != nil {
+		t.Fatalf("Unexpected error while decoding the configuration: %+v", err)
+	}
+	return p
+}
+
+func TestPlaybookFilePathConflictsWithRepo(t *testing.T) {
+	c := testConfig(t, map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"playbook": []interface{}{
+					map[string]interface{}{
+						"file_path": playbookFile,
+						"repo":      "git::https://git.example.com/playbooks.git",
+					},
+				},
+			},
+		},
+	})
+	_, errs := Provisioner().Validate(c)
+	if len(errs) != 1 {
+		t.Fatalf("Expected 1 error but got: %v", errs)
+	}
+}
+
+func TestConfigProvisionerPhaseDisablesPlays(t *testing.T) {
+	newPlay := func(name, phase string) map[string]interface{} {
+		return map[string]interface{}{
+			"name": name,
+			"module": []interface{}{
+				map[string]interface{}{
+					"module": "ping",
+				},
+			},
+			"hosts": []interface{}{"host.to.play"},
+			"phase": phase,
+		}
+	}
+	c := map[string]interface{}{
+		"phase": "destroy",
+		"plays": []interface{}{
+			newPlay("configure", "create"),
+			newPlay("deregister", "destroy"),
+			newPlay("notify", "always"),
+		},
+	}
+
+	warn, errs := Provisioner().Validate(testConfig(t, c))
+	if len(warn) > 0 {
+		t.Fatalf("Warnings: %+v", warn)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("Errors: %+v", errs)
+	}
+
+	p, err := decodeConfig(
+		schema.TestResourceDataRaw(t, Provisioner().(*schema.Provisioner).Schema, c),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error while decoding the configuration: %+v", err)
+	}
+	for idx, expected := range []bool{false, true, true} {
+		if p.plays[idx].Enabled() != expected {
+			t.Fatalf("Expected play '%s' enabled to be %v in the destroy phase", p.plays[idx].Name(), expected)
+		}
+	}
+
+	c["phase"] = "cleanup"
+	if _, errs := Provisioner().Validate(testConfig(t, c)); len(errs) == 0 {
+		t.Fatalf("Expected an error for an invalid phase")
+	}
+}
+
+func TestConfigProvisionerGalaxyInstallToken(t *testing.T) {
+	c := map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"galaxy_install": []interface{}{
+					map[string]interface{}{
+						"role_file": galaxyInstallRequirementsFile,
+						"type":      "collection",
+						"server":    "https://console.redhat.com/api/automation-hub/",
+						"token":     "hub-t0ken",
+					},
+				},
+			},
+		},
+	}
+
+	warn, errs := Provisioner().Validate(testConfig(t, c))
+	if len(warn) > 0 {
+		t.Fatalf("Warnings: %+v", warn)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("Errors: %+v", errs)
+	}
+
+	p, err := decodeConfig(
+		schema.TestResourceDataRaw(t, Provisioner().(*schema.Provisioner).Schema, c),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error while decoding the configuration: %+v", err)
+	}
+
+	command, err := p.plays[0].ToCommand(types.LocalModeAnsibleArgs{})
+	if err != nil {
+		t.Fatalf("Unexpected error while building the command: %+v", err)
+	}
+	for _, expected := range []string{"collection install", "--server='https://console.redhat.com/api/automation-hub/'", "--token='hub-t0ken'"} {
+		if !strings.Contains(command, expected) {
+			t.Fatalf("Expected '%s' in the command but got: %s", expected, command)
+		}
+	}
+}
+
+func TestConfigProvisionerAnsibleBinaries(t *testing.T) {
+	c := map[string]interface{}{
+		"plays": []interface{}{
+			map[string]interface{}{
+				"playbook": []interface{}{
+					map[string]interface{}{
+						"file_path": playbookFile,
+					},
+				},
+				"ansible_playbook_binary": "/opt/ansible-2.9/bin/ansible-playbook",
+			},
+			map[string]interface{}{
+				"module": []interface{}{
+					map[string]interface{}{
+						"module": "ping",
+					},
+				},
+			},
+		},
+		"defaults": []interface{}{
+			map[string]interface{}{
+				"virtualenv_path": "/opt/ansible-2.15",
+				"ansible_binary":  "/usr/local/bin/ansible",
+			},
+		},
+	}
+
+	warn, errs := Provisioner().Validate(testConfig(t, c))
+	if len(warn) > 0 {
+		t.Fatalf("Warnings: %+v", warn)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("Errors: %+v", errs)
+	}
+
+	p, err := decodeConfig(
+		schema.TestResourceDataRaw(t, Provisioner().(*schema.Provisioner).Schema, c),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error while decoding the configuration: %+v", err)
+	}
+
+	for idx, expected := range []string{
+		`ANSIBLE_FORCE_COLOR=true VIRTUAL_ENV='/opt/ansible-2.15' PATH='/opt/ansible-2.15/bin':"$PATH" `,
+		"'/opt/ansible-2.9/bin/ansible-playbook' ",
+		"'/usr/local/bin/ansible' ",
+	} {
+		play := p.plays[0]
+		if idx == 2 {
+			play = p.plays[1]
+		}
+		command, err := play.ToCommand(types.LocalModeAnsibleArgs{})
+		if err != nil {
+			t.Fatalf("Unexpected error while building the command: %+v", err)
+		}
+		if !strings.Contains(command, expected) {
+			t.Fatalf("Expected '%s' in the command but got: %s", expected, command)
+		}
+	}
+	if command := p.plays[0].ToVersionCommand().String(); !strings.HasSuffix(command, "'/opt/ansible-2.9/bin/ansible-playbook' --version") {
+		t.Fatalf("Expected the version of the play ansible-playbook but got: %s", command)
+	}
+	if command := p.plays[1].ToVersionCommand().String(); !strings.HasSuffix(command, "'/opt/ansible-2.15/bin/ansible-playbook' --version") {
+		t.Fatalf("Expected the ansible-playbook of the virtualenv but got: %s", command)
+	}
+}
+
+func TestDefaultConnectionType(t *testing.T) {
+	// Terraform 0.13 and later pass no connection to a provisioner without a connection block:
+	s := withDefaultConnectionType(&terraform.InstanceState{})
+	if s.Ephemeral.ConnInfo["type"] != "ssh" {
+		t.Fatalf("Expected the ssh connection type but got: %v", s.Ephemeral.ConnInfo)
+	}
+	s = withDefaultConnectionType(&terraform.InstanceState{
+		Ephemeral: terraform.EphemeralState{ConnInfo: map[string]string{"type": "winrm", "host": "10.0.0.1"}},
+	})
+	if s.Ephemeral.ConnInfo["type"] != "winrm" || s.Ephemeral.ConnInfo["host"] != "10.0.0.1" {
+		t.Fatalf("Expected the connection to be kept but got: %v", s.Ephemeral.ConnInfo)
 	}
-	return terraform.NewResourceConfig(r)
 }
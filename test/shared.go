@@ -232,6 +232,11 @@ func GetDefaultSettingsForUser(t *testing.T, user *user.User) *types.Defaults {
 	return types.NewDefaultsFromMapInterface(defaultSettings, true)
 }
 
+// GetNewDefaultPlay returns *types.Play from GetRawPlay using the default settings of the current user.
+func GetNewDefaultPlay(t *testing.T, extra map[string]interface{}) *types.Play {
+	return GetNewPlay(t, GetRawPlay(t, extra), GetDefaultSettingsForUser(t, GetCurrentUser(t)))
+}
+
 // GetNewPlay returns *types.Play from a raw map using th default settings.
 func GetNewPlay(t *testing.T, raw map[string]interface{}, defaultSettings *types.Defaults) *types.Play {
 	return types.NewPlayFromMapInterface(raw, defaultSettings)
@@ -292,6 +297,50 @@ func GetPlayPlaybookSchema(t *testing.T, playbookFilePath string) *schema.Resour
 	return schema.TestResourceDataRaw(t, playEntitySchemas, playPlaybookEntity)
 }
 
+// GetRawPlay returns a raw play running the ping module against localhost, the extra values
+// override the defaults. A module or playbook given as a raw list replaces the ping module.
+func GetRawPlay(t *testing.T, extra map[string]interface{}) map[string]interface{} {
+	raw := map[string]interface{}{
+		"hosts":               []interface{}{"localhost"},
+		"enabled":             true,
+		"become":              false,
+		"become_method":       "sudo",
+		"become_user":         "root",
+		"diff":                false,
+		"check":               false,
+		"forks":               5,
+		"inventory_file":      "",
+		"limit":               "",
+		"vault_id":            []interface{}{},
+		"vault_password_file": "",
+		"verbose":             false,
+		"extra_vars":          map[string]interface{}{},
+	}
+	module, playbook := []interface{}{map[string]interface{}{"module": "ping"}}, []interface{}{}
+	if list, ok := extra["playbook"].([]interface{}); ok {
+		module, playbook = []interface{}{}, list
+	}
+	if list, ok := extra["module"].([]interface{}); ok {
+		module = list
+	}
+	playEntities := schema.TestResourceDataRaw(t, map[string]*schema.Schema{
+		"module":   types.NewModuleSchema(),
+		"playbook": types.NewPlaybookSchema(),
+	}, map[string]interface{}{
+		"module":   module,
+		"playbook": playbook,
+	})
+	raw["module"] = playEntities.Get("module").(*schema.Set)
+	raw["playbook"] = playEntities.Get("playbook").(*schema.Set)
+	for k, v := range extra {
+		if _, ok := v.([]interface{}); ok && (k == "module" || k == "playbook") {
+			continue
+		}
+		raw[k] = v
+	}
+	return raw
+}
+
 // WriteTempVaultIDFile creates and writes a temporrary Vault ID password file.
 func WriteTempVaultIDFile(t *testing.T, password string) string {
 	tempVaultIDFile, err := ioutil.TempFile("", ".temp-vault-id")
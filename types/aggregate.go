@@ -0,0 +1,147 @@
+package types
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// AggregateSettings represents the fleet a resource registers in, or the fleet a null_resource runs the plays against.
+type AggregateSettings struct {
+	isAggregateInUse bool
+	id               string
+	directory        string
+	alias            string
+	groups           []string
+	hostVars         map[string]interface{}
+	minMembers       int
+}
+
+const (
+	// default values:
+	aggregateDefaultDirectory = ".terraform/ansible-aggregates"
+	// attribute names:
+	aggregateAttributeID         = "id"
+	aggregateAttributeDirectory  = "directory"
+	aggregateAttributeAlias      = "alias"
+	aggregateAttributeGroups     = "groups"
+	aggregateAttributeHostVars   = "host_vars"
+	aggregateAttributeMinMembers = "min_members"
+)
+
+// NewAggregateSchema returns a new fleet aggregation schema.
+func NewAggregateSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:          schema.TypeSet,
+		Optional:      true,
+		MaxItems:      1,
+		ConflictsWith: []string{"remote", "tower", "kubernetes", "pull_bootstrap", "wsl"},
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				aggregateAttributeID: &schema.Schema{
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				aggregateAttributeDirectory: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+					Default:  aggregateDefaultDirectory,
+				},
+				aggregateAttributeAlias: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				aggregateAttributeGroups: &schema.Schema{
+					Type:     schema.TypeList,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+					Optional: true,
+				},
+				aggregateAttributeHostVars: &schema.Schema{
+					Type:     schema.TypeMap,
+					Optional: true,
+				},
+				aggregateAttributeMinMembers: &schema.Schema{
+					Type:         schema.TypeInt,
+					Optional:     true,
+					ValidateFunc: vfNonNegativeInt,
+				},
+			},
+		},
+	}
+}
+
+// NewAggregateSettingsFromInterface reads fleet aggregation configuration from Terraform schema.
+func NewAggregateSettingsFromInterface(i interface{}, ok bool) *AggregateSettings {
+	if ok {
+		return NewAggregateSettingsFromMapInterface(mapFromTypeSetList(i.(*schema.Set).List()), ok)
+	}
+	return newDefaultAggregateSettings()
+}
+
+// NewAggregateSettingsFromMapInterface reads fleet aggregation configuration from a map.
+func NewAggregateSettingsFromMapInterface(vals map[string]interface{}, ok bool) *AggregateSettings {
+	v := newDefaultAggregateSettings()
+	if ok {
+		v.isAggregateInUse = true
+		if val, ok := vals[aggregateAttributeID]; ok {
+			v.id = val.(string)
+		}
+		if val, ok := vals[aggregateAttributeDirectory]; ok && val.(string) != "" {
+			v.directory = val.(string)
+		}
+		if val, ok := vals[aggregateAttributeAlias]; ok {
+			v.alias = val.(string)
+		}
+		if val, ok := vals[aggregateAttributeGroups]; ok {
+			v.groups = listOfInterfaceToListOfString(val)
+		}
+		if val, ok := vals[aggregateAttributeHostVars]; ok {
+			v.hostVars = mapFromTypeMap(val)
+		}
+		if val, ok := vals[aggregateAttributeMinMembers]; ok {
+			v.minMembers = val.(int)
+		}
+	}
+	return v
+}
+
+func newDefaultAggregateSettings() *AggregateSettings {
+	return &AggregateSettings{
+		directory: aggregateDefaultDirectory,
+		groups:    make([]string, 0),
+		hostVars:  make(map[string]interface{}),
+	}
+}
+
+// IsAggregateInUse returns true when the resource registers in a fleet or runs the plays against a fleet.
+func (v *AggregateSettings) IsAggregateInUse() bool {
+	return v.isAggregateInUse
+}
+
+// ID returns the ID of the fleet.
+func (v *AggregateSettings) ID() string {
+	return v.id
+}
+
+// Directory returns the directory the members of the fleets are registered in.
+func (v *AggregateSettings) Directory() string {
+	return v.directory
+}
+
+// Alias returns the inventory name of the member, empty for the connection host.
+func (v *AggregateSettings) Alias() string {
+	return v.alias
+}
+
+// Groups returns the inventory groups of the member.
+func (v *AggregateSettings) Groups() []string {
+	return v.groups
+}
+
+// HostVars returns the inventory variables of the member.
+func (v *AggregateSettings) HostVars() map[string]interface{} {
+	return v.hostVars
+}
+
+// MinMembers returns the number of members the fleet must have before the plays run, 0 for any number.
+func (v *AggregateSettings) MinMembers() int {
+	return v.minMembers
+}
@@ -0,0 +1,92 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+const (
+	// environment variable names:
+	ansibleEnvVarConfig = "ANSIBLE_CONFIG"
+	// attribute names:
+	ansibleCfgAttributeSection = "section"
+	ansibleCfgAttributeOptions = "options"
+)
+
+// AnsibleCfgSection represents a section of a generated ansible.cfg.
+type AnsibleCfgSection struct {
+	section string
+	options map[string]interface{}
+}
+
+// NewAnsibleCfgSchema returns a new ansible.cfg schema.
+func NewAnsibleCfgSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				ansibleCfgAttributeSection: &schema.Schema{
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				ansibleCfgAttributeOptions: &schema.Schema{
+					Type:     schema.TypeMap,
+					Optional: true,
+				},
+			},
+		},
+	}
+}
+
+// NewAnsibleCfgSectionFromMapInterface reads an ansible.cfg section from a map.
+func NewAnsibleCfgSectionFromMapInterface(vals map[string]interface{}) *AnsibleCfgSection {
+	return &AnsibleCfgSection{
+		section: vals[ansibleCfgAttributeSection].(string),
+		options: mapFromTypeMap(vals[ansibleCfgAttributeOptions]),
+	}
+}
+
+// Section returns the section name, for example defaults or ssh_connection.
+func (v *AnsibleCfgSection) Section() string {
+	return v.section
+}
+
+// Options returns the options of the section.
+func (v *AnsibleCfgSection) Options() map[string]interface{} {
+	return v.options
+}
+
+// renderAnsibleCfg serializes sections to the ansible.cfg format.
+// Options of sections with the same name are merged, later values win.
+func renderAnsibleCfg(sections []*AnsibleCfgSection) string {
+	names := make([]string, 0)
+	merged := make(map[string]map[string]interface{})
+	for _, section := range sections {
+		if _, ok := merged[section.Section()]; !ok {
+			names = append(names, section.Section())
+			merged[section.Section()] = make(map[string]interface{})
+		}
+		for key, value := range section.Options() {
+			merged[section.Section()][key] = value
+		}
+	}
+
+	var builder strings.Builder
+	for _, name := range names {
+		builder.WriteString(fmt.Sprintf("[%s]\n", name))
+		keys := make([]string, 0, len(merged[name]))
+		for key := range merged[name] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			builder.WriteString(fmt.Sprintf("%s = %v\n", key, merged[name][key]))
+		}
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
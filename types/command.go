@@ -0,0 +1,140 @@
+package types
+
+import (
+	"strings"
+)
+
+// Command is an Ansible command: the environment variables and the arguments of the program.
+// Local provisioning executes the arguments as the argument vector of the program, a shell never
+// interprets these. String renders the command line for a POSIX shell, executed on remote hosts,
+// in containers and in WSL.
+type Command struct {
+	environment []commandWord
+	args        []commandWord
+}
+
+// commandWord is a single environment variable or argument of a command: the value is passed
+// to the program, the shell form is written on the command line.
+type commandWord struct {
+	value      string
+	shell      string
+	prependDir bool
+}
+
+// Commands are commands executed one after another, the first failing command stops the sequence.
+type Commands []*Command
+
+// NewCommand returns a command executing the program, the program is written as is on the command line.
+func NewCommand(program string) *Command {
+	return (&Command{}).Arg(program)
+}
+
+// Arg appends an argument written as is on the command line.
+func (c *Command) Arg(value string) *Command {
+	c.args = append(c.args, commandWord{value: value, shell: value})
+	return c
+}
+
+// QuotedArg appends an argument quoted on the command line.
+func (c *Command) QuotedArg(value string) *Command {
+	c.args = append(c.args, commandWord{value: value, shell: ShellQuote(value)})
+	return c
+}
+
+// Option appends a name=value argument, the value is quoted on the command line.
+func (c *Command) Option(name string, value string) *Command {
+	c.args = append(c.args, commandWord{value: name + "=" + value, shell: name + "=" + ShellQuote(value)})
+	return c
+}
+
+// Env sets an environment variable of the command, the value is quoted on the command line.
+func (c *Command) Env(name string, value string) *Command {
+	return c.env(name, value, ShellQuote(value))
+}
+
+// env sets an environment variable of the command written with the shell form of the value.
+func (c *Command) env(name string, value string, shell string) *Command {
+	c.environment = append(c.environment, commandWord{value: name + "=" + value, shell: name + "=" + shell})
+	return c
+}
+
+// prependPath prepends the directory to the PATH the command inherits.
+func (c *Command) prependPath(directory string) *Command {
+	c.environment = append(c.environment, commandWord{
+		value:      directory,
+		shell:      "PATH=" + ShellQuote(directory) + ":\"$PATH\"",
+		prependDir: true,
+	})
+	return c
+}
+
+// Args returns the program and its arguments.
+func (c *Command) Args() []string {
+	args := make([]string, 0, len(c.args))
+	for _, arg := range c.args {
+		args = append(args, arg.value)
+	}
+	return args
+}
+
+// Environment returns the environment variables of the command as name=value,
+// the variables take precedence over the inherited environment.
+func (c *Command) Environment() []string {
+	environment := make([]string, 0, len(c.environment))
+	for _, variable := range c.environment {
+		if !variable.prependDir {
+			environment = append(environment, variable.value)
+		}
+	}
+	return environment
+}
+
+// PathDirectories returns the directories prepended to the inherited PATH, in order.
+func (c *Command) PathDirectories() []string {
+	directories := make([]string, 0)
+	for _, variable := range c.environment {
+		if variable.prependDir {
+			directories = append(directories, variable.value)
+		}
+	}
+	return directories
+}
+
+// WithArgs returns a copy of the command with the arguments appended as is.
+func (c *Command) WithArgs(args ...string) *Command {
+	command := &Command{
+		environment: append([]commandWord{}, c.environment...),
+		args:        append([]commandWord{}, c.args...),
+	}
+	for _, arg := range args {
+		command.Arg(arg)
+	}
+	return command
+}
+
+// String returns the command line of the command for a POSIX shell.
+func (c *Command) String() string {
+	words := make([]string, 0, len(c.environment)+len(c.args))
+	for _, word := range append(append([]commandWord{}, c.environment...), c.args...) {
+		words = append(words, word.shell)
+	}
+	return strings.Join(words, " ")
+}
+
+// argsString returns the command line of the arguments without the program and the environment.
+func (c *Command) argsString() string {
+	words := make([]string, 0, len(c.args))
+	for _, arg := range c.args {
+		words = append(words, arg.shell)
+	}
+	return strings.Join(words, " ")
+}
+
+// String returns the command line executing the commands one after another for a POSIX shell.
+func (c Commands) String() string {
+	commands := make([]string, 0, len(c))
+	for _, command := range c {
+		commands = append(commands, command.String())
+	}
+	return strings.Join(commands, " && ")
+}
@@ -6,27 +6,51 @@ import (
 
 // Defaults represents default settings for each consequent play.
 type Defaults struct {
-	hosts             []string
-	groups            []string
-	becomeMethod      string
-	becomeUser        string
-	extraVars         map[string]interface{}
-	forks             int
-	inventoryFile     string
-	limit             string
-	vaultID           []string
-	vaultPasswordFile string
+	hosts                 []string
+	groups                []string
+	becomeMethod          string
+	becomeUser            string
+	collectionsPath       []string
+	environment           map[string]interface{}
+	extraVars             map[string]interface{}
+	forks                 int
+	inventoryFile         string
+	limit                 string
+	rolesPath             []string
+	stdoutCallback        string
+	strategy              string
+	strategyPlugins       string
+	syntaxCheck           bool
+	vaultID               []string
+	vaultPasswordFile     string
+	ansiblePlaybookBinary string
+	ansibleBinary         string
+	ansibleGalaxyBinary   string
+	virtualenvPath        string
+	profileTasks          bool
 	//
-	hostsIsSet             bool
-	groupsIsSet            bool
-	becomeMethodIsSet      bool
-	becomeUserIsSet        bool
-	extraVarsIsSet         bool
-	forksIsSet             bool
-	inventoryFileIsSet     bool
-	limitIsSet             bool
-	vaultIDIsSet           bool
-	vaultPasswordFileIsSet bool
+	hostsIsSet                 bool
+	groupsIsSet                bool
+	becomeMethodIsSet          bool
+	becomeUserIsSet            bool
+	collectionsPathIsSet       bool
+	environmentIsSet           bool
+	extraVarsIsSet             bool
+	forksIsSet                 bool
+	inventoryFileIsSet         bool
+	limitIsSet                 bool
+	rolesPathIsSet             bool
+	stdoutCallbackIsSet        bool
+	strategyIsSet              bool
+	strategyPluginsIsSet       bool
+	syntaxCheckIsSet           bool
+	vaultIDIsSet               bool
+	vaultPasswordFileIsSet     bool
+	ansiblePlaybookBinaryIsSet bool
+	ansibleBinaryIsSet         bool
+	ansibleGalaxyBinaryIsSet   bool
+	virtualenvPathIsSet        bool
+	profileTasksIsSet          bool
 }
 
 const (
@@ -35,12 +59,24 @@ const (
 	defaultsAttributeGroups            = "groups"
 	defaultsAttributeBecomeMethod      = "become_method"
 	defaultsAttributeBecomeUser        = "become_user"
+	defaultsAttributeCollectionsPath   = "collections_path"
+	defaultsAttributeEnvironment       = "environment"
 	defaultsAttributeExtraVars         = "extra_vars"
 	defaultsAttributeForks             = "forks"
 	defaultsAttributeInventoryFile     = "inventory_file"
 	defaultsAttributeLimit             = "limit"
+	defaultsAttributeRolesPath         = "roles_path"
+	defaultsAttributeStdoutCallback    = "stdout_callback"
+	defaultsAttributeStrategy          = "strategy"
+	defaultsAttributeStrategyPlugins   = "strategy_plugins"
+	defaultsAttributeSyntaxCheck       = "syntax_check"
 	defaultsAttributeVaultID           = "vault_id"
 	defaultsAttributeVaultPasswordFile = "vault_password_file"
+	defaultsAttributePlaybookBinary    = "ansible_playbook_binary"
+	defaultsAttributeAnsibleBinary     = "ansible_binary"
+	defaultsAttributeGalaxyBinary      = "ansible_galaxy_binary"
+	defaultsAttributeVirtualenvPath    = "virtualenv_path"
+	defaultsAttributeProfileTasks      = "profile_tasks"
 )
 
 // NewDefaultsSchema returns a new defaults schema.
@@ -69,6 +105,16 @@ func NewDefaultsSchema() *schema.Schema {
 					Type:     schema.TypeString,
 					Optional: true,
 				},
+				defaultsAttributeCollectionsPath: &schema.Schema{
+					Type:     schema.TypeList,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+					Optional: true,
+				},
+				defaultsAttributeEnvironment: &schema.Schema{
+					Type:         schema.TypeMap,
+					Optional:     true,
+					ValidateFunc: vfEnvironment,
+				},
 				defaultsAttributeExtraVars: &schema.Schema{
 					Type:     schema.TypeMap,
 					Optional: true,
@@ -87,6 +133,29 @@ func NewDefaultsSchema() *schema.Schema {
 					Type:     schema.TypeString,
 					Optional: true,
 				},
+				defaultsAttributeRolesPath: &schema.Schema{
+					Type:     schema.TypeList,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+					Optional: true,
+				},
+				defaultsAttributeStdoutCallback: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: vfStdoutCallback,
+				},
+				defaultsAttributeStrategy: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: vfStrategy,
+				},
+				defaultsAttributeSyntaxCheck: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
+				defaultsAttributeStrategyPlugins: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
 				defaultsAttributeVaultID: &schema.Schema{
 					Type:          schema.TypeList,
 					Elem:          &schema.Schema{Type: schema.TypeString},
@@ -99,6 +168,26 @@ func NewDefaultsSchema() *schema.Schema {
 					ValidateFunc:  vfPath,
 					ConflictsWith: []string{"defaults.vault_id"},
 				},
+				defaultsAttributePlaybookBinary: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				defaultsAttributeAnsibleBinary: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				defaultsAttributeGalaxyBinary: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				defaultsAttributeVirtualenvPath: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				defaultsAttributeProfileTasks: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
 			},
 		},
 	}
@@ -133,6 +222,14 @@ func NewDefaultsFromMapInterface(vals map[string]interface{}, ok bool) *Defaults
 			v.becomeUser = val.(string)
 			v.becomeUserIsSet = v.becomeUser != ""
 		}
+		if val, ok := vals[defaultsAttributeCollectionsPath]; ok {
+			v.collectionsPath = listOfInterfaceToListOfString(val.([]interface{}))
+			v.collectionsPathIsSet = len(v.collectionsPath) > 0
+		}
+		if val, ok := vals[defaultsAttributeEnvironment]; ok {
+			v.environment = mapFromTypeMap(val)
+			v.environmentIsSet = len(v.environment) > 0
+		}
 		if val, ok := vals[defaultsAttributeExtraVars]; ok {
 			v.extraVars = mapFromTypeMap(val)
 			v.extraVarsIsSet = len(v.extraVars) > 0
@@ -149,6 +246,26 @@ func NewDefaultsFromMapInterface(vals map[string]interface{}, ok bool) *Defaults
 			v.limit = val.(string)
 			v.limitIsSet = v.limit != ""
 		}
+		if val, ok := vals[defaultsAttributeRolesPath]; ok {
+			v.rolesPath = listOfInterfaceToListOfString(val.([]interface{}))
+			v.rolesPathIsSet = len(v.rolesPath) > 0
+		}
+		if val, ok := vals[defaultsAttributeStdoutCallback]; ok {
+			v.stdoutCallback = val.(string)
+			v.stdoutCallbackIsSet = v.stdoutCallback != ""
+		}
+		if val, ok := vals[defaultsAttributeStrategy]; ok {
+			v.strategy = val.(string)
+			v.strategyIsSet = v.strategy != ""
+		}
+		if val, ok := vals[defaultsAttributeStrategyPlugins]; ok {
+			v.strategyPlugins = val.(string)
+			v.strategyPluginsIsSet = v.strategyPlugins != ""
+		}
+		if val, ok := vals[defaultsAttributeSyntaxCheck]; ok {
+			v.syntaxCheck = val.(bool)
+			v.syntaxCheckIsSet = v.syntaxCheck
+		}
 		if val, ok := vals[defaultsAttributeVaultID]; ok {
 			v.vaultID = listOfInterfaceToListOfString(val.([]interface{}))
 			v.vaultIDIsSet = len(v.vaultID) > 0
@@ -157,6 +274,26 @@ func NewDefaultsFromMapInterface(vals map[string]interface{}, ok bool) *Defaults
 			v.vaultPasswordFile = val.(string)
 			v.vaultPasswordFileIsSet = v.vaultPasswordFile != ""
 		}
+		if val, ok := vals[defaultsAttributePlaybookBinary]; ok {
+			v.ansiblePlaybookBinary = val.(string)
+			v.ansiblePlaybookBinaryIsSet = v.ansiblePlaybookBinary != ""
+		}
+		if val, ok := vals[defaultsAttributeAnsibleBinary]; ok {
+			v.ansibleBinary = val.(string)
+			v.ansibleBinaryIsSet = v.ansibleBinary != ""
+		}
+		if val, ok := vals[defaultsAttributeGalaxyBinary]; ok {
+			v.ansibleGalaxyBinary = val.(string)
+			v.ansibleGalaxyBinaryIsSet = v.ansibleGalaxyBinary != ""
+		}
+		if val, ok := vals[defaultsAttributeVirtualenvPath]; ok {
+			v.virtualenvPath = val.(string)
+			v.virtualenvPathIsSet = v.virtualenvPath != ""
+		}
+		if val, ok := vals[defaultsAttributeProfileTasks]; ok {
+			v.profileTasks = val.(bool)
+			v.profileTasksIsSet = v.profileTasks
+		}
 	}
 	return v
 }
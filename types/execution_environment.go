@@ -0,0 +1,136 @@
+package types
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// ExecutionEnvironment represents the container the local provisioner runs Ansible in.
+type ExecutionEnvironment struct {
+	isInUse  bool
+	image    string
+	engine   string
+	volumes  []string
+	readOnly bool
+}
+
+const (
+	// default values:
+	executionEnvironmentDefaultEngine = "podman"
+	runInDockerEngine                 = "docker"
+	// attribute names:
+	executionEnvironmentAttributeImage   = "image"
+	executionEnvironmentAttributeEngine  = "engine"
+	executionEnvironmentAttributeVolumes = "volumes"
+)
+
+// NewExecutionEnvironmentSchema returns a new execution environment schema.
+func NewExecutionEnvironmentSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:          schema.TypeSet,
+		Optional:      true,
+		MaxItems:      1,
+		ConflictsWith: []string{"remote", "run_in_docker"},
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				executionEnvironmentAttributeImage: &schema.Schema{
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				executionEnvironmentAttributeEngine: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					Default:      executionEnvironmentDefaultEngine,
+					ValidateFunc: vfContainerEngine,
+				},
+				executionEnvironmentAttributeVolumes: &schema.Schema{
+					Type:     schema.TypeList,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+					Optional: true,
+				},
+			},
+		},
+	}
+}
+
+// NewExecutionEnvironmentFromInterface reads execution environment configuration from Terraform schema.
+func NewExecutionEnvironmentFromInterface(i interface{}, ok bool) *ExecutionEnvironment {
+	if ok {
+		return NewExecutionEnvironmentFromMapInterface(mapFromTypeSetList(i.(*schema.Set).List()), ok)
+	}
+	return &ExecutionEnvironment{engine: executionEnvironmentDefaultEngine}
+}
+
+// NewExecutionEnvironmentFromMapInterface reads execution environment configuration from a map.
+func NewExecutionEnvironmentFromMapInterface(vals map[string]interface{}, ok bool) *ExecutionEnvironment {
+	v := &ExecutionEnvironment{engine: executionEnvironmentDefaultEngine}
+	if ok {
+		v.isInUse = true
+		v.image = vals[executionEnvironmentAttributeImage].(string)
+		if val, ok := vals[executionEnvironmentAttributeEngine]; ok && val.(string) != "" {
+			v.engine = val.(string)
+		}
+		if val, ok := vals[executionEnvironmentAttributeVolumes]; ok {
+			v.volumes = listOfInterfaceToListOfString(val)
+		}
+	}
+	return v
+}
+
+// NewRunInDockerSchema returns a new run in docker schema.
+func NewRunInDockerSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:          schema.TypeSet,
+		Optional:      true,
+		MaxItems:      1,
+		ConflictsWith: []string{"remote", "execution_environment"},
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				executionEnvironmentAttributeImage: &schema.Schema{
+					Type:     schema.TypeString,
+					Required: true,
+				},
+			},
+		},
+	}
+}
+
+// NewRunInDockerFromInterface reads run in docker configuration from Terraform schema.
+// Run in docker is a read-only execution environment run by docker.
+func NewRunInDockerFromInterface(i interface{}, ok bool) *ExecutionEnvironment {
+	if ok {
+		vals := mapFromTypeSetList(i.(*schema.Set).List())
+		return &ExecutionEnvironment{
+			isInUse:  true,
+			image:    vals[executionEnvironmentAttributeImage].(string),
+			engine:   runInDockerEngine,
+			readOnly: true,
+		}
+	}
+	return &ExecutionEnvironment{engine: executionEnvironmentDefaultEngine}
+}
+
+// IsInUse returns true when Ansible runs in the execution environment container.
+func (v *ExecutionEnvironment) IsInUse() bool {
+	return v.isInUse
+}
+
+// Image returns the execution environment image.
+func (v *ExecutionEnvironment) Image() string {
+	return v.image
+}
+
+// Engine returns the container engine running the image, podman or docker.
+func (v *ExecutionEnvironment) Engine() string {
+	return v.engine
+}
+
+// Volumes returns additional volumes mounted in the container, in the format of the container engine.
+func (v *ExecutionEnvironment) Volumes() []string {
+	return v.volumes
+}
+
+// ReadOnly returns true when the directories of the play are mounted read-only, except of the artifact directory,
+// and the working directory is not mounted.
+func (v *ExecutionEnvironment) ReadOnly() bool {
+	return v.readOnly
+}
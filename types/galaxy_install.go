@@ -3,30 +3,40 @@ package types
 import "github.com/hashicorp/terraform/helper/schema"
 
 // ansible-galaxy install -r requirements.yml
+// ansible-galaxy collection install -r requirements.yml -p path
 
 const (
-	ansibleGalaxyAttributeForce        = "force"
-	ansibleGalaxyAttributeIgnoreCerts  = "ignore_certs"
-	ansibleGalaxyAttributeIgnoreErrors = "ignore_errors"
-	ansibleGalaxyAttributeKeepScmMeta  = "keep_scm_meta"
-	ansibleGalaxyAttributeNoDeps       = "no_deps"
-	ansibleGalaxyAttributeRoleFile     = "role_file"
-	ansibleGalaxyAttributeRolesPath    = "roles_path"
-	ansibleGalaxyAttributeServer       = "server"
-	ansibleGalaxyAttributeVerbose      = "verbose"
+	// default values:
+	ansibleGalaxyDefaultType = "role"
+	// attribute names:
+	ansibleGalaxyAttributeCollectionsPath = "collections_path"
+	ansibleGalaxyAttributeForce           = "force"
+	ansibleGalaxyAttributeIgnoreCerts     = "ignore_certs"
+	ansibleGalaxyAttributeIgnoreErrors    = "ignore_errors"
+	ansibleGalaxyAttributeKeepScmMeta     = "keep_scm_meta"
+	ansibleGalaxyAttributeNoDeps          = "no_deps"
+	ansibleGalaxyAttributeRoleFile        = "role_file"
+	ansibleGalaxyAttributeRolesPath       = "roles_path"
+	ansibleGalaxyAttributeServer          = "server"
+	ansibleGalaxyAttributeToken           = "token"
+	ansibleGalaxyAttributeType            = "type"
+	ansibleGalaxyAttributeVerbose         = "verbose"
 )
 
 // GalaxyInstall represents ansible-galaxy settings.
 type GalaxyInstall struct {
-	force        bool
-	ignoreCerts  bool
-	ignoreErrors bool
-	keepScmMeta  bool
-	noDeps       bool
-	roleFile     string
-	rolesPath    string
-	server       string
-	verbose      bool
+	collectionsPath string
+	force           bool
+	ignoreCerts     bool
+	ignoreErrors    bool
+	keepScmMeta     bool
+	noDeps          bool
+	roleFile        string
+	rolesPath       string
+	server          string
+	token           string
+	installType     string
+	verbose         bool
 }
 
 // NewGalaxyInstallSchema returns a new Ansible Galaxy schema for the install operation.
@@ -34,10 +44,14 @@ func NewGalaxyInstallSchema() *schema.Schema {
 	return &schema.Schema{
 		Type:          schema.TypeSet,
 		Optional:      true,
-		ConflictsWith: []string{"plays.module", "plays.playbook"},
+		ConflictsWith: []string{"plays.module", "plays.playbook", "plays.pull"},
 		Elem: &schema.Resource{
 			Schema: map[string]*schema.Schema{
 				// Ansible Galaxy parameters:
+				ansibleGalaxyAttributeCollectionsPath: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
 				ansibleGalaxyAttributeForce: &schema.Schema{
 					Type:     schema.TypeBool,
 					Optional: true,
@@ -77,6 +91,17 @@ func NewGalaxyInstallSchema() *schema.Schema {
 					Type:     schema.TypeString,
 					Optional: true,
 				},
+				ansibleGalaxyAttributeToken: &schema.Schema{
+					Type:      schema.TypeString,
+					Optional:  true,
+					Sensitive: true,
+				},
+				ansibleGalaxyAttributeType: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					Default:      ansibleGalaxyDefaultType,
+					ValidateFunc: vfGalaxyInstallType,
+				},
 				ansibleGalaxyAttributeVerbose: &schema.Schema{
 					Type:     schema.TypeBool,
 					Optional: true,
@@ -90,7 +115,7 @@ func NewGalaxyInstallSchema() *schema.Schema {
 // NewGalaxyInstallFromInterface reads Ansible Galaxy install configuration from Terraform schema.
 func NewGalaxyInstallFromInterface(i interface{}) *GalaxyInstall {
 	vals := mapFromTypeSetList(i.(*schema.Set).List())
-	return &GalaxyInstall{
+	v := &GalaxyInstall{
 		force:        vals[ansibleGalaxyAttributeForce].(bool),
 		ignoreCerts:  vals[ansibleGalaxyAttributeIgnoreCerts].(bool),
 		ignoreErrors: vals[ansibleGalaxyAttributeIgnoreErrors].(bool),
@@ -101,6 +126,31 @@ func NewGalaxyInstallFromInterface(i interface{}) *GalaxyInstall {
 		server:       vals[ansibleGalaxyAttributeServer].(string),
 		verbose:      vals[ansibleGalaxyAttributeVerbose].(bool),
 	}
+	if val, ok := vals[ansibleGalaxyAttributeCollectionsPath]; ok {
+		v.collectionsPath = val.(string)
+	}
+	if val, ok := vals[ansibleGalaxyAttributeType]; ok {
+		v.installType = val.(string)
+	}
+	if val, ok := vals[ansibleGalaxyAttributeToken]; ok {
+		v.token = val.(string)
+	}
+	return v
+}
+
+// CollectionsPath is the ansible-galaxy collection install --collections-path.
+func (v *GalaxyInstall) CollectionsPath() string {
+	return v.collectionsPath
+}
+
+// SetCollectionsPath is used by the remote provisioner to set calculated collections path.
+func (v *GalaxyInstall) SetCollectionsPath(p string) {
+	v.collectionsPath = p
+}
+
+// IsCollection returns true when the requirements file lists collections instead of roles.
+func (v *GalaxyInstall) IsCollection() bool {
+	return v.installType == "collection"
 }
 
 // Force is the ansible-galaxy install --force flag.
@@ -153,6 +203,11 @@ func (v *GalaxyInstall) Server() string {
 	return v.server
 }
 
+// Token is the ansible-galaxy --token, the API key of the server, for example Automation Hub.
+func (v *GalaxyInstall) Token() string {
+	return v.token
+}
+
 // Verbose is the ansible-galaxy --verbose flag.
 func (v *GalaxyInstall) Verbose() bool {
 	return v.verbose
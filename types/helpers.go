@@ -1,16 +1,27 @@
 package types
 
 import (
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	homedir "github.com/mitchellh/go-homedir"
 )
 
+// moduleArgsSpecialCharacters can not appear unquoted in a key=value module argument.
+const moduleArgsSpecialCharacters = " \t\n\"'\\={}[]"
+
 var (
-	becomeMethods = map[string]bool{
+	environmentVariableName = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+	ansibleVersion          = regexp.MustCompile(`^[0-9]+(\.[0-9]+){0,2}$`)
+	lockName                = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	becomeMethods           = map[string]bool{
 		"sudo":   true,
 		"su":     true,
 		"pbrun":  true,
@@ -20,6 +31,134 @@ var (
 		"ksu":    true,
 		"runas":  true,
 	}
+	windowsConnectionTypes = map[string]bool{
+		"":      true,
+		"winrm": true,
+		"psrp":  true,
+	}
+	windowsKinitModes = map[string]bool{
+		"":        true,
+		"managed": true,
+		"manual":  true,
+	}
+	windowsMessageEncryptions = map[string]bool{
+		"":       true,
+		"auto":   true,
+		"always": true,
+		"never":  true,
+	}
+	windowsShellTypes = map[string]bool{
+		"":           true,
+		"powershell": true,
+		"cmd":        true,
+	}
+	// flags set by the provisioner, these can not be given in extra_args:
+	ansibleManagedFlags = map[string]bool{
+		"-i":                     true,
+		"--inventory":            true,
+		"--inventory-file":       true,
+		"-u":                     true,
+		"--user":                 true,
+		"--private-key":          true,
+		"--key-file":             true,
+		"--ssh-extra-args":       true,
+		"--become-password-file": true,
+		"--vault-id":             true,
+		"--vault-password-file":  true,
+		"-k":                     true,
+		"--ask-pass":             true,
+		"-K":                     true,
+		"--ask-become-pass":      true,
+		"--ask-vault-pass":       true,
+	}
+	galaxyInstallTypes = map[string]bool{
+		"role":       true,
+		"collection": true,
+	}
+	stdoutCallbacks = map[string]bool{
+		"":        true,
+		"debug":   true,
+		"default": true,
+		"dense":   true,
+		"json":    true,
+		"minimal": true,
+		"yaml":    true,
+	}
+	strategies = map[string]bool{
+		"":                    true,
+		"debug":               true,
+		"free":                true,
+		"host_pinned":         true,
+		"linear":              true,
+		"mitogen_free":        true,
+		"mitogen_host_pinned": true,
+		"mitogen_linear":      true,
+	}
+	windowsSchemes = map[string]bool{
+		"":      true,
+		"http":  true,
+		"https": true,
+	}
+	lintProfiles = map[string]bool{
+		"":           true,
+		"min":        true,
+		"basic":      true,
+		"moderate":   true,
+		"safety":     true,
+		"shared":     true,
+		"production": true,
+	}
+	lintOnViolations = map[string]bool{
+		"fail": true,
+		"warn": true,
+	}
+	playPhases = map[string]bool{
+		PhaseCreate:  true,
+		PhaseDestroy: true,
+		PhaseAlways:  true,
+	}
+	installPackages = map[string]bool{
+		"ansible":      true,
+		"ansible-core": true,
+	}
+	containerEngines = map[string]bool{
+		"podman": true,
+		"docker": true,
+	}
+	pullSchedulers = map[string]bool{
+		PullSchedulerSystemd: true,
+		PullSchedulerCron:    true,
+	}
+)
+
+// Provisioner phases, the provisioner runs in the create or the destroy phase,
+// a play may run in either or both.
+const (
+	PhaseCreate  = "create"
+	PhaseDestroy = "destroy"
+	PhaseAlways  = "always"
+)
+
+// Executors of the local provisioner plays, ansible-playbook is called directly
+// or driven by ansible-runner.
+const (
+	ExecutorAnsiblePlaybook = "ansible-playbook"
+	ExecutorAnsibleRunner   = "ansible-runner"
+)
+
+// Reactions to an Ansible version out of the range required by the configuration.
+const (
+	OnMismatchFail = "fail"
+	OnMismatchWarn = "warn"
+)
+
+// Log levels of the provisioner messages, the Ansible output is always written.
+// quiet writes warnings only, info the progress of the run, debug also the internal details
+// like the written files, known hosts and host key scans.
+const (
+	LogLevelQuiet = "quiet"
+	LogLevelInfo  = "info"
+	LogLevelDebug = "debug"
 )
 
 // HasMoreThanOneTrue checks if a list of booleans contains more than one true value.
@@ -44,6 +183,156 @@ func vfBecomeMethod(val interface{}, key string) (warns []string, errs []error)
 	return
 }
 
+func vfWindowsConnectionType(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if !windowsConnectionTypes[v] {
+		errs = append(errs, fmt.Errorf("%s is not a valid connection_type", v))
+	}
+	return
+}
+
+func vfWindowsKinitMode(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if !windowsKinitModes[v] {
+		errs = append(errs, fmt.Errorf("%s is not a valid kinit_mode", v))
+	}
+	return
+}
+
+func vfWindowsMessageEncryption(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if !windowsMessageEncryptions[v] {
+		errs = append(errs, fmt.Errorf("%s is not a valid message_encryption", v))
+	}
+	return
+}
+
+func vfWindowsShellType(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if !windowsShellTypes[v] {
+		errs = append(errs, fmt.Errorf("%s is not a valid shell_type", v))
+	}
+	return
+}
+
+// ModuleArgs serializes module arguments to Ansible key=value pairs sorted by key.
+// Lists and maps are serialized to JSON, modules convert JSON strings to structured parameters.
+// Values with characters meaningful to the Ansible key=value parser are double quoted.
+func ModuleArgs(args map[string]interface{}) string {
+	keys := make([]string, 0, len(args))
+	for key := range args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		var value string
+		switch typed := args[key].(type) {
+		case string:
+			value = typed
+		case map[string]interface{}, []interface{}:
+			encoded, _ := json.Marshal(typed)
+			value = string(encoded)
+		default:
+			value = fmt.Sprintf("%v", typed)
+		}
+		if strings.ContainsAny(value, moduleArgsSpecialCharacters) || value == "" {
+			value = strings.Replace(value, "\\", "\\\\", -1)
+			value = strings.Replace(value, "\"", "\\\"", -1)
+			value = strings.Replace(value, "\n", "\\n", -1)
+			value = fmt.Sprintf("\"%s\"", value)
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, value))
+	}
+	return strings.Join(pairs, " ")
+}
+
+// ShellQuote quotes a value for use in a shell command.
+func ShellQuote(value string) string {
+	return fmt.Sprintf("'%s'", strings.Replace(value, "'", "'\\''", -1))
+}
+
+// SplitVaultID splits a label@source vault ID into the label and the password source.
+// The label is empty when the vault ID is a password source only.
+func SplitVaultID(vaultID string) (string, string) {
+	if idx := strings.Index(vaultID, "@"); idx > -1 {
+		return vaultID[:idx], vaultID[idx+1:]
+	}
+	return "", vaultID
+}
+
+// JoinVaultID builds a vault ID from the label and the password source.
+func JoinVaultID(label string, source string) string {
+	if label == "" {
+		return source
+	}
+	return fmt.Sprintf("%s@%s", label, source)
+}
+
+func vfWindowsScheme(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if !windowsSchemes[v] {
+		errs = append(errs, fmt.Errorf("%s is not a valid scheme", v))
+	}
+	return
+}
+
+func vfEnvironment(val interface{}, key string) (warns []string, errs []error) {
+	for name := range val.(map[string]interface{}) {
+		if !environmentVariableName.MatchString(name) {
+			errs = append(errs, fmt.Errorf("%s is not a valid environment variable name", name))
+		}
+	}
+	return
+}
+
+func vfGalaxyInstallType(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if !galaxyInstallTypes[v] {
+		errs = append(errs, fmt.Errorf("%s is not a valid galaxy_install type", v))
+	}
+	return
+}
+
+func vfStdoutCallback(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	// fully qualified collection callbacks, like community.general.yaml, are not validated:
+	if !stdoutCallbacks[v] && !strings.Contains(v, ".") {
+		errs = append(errs, fmt.Errorf("%s is not a valid stdout_callback", v))
+	}
+	return
+}
+
+func vfStrategy(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	// fully qualified collection strategies are not validated:
+	if !strategies[v] && !strings.Contains(v, ".") {
+		errs = append(errs, fmt.Errorf("%s is not a valid strategy", v))
+	}
+	return
+}
+
+func vfJSONObject(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if v == "" {
+		return
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(v), &decoded); err != nil {
+		errs = append(errs, fmt.Errorf("%s must be a JSON object: %s", key, err))
+	}
+	return
+}
+
+func vfExtraArg(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	flag := strings.SplitN(v, "=", 2)[0]
+	if ansibleManagedFlags[flag] {
+		errs = append(errs, fmt.Errorf("%s is managed by the provisioner and can not be used in extra_args", flag))
+	}
+	return
+}
+
 func vfPath(val interface{}, key string) (warns []string, errs []error) {
 	v := val.(string)
 	if strings.Index(v, "${path.module}") > -1 {
@@ -132,3 +421,198 @@ func ResolveDirectory(path string) (string, error) {
 	}
 	return "", fmt.Errorf("Ansible module not found at path: [%s]", path)
 }
+
+func vfCronSchedule(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if v != "" && len(strings.Fields(v)) != 5 {
+		errs = append(errs, fmt.Errorf("%s must have five fields: minute, hour, day, month and weekday, got: %s", key, v))
+	}
+	return
+}
+
+func vfNonNegativeInt(val interface{}, key string) (warns []string, errs []error) {
+	if val.(int) < 0 {
+		errs = append(errs, fmt.Errorf("%s must not be negative, got: %d", key, val.(int)))
+	}
+	return
+}
+
+func vfPositiveInt(val interface{}, key string) (warns []string, errs []error) {
+	if val.(int) < 1 {
+		errs = append(errs, fmt.Errorf("%s must be at least 1, got: %d", key, val.(int)))
+	}
+	return
+}
+
+// VfNonNegativeInt validates an integer of at least 0.
+func VfNonNegativeInt(val interface{}, key string) (warns []string, errs []error) {
+	return vfNonNegativeInt(val, key)
+}
+
+// VfPositiveInt validates an integer of at least 1.
+func VfPositiveInt(val interface{}, key string) (warns []string, errs []error) {
+	return vfPositiveInt(val, key)
+}
+
+// VfLockName validates the name of a run lock, the name is a part of the lock file names.
+func VfLockName(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if !lockName.MatchString(v) || strings.HasPrefix(v, ".") {
+		errs = append(errs, fmt.Errorf("%s must contain letters, digits, '_', '-' and '.' only, and not start with '.', got: %s", key, v))
+	}
+	return
+}
+
+func vfLintProfile(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if !lintProfiles[v] {
+		errs = append(errs, fmt.Errorf("%s is not a valid ansible-lint profile", v))
+	}
+	return
+}
+
+func vfLintOnViolation(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if !lintOnViolations[v] {
+		errs = append(errs, fmt.Errorf("%s must be one of: fail, warn, got: %s", key, v))
+	}
+	return
+}
+
+func vfPercentage(val interface{}, key string) (warns []string, errs []error) {
+	if v := val.(int); v < 0 || v > 100 {
+		errs = append(errs, fmt.Errorf("%s must be between 0 and 100, got: %d", key, v))
+	}
+	return
+}
+
+// SplitChecksum splits an algorithm:digest checksum, the algorithm defaults to sha256.
+func SplitChecksum(checksum string) (string, string) {
+	parts := strings.SplitN(checksum, ":", 2)
+	if len(parts) == 1 {
+		return "sha256", parts[0]
+	}
+	return strings.ToLower(parts[0]), parts[1]
+}
+
+func vfChecksum(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if v == "" {
+		return
+	}
+	algorithm, digest := SplitChecksum(v)
+	lengths := map[string]int{"sha256": 64, "sha512": 128}
+	length, ok := lengths[algorithm]
+	if !ok {
+		errs = append(errs, fmt.Errorf("%s algorithm must be sha256 or sha512, got: %s", key, algorithm))
+		return
+	}
+	if _, err := hex.DecodeString(digest); err != nil || len(digest) != length {
+		errs = append(errs, fmt.Errorf("%s must be a hex encoded %s digest, got: %s", key, algorithm, digest))
+	}
+	return
+}
+
+// VfProvisionerPhase validates the phase the provisioner is executed in.
+func VfProvisionerPhase(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if v != PhaseCreate && v != PhaseDestroy {
+		errs = append(errs, fmt.Errorf("%s must be one of: %s, %s, got: %s", key, PhaseCreate, PhaseDestroy, v))
+	}
+	return
+}
+
+// VfRegexp validates a regular expression.
+func VfRegexp(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if _, err := regexp.Compile(v); err != nil {
+		errs = append(errs, fmt.Errorf("%s must be a valid regular expression, got: %s: %v", key, v, err))
+	}
+	return
+}
+
+// VfEnvironmentAllowlist validates an entry of the environment allowlist, a variable name,
+// optionally ending with * for all variables with the prefix.
+func VfEnvironmentAllowlist(val interface{}, key string) (warns []string, errs []error) {
+	v := strings.TrimSuffix(val.(string), "*")
+	if !environmentVariableName.MatchString(v) {
+		errs = append(errs, fmt.Errorf("%s must be an environment variable name, optionally ending with *, got: %s", key, val.(string)))
+	}
+	return
+}
+
+// VfOnMismatch validates the reaction to an Ansible version out of the required range.
+func VfOnMismatch(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if v != OnMismatchFail && v != OnMismatchWarn {
+		errs = append(errs, fmt.Errorf("%s must be one of: %s, %s, got: %s", key, OnMismatchFail, OnMismatchWarn, v))
+	}
+	return
+}
+
+// VfLogLevel validates the log level of the provisioner messages.
+func VfLogLevel(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if v != LogLevelQuiet && v != LogLevelInfo && v != LogLevelDebug {
+		errs = append(errs, fmt.Errorf("%s must be one of: %s, %s, %s, got: %s", key, LogLevelQuiet, LogLevelInfo, LogLevelDebug, v))
+	}
+	return
+}
+
+// VfExecutor validates the executor of the plays.
+func VfExecutor(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if v != ExecutorAnsiblePlaybook && v != ExecutorAnsibleRunner {
+		errs = append(errs, fmt.Errorf("%s must be one of: %s, %s, got: %s", key, ExecutorAnsiblePlaybook, ExecutorAnsibleRunner, v))
+	}
+	return
+}
+
+func vfPlayPhase(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if !playPhases[v] {
+		errs = append(errs, fmt.Errorf("%s must be one of: %s, %s, %s, got: %s", key, PhaseCreate, PhaseDestroy, PhaseAlways, v))
+	}
+	return
+}
+
+func vfInstallPackage(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if !installPackages[v] {
+		errs = append(errs, fmt.Errorf("%s must be one of: ansible, ansible-core, got: %s", key, v))
+	}
+	return
+}
+
+func vfContainerEngine(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if !containerEngines[v] {
+		errs = append(errs, fmt.Errorf("%s must be one of: podman, docker, got: %s", key, v))
+	}
+	return
+}
+
+func vfPullScheduler(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if !pullSchedulers[v] {
+		errs = append(errs, fmt.Errorf("%s must be one of: systemd, cron, got: %s", key, v))
+	}
+	return
+}
+
+// VfAnsibleVersion validates an Ansible version.
+func VfAnsibleVersion(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if !ansibleVersion.MatchString(v) {
+		errs = append(errs, fmt.Errorf("%s must be a version like 2.9 or 2.15.5, got: %s", key, v))
+	}
+	return
+}
+
+func vfFileMode(val interface{}, key string) (warns []string, errs []error) {
+	v := val.(string)
+	if mode, err := strconv.ParseUint(v, 8, 32); err != nil || mode > 07777 {
+		errs = append(errs, fmt.Errorf("%s must be an octal file mode, for example 0700, got: %s", key, v))
+	}
+	return
+}
@@ -0,0 +1,229 @@
+package types
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// KubernetesSettings represents the Kubernetes Job the plays are executed in.
+type KubernetesSettings struct {
+	isKubernetesInUse bool
+	image             string
+	namespace         string
+	serviceAccount    string
+	secretMounts      []*KubernetesSecretMount
+	kubeconfig        string
+	context           string
+	kubectl           string
+	podRunningTimeout int
+	keepJobs          bool
+}
+
+// KubernetesSecretMount represents a secret mounted in the Job container.
+type KubernetesSecretMount struct {
+	secretName string
+	mountPath  string
+}
+
+const (
+	// default values:
+	kubernetesDefaultNamespace         = "default"
+	kubernetesDefaultKubectl           = "kubectl"
+	kubernetesDefaultPodRunningTimeout = 300
+	// attribute names:
+	kubernetesAttributeImage             = "image"
+	kubernetesAttributeNamespace         = "namespace"
+	kubernetesAttributeServiceAccount    = "service_account"
+	kubernetesAttributeSecretMounts      = "secret_mounts"
+	kubernetesAttributeKubeconfig        = "kubeconfig"
+	kubernetesAttributeContext           = "context"
+	kubernetesAttributeKubectl           = "kubectl"
+	kubernetesAttributePodRunningTimeout = "pod_running_timeout"
+	kubernetesAttributeKeepJobs          = "keep_jobs"
+	kubernetesSecretMountAttributeName   = "secret_name"
+	kubernetesSecretMountAttributePath   = "mount_path"
+)
+
+// NewKubernetesSchema returns a new Kubernetes schema.
+func NewKubernetesSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:          schema.TypeSet,
+		Optional:      true,
+		MaxItems:      1,
+		ConflictsWith: []string{"remote", "tower", "execution_environment", "run_in_docker"},
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				kubernetesAttributeImage: &schema.Schema{
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				kubernetesAttributeNamespace: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+					Default:  kubernetesDefaultNamespace,
+				},
+				kubernetesAttributeServiceAccount: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				kubernetesAttributeSecretMounts: &schema.Schema{
+					Type:     schema.TypeList,
+					Optional: true,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							kubernetesSecretMountAttributeName: &schema.Schema{
+								Type:     schema.TypeString,
+								Required: true,
+							},
+							kubernetesSecretMountAttributePath: &schema.Schema{
+								Type:     schema.TypeString,
+								Required: true,
+							},
+						},
+					},
+				},
+				kubernetesAttributeKubeconfig: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: vfPath,
+				},
+				kubernetesAttributeContext: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				kubernetesAttributeKubectl: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+					Default:  kubernetesDefaultKubectl,
+				},
+				kubernetesAttributePodRunningTimeout: &schema.Schema{
+					Type:         schema.TypeInt,
+					Optional:     true,
+					Default:      kubernetesDefaultPodRunningTimeout,
+					ValidateFunc: vfPositiveInt,
+				},
+				kubernetesAttributeKeepJobs: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+					Default:  false,
+				},
+			},
+		},
+	}
+}
+
+// NewKubernetesSettingsFromInterface reads Kubernetes configuration from Terraform schema.
+func NewKubernetesSettingsFromInterface(i interface{}, ok bool) *KubernetesSettings {
+	if ok {
+		return NewKubernetesSettingsFromMapInterface(mapFromTypeSetList(i.(*schema.Set).List()), ok)
+	}
+	return newDefaultKubernetesSettings()
+}
+
+// NewKubernetesSettingsFromMapInterface reads Kubernetes configuration from a map.
+func NewKubernetesSettingsFromMapInterface(vals map[string]interface{}, ok bool) *KubernetesSettings {
+	v := newDefaultKubernetesSettings()
+	if ok {
+		v.isKubernetesInUse = true
+		v.image = vals[kubernetesAttributeImage].(string)
+		if val, ok := vals[kubernetesAttributeNamespace]; ok && val.(string) != "" {
+			v.namespace = val.(string)
+		}
+		if val, ok := vals[kubernetesAttributeServiceAccount]; ok {
+			v.serviceAccount = val.(string)
+		}
+		if val, ok := vals[kubernetesAttributeSecretMounts]; ok {
+			for _, iface := range val.([]interface{}) {
+				mount := iface.(map[string]interface{})
+				v.secretMounts = append(v.secretMounts, &KubernetesSecretMount{
+					secretName: mount[kubernetesSecretMountAttributeName].(string),
+					mountPath:  mount[kubernetesSecretMountAttributePath].(string),
+				})
+			}
+		}
+		if val, ok := vals[kubernetesAttributeKubeconfig]; ok {
+			v.kubeconfig = val.(string)
+		}
+		if val, ok := vals[kubernetesAttributeContext]; ok {
+			v.context = val.(string)
+		}
+		if val, ok := vals[kubernetesAttributeKubectl]; ok && val.(string) != "" {
+			v.kubectl = val.(string)
+		}
+		if val, ok := vals[kubernetesAttributePodRunningTimeout]; ok && val.(int) > 0 {
+			v.podRunningTimeout = val.(int)
+		}
+		if val, ok := vals[kubernetesAttributeKeepJobs]; ok {
+			v.keepJobs = val.(bool)
+		}
+	}
+	return v
+}
+
+func newDefaultKubernetesSettings() *KubernetesSettings {
+	return &KubernetesSettings{
+		namespace:         kubernetesDefaultNamespace,
+		kubectl:           kubernetesDefaultKubectl,
+		podRunningTimeout: kubernetesDefaultPodRunningTimeout,
+		secretMounts:      make([]*KubernetesSecretMount, 0),
+	}
+}
+
+// IsKubernetesInUse returns true when the plays are executed in Kubernetes Jobs.
+func (v *KubernetesSettings) IsKubernetesInUse() bool {
+	return v.isKubernetesInUse
+}
+
+// Image returns the image of the Job container, containing Ansible and the ssh client.
+func (v *KubernetesSettings) Image() string {
+	return v.image
+}
+
+// Namespace returns the namespace the Jobs are created in.
+func (v *KubernetesSettings) Namespace() string {
+	return v.namespace
+}
+
+// ServiceAccount returns the service account of the Job pods, empty string means the namespace default.
+func (v *KubernetesSettings) ServiceAccount() string {
+	return v.serviceAccount
+}
+
+// SecretMounts returns the secrets mounted in the Job container.
+func (v *KubernetesSettings) SecretMounts() []*KubernetesSecretMount {
+	return v.secretMounts
+}
+
+// Kubeconfig returns the path of the kubeconfig file, empty string means the kubectl default.
+func (v *KubernetesSettings) Kubeconfig() string {
+	return v.kubeconfig
+}
+
+// Context returns the kubeconfig context, empty string means the current context.
+func (v *KubernetesSettings) Context() string {
+	return v.context
+}
+
+// Kubectl returns the kubectl executable.
+func (v *KubernetesSettings) Kubectl() string {
+	return v.kubectl
+}
+
+// PodRunningTimeout returns the number of seconds to wait for the Job pod to start.
+func (v *KubernetesSettings) PodRunningTimeout() int {
+	return v.podRunningTimeout
+}
+
+// KeepJobs returns true when the finished Jobs and their secrets are not deleted.
+func (v *KubernetesSettings) KeepJobs() bool {
+	return v.keepJobs
+}
+
+// SecretName returns the name of the mounted secret.
+func (v *KubernetesSecretMount) SecretName() string {
+	return v.secretName
+}
+
+// MountPath returns the directory the secret is mounted at.
+func (v *KubernetesSecretMount) MountPath() string {
+	return v.mountPath
+}
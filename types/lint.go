@@ -0,0 +1,164 @@
+package types
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+const (
+	// default values:
+	lintDefaultBinary      = "ansible-lint"
+	lintDefaultOnViolation = "fail"
+	// attribute names:
+	lintAttributeEnabled     = "enabled"
+	lintAttributeBinary      = "binary"
+	lintAttributeConfigFile  = "config_file"
+	lintAttributeIgnoreFile  = "ignore_file"
+	lintAttributeProfile     = "profile"
+	lintAttributeWarnList    = "warn_list"
+	lintAttributeOnViolation = "on_violation"
+)
+
+// Lint represents ansible-lint settings of a playbook.
+type Lint struct {
+	enabled     bool
+	binary      string
+	configFile  string
+	ignoreFile  string
+	profile     string
+	warnList    []string
+	onViolation string
+}
+
+// NewLintSchema returns a new ansible-lint schema.
+func NewLintSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeSet,
+		Optional: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				lintAttributeEnabled: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+					Default:  true,
+				},
+				lintAttributeBinary: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+					Default:  lintDefaultBinary,
+				},
+				lintAttributeConfigFile: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: vfPath,
+				},
+				lintAttributeIgnoreFile: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: vfPath,
+				},
+				lintAttributeProfile: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: vfLintProfile,
+				},
+				lintAttributeWarnList: &schema.Schema{
+					Type:     schema.TypeList,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+					Optional: true,
+				},
+				lintAttributeOnViolation: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					Default:      lintDefaultOnViolation,
+					ValidateFunc: vfLintOnViolation,
+				},
+			},
+		},
+	}
+}
+
+// NewLintFromInterface reads ansible-lint configuration from Terraform schema.
+func NewLintFromInterface(i interface{}) *Lint {
+	vals := mapFromTypeSetList(i.(*schema.Set).List())
+	return &Lint{
+		enabled:     vals[lintAttributeEnabled].(bool),
+		binary:      vals[lintAttributeBinary].(string),
+		configFile:  vals[lintAttributeConfigFile].(string),
+		ignoreFile:  vals[lintAttributeIgnoreFile].(string),
+		profile:     vals[lintAttributeProfile].(string),
+		warnList:    listOfInterfaceToListOfString(vals[lintAttributeWarnList].([]interface{})),
+		onViolation: vals[lintAttributeOnViolation].(string),
+	}
+}
+
+// Enabled controls the execution of ansible-lint.
+func (v *Lint) Enabled() bool {
+	return v.enabled
+}
+
+// Binary returns the ansible-lint executable, a name looked up in PATH or a full path.
+func (v *Lint) Binary() string {
+	if v.binary == "" {
+		return lintDefaultBinary
+	}
+	return v.binary
+}
+
+// ConfigFile represents ansible-lint --config-file flag.
+func (v *Lint) ConfigFile() string {
+	return v.configFile
+}
+
+// IgnoreFile represents ansible-lint --ignore-file flag.
+func (v *Lint) IgnoreFile() string {
+	return v.ignoreFile
+}
+
+// Profile represents ansible-lint --profile flag.
+func (v *Lint) Profile() string {
+	return v.profile
+}
+
+// WarnList represents ansible-lint --warn-list flag, rules reported as warnings only.
+func (v *Lint) WarnList() []string {
+	return v.warnList
+}
+
+// WarnOnly returns true when rule violations should be reported without failing the play.
+func (v *Lint) WarnOnly() bool {
+	return v.onViolation == "warn"
+}
+
+// ToCommand serializes the settings to an ansible-lint command checking the playbooks.
+func (v *Lint) ToCommand(playbookPaths []string, rolesPath []string) *Command {
+	command := &Command{}
+	// roles outside of the playbook directory are resolved the same way ansible-playbook does:
+	if len(rolesPath) > 0 {
+		cleanRolesPath := make([]string, 0, len(rolesPath))
+		for _, rp := range rolesPath {
+			cleanRolesPath = append(cleanRolesPath, filepath.Clean(rp))
+		}
+		command.Env(ansibleEnvVarRolesPath, strings.Join(cleanRolesPath, ":"))
+	}
+	command.QuotedArg(v.Binary())
+	if v.ConfigFile() != "" {
+		command.Option("--config-file", v.ConfigFile())
+	}
+	if v.IgnoreFile() != "" {
+		command.Option("--ignore-file", v.IgnoreFile())
+	}
+	if v.Profile() != "" {
+		command.Arg(fmt.Sprintf("--profile=%s", v.Profile()))
+	}
+	if len(v.WarnList()) > 0 {
+		command.Option("--warn-list", strings.Join(v.WarnList(), ","))
+	}
+	for _, playbookPath := range playbookPaths {
+		command.QuotedArg(playbookPath)
+	}
+	return command
+}
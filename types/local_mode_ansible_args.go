@@ -13,3 +13,10 @@ type LocalModeAnsibleArgs struct {
 	BastionPort           int
 	BastionPemFile        string
 }
+
+// RunnerArgs are the ansible-runner directories of a local play executed with ansible-runner.
+type RunnerArgs struct {
+	PrivateDataDirectory string
+	ArtifactDirectory    string
+	Ident                string
+}
@@ -1,6 +1,10 @@
 package types
 
-import "github.com/hashicorp/terraform/helper/schema"
+import (
+	"encoding/json"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
 
 const (
 	// default values:
@@ -8,11 +12,14 @@ const (
 	ansibleModuleDefaultPoll        = 15
 	// attribute names:
 	ansibleModuleAttributeArgs        = "args"
+	ansibleModuleAttributeArgsJSON    = "args_json"
 	ansibleModuleAttributeBackground  = "background"
 	ansibleModuleAttributeHostPattern = "host_pattern"
 	ansibleModuleAttributeOneLine     = "one_line"
 	ansibleModuleAttributePoll        = "poll"
 	ansibleModuleAttributeModule      = "module"
+	ansibleModuleAttributeSequence    = "sequence"
+	ansibleModuleAttributeTree        = "tree"
 )
 
 // Module represents module settings.
@@ -23,6 +30,10 @@ type Module struct {
 	oneLine     bool
 	poll        int
 	module      string
+	sequence    []*Module
+	tree        string
+
+	overrideTree string
 }
 
 // NewModuleSchema return a new Ansible module schema.
@@ -30,7 +41,7 @@ func NewModuleSchema() *schema.Schema {
 	return &schema.Schema{
 		Type:          schema.TypeSet,
 		Optional:      true,
-		ConflictsWith: []string{"plays.galaxy_install", "plays.playbook"},
+		ConflictsWith: []string{"plays.galaxy_install", "plays.playbook", "plays.pull"},
 		Elem: &schema.Resource{
 			Schema: map[string]*schema.Schema{
 				// Ansible parameters:
@@ -39,10 +50,16 @@ func NewModuleSchema() *schema.Schema {
 					Optional: true,
 					Computed: true,
 				},
+				ansibleModuleAttributeArgsJSON: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: vfJSONObject,
+				},
 				ansibleModuleAttributeBackground: &schema.Schema{
-					Type:     schema.TypeInt,
-					Optional: true,
-					Default:  0,
+					Type:         schema.TypeInt,
+					Optional:     true,
+					Default:      0,
+					ValidateFunc: vfNonNegativeInt,
 				},
 				ansibleModuleAttributeHostPattern: &schema.Schema{
 					Type:     schema.TypeString,
@@ -55,14 +72,40 @@ func NewModuleSchema() *schema.Schema {
 					Default:  false,
 				},
 				ansibleModuleAttributePoll: &schema.Schema{
-					Type:     schema.TypeInt,
+					Type:         schema.TypeInt,
+					Optional:     true,
+					Default:      ansibleModuleDefaultPoll,
+					ValidateFunc: vfNonNegativeInt,
+				},
+				ansibleModuleAttributeTree: &schema.Schema{
+					Type:     schema.TypeString,
 					Optional: true,
-					Default:  ansibleModuleDefaultPoll,
 				},
 				// operational:
 				ansibleModuleAttributeModule: &schema.Schema{
 					Type:     schema.TypeString,
-					Required: true,
+					Optional: true,
+				},
+				ansibleModuleAttributeSequence: &schema.Schema{
+					Type:     schema.TypeList,
+					Optional: true,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							ansibleModuleAttributeArgs: &schema.Schema{
+								Type:     schema.TypeMap,
+								Optional: true,
+							},
+							ansibleModuleAttributeArgsJSON: &schema.Schema{
+								Type:         schema.TypeString,
+								Optional:     true,
+								ValidateFunc: vfJSONObject,
+							},
+							ansibleModuleAttributeModule: &schema.Schema{
+								Type:     schema.TypeString,
+								Required: true,
+							},
+						},
+					},
 				},
 			},
 		},
@@ -72,7 +115,7 @@ func NewModuleSchema() *schema.Schema {
 // NewModuleFromInterface reads Module configuration from Terraform schema.
 func NewModuleFromInterface(i interface{}) *Module {
 	vals := mapFromTypeSetList(i.(*schema.Set).List())
-	return &Module{
+	v := &Module{
 		module:      vals[ansibleModuleAttributeModule].(string),
 		args:        mapFromTypeMap(vals[ansibleModuleAttributeArgs]),
 		background:  vals[ansibleModuleAttributeBackground].(int),
@@ -80,14 +123,74 @@ func NewModuleFromInterface(i interface{}) *Module {
 		oneLine:     vals[ansibleModuleAttributeOneLine].(bool),
 		poll:        vals[ansibleModuleAttributePoll].(int),
 	}
+	if val, ok := vals[ansibleModuleAttributeArgsJSON]; ok {
+		v.args = mergeModuleArgsJSON(v.args, val.(string))
+	}
+	if val, ok := vals[ansibleModuleAttributeSequence]; ok {
+		for _, step := range val.([]interface{}) {
+			v.sequence = append(v.sequence, newModuleStepFromMapInterface(step.(map[string]interface{})))
+		}
+	}
+	if val, ok := vals[ansibleModuleAttributeTree]; ok {
+		v.tree = val.(string)
+	}
+	return v
+}
+
+// newModuleStepFromMapInterface reads a sequence step, only the module and the args are set,
+// the remaining settings come from the module block.
+func newModuleStepFromMapInterface(vals map[string]interface{}) *Module {
+	v := &Module{
+		module: vals[ansibleModuleAttributeModule].(string),
+		args:   mapFromTypeMap(vals[ansibleModuleAttributeArgs]),
+	}
+	if val, ok := vals[ansibleModuleAttributeArgsJSON]; ok {
+		v.args = mergeModuleArgsJSON(v.args, val.(string))
+	}
+	return v
 }
 
-// Module returns a module name to run.
+// mergeModuleArgsJSON merges the args_json object into args, structured arguments take precedence.
+func mergeModuleArgsJSON(args map[string]interface{}, argsJSON string) map[string]interface{} {
+	if argsJSON == "" {
+		return args
+	}
+	// validated by the schema:
+	structured := make(map[string]interface{})
+	json.Unmarshal([]byte(argsJSON), &structured)
+	merged := make(map[string]interface{})
+	for key, value := range args {
+		merged[key] = value
+	}
+	for key, value := range structured {
+		merged[key] = value
+	}
+	return merged
+}
+
+// Module returns a module name to run, empty for a module sequence.
 func (v *Module) Module() string {
 	return v.module
 }
 
-// Args represent Ansible --args flag.
+// Steps returns the modules to run in order, the module itself unless a sequence is given.
+func (v *Module) Steps() []*Module {
+	if len(v.sequence) > 0 {
+		return v.sequence
+	}
+	return []*Module{v}
+}
+
+// Modules returns the names of the modules to run in order.
+func (v *Module) Modules() []string {
+	modules := make([]string, 0)
+	for _, step := range v.Steps() {
+		modules = append(modules, step.Module())
+	}
+	return modules
+}
+
+// Args represent Ansible --args flag, args merged with args_json.
 func (v *Module) Args() map[string]interface{} {
 	return v.args
 }
@@ -107,7 +210,20 @@ func (v *Module) OneLine() bool {
 	return v.oneLine
 }
 
-// Poll represents Ansible --poll flag.
+// Poll represents Ansible --poll flag, 0 starts the background job without waiting for it.
 func (v *Module) Poll() int {
 	return v.poll
 }
+
+// Tree represents Ansible --tree flag, the directory the per-host JSON results are written to.
+func (v *Module) Tree() string {
+	if v.overrideTree != "" {
+		return v.overrideTree
+	}
+	return v.tree
+}
+
+// SetOverrideTree is used by the provisioner to point the tree at the artifact directory.
+func (v *Module) SetOverrideTree(path string) {
+	v.overrideTree = path
+}
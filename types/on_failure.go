@@ -0,0 +1,71 @@
+package types
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+const (
+	// attribute names:
+	onFailureAttributeFilePath  = "file_path"
+	onFailureAttributeExtraVars = "extra_vars"
+)
+
+// OnFailure represents a rollback playbook executed when the play fails,
+// with the inventory, connection and credentials of the failed play.
+type OnFailure struct {
+	filePath  string
+	extraVars map[string]interface{}
+
+	// when running a remote provisioner, the path will changed to the remote path:
+	overrideFilePath string
+}
+
+// NewOnFailureSchema returns a new on failure playbook schema.
+func NewOnFailureSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeSet,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				onFailureAttributeFilePath: &schema.Schema{
+					Type:         schema.TypeString,
+					Required:     true,
+					ValidateFunc: vfPath,
+				},
+				onFailureAttributeExtraVars: &schema.Schema{
+					Type:     schema.TypeMap,
+					Optional: true,
+				},
+			},
+		},
+	}
+}
+
+// NewOnFailureFromInterface reads on failure playbook configuration from Terraform schema.
+func NewOnFailureFromInterface(i interface{}) *OnFailure {
+	vals := mapFromTypeSetList(i.(*schema.Set).List())
+	return &OnFailure{
+		filePath:  vals[onFailureAttributeFilePath].(string),
+		extraVars: mapFromTypeMap(vals[onFailureAttributeExtraVars]),
+	}
+}
+
+// FilePath returns a path to the rollback playbook.
+func (v *OnFailure) FilePath() string {
+	if v.overrideFilePath == "" {
+		return v.filePath
+	}
+	return v.overrideFilePath
+}
+
+// ExtraVars returns extra vars of the rollback playbook, merged with the extra vars of the failed play.
+func (v *OnFailure) ExtraVars() map[string]interface{} {
+	return v.extraVars
+}
+
+// SetOverrideFilePath is used by the remote provisioner to reference the correct
+// playbook location after the upload to the provisioned machine.
+func (v *OnFailure) SetOverrideFilePath(path string) {
+	v.overrideFilePath = path
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/hashicorp/terraform/helper/schema"
@@ -15,24 +16,75 @@ import (
 type Play struct {
 	defaults                  *Defaults
 	enabled                   bool
+	ansibleCfg                []*AnsibleCfgSection
+	ansibleCfgFile            string
 	entity                    interface{}
+	name                      string
+	dependsOn                 []string
+	before                    []string
+	after                     []string
 	hosts                     []string
 	groups                    []string
 	become                    bool
 	becomeMethod              string
 	becomeUser                string
+	becomePassword            string
+	becomePasswordFile        string
 	diff                      bool
+	diffOutputFile            string
+	factsOutputFile           string
+	facts                     []string
 	check                     bool
+	checkMode                 bool
+	collectionsPath           []string
+	environment               map[string]interface{}
+	extraArgs                 []string
 	extraVars                 map[string]interface{}
 	forks                     int
 	inventoryFile             string
 	limit                     string
+	parallel                  bool
+	preflight                 *Preflight
+	allowedExitCodes          []int
+	ignoreUnreachable         bool
+	maxFailPercentage         int
+	expectNoChanges           bool
+	verifyConvergence         bool
+	extraVarsJSON             string
+	extraVarsFile             string
+	extraVarsFiles            []string
+	overrideExtraVarsFiles    []string
+	extraVarsVaultFiles       []string
+	overrideExtraVarsVault    []string
+	templateFiles             []string
+	templateVars              map[string]interface{}
+	templateDelimiters        []string
+	phase                     string
+	onFailure                 *OnFailure
+	skipUnchanged             bool
+	force                     bool
+	retries                   int
+	retryDelay                int
+	retryOnExitCodes          []int
+	stdoutCallback            string
+	timeout                   int
+	strategy                  string
+	strategyPlugins           string
+	syntaxCheck               bool
 	vaultID                   []string
 	vaultPasswordFile         string
+	vaultPasswordCommand      string
+	vaultPasswordEnv          string
 	verbose                   bool
 	overrideInventoryFile     string
 	overrideVaultID           []string
 	overrideVaultPasswordFile string
+	overrideBinDirectory      string
+	ansiblePlaybookBinary     string
+	ansibleBinary             string
+	ansibleGalaxyBinary       string
+	virtualenvPath            string
+	profileTasks              bool
 }
 
 const (
@@ -40,30 +92,87 @@ const (
 	playDefaultBecomeMethod = "sudo"
 	playDefaultBecomeUser   = "root"
 	playDefaultForks        = 5
+	playDefaultRetryDelay   = 10
+	profileTasksCallbacks   = "profile_tasks,timer"
 	// environment variable names:
 	ansibleEnvVarForceColor       = "ANSIBLE_FORCE_COLOR"
 	ansibleEnvVarRolesPath        = "ANSIBLE_ROLES_PATH"
 	ansibleEnvVarDefaultRolesPath = "DEFAULT_ROLES_PATH"
 	ansibleEnvVarRemoteTmp        = "ANSIBLE_REMOTE_TMP"
+	ansibleEnvVarCollectionsPath  = "ANSIBLE_COLLECTIONS_PATH"
+	ansibleEnvVarCollectionsPaths = "ANSIBLE_COLLECTIONS_PATHS"
+	ansibleEnvVarStdoutCallback   = "ANSIBLE_STDOUT_CALLBACK"
+	ansibleEnvVarLoadCallbacks    = "ANSIBLE_LOAD_CALLBACK_PLUGINS"
+	ansibleEnvVarStrategy         = "ANSIBLE_STRATEGY"
+	ansibleEnvVarStrategyPlugins  = "ANSIBLE_STRATEGY_PLUGINS"
+	envVarVirtualEnv              = "VIRTUAL_ENV"
+	ansibleEnvVarCallbacksEnabled = "ANSIBLE_CALLBACKS_ENABLED"
+	ansibleEnvVarWhitelist        = "ANSIBLE_CALLBACK_WHITELIST"
 	// attribute names:
 	playAttributeEnabled           = "enabled"
+	playAttributeName              = "name"
+	playAttributeDependsOn         = "depends_on"
+	playAttributeAnsibleCfg        = "ansible_cfg"
 	playAttributePlaybook          = "playbook"
 	playAttributeModule            = "module"
 	playAttributeGalaxyInstall     = "galaxy_install"
+	playAttributePull              = "pull"
+	playAttributeBefore            = "before"
+	playAttributeAfter             = "after"
 	playAttributeHosts             = "hosts"
 	playAttributeGroups            = "groups"
 	playAttributeBecome            = "become"
 	playAttributeBecomeMethod      = "become_method"
 	playAttributeBecomeUser        = "become_user"
+	playAttributeBecomePassword    = "become_password"
 	playAttributeDiff              = "diff"
+	playAttributeDiffOutputFile    = "diff_output_file"
+	playAttributeFactsOutputFile   = "facts_output_file"
+	playAttributeFacts             = "facts"
 	playAttributeCheck             = "check"
+	playAttributeCheckMode         = "check_mode"
+	playAttributeCollectionsPath   = "collections_path"
+	playAttributeEnvironment       = "environment"
+	playAttributeExtraArgs         = "extra_args"
 	playAttributeExtraVars         = "extra_vars"
 	playAttributeForks             = "forks"
 	playAttributeInventoryFile     = "inventory_file"
 	playAttributeLimit             = "limit"
+	playAttributeParallel          = "parallel"
+	playAttributePreflight         = "preflight"
+	playAttributeAllowedExitCodes  = "allowed_exit_codes"
+	playAttributeIgnoreUnreachable = "ignore_unreachable"
+	playAttributeMaxFailPercentage = "max_fail_percentage"
+	playAttributeExpectNoChanges   = "expect_no_changes"
+	playAttributeVerifyConvergence = "verify_convergence"
+	playAttributeExtraVarsJSON     = "extra_vars_json"
+	playAttributeExtraVarsFiles    = "extra_vars_files"
+	playAttributeExtraVarsVault    = "extra_vars_vault_files"
+	playAttributeTemplateFiles     = "template_files"
+	playAttributeTemplateVars      = "template_vars"
+	playAttributeTemplateDelims    = "template_delimiters"
+	playAttributePhase             = "phase"
+	playAttributeOnFailure         = "on_failure"
+	playAttributeSkipUnchanged     = "skip_unchanged"
+	playAttributeForce             = "force"
+	playAttributeRetries           = "retries"
+	playAttributeRetryDelay        = "retry_delay"
+	playAttributeRetryOnExitCodes  = "retry_on_exit_codes"
+	playAttributeStdoutCallback    = "stdout_callback"
+	playAttributeStrategy          = "strategy"
+	playAttributeStrategyPlugins   = "strategy_plugins"
+	playAttributeSyntaxCheck       = "syntax_check"
+	playAttributeTimeout           = "timeout"
 	playAttributeVaultID           = "vault_id"
 	playAttributeVaultPasswordFile = "vault_password_file"
+	playAttributeVaultPasswordCmd  = "vault_password_command"
+	playAttributeVaultPasswordEnv  = "vault_password_env"
 	playAttributeVerbose           = "verbose"
+	playAttributePlaybookBinary    = "ansible_playbook_binary"
+	playAttributeAnsibleBinary     = "ansible_binary"
+	playAttributeGalaxyBinary      = "ansible_galaxy_binary"
+	playAttributeVirtualenvPath    = "virtualenv_path"
+	playAttributeProfileTasks      = "profile_tasks"
 )
 
 // NewPlaySchema returns a new play schema.
@@ -79,9 +188,30 @@ func NewPlaySchema() *schema.Schema {
 					Optional: true,
 					Default:  true,
 				},
+				playAttributeName: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				playAttributeDependsOn: &schema.Schema{
+					Type:     schema.TypeList,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+					Optional: true,
+				},
+				playAttributeAnsibleCfg:    NewAnsibleCfgSchema(),
 				playAttributePlaybook:      NewPlaybookSchema(),
 				playAttributeModule:        NewModuleSchema(),
 				playAttributeGalaxyInstall: NewGalaxyInstallSchema(),
+				playAttributePull:          NewPullSchema(),
+				playAttributeBefore: &schema.Schema{
+					Type:     schema.TypeList,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+					Optional: true,
+				},
+				playAttributeAfter: &schema.Schema{
+					Type:     schema.TypeList,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+					Optional: true,
+				},
 				playAttributeHosts: &schema.Schema{
 					Type:     schema.TypeList,
 					Elem:     &schema.Schema{Type: schema.TypeString},
@@ -107,12 +237,51 @@ func NewPlaySchema() *schema.Schema {
 					Optional: true,
 					Default:  playDefaultBecomeUser,
 				},
+				playAttributeBecomePassword: &schema.Schema{
+					Type:      schema.TypeString,
+					Optional:  true,
+					Sensitive: true,
+				},
 				playAttributeDiff: &schema.Schema{
 					Type:     schema.TypeBool,
 					Optional: true,
 				},
+				playAttributeDiffOutputFile: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				playAttributeFactsOutputFile: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				playAttributeFacts: &schema.Schema{
+					Type:     schema.TypeList,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+					Optional: true,
+				},
 				playAttributeCheck: &schema.Schema{
-					Type:     schema.TypeBool,
+					Type:          schema.TypeBool,
+					Optional:      true,
+					ConflictsWith: []string{"plays.check_mode"},
+				},
+				playAttributeCheckMode: &schema.Schema{
+					Type:          schema.TypeBool,
+					Optional:      true,
+					ConflictsWith: []string{"plays.check"},
+				},
+				playAttributeCollectionsPath: &schema.Schema{
+					Type:     schema.TypeList,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+					Optional: true,
+				},
+				playAttributeEnvironment: &schema.Schema{
+					Type:         schema.TypeMap,
+					Optional:     true,
+					ValidateFunc: vfEnvironment,
+				},
+				playAttributeExtraArgs: &schema.Schema{
+					Type:     schema.TypeList,
+					Elem:     &schema.Schema{Type: schema.TypeString, ValidateFunc: vfExtraArg},
 					Optional: true,
 				},
 				playAttributeExtraVars: &schema.Schema{
@@ -123,7 +292,6 @@ func NewPlaySchema() *schema.Schema {
 				playAttributeForks: &schema.Schema{
 					Type:     schema.TypeInt,
 					Optional: true,
-					Default:  playDefaultForks,
 				},
 				playAttributeInventoryFile: &schema.Schema{
 					Type:         schema.TypeString,
@@ -134,6 +302,138 @@ func NewPlaySchema() *schema.Schema {
 					Type:     schema.TypeString,
 					Optional: true,
 				},
+				playAttributeParallel: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
+				playAttributePreflight: NewPreflightSchema(),
+				playAttributeAllowedExitCodes: &schema.Schema{
+					Type:     schema.TypeList,
+					Elem:     &schema.Schema{Type: schema.TypeInt},
+					Optional: true,
+				},
+				playAttributeIgnoreUnreachable: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
+				playAttributeMaxFailPercentage: &schema.Schema{
+					Type:         schema.TypeInt,
+					Optional:     true,
+					ValidateFunc: vfPercentage,
+				},
+				playAttributeExtraVarsJSON: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: vfJSONObject,
+				},
+				playAttributeExtraVarsFiles: &schema.Schema{
+					Type:     schema.TypeList,
+					Elem:     &schema.Schema{Type: schema.TypeString, ValidateFunc: vfPath},
+					Optional: true,
+				},
+				playAttributeExtraVarsVault: &schema.Schema{
+					Type:     schema.TypeList,
+					Elem:     &schema.Schema{Type: schema.TypeString, ValidateFunc: vfPath},
+					Optional: true,
+				},
+				playAttributeTemplateFiles: &schema.Schema{
+					Type:     schema.TypeList,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+					Optional: true,
+				},
+				playAttributeTemplateVars: &schema.Schema{
+					Type:     schema.TypeMap,
+					Optional: true,
+				},
+				playAttributeTemplateDelims: &schema.Schema{
+					Type:     schema.TypeList,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+					Optional: true,
+					MinItems: 2,
+					MaxItems: 2,
+				},
+				playAttributePhase: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					Default:      PhaseCreate,
+					ValidateFunc: vfPlayPhase,
+				},
+				playAttributeOnFailure: NewOnFailureSchema(),
+				playAttributeSkipUnchanged: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
+				playAttributeForce: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
+				playAttributeExpectNoChanges: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
+				playAttributeVerifyConvergence: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
+				playAttributeRetries: &schema.Schema{
+					Type:         schema.TypeInt,
+					Optional:     true,
+					ValidateFunc: vfNonNegativeInt,
+				},
+				playAttributeRetryDelay: &schema.Schema{
+					Type:         schema.TypeInt,
+					Optional:     true,
+					Default:      playDefaultRetryDelay,
+					ValidateFunc: vfNonNegativeInt,
+				},
+				playAttributeRetryOnExitCodes: &schema.Schema{
+					Type:     schema.TypeList,
+					Elem:     &schema.Schema{Type: schema.TypeInt},
+					Optional: true,
+				},
+				playAttributeStdoutCallback: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: vfStdoutCallback,
+				},
+				playAttributeStrategy: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: vfStrategy,
+				},
+				playAttributeStrategyPlugins: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				playAttributePlaybookBinary: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				playAttributeAnsibleBinary: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				playAttributeGalaxyBinary: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				playAttributeVirtualenvPath: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				playAttributeSyntaxCheck: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
+				playAttributeProfileTasks: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
+				playAttributeTimeout: &schema.Schema{
+					Type:         schema.TypeInt,
+					Optional:     true,
+					ValidateFunc: vfNonNegativeInt,
+				},
 				playAttributeVaultID: &schema.Schema{
 					Type:          schema.TypeList,
 					Elem:          &schema.Schema{Type: schema.TypeString},
@@ -146,6 +446,17 @@ func NewPlaySchema() *schema.Schema {
 					ValidateFunc:  vfPath,
 					ConflictsWith: []string{"plays.vault_id"},
 				},
+				playAttributeVaultPasswordCmd: &schema.Schema{
+					Type:          schema.TypeString,
+					Optional:      true,
+					ValidateFunc:  vfPath,
+					ConflictsWith: []string{"plays.vault_id", "plays.vault_password_file", "plays.vault_password_env"},
+				},
+				playAttributeVaultPasswordEnv: &schema.Schema{
+					Type:          schema.TypeString,
+					Optional:      true,
+					ConflictsWith: []string{"plays.vault_id", "plays.vault_password_file", "plays.vault_password_command"},
+				},
 				playAttributeVerbose: &schema.Schema{
 					Type:     schema.TypeBool,
 					Optional: true,
@@ -188,6 +499,175 @@ func NewPlayFromMapInterface(vals map[string]interface{}, defaults *Defaults) *P
 		v.entity = NewModuleFromInterface(vals[playAttributeModule])
 	} else if vals[playAttributeGalaxyInstall].(*schema.Set).GoString() != emptySet {
 		v.entity = NewGalaxyInstallFromInterface(vals[playAttributeGalaxyInstall])
+	} else if val, ok := vals[playAttributePull]; ok && val.(*schema.Set).GoString() != emptySet {
+		v.entity = NewPullFromInterface(val)
+	}
+
+	if val, ok := vals[playAttributeAnsibleCfg]; ok {
+		for _, section := range val.([]interface{}) {
+			v.ansibleCfg = append(v.ansibleCfg, NewAnsibleCfgSectionFromMapInterface(section.(map[string]interface{})))
+		}
+	}
+
+	if val, ok := vals[playAttributeCollectionsPath]; ok {
+		v.collectionsPath = listOfInterfaceToListOfString(val.([]interface{}))
+	}
+
+	if val, ok := vals[playAttributeEnvironment]; ok {
+		v.environment = mapFromTypeMap(val)
+	}
+
+	if val, ok := vals[playAttributeExtraArgs]; ok {
+		v.extraArgs = listOfInterfaceToListOfString(val.([]interface{}))
+	}
+
+	if val, ok := vals[playAttributeBecomePassword]; ok {
+		v.becomePassword = val.(string)
+	}
+
+	if val, ok := vals[playAttributeDiffOutputFile]; ok {
+		v.diffOutputFile = val.(string)
+	}
+
+	if val, ok := vals[playAttributeFactsOutputFile]; ok {
+		v.factsOutputFile = val.(string)
+	}
+
+	if val, ok := vals[playAttributeFacts]; ok {
+		v.facts = listOfInterfaceToListOfString(val.([]interface{}))
+	}
+
+	if val, ok := vals[playAttributeCheckMode]; ok {
+		v.checkMode = val.(bool)
+	}
+
+	if val, ok := vals[playAttributeStdoutCallback]; ok {
+		v.stdoutCallback = val.(string)
+	}
+
+	if val, ok := vals[playAttributeStrategy]; ok {
+		v.strategy = val.(string)
+	}
+	if val, ok := vals[playAttributeStrategyPlugins]; ok {
+		v.strategyPlugins = val.(string)
+	}
+
+	if val, ok := vals[playAttributePlaybookBinary]; ok {
+		v.ansiblePlaybookBinary = val.(string)
+	}
+	if val, ok := vals[playAttributeAnsibleBinary]; ok {
+		v.ansibleBinary = val.(string)
+	}
+	if val, ok := vals[playAttributeGalaxyBinary]; ok {
+		v.ansibleGalaxyBinary = val.(string)
+	}
+	if val, ok := vals[playAttributeVirtualenvPath]; ok {
+		v.virtualenvPath = val.(string)
+	}
+
+	if val, ok := vals[playAttributeSyntaxCheck]; ok {
+		v.syntaxCheck = val.(bool)
+	}
+
+	if val, ok := vals[playAttributeProfileTasks]; ok {
+		v.profileTasks = val.(bool)
+	}
+
+	if val, ok := vals[playAttributeTimeout]; ok {
+		v.timeout = val.(int)
+	}
+
+	if val, ok := vals[playAttributeVaultPasswordCmd]; ok {
+		v.vaultPasswordCommand = val.(string)
+	}
+	if val, ok := vals[playAttributeVaultPasswordEnv]; ok {
+		v.vaultPasswordEnv = val.(string)
+	}
+
+	if val, ok := vals[playAttributePreflight]; ok {
+		if val.(*schema.Set).Len() > 0 {
+			v.preflight = NewPreflightFromInterface(val)
+		}
+	}
+
+	if val, ok := vals[playAttributeParallel]; ok {
+		v.parallel = val.(bool)
+	}
+
+	if val, ok := vals[playAttributeAllowedExitCodes]; ok {
+		for _, code := range val.([]interface{}) {
+			v.allowedExitCodes = append(v.allowedExitCodes, code.(int))
+		}
+	}
+	if val, ok := vals[playAttributeIgnoreUnreachable]; ok {
+		v.ignoreUnreachable = val.(bool)
+	}
+	if val, ok := vals[playAttributeMaxFailPercentage]; ok {
+		v.maxFailPercentage = val.(int)
+	}
+	if val, ok := vals[playAttributeExtraVarsJSON]; ok {
+		v.extraVarsJSON = val.(string)
+	}
+	if val, ok := vals[playAttributeExtraVarsFiles]; ok {
+		v.extraVarsFiles = listOfInterfaceToListOfString(val.([]interface{}))
+	}
+	if val, ok := vals[playAttributeExtraVarsVault]; ok {
+		v.extraVarsVaultFiles = listOfInterfaceToListOfString(val.([]interface{}))
+	}
+	if val, ok := vals[playAttributeTemplateFiles]; ok {
+		v.templateFiles = listOfInterfaceToListOfString(val.([]interface{}))
+	}
+	if val, ok := vals[playAttributeTemplateVars]; ok {
+		v.templateVars = mapFromTypeMap(val)
+	}
+	if val, ok := vals[playAttributeTemplateDelims]; ok {
+		v.templateDelimiters = listOfInterfaceToListOfString(val.([]interface{}))
+	}
+	if val, ok := vals[playAttributePhase]; ok {
+		v.phase = val.(string)
+	}
+	if val, ok := vals[playAttributeOnFailure]; ok {
+		if val.(*schema.Set).Len() > 0 {
+			v.onFailure = NewOnFailureFromInterface(val)
+		}
+	}
+	if val, ok := vals[playAttributeSkipUnchanged]; ok {
+		v.skipUnchanged = val.(bool)
+	}
+	if val, ok := vals[playAttributeForce]; ok {
+		v.force = val.(bool)
+	}
+	if val, ok := vals[playAttributeExpectNoChanges]; ok {
+		v.expectNoChanges = val.(bool)
+	}
+	if val, ok := vals[playAttributeVerifyConvergence]; ok {
+		v.verifyConvergence = val.(bool)
+	}
+
+	if val, ok := vals[playAttributeRetries]; ok {
+		v.retries = val.(int)
+	}
+	if val, ok := vals[playAttributeRetryDelay]; ok {
+		v.retryDelay = val.(int)
+	}
+	if val, ok := vals[playAttributeRetryOnExitCodes]; ok {
+		for _, code := range val.([]interface{}) {
+			v.retryOnExitCodes = append(v.retryOnExitCodes, code.(int))
+		}
+	}
+
+	if val, ok := vals[playAttributeName]; ok {
+		v.name = val.(string)
+	}
+	if val, ok := vals[playAttributeDependsOn]; ok {
+		v.dependsOn = listOfInterfaceToListOfString(val.([]interface{}))
+	}
+
+	if val, ok := vals[playAttributeBefore]; ok {
+		v.before = listOfInterfaceToListOfString(val.([]interface{}))
+	}
+	if val, ok := vals[playAttributeAfter]; ok {
+		v.after = listOfInterfaceToListOfString(val.([]interface{}))
 	}
 
 	if val, ok := vals[playAttributeHosts]; ok {
@@ -206,6 +686,112 @@ func (v *Play) Enabled() bool {
 	return v.enabled
 }
 
+// Phase returns the provisioner phase the play runs in: create, destroy or always.
+func (v *Play) Phase() string {
+	if v.phase == "" {
+		return PhaseCreate
+	}
+	return v.phase
+}
+
+// RunsInPhase returns true when the play runs in the given provisioner phase.
+func (v *Play) RunsInPhase(phase string) bool {
+	return v.Phase() == PhaseAlways || v.Phase() == phase
+}
+
+// Disable is used by the provisioner to skip plays not running in the current phase.
+func (v *Play) Disable() {
+	v.enabled = false
+}
+
+// OnFailure returns the rollback playbook settings, nil when not configured.
+func (v *Play) OnFailure() *OnFailure {
+	return v.onFailure
+}
+
+// OnFailurePlay returns a play executing the rollback playbook with the inventory, connection,
+// become and vault settings of this play, nil when the play has no rollback playbook.
+// Hooks, retries, assertions and templates of this play do not apply to the rollback play.
+func (v *Play) OnFailurePlay() *Play {
+	if v.onFailure == nil {
+		return nil
+	}
+	rollback := *v
+	rollback.entity = &Playbook{filePath: v.onFailure.FilePath()}
+	rollback.onFailure = nil
+	rollback.before = nil
+	rollback.after = nil
+	rollback.retries = 0
+	rollback.allowedExitCodes = nil
+	rollback.ignoreUnreachable = false
+	rollback.maxFailPercentage = 0
+	rollback.expectNoChanges = false
+	rollback.syntaxCheck = false
+	rollback.templateFiles = nil
+	rollback.extraVarsFile = ""
+	rollback.extraVars = make(map[string]interface{})
+	for key, value := range v.ExtraVars() {
+		rollback.extraVars[key] = value
+	}
+	for key, value := range v.onFailure.ExtraVars() {
+		rollback.extraVars[key] = value
+	}
+	return &rollback
+}
+
+// SkipUnchanged returns true when the play is skipped if its inputs did not change since the last successful run.
+func (v *Play) SkipUnchanged() bool {
+	return v.skipUnchanged
+}
+
+// Force returns true when the play is executed even if its inputs did not change.
+func (v *Play) Force() bool {
+	return v.force
+}
+
+// Name returns the name other plays refer to in depends_on.
+func (v *Play) Name() string {
+	return v.name
+}
+
+// DependsOn returns names of plays which must succeed before the play is executed.
+// When empty, the play is executed in the list order.
+func (v *Play) DependsOn() []string {
+	return v.dependsOn
+}
+
+// Before returns local shell commands executed before the play.
+func (v *Play) Before() []string {
+	return v.before
+}
+
+// After returns local shell commands executed after the play, regardless of the play result.
+func (v *Play) After() []string {
+	return v.after
+}
+
+// AnsibleCfg returns sections of the ansible.cfg generated for the play.
+func (v *Play) AnsibleCfg() []*AnsibleCfgSection {
+	return v.ansibleCfg
+}
+
+// AnsibleCfgContents returns the contents of the ansible.cfg generated for the play,
+// empty string when the play does not require a generated configuration.
+func (v *Play) AnsibleCfgContents() string {
+	return renderAnsibleCfg(v.AnsibleCfg())
+}
+
+// AnsibleCfgFile returns the path of the generated ansible.cfg, exported as ANSIBLE_CONFIG.
+func (v *Play) AnsibleCfgFile() string {
+	return v.ansibleCfgFile
+}
+
+// SetAnsibleCfgFile is used by the provisioner to reference the generated ansible.cfg
+// after writing it to a temporary file.
+func (v *Play) SetAnsibleCfgFile(path string) {
+	v.ansibleCfgFile = path
+}
+
 // Entity to run. A Playbook or Module.
 func (v *Play) Entity() interface{} {
 	return v.entity
@@ -260,14 +846,50 @@ func (v *Play) BecomeUser() string {
 	return "" // will be obtained from connection info
 }
 
+// BecomePassword returns the password for privilege escalation.
+// The password is never put on the command line, it is written to a temporary file
+// passed with --become-password-file.
+func (v *Play) BecomePassword() string {
+	return v.becomePassword
+}
+
+// BecomePasswordFile represents Ansible --become-password-file flag.
+func (v *Play) BecomePasswordFile() string {
+	return v.becomePasswordFile
+}
+
+// SetBecomePasswordFile is used by the provisioner to reference the temporary file
+// containing the become password.
+func (v *Play) SetBecomePasswordFile(path string) {
+	v.becomePasswordFile = path
+}
+
 // Diff represents Ansible --diff flag.
 func (v *Play) Diff() bool {
 	return v.diff
 }
 
+// DiffOutputFile returns a path of the file the output of a diff play is captured to.
+// A relative path is resolved under the artifact directory. Used only with local provisioning and when diff is enabled.
+func (v *Play) DiffOutputFile() string {
+	return v.diffOutputFile
+}
+
+// FactsOutputFile returns a path of the file the facts of the hosts are written to after the play.
+// A relative path is resolved under the artifact directory. Used only with local provisioning.
+func (v *Play) FactsOutputFile() string {
+	return v.factsOutputFile
+}
+
+// Facts returns the patterns of the facts written to the facts output file, all facts when empty.
+func (v *Play) Facts() []string {
+	return v.facts
+}
+
 // Check represents Ansible --check flag.
+// Set with either check or check_mode.
 func (v *Play) Check() bool {
-	return v.check
+	return v.check || v.checkMode
 }
 
 // ExtraVars represents Ansible --extra-vars flag.
@@ -281,6 +903,126 @@ func (v *Play) ExtraVars() map[string]interface{} {
 	return make(map[string]interface{})
 }
 
+// ExtraVarsContents returns the JSON serialized extra vars of the play, empty when there are none.
+// Values of extra_vars_json keep their types and take precedence over extra_vars.
+func (v *Play) ExtraVarsContents() ([]byte, error) {
+	extraVars := make(map[string]interface{})
+	for key, value := range v.ExtraVars() {
+		extraVars[key] = value
+	}
+	if v.extraVarsJSON != "" {
+		decoder := json.NewDecoder(strings.NewReader(v.extraVarsJSON))
+		decoder.UseNumber()
+		var typed map[string]interface{}
+		if err := decoder.Decode(&typed); err != nil {
+			return nil, fmt.Errorf("extra_vars_json must be a JSON object: %v", err)
+		}
+		for key, value := range typed {
+			extraVars[key] = value
+		}
+	}
+	if len(extraVars) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(extraVars)
+}
+
+// ExtraVarsFile returns the path of the file with the serialized extra vars, passed as --extra-vars @file.
+func (v *Play) ExtraVarsFile() string {
+	return v.extraVarsFile
+}
+
+// SetExtraVarsFile is used by the provisioner to reference the temporary file
+// containing the serialized extra vars.
+func (v *Play) SetExtraVarsFile(path string) {
+	v.extraVarsFile = path
+}
+
+// ExtraVarsFiles returns the variable files passed to Ansible with repeated --extra-vars @file flags.
+func (v *Play) ExtraVarsFiles() []string {
+	if len(v.overrideExtraVarsFiles) > 0 {
+		return v.overrideExtraVarsFiles
+	}
+	return v.extraVarsFiles
+}
+
+// SetOverrideExtraVarsFiles is used by remote provisioner when extra vars files are defined.
+// After uploading the files to the machine, the paths are updated to the remote paths.
+func (v *Play) SetOverrideExtraVarsFiles(paths []string) {
+	v.overrideExtraVarsFiles = paths
+}
+
+// ExtraVarsVaultFiles returns the ansible-vault encrypted variable files passed to Ansible
+// with repeated --extra-vars @file flags, decrypted by Ansible with the vault credentials of the play.
+func (v *Play) ExtraVarsVaultFiles() []string {
+	if len(v.overrideExtraVarsVault) > 0 {
+		return v.overrideExtraVarsVault
+	}
+	return v.extraVarsVaultFiles
+}
+
+// SetOverrideExtraVarsVaultFiles is used by remote provisioner when encrypted extra vars files are defined.
+// After uploading the files to the machine, the paths are updated to the remote paths.
+func (v *Play) SetOverrideExtraVarsVaultFiles(paths []string) {
+	v.overrideExtraVarsVault = paths
+}
+
+// HasVaultCredentials returns true when the play has a vault ID or any source of the vault password.
+func (v *Play) HasVaultCredentials() bool {
+	return len(v.VaultID()) > 0 || v.VaultPasswordFile() != "" || v.VaultPasswordCommand() != "" || v.VaultPasswordEnv() != ""
+}
+
+// TemplateFiles returns the playbook directory files and extra vars files rendered
+// with the template variables before the play is executed.
+func (v *Play) TemplateFiles() []string {
+	return v.templateFiles
+}
+
+// TemplateVars returns the variables available to the template files.
+func (v *Play) TemplateVars() map[string]interface{} {
+	if v.templateVars == nil {
+		return make(map[string]interface{})
+	}
+	return v.templateVars
+}
+
+// TemplateDelimiters returns the left and right template action delimiters,
+// different from the Jinja2 delimiters used by Ansible.
+func (v *Play) TemplateDelimiters() (string, string) {
+	if len(v.templateDelimiters) == 2 {
+		return v.templateDelimiters[0], v.templateDelimiters[1]
+	}
+	return "[[", "]]"
+}
+
+// CollectionsPath returns directories Ansible looks up collections in,
+// exported as ANSIBLE_COLLECTIONS_PATH and ANSIBLE_COLLECTIONS_PATHS.
+func (v *Play) CollectionsPath() []string {
+	if len(v.collectionsPath) > 0 {
+		return v.collectionsPath
+	}
+	if v.defaults.collectionsPathIsSet {
+		return v.defaults.collectionsPath
+	}
+	return make([]string, 0)
+}
+
+// Environment returns environment variables exported for the Ansible command.
+func (v *Play) Environment() map[string]interface{} {
+	if len(v.environment) > 0 {
+		return v.environment
+	}
+	if v.defaults.environmentIsSet {
+		return v.defaults.environment
+	}
+	return make(map[string]interface{})
+}
+
+// ExtraArgs returns arguments appended to the Ansible command, each argument is quoted.
+func (v *Play) ExtraArgs() []string {
+	return v.extraArgs
+}
+
 // Forks represents Ansible --forks flag.
 func (v *Play) Forks() int {
 	if v.forks > 0 {
@@ -317,6 +1059,157 @@ func (v *Play) Limit() string {
 	return ""
 }
 
+// AllowedExitCodes returns non-zero exit codes of the play command which are not treated as a failure.
+func (v *Play) AllowedExitCodes() []int {
+	return v.allowedExitCodes
+}
+
+// IgnoreUnreachable returns true when unreachable hosts, exit code 4, should not fail the provisioner.
+func (v *Play) IgnoreUnreachable() bool {
+	return v.ignoreUnreachable
+}
+
+// MaxFailPercentage returns the percentage of hosts allowed to fail or be unreachable
+// without failing the provisioner, 0 means none.
+func (v *Play) MaxFailPercentage() int {
+	return v.maxFailPercentage
+}
+
+// ExpectNoChanges returns true when the play must not report changed tasks.
+func (v *Play) ExpectNoChanges() bool {
+	return v.expectNoChanges
+}
+
+// VerifyConvergence returns true when a play expected to make no changes is re-run once
+// after reporting changes, and only the second run must not report changes.
+func (v *Play) VerifyConvergence() bool {
+	return v.verifyConvergence
+}
+
+// Parallel marks the play as independent of its neighbours, consecutive parallel plays are executed concurrently.
+func (v *Play) Parallel() bool {
+	return v.parallel
+}
+
+// Preflight returns the pre-flight hook of the play, nil when not configured.
+func (v *Play) Preflight() *Preflight {
+	return v.preflight
+}
+
+// Retries returns how many times a failed play command is retried before the provisioner fails.
+func (v *Play) Retries() int {
+	return v.retries
+}
+
+// RetryDelay returns the number of seconds to wait between retries.
+func (v *Play) RetryDelay() int {
+	return v.retryDelay
+}
+
+// RetryOnExitCodes returns exit codes a failed play command is retried on.
+// When empty, every failure is retried.
+func (v *Play) RetryOnExitCodes() []int {
+	return v.retryOnExitCodes
+}
+
+// SyntaxCheck controls if ansible-playbook --syntax-check is executed before a playbook play.
+// Enabled when set on the play or in the defaults.
+func (v *Play) SyntaxCheck() bool {
+	if v.syntaxCheck {
+		return true
+	}
+	return v.defaults.syntaxCheckIsSet
+}
+
+// ProfileTasks controls if the profile_tasks and timer callbacks time the tasks of the play.
+// Set on the play or in the defaults.
+func (v *Play) ProfileTasks() bool {
+	if v.profileTasks {
+		return true
+	}
+	return v.defaults.profileTasksIsSet
+}
+
+// ToSyntaxCheckCommands returns the play commands with ansible-playbook --syntax-check,
+// nil when the play is not a playbook play.
+func (v *Play) ToSyntaxCheckCommands(commands Commands) Commands {
+	if _, ok := v.Entity().(*Playbook); !ok || len(commands) != 1 {
+		return nil
+	}
+	return Commands{commands[0].WithArgs("--syntax-check")}
+}
+
+// ToPlanCommands returns the play commands listing hosts and tasks instead of executing the play,
+// nil when the play can not be listed.
+func (v *Play) ToPlanCommands(commands Commands) Commands {
+	if len(commands) != 1 {
+		return nil
+	}
+	switch entity := v.Entity().(type) {
+	case *Playbook:
+		return Commands{commands[0].WithArgs("--list-hosts", "--list-tasks")}
+	case *Module:
+		// the hosts of a chained module sequence can not be listed without running the earlier steps:
+		if len(entity.Steps()) > 1 {
+			return nil
+		}
+		return Commands{commands[0].WithArgs("--list-hosts")}
+	default:
+		return nil
+	}
+}
+
+// Timeout returns the number of seconds a single play command may run before it is killed,
+// 0 means no timeout.
+func (v *Play) Timeout() int {
+	return v.timeout
+}
+
+// RolesPath returns role directories of a playbook play, appended to ANSIBLE_ROLES_PATH.
+// The playbook roles_path takes precedence over the defaults.
+func (v *Play) RolesPath() []string {
+	if entity, ok := v.Entity().(*Playbook); ok && len(entity.RolesPath()) > 0 {
+		return entity.RolesPath()
+	}
+	if v.defaults.rolesPathIsSet {
+		return v.defaults.rolesPath
+	}
+	return make([]string, 0)
+}
+
+// StdoutCallback returns the Ansible stdout callback plugin used for the play output.
+func (v *Play) StdoutCallback() string {
+	if v.stdoutCallback != "" {
+		return v.stdoutCallback
+	}
+	if v.defaults.stdoutCallbackIsSet {
+		return v.defaults.stdoutCallback
+	}
+	return ""
+}
+
+// Strategy returns the Ansible strategy plugin used for the play.
+func (v *Play) Strategy() string {
+	if v.strategy != "" {
+		return v.strategy
+	}
+	if v.defaults.strategyIsSet {
+		return v.defaults.strategy
+	}
+	return ""
+}
+
+// StrategyPlugins returns a directory with additional strategy plugins, for example Mitogen.
+func (v *Play) StrategyPlugins() string {
+	if v.strategyPlugins != "" {
+		return v.strategyPlugins
+	}
+	if v.defaults.strategyPluginsIsSet {
+		return v.defaults.strategyPlugins
+	}
+	return ""
+}
+
 // VaultPasswordFile represents Ansible --vault-password-file flag.
 func (v *Play) VaultPasswordFile() string {
 	if v.overrideVaultPasswordFile != "" {
@@ -331,7 +1224,20 @@ func (v *Play) VaultPasswordFile() string {
 	return ""
 }
 
-// VaultID represents Ansible --vault-id flag.
+// VaultPasswordCommand returns a path to an executable printing the vault password.
+// The provisioner writes the output to a temporary vault password file.
+func (v *Play) VaultPasswordCommand() string {
+	return v.vaultPasswordCommand
+}
+
+// VaultPasswordEnv returns a name of the environment variable holding the vault password.
+// The provisioner writes the value to a temporary vault password file.
+func (v *Play) VaultPasswordEnv() string {
+	return v.vaultPasswordEnv
+}
+
+// VaultID represents Ansible --vault-id flag, repeated for every vault ID.
+// A vault ID is a path to a password file or script, optionally prefixed with a label: label@source.
 func (v *Play) VaultID() []string {
 	if len(v.overrideVaultID) > 0 {
 		return v.overrideVaultID
@@ -371,6 +1277,77 @@ func (v *Play) SetOverrideVaultPasswordPath(path string) {
 	v.overrideVaultPasswordFile = path
 }
 
+// SetOverrideBinDirectory is used by the provisioner when Ansible is installed to a directory
+// which is not on the PATH, such as a virtualenv. Ansible binaries are executed from the directory.
+func (v *Play) SetOverrideBinDirectory(path string) {
+	v.overrideBinDirectory = path
+}
+
+// AnsiblePlaybookBinary returns the path of the ansible-playbook executable, empty for a PATH lookup.
+func (v *Play) AnsiblePlaybookBinary() string {
+	if v.ansiblePlaybookBinary != "" {
+		return v.ansiblePlaybookBinary
+	}
+	if v.defaults.ansiblePlaybookBinaryIsSet {
+		return v.defaults.ansiblePlaybookBinary
+	}
+	return ""
+}
+
+// AnsibleBinary returns the path of the ansible executable, empty for a PATH lookup.
+func (v *Play) AnsibleBinary() string {
+	if v.ansibleBinary != "" {
+		return v.ansibleBinary
+	}
+	if v.defaults.ansibleBinaryIsSet {
+		return v.defaults.ansibleBinary
+	}
+	return ""
+}
+
+// AnsibleGalaxyBinary returns the path of the ansible-galaxy executable, empty for a PATH lookup.
+func (v *Play) AnsibleGalaxyBinary() string {
+	if v.ansibleGalaxyBinary != "" {
+		return v.ansibleGalaxyBinary
+	}
+	if v.defaults.ansibleGalaxyBinaryIsSet {
+		return v.defaults.ansibleGalaxyBinary
+	}
+	return ""
+}
+
+// VirtualenvPath returns the virtualenv the Ansible commands run with, the Ansible executables are called
+// from its bin directory and the bin directory is prepended to PATH.
+func (v *Play) VirtualenvPath() string {
+	if v.virtualenvPath != "" {
+		return v.virtualenvPath
+	}
+	if v.defaults.virtualenvPathIsSet {
+		return v.defaults.virtualenvPath
+	}
+	return ""
+}
+
+// binary appends the Ansible executable to call: the path given for the executable,
+// the executable in the virtualenv or in the bin directory when one is given, otherwise looked up in PATH.
+func (v *Play) binary(command *Command, name string) *Command {
+	explicit := map[string]string{
+		"ansible-playbook": v.AnsiblePlaybookBinary(),
+		"ansible":          v.AnsibleBinary(),
+		"ansible-galaxy":   v.AnsibleGalaxyBinary(),
+	}[name]
+	if explicit != "" {
+		return command.QuotedArg(explicit)
+	}
+	if v.VirtualenvPath() != "" {
+		return command.QuotedArg(filepath.Join(v.VirtualenvPath(), "bin", name))
+	}
+	if v.overrideBinDirectory != "" {
+		return command.QuotedArg(filepath.Join(v.overrideBinDirectory, name))
+	}
+	return command.Arg(name)
+}
+
 func (v *Play) defaultRolePaths() []string {
 	if val, ok := os.LookupEnv(ansibleEnvVarRolesPath); ok {
 		return strings.Split(val, ":")
@@ -381,204 +1358,478 @@ func (v *Play) defaultRolePaths() []string {
 	return []string{}
 }
 
-// ToCommand serializes the play to an executable Ansible command.
-func (v *Play) ToCommand(ansibleArgs LocalModeAnsibleArgs) (string, error) {
+// environmentPrefix returns a command with the environment variables of every Ansible command of the play.
+func (v *Play) environmentPrefix() *Command {
+
+	command := (&Command{}).env(ansibleEnvVarForceColor, "true", "true")
 
-	command := fmt.Sprintf("%s=true", ansibleEnvVarForceColor)
+	// the virtualenv is activated, it takes precedence over other Ansible installations
+	// for the executables and the Python interpreter Ansible calls:
+	if v.VirtualenvPath() != "" {
+		command.Env(envVarVirtualEnv, v.VirtualenvPath()).prependPath(filepath.Join(v.VirtualenvPath(), "bin"))
+	}
 
 	if envVarVal, ok := os.LookupEnv(ansibleEnvVarRemoteTmp); ok {
-		command = fmt.Sprintf("%s %s=\"%s\"", command, ansibleEnvVarRemoteTmp, envVarVal)
+		command.env(ansibleEnvVarRemoteTmp, envVarVal, fmt.Sprintf("\"%s\"", envVarVal))
+	}
+
+	// generated ansible.cfg:
+	if v.AnsibleCfgFile() != "" {
+		command.Env(ansibleEnvVarConfig, v.AnsibleCfgFile())
+	}
+
+	// collections path, the singular name is used by Ansible 2.10 and newer,
+	// collections shipped with the playbook take precedence:
+	collectionsPaths := v.CollectionsPath()
+	if entity, ok := v.Entity().(*Playbook); ok && len(entity.CollectionsPath()) > 0 {
+		collectionsPaths = append(append([]string{}, entity.CollectionsPath()...), collectionsPaths...)
+	}
+	if len(collectionsPaths) > 0 {
+		collectionsPath := strings.Join(collectionsPaths, ":")
+		command.Env(ansibleEnvVarCollectionsPath, collectionsPath).Env(ansibleEnvVarCollectionsPaths, collectionsPath)
+	}
+
+	// stdout callback, ad-hoc commands load callback plugins only when asked to:
+	if v.StdoutCallback() != "" {
+		command.env(ansibleEnvVarStdoutCallback, v.StdoutCallback(), v.StdoutCallback()).env(ansibleEnvVarLoadCallbacks, "1", "1")
+	}
+
+	// task timing, the setting was renamed in Ansible 2.11:
+	if v.ProfileTasks() {
+		command.env(ansibleEnvVarCallbacksEnabled, profileTasksCallbacks, profileTasksCallbacks).
+			env(ansibleEnvVarWhitelist, profileTasksCallbacks, profileTasksCallbacks)
 	}
 
+	// strategy:
+	if v.Strategy() != "" {
+		command.env(ansibleEnvVarStrategy, v.Strategy(), v.Strategy())
+	}
+	if v.StrategyPlugins() != "" {
+		command.Env(ansibleEnvVarStrategyPlugins, v.StrategyPlugins())
+	}
+
+	// environment:
+	v.environmentAssignments(command)
+
+	return command
+}
+
+// ToCommand serializes the play to an executable Ansible command line.
+func (v *Play) ToCommand(ansibleArgs LocalModeAnsibleArgs) (string, error) {
+	commands, err := v.ToCommands(ansibleArgs)
+	if err != nil {
+		return "", err
+	}
+	return commands.String(), nil
+}
+
+// ToCommands serializes the play to the Ansible commands executing it.
+func (v *Play) ToCommands(ansibleArgs LocalModeAnsibleArgs) (Commands, error) {
+
+	command := v.environmentPrefix()
+
 	// entity to call:
 	switch entity := v.Entity().(type) {
 	case *Playbook:
 
-		// handling role directories:
-		rolePaths := v.defaultRolePaths()
-		for _, rp := range entity.RolesPath() {
-			rolePaths = append(rolePaths, filepath.Clean(rp))
-		}
+		v.binary(v.playbookPrefix(command), "ansible-playbook")
+		playbookArguments(command, entity, entity.FilePaths())
 
-		// Only set ANSIBLE_ROLES_PATH when not empty.
-		if len(rolePaths) > 0 {
-			command = fmt.Sprintf("%s %s=%s", command, ansibleEnvVarRolesPath, strings.Join(rolePaths, ":"))
+		if err := v.appendSharedArguments(command, ansibleArgs); err != nil {
+			return nil, err
 		}
-
-		command = fmt.Sprintf("%s ansible-playbook %s", command, entity.FilePath())
-
-		// force handlers:
-		if entity.ForceHandlers() {
-			command = fmt.Sprintf("%s --force-handlers", command)
-		}
-		// skip tags:
-		if len(entity.SkipTags()) > 0 {
-			command = fmt.Sprintf("%s --skip-tags='%s'", command, strings.Join(entity.SkipTags(), ","))
-		}
-		// start at task:
-		if entity.StartAtTask() != "" {
-			command = fmt.Sprintf("%s --start-at-task='%s'", command, entity.StartAtTask())
-		}
-		// tags:
-		if len(entity.Tags()) > 0 {
-			command = fmt.Sprintf("%s --tags='%s'", command, strings.Join(entity.Tags(), ","))
-		}
-
-		return v.appendSharedArguments(command, ansibleArgs)
+		return Commands{command}, nil
 
 	case *Module:
 
-		hostPattern := entity.HostPattern()
-		if hostPattern == "" {
-			hostPattern = ansibleModuleDefaultHostPattern
-		}
-		command = fmt.Sprintf("%s ansible %s --module-name='%s'", command, hostPattern, entity.module)
+		return v.moduleCommands(entity, ansibleArgs)
+
+	case *GalaxyInstall:
 
-		if entity.Background() > 0 {
-			command = fmt.Sprintf("%s --background=%d", command, entity.Background())
-			if entity.Poll() > 0 {
-				command = fmt.Sprintf("%s --poll=%d", command, entity.Poll())
+		if entity.IsCollection() {
+			v.binary(command, "ansible-galaxy").Arg("collection").Arg("install").Option("--requirements-file", entity.RoleFile())
+			// force:
+			if entity.Force() {
+				command.Arg("--force")
 			}
-		}
-		// module args:
-		if len(entity.Args()) > 0 {
-			args := make([]string, 0)
-			for mak, mav := range entity.Args() {
-				args = append(args, fmt.Sprintf("%s=%+v", mak, mav))
+			// ignore certs:
+			if entity.IgnoreCerts() {
+				command.Arg("--ignore-certs")
 			}
-			command = fmt.Sprintf("%s --args=\"%s\"", command, strings.Join(args, " "))
-		}
-		// one line:
-		if entity.OneLine() {
-			command = fmt.Sprintf("%s --one-line", command)
+			// ignore errors:
+			if entity.IgnoreErrors() {
+				command.Arg("--ignore-errors")
+			}
+			// no deps:
+			if entity.NoDeps() {
+				command.Arg("--no-deps")
+			}
+			// verbose:
+			if entity.Verbose() {
+				command.Arg("--verbose")
+			}
+			// collections path:
+			if entity.CollectionsPath() != "" {
+				command.Option("--collections-path", entity.CollectionsPath())
+			}
+			// API server:
+			if len(entity.Server()) > 0 {
+				command.Option("--server", entity.Server())
+			}
+			// API token:
+			if len(entity.Token()) > 0 {
+				command.Option("--token", entity.Token())
+			}
+			return Commands{command}, nil
 		}
 
-		return v.appendSharedArguments(command, ansibleArgs)
-
-	case *GalaxyInstall:
-
-		command = fmt.Sprintf("%s ansible-galaxy install --role-file='%s'", command, entity.RoleFile())
+		v.binary(command, "ansible-galaxy").Arg("install").Option("--role-file", entity.RoleFile())
 		// force:
 		if entity.Force() {
-			command = fmt.Sprintf("%s --force", command)
+			command.Arg("--force")
 		}
 		// ignore certs:
 		if entity.IgnoreCerts() {
-			command = fmt.Sprintf("%s --ignore-certs", command)
+			command.Arg("--ignore-certs")
 		}
 		// ignore errors:
 		if entity.IgnoreErrors() {
-			command = fmt.Sprintf("%s --ignore-errors", command)
+			command.Arg("--ignore-errors")
 		}
 		// keep scm meta:
 		if entity.KeepScmMeta() {
-			command = fmt.Sprintf("%s --keep-scm-meta", command)
+			command.Arg("--keep-scm-meta")
 		}
 		// no deps:
 		if entity.NoDeps() {
-			command = fmt.Sprintf("%s --no-deps", command)
+			command.Arg("--no-deps")
 		}
 		// no deps:
 		if entity.Verbose() {
-			command = fmt.Sprintf("%s --verbose", command)
+			command.Arg("--verbose")
 		}
 		// roles path:
 		if len(entity.RolesPath()) > 0 {
-			command = fmt.Sprintf("%s --roles-path='%s'", command, entity.RolesPath())
+			command.Option("--roles-path", entity.RolesPath())
 		}
 		// API server:
 		if len(entity.Server()) > 0 {
-			command = fmt.Sprintf("%s --server='%s'", command, entity.Server())
+			command.Option("--server", entity.Server())
+		}
+		// API token:
+		if len(entity.Token()) > 0 {
+			command.Option("--token", entity.Token())
 		}
 
 		// Galaxy Install does not support shared arguments
-		return command, nil
+		return Commands{command}, nil
+
+	case *Pull:
+
+		return v.pullCommands(entity, ansibleArgs)
 
 	default:
 
-		return "", errors.New("Unsupported entity type")
+		return nil, errors.New("Unsupported entity type")
 
 	}
 }
 
-// ToLocalCommand serializes the play to an executable local provisioning Ansible command.
+// playbookPrefix appends the roles path of the play to the environment of a playbook command.
+func (v *Play) playbookPrefix(command *Command) *Command {
+
+	// handling role directories:
+	rolePaths := v.defaultRolePaths()
+	for _, rp := range v.RolesPath() {
+		rolePaths = append(rolePaths, filepath.Clean(rp))
+	}
+
+	// Only set ANSIBLE_ROLES_PATH when not empty.
+	if len(rolePaths) > 0 {
+		joined := strings.Join(rolePaths, ":")
+		command.env(ansibleEnvVarRolesPath, joined, joined)
+	}
+	return command
+}
+
+// playbookArguments appends the playbook files and the playbook specific options.
+func playbookArguments(command *Command, entity *Playbook, filePaths []string) *Command {
+
+	for _, filePath := range filePaths {
+		command.Arg(filePath)
+	}
+
+	// flush cache:
+	if entity.FlushCache() {
+		command.Arg("--flush-cache")
+	}
+	// force handlers:
+	if entity.ForceHandlers() {
+		command.Arg("--force-handlers")
+	}
+	// skip tags:
+	if len(entity.SkipTags()) > 0 {
+		command.Option("--skip-tags", strings.Join(entity.SkipTags(), ","))
+	}
+	// start at task:
+	if entity.StartAtTask() != "" {
+		command.Option("--start-at-task", entity.StartAtTask())
+	}
+	// step:
+	if entity.Step() {
+		command.Arg("--step")
+	}
+	// tags:
+	if len(entity.Tags()) > 0 {
+		command.Option("--tags", strings.Join(entity.Tags(), ","))
+	}
+
+	return command
+}
+
+// ToLocalCommand serializes the play to an executable local provisioning Ansible command line.
 func (v *Play) ToLocalCommand(ansibleArgs LocalModeAnsibleArgs, ansibleSSHSettings *AnsibleSSHSettings) (string, error) {
-	baseCommand, err := v.ToCommand(ansibleArgs)
+	commands, err := v.ToLocalCommands(ansibleArgs, ansibleSSHSettings)
 	if err != nil {
 		return "", err
 	}
+	return commands.String(), nil
+}
 
-	switch v.Entity().(type) {
-	case *GalaxyInstall:
-		return baseCommand, nil
+// ToLocalCommands serializes the play to the local provisioning Ansible commands executing it.
+func (v *Play) ToLocalCommands(ansibleArgs LocalModeAnsibleArgs, ansibleSSHSettings *AnsibleSSHSettings) (Commands, error) {
+	commands, err := v.ToCommands(ansibleArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := v.Entity().(*GalaxyInstall); ok {
+		return commands, nil
+	}
+	// every chained command of a module sequence or a pull needs the connection arguments:
+	for _, command := range commands {
+		v.toCommandArguments(command, ansibleArgs, ansibleSSHSettings)
+	}
+	return commands, nil
+}
+
+// ToVersionCommand returns the command printing the version of the ansible-playbook the play runs with.
+func (v *Play) ToVersionCommand() *Command {
+	return v.binary(v.environmentPrefix(), "ansible-playbook").Arg("--version")
+}
+
+// ToLocalRunnerCommand serializes a playbook play to an ansible-runner command executing the same
+// ansible-playbook command line in the private data directory. The playbook options, the shared
+// and the connection arguments are passed with --cmdline, the environment is inherited by ansible-runner.
+func (v *Play) ToLocalRunnerCommand(ansibleArgs LocalModeAnsibleArgs, ansibleSSHSettings *AnsibleSSHSettings, runnerArgs RunnerArgs) (*Command, error) {
+	entity, ok := v.Entity().(*Playbook)
+	if !ok {
+		return nil, errors.New("ansible-runner executes playbook plays only")
+	}
+	filePaths := entity.FilePaths()
+	if len(filePaths) == 0 {
+		return nil, errors.New("ansible-runner requires a playbook file")
+	}
+
+	// ansible-runner splits the command line of the arguments itself:
+	cmdline := playbookArguments(&Command{}, entity, filePaths[1:])
+	if err := v.appendSharedArguments(cmdline, ansibleArgs); err != nil {
+		return nil, err
+	}
+	v.toCommandArguments(cmdline, ansibleArgs, ansibleSSHSettings)
+
+	return v.binary(v.playbookPrefix(v.environmentPrefix()), "ansible-runner").
+		Arg("run").
+		QuotedArg(runnerArgs.PrivateDataDirectory).
+		Option("--ident", runnerArgs.Ident).
+		Option("--artifact-dir", runnerArgs.ArtifactDirectory).
+		Option("--playbook", filePaths[0]).
+		Option("--cmdline", cmdline.argsString()), nil
+}
+
+// moduleCommands serializes every step of a module play to an ad-hoc command,
+// the steps run in order against the same inventory and the first failure stops the sequence.
+func (v *Play) moduleCommands(entity *Module, ansibleArgs LocalModeAnsibleArgs) (Commands, error) {
+	commands := make(Commands, 0)
+	for _, step := range entity.Steps() {
+		command := v.moduleCommand(entity, step)
+		if err := v.appendSharedArguments(command, ansibleArgs); err != nil {
+			return nil, err
+		}
+		commands = append(commands, command)
+	}
+	return commands, nil
+}
+
+// moduleCommand serializes a single ad-hoc module run of a step, without the shared arguments.
+// The step is the module block itself unless the block holds a sequence.
+func (v *Play) moduleCommand(entity *Module, step *Module) *Command {
+
+	hostPattern := entity.HostPattern()
+	if hostPattern == "" {
+		hostPattern = ansibleModuleDefaultHostPattern
+	}
+	command := v.binary(v.environmentPrefix(), "ansible").Arg(hostPattern).Option("--module-name", step.Module())
+
+	// background, poll 0 is passed such that the job is not awaited over the connection:
+	if entity.Background() > 0 {
+		command.Arg(fmt.Sprintf("--background=%d", entity.Background())).Arg(fmt.Sprintf("--poll=%d", entity.Poll()))
+	}
+	// module args:
+	if len(step.Args()) > 0 {
+		command.Option("--args", ModuleArgs(step.Args()))
 	}
+	// one line:
+	if entity.OneLine() {
+		command.Arg("--one-line")
+	}
+	// tree:
+	if entity.Tree() != "" {
+		command.Option("--tree", entity.Tree())
+	}
+
+	return command
+}
 
-	return fmt.Sprintf("%s %s", baseCommand, v.toCommandArguments(ansibleArgs, ansibleSSHSettings)), nil
+// pullCommands serializes the ansible-pull settings to ad-hoc commands executed against the play inventory:
+// the cron module installs the scheduled runs, the shell module runs ansible-pull immediately.
+func (v *Play) pullCommands(entity *Pull, ansibleArgs LocalModeAnsibleArgs) (Commands, error) {
+	commands := make(Commands, 0)
+	if entity.Schedule() != "" {
+		command := v.binary(v.environmentPrefix(), "ansible").Arg(ansibleModuleDefaultHostPattern).
+			Option("--module-name", "cron").Option("--args", ModuleArgs(entity.ToCronArgs()))
+		if err := v.appendSharedArguments(command, ansibleArgs); err != nil {
+			return nil, err
+		}
+		commands = append(commands, command)
+	}
+	if entity.RunNow() {
+		command := v.binary(v.environmentPrefix(), "ansible").Arg(ansibleModuleDefaultHostPattern).
+			Option("--module-name", "shell").Option("--args", entity.ToPullCommand(false))
+		if err := v.appendSharedArguments(command, ansibleArgs); err != nil {
+			return nil, err
+		}
+		commands = append(commands, command)
+	}
+	if len(commands) == 0 {
+		return nil, errors.New("pull requires a schedule or run_now")
+	}
+	return commands, nil
 }
 
-func (v *Play) appendSharedArguments(command string, ansibleArgs LocalModeAnsibleArgs) (string, error) {
+// ToLocalPreflightCommand serializes the pre-flight hook to an executable local provisioning Ansible command.
+func (v *Play) ToLocalPreflightCommand(preflight *Preflight, ansibleArgs LocalModeAnsibleArgs, ansibleSSHSettings *AnsibleSSHSettings) *Command {
+	command := &Command{}
+	if v.AnsibleCfgFile() != "" {
+		command.Env(ansibleEnvVarConfig, v.AnsibleCfgFile())
+	}
+	v.environmentAssignments(command)
+	return v.toCommandArguments(preflight.ToCommand(command, v.InventoryFile()), ansibleArgs, ansibleSSHSettings)
+}
+
+// ToLocalFactsCommand serializes gathering the facts of the play hosts to an executable local provisioning
+// Ansible command, the facts of every host are written to a file named after the host in the tree directory.
+func (v *Play) ToLocalFactsCommand(tree string, ansibleArgs LocalModeAnsibleArgs, ansibleSSHSettings *AnsibleSSHSettings) *Command {
+	setup := &Preflight{enabled: true, module: factsModule}
+	return v.ToLocalPreflightCommand(setup, ansibleArgs, ansibleSSHSettings).Option("--tree", tree)
+}
+
+// environmentAssignments sets the environment of the play on the command, sorted by name.
+func (v *Play) environmentAssignments(command *Command) *Command {
+	environment := v.Environment()
+	names := make([]string, 0, len(environment))
+	for name := range environment {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		command.Env(name, fmt.Sprintf("%v", environment[name]))
+	}
+	return command
+}
+
+func (v *Play) appendSharedArguments(command *Command, ansibleArgs LocalModeAnsibleArgs) error {
 
 	// inventory file:
-	command = fmt.Sprintf("%s --inventory-file='%s'", command, v.InventoryFile())
-	
+	command.Option("--inventory-file", v.InventoryFile())
+
 	// become:
 	if v.Become() {
-		command = fmt.Sprintf("%s --become", command)
-		command = fmt.Sprintf("%s --become-method='%s'", command, v.BecomeMethod())
+		command.Arg("--become")
+		command.Option("--become-method", v.BecomeMethod())
 		if v.BecomeUser() != "" {
-			command = fmt.Sprintf("%s --become-user='%s'", command, v.BecomeUser())
+			command.Option("--become-user", v.BecomeUser())
 		} else {
-			command = fmt.Sprintf("%s --become-user='%s'", command, ansibleArgs.Username)
+			command.Option("--become-user", ansibleArgs.Username)
+		}
+		if v.BecomePasswordFile() != "" {
+			command.Option("--become-password-file", v.BecomePasswordFile())
 		}
 	}
 	// diff:
 	if v.Diff() {
-		command = fmt.Sprintf("%s --diff", command)
+		command.Arg("--diff")
 	}
 	// check:
 	if v.Check() {
-		command = fmt.Sprintf("%s --check", command)
+		command.Arg("--check")
 	}
-	// extra vars:
-	if len(v.ExtraVars()) > 0 {
-		extraVars, err := json.Marshal(v.ExtraVars())
+	// extra vars, files first, such that inline vars take precedence:
+	for _, extraVarsFile := range v.ExtraVarsFiles() {
+		command.Option("--extra-vars", "@"+filepath.Clean(extraVarsFile))
+	}
+	for _, extraVarsFile := range v.ExtraVarsVaultFiles() {
+		command.Option("--extra-vars", "@"+filepath.Clean(extraVarsFile))
+	}
+	if v.ExtraVarsFile() != "" {
+		command.Option("--extra-vars", "@"+v.ExtraVarsFile())
+	} else {
+		extraVars, err := v.ExtraVarsContents()
 		if err != nil {
-			return "", err
+			return err
+		}
+		if len(extraVars) > 0 {
+			command.Option("--extra-vars", string(extraVars))
 		}
-		command = fmt.Sprintf("%s --extra-vars='%s'", command, string(extraVars))
 	}
 	// forks:
 	if v.Forks() > 0 {
-		command = fmt.Sprintf("%s --forks=%d", command, v.Forks())
+		command.Arg(fmt.Sprintf("--forks=%d", v.Forks()))
 	}
 	// limit
 	if v.Limit() != "" {
-		command = fmt.Sprintf("%s --limit='%s'", command, v.Limit())
+		command.Option("--limit", v.Limit())
 	}
 
 	if len(v.VaultID()) > 0 {
 		for _, vaultID := range v.VaultID() {
-			command = fmt.Sprintf("%s --vault-id='%s'", command, filepath.Clean(vaultID))
+			label, source := SplitVaultID(vaultID)
+			command.Option("--vault-id", JoinVaultID(label, filepath.Clean(source)))
 		}
 	} else {
 		// vault password file:
 		if v.VaultPasswordFile() != "" {
-			command = fmt.Sprintf("%s --vault-password-file='%s'", command, v.VaultPasswordFile())
+			command.Option("--vault-password-file", v.VaultPasswordFile())
 		}
 	}
 
 	// verbose:
 	if v.Verbose() {
-		command = fmt.Sprintf("%s --verbose", command)
+		command.Arg("--verbose")
 	}
 
-	return command, nil
+	// extra args:
+	for _, arg := range v.ExtraArgs() {
+		command.QuotedArg(arg)
+	}
+
+	return nil
 }
 
-func (v *Play) toCommandArguments(ansibleArgs LocalModeAnsibleArgs, ansibleSSHSettings *AnsibleSSHSettings) string {
-	args := fmt.Sprintf("--user='%s'", ansibleArgs.Username)
+func (v *Play) toCommandArguments(command *Command, ansibleArgs LocalModeAnsibleArgs, ansibleSSHSettings *AnsibleSSHSettings) *Command {
+	command.Option("--user", ansibleArgs.Username)
 	if ansibleArgs.PemFile != "" {
-		args = fmt.Sprintf("%s --private-key='%s'", args, ansibleArgs.PemFile)
+		command.Option("--private-key", ansibleArgs.PemFile)
 	}
 
 	sshExtraAgrsOptions := make([]string, 0)
@@ -619,7 +1870,5 @@ func (v *Play) toCommandArguments(ansibleArgs LocalModeAnsibleArgs, ansibleSSHSe
 		}
 	}
 
-	args = fmt.Sprintf("%s --ssh-extra-args='%s'", args, strings.Join(sshExtraAgrsOptions, " "))
-
-	return args
+	return command.Option("--ssh-extra-args", strings.Join(sshExtraAgrsOptions, " "))
 }
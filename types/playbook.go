@@ -1,30 +1,63 @@
 package types
 
 import (
+	"strings"
+
 	"github.com/hashicorp/terraform/helper/schema"
 )
 
 const (
+	ansiblePlaybookAttributeFlushCache    = "flush_cache"
 	ansiblePlaybookAttributeForceHandlers = "force_handlers"
+	ansiblePlaybookAttributeLint          = "lint"
 	ansiblePlaybookAttributeSkipTags      = "skip_tags"
 	ansiblePlaybookAttributeStartAtTask   = "start_at_task"
+	ansiblePlaybookAttributeStep          = "step"
 	ansiblePlaybookAttributeTags          = "tags"
 	ansiblePlaybookAttributeFilePath      = "file_path"
 	ansiblePlaybookAttributeRolesPath     = "roles_path"
+	ansiblePlaybookAttributeRepo          = "repo"
+	ansiblePlaybookAttributeRef           = "ref"
+	ansiblePlaybookAttributePath          = "path"
+	ansiblePlaybookAttributeRepoTokenEnv  = "repo_token_env"
+	ansiblePlaybookAttributeRepoSSHKey    = "repo_ssh_key_file"
+	ansiblePlaybookAttributeBundleURL     = "bundle_url"
+	ansiblePlaybookAttributeBundleSum     = "bundle_checksum"
+	ansiblePlaybookAttributeAdditional    = "additional_file_paths"
+	ansiblePlaybookAttributeCollections   = "collections_path"
+)
+
+const (
+	playbookGitSourcePrefix = "git::"
+	playbookDefaultPath     = "site.yml"
 )
 
 // Playbook represents playbook settings.
 type Playbook struct {
+	flushCache    bool
 	forceHandlers bool
+	lint          *Lint
 	skipTags      []string
 	startAtTask   string
+	step          bool
 	tags          []string
 	filePath      string
 	rolesPath     []string
+	repo          string
+	ref           string
+	path          string
+	repoTokenEnv  string
+	repoSSHKey    string
+	bundleURL     string
+	bundleSum     string
+	additional    []string
+	collections   []string
 
 	// when running a remote provisioner, the path will changed to the remote path:
-	overrideFilePath  string
-	overrideRolesPath []string
+	overrideFilePath    string
+	overrideRolesPath   []string
+	overrideAdditional  []string
+	overrideCollections []string
 }
 
 // NewPlaybookSchema returns a new Ansible playbook schema.
@@ -32,14 +65,19 @@ func NewPlaybookSchema() *schema.Schema {
 	return &schema.Schema{
 		Type:          schema.TypeSet,
 		Optional:      true,
-		ConflictsWith: []string{"plays.galaxy_install", "plays.module"},
+		ConflictsWith: []string{"plays.galaxy_install", "plays.module", "plays.pull"},
 		Elem: &schema.Resource{
 			Schema: map[string]*schema.Schema{
 				// Ansible parameters:
+				ansiblePlaybookAttributeFlushCache: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
 				ansiblePlaybookAttributeForceHandlers: &schema.Schema{
 					Type:     schema.TypeBool,
 					Optional: true,
 				},
+				ansiblePlaybookAttributeLint: NewLintSchema(),
 				ansiblePlaybookAttributeSkipTags: &schema.Schema{
 					Type:     schema.TypeList,
 					Elem:     &schema.Schema{Type: schema.TypeString},
@@ -49,6 +87,10 @@ func NewPlaybookSchema() *schema.Schema {
 					Type:     schema.TypeString,
 					Optional: true,
 				},
+				ansiblePlaybookAttributeStep: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
 				ansiblePlaybookAttributeTags: &schema.Schema{
 					Type:     schema.TypeList,
 					Elem:     &schema.Schema{Type: schema.TypeString},
@@ -57,7 +99,7 @@ func NewPlaybookSchema() *schema.Schema {
 				// operational:
 				ansiblePlaybookAttributeFilePath: &schema.Schema{
 					Type:         schema.TypeString,
-					Required:     true,
+					Optional:     true,
 					ValidateFunc: vfPath,
 				},
 				ansiblePlaybookAttributeRolesPath: &schema.Schema{
@@ -65,6 +107,47 @@ func NewPlaybookSchema() *schema.Schema {
 					Elem:     &schema.Schema{Type: schema.TypeString},
 					Optional: true,
 				},
+				ansiblePlaybookAttributeCollections: &schema.Schema{
+					Type:     schema.TypeList,
+					Elem:     &schema.Schema{Type: schema.TypeString, ValidateFunc: VfPathDirectory},
+					Optional: true,
+				},
+				ansiblePlaybookAttributeRepo: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				ansiblePlaybookAttributeRef: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				ansiblePlaybookAttributePath: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+					Default:  playbookDefaultPath,
+				},
+				ansiblePlaybookAttributeRepoTokenEnv: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				ansiblePlaybookAttributeRepoSSHKey: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: vfPath,
+				},
+				ansiblePlaybookAttributeAdditional: &schema.Schema{
+					Type:     schema.TypeList,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+					Optional: true,
+				},
+				ansiblePlaybookAttributeBundleURL: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				ansiblePlaybookAttributeBundleSum: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: vfChecksum,
+				},
 			},
 		},
 	}
@@ -73,7 +156,7 @@ func NewPlaybookSchema() *schema.Schema {
 // NewPlaybookFromInterface reads Playbook configuration from Terraform schema.
 func NewPlaybookFromInterface(i interface{}) *Playbook {
 	vals := mapFromTypeSetList(i.(*schema.Set).List())
-	return &Playbook{
+	v := &Playbook{
 		filePath:      vals[ansiblePlaybookAttributeFilePath].(string),
 		forceHandlers: vals[ansiblePlaybookAttributeForceHandlers].(bool),
 		skipTags:      listOfInterfaceToListOfString(vals[ansiblePlaybookAttributeSkipTags].([]interface{})),
@@ -81,6 +164,45 @@ func NewPlaybookFromInterface(i interface{}) *Playbook {
 		tags:          listOfInterfaceToListOfString(vals[ansiblePlaybookAttributeTags].([]interface{})),
 		rolesPath:     listOfInterfaceToListOfString(vals[ansiblePlaybookAttributeRolesPath].([]interface{})),
 	}
+	if val, ok := vals[ansiblePlaybookAttributeFlushCache]; ok {
+		v.flushCache = val.(bool)
+	}
+	if val, ok := vals[ansiblePlaybookAttributeStep]; ok {
+		v.step = val.(bool)
+	}
+	if val, ok := vals[ansiblePlaybookAttributeCollections]; ok {
+		v.collections = listOfInterfaceToListOfString(val.([]interface{}))
+	}
+	if val, ok := vals[ansiblePlaybookAttributeRepo]; ok {
+		v.repo = strings.TrimPrefix(val.(string), playbookGitSourcePrefix)
+	}
+	if val, ok := vals[ansiblePlaybookAttributeRef]; ok {
+		v.ref = val.(string)
+	}
+	if val, ok := vals[ansiblePlaybookAttributePath]; ok {
+		v.path = val.(string)
+	}
+	if val, ok := vals[ansiblePlaybookAttributeRepoTokenEnv]; ok {
+		v.repoTokenEnv = val.(string)
+	}
+	if val, ok := vals[ansiblePlaybookAttributeRepoSSHKey]; ok {
+		v.repoSSHKey = val.(string)
+	}
+	if val, ok := vals[ansiblePlaybookAttributeAdditional]; ok {
+		v.additional = listOfInterfaceToListOfString(val.([]interface{}))
+	}
+	if val, ok := vals[ansiblePlaybookAttributeBundleURL]; ok {
+		v.bundleURL = val.(string)
+	}
+	if val, ok := vals[ansiblePlaybookAttributeBundleSum]; ok {
+		v.bundleSum = val.(string)
+	}
+	if val, ok := vals[ansiblePlaybookAttributeLint]; ok {
+		if val.(*schema.Set).Len() > 0 {
+			v.lint = NewLintFromInterface(val)
+		}
+	}
+	return v
 }
 
 // FilePath represents a path to the Ansible playbook to be executed.
@@ -91,11 +213,21 @@ func (v *Playbook) FilePath() string {
 	return v.overrideFilePath
 }
 
+// FlushCache represents Ansible Playbook --flush-cache flag.
+func (v *Playbook) FlushCache() bool {
+	return v.flushCache
+}
+
 // ForceHandlers represents Ansible Playbook --force-handlers flag.
 func (v *Playbook) ForceHandlers() bool {
 	return v.forceHandlers
 }
 
+// Lint returns ansible-lint settings, nil when not configured.
+func (v *Playbook) Lint() *Lint {
+	return v.lint
+}
+
 // SkipTags represents Ansible Playbook --skip-tags flag.
 func (v *Playbook) SkipTags() []string {
 	return v.skipTags
@@ -106,6 +238,11 @@ func (v *Playbook) StartAtTask() string {
 	return v.startAtTask
 }
 
+// Step represents Ansible Playbook --step flag.
+func (v *Playbook) Step() bool {
+	return v.step
+}
+
 // Tags represents Ansible Playbook --tags flag.
 func (v *Playbook) Tags() []string {
 	return v.tags
@@ -120,6 +257,41 @@ func (v *Playbook) RolesPath() []string {
 	return v.overrideRolesPath
 }
 
+// CollectionsPath returns local directories with pre-fetched collections, prepended to ANSIBLE_COLLECTIONS_PATH.
+// The remote provisioner uploads these directories with the playbook.
+func (v *Playbook) CollectionsPath() []string {
+	if len(v.overrideCollections) == 0 {
+		return v.collections
+	}
+	return v.overrideCollections
+}
+
+// SetOverrideCollectionsPath is used by the remote provisioner to reference the correct
+// collection locations after the upload to the provisioned machine.
+func (v *Playbook) SetOverrideCollectionsPath(paths []string) {
+	v.overrideCollections = paths
+}
+
+// AdditionalFilePaths represents playbooks executed after the playbook in the same ansible-playbook run,
+// sharing the inventory and the connections. Relative to the root of the repository or the bundle, if any.
+func (v *Playbook) AdditionalFilePaths() []string {
+	if len(v.overrideAdditional) == 0 {
+		return v.additional
+	}
+	return v.overrideAdditional
+}
+
+// FilePaths returns the playbook followed by the additional playbooks.
+func (v *Playbook) FilePaths() []string {
+	return append([]string{v.FilePath()}, v.AdditionalFilePaths()...)
+}
+
+// SetOverrideAdditionalFilePaths is used by the provisioner to reference the correct
+// locations of the additional playbooks after these were checked out, rendered or uploaded.
+func (v *Playbook) SetOverrideAdditionalFilePaths(paths []string) {
+	v.overrideAdditional = paths
+}
+
 // SetOverrideFilePath is used by the remote provisioner to reference the correct
 // playbook location after the upload to the provisioned machine.
 func (v *Playbook) SetOverrideFilePath(path string) {
@@ -131,3 +303,41 @@ func (v *Playbook) SetOverrideFilePath(path string) {
 func (v *Playbook) SetOverrideRolesPath(path []string) {
 	v.overrideRolesPath = path
 }
+
+// Repo returns the URL of the git repository the playbook is cloned from, the git:: prefix removed.
+func (v *Playbook) Repo() string {
+	return v.repo
+}
+
+// Ref returns the branch, tag or commit of the git repository to check out, empty for the default branch.
+func (v *Playbook) Ref() string {
+	return v.ref
+}
+
+// Path returns the playbook path relative to the root of the git repository or the bundle.
+func (v *Playbook) Path() string {
+	if v.path == "" {
+		return playbookDefaultPath
+	}
+	return v.path
+}
+
+// RepoTokenEnv returns the name of the environment variable holding the token used to clone over HTTPS.
+func (v *Playbook) RepoTokenEnv() string {
+	return v.repoTokenEnv
+}
+
+// RepoSSHKeyFile returns the path to the private key used to clone over SSH.
+func (v *Playbook) RepoSSHKeyFile() string {
+	return v.repoSSHKey
+}
+
+// BundleURL returns the http(s), s3:// or gs:// URL of a .tar.gz, .tgz or .zip playbook bundle.
+func (v *Playbook) BundleURL() string {
+	return v.bundleURL
+}
+
+// BundleChecksum returns the expected checksum of the bundle, sha256:<hex> or sha512:<hex>.
+func (v *Playbook) BundleChecksum() string {
+	return v.bundleSum
+}
@@ -0,0 +1,100 @@
+package types
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+const (
+	// default values:
+	preflightDefaultModule = "wait_for_connection"
+	// factsModule gathers the facts of the facts output file:
+	factsModule = "setup"
+	// attribute names:
+	preflightAttributeEnabled = "enabled"
+	preflightAttributeModule  = "module"
+	preflightAttributeArgs    = "args"
+)
+
+// Preflight represents an ad-hoc module executed against the play inventory before the play.
+type Preflight struct {
+	enabled bool
+	module  string
+	args    map[string]interface{}
+}
+
+// NewPreflightSchema returns a new pre-flight hook schema.
+func NewPreflightSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeSet,
+		Optional: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				preflightAttributeEnabled: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+					Default:  true,
+				},
+				preflightAttributeModule: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+					Default:  preflightDefaultModule,
+				},
+				preflightAttributeArgs: &schema.Schema{
+					Type:     schema.TypeMap,
+					Optional: true,
+					Computed: true,
+				},
+			},
+		},
+	}
+}
+
+// NewPreflightFromInterface reads pre-flight hook configuration from Terraform schema.
+func NewPreflightFromInterface(i interface{}) *Preflight {
+	vals := mapFromTypeSetList(i.(*schema.Set).List())
+	return &Preflight{
+		enabled: vals[preflightAttributeEnabled].(bool),
+		module:  vals[preflightAttributeModule].(string),
+		args:    mapFromTypeMap(vals[preflightAttributeArgs]),
+	}
+}
+
+// NewDefaultPreflight returns the pre-flight hook used for WinRM targets when none is configured.
+func NewDefaultPreflight() *Preflight {
+	return &Preflight{
+		enabled: true,
+		module:  preflightDefaultModule,
+		args:    map[string]interface{}{"timeout": 600},
+	}
+}
+
+// Enabled controls the execution of the pre-flight hook.
+func (v *Preflight) Enabled() bool {
+	return v.enabled
+}
+
+// Module returns a module name to run.
+func (v *Preflight) Module() string {
+	if v.module == "" {
+		return preflightDefaultModule
+	}
+	return v.module
+}
+
+// Args represent Ansible --args flag.
+func (v *Preflight) Args() map[string]interface{} {
+	return v.args
+}
+
+// ToCommand appends the pre-flight hook to the command as an executable Ansible command.
+func (v *Preflight) ToCommand(command *Command, inventoryFile string) *Command {
+	command.env(ansibleEnvVarForceColor, "true", "true").
+		Arg("ansible").
+		Arg(ansibleModuleDefaultHostPattern).
+		Option("--inventory-file", inventoryFile).
+		Option("--module-name", v.Module())
+	if len(v.Args()) > 0 {
+		command.Option("--args", ModuleArgs(v.Args()))
+	}
+	return command
+}
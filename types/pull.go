@@ -0,0 +1,172 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+const (
+	// default values:
+	pullDefaultDirectory = "/var/lib/ansible/local"
+	pullDefaultLogFile   = "/var/log/ansible-pull.log"
+	// attribute names:
+	pullAttributeURL          = "url"
+	pullAttributeCheckout     = "checkout"
+	pullAttributePlaybookFile = "playbook_file"
+	pullAttributeDirectory    = "directory"
+	pullAttributeSchedule     = "schedule"
+	pullAttributeLogFile      = "log_file"
+	pullAttributeRunNow       = "run_now"
+)
+
+// Pull represents ansible-pull settings. Rather than pushing a playbook from
+// the machine running Terraform, the target is configured to pull a git repository
+// and apply a playbook from it on a cron schedule.
+type Pull struct {
+	url          string
+	checkout     string
+	playbookFile string
+	directory    string
+	schedule     string
+	logFile      string
+	runNow       bool
+}
+
+// NewPullSchema returns a new ansible-pull schema.
+func NewPullSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:          schema.TypeSet,
+		Optional:      true,
+		ConflictsWith: []string{"plays.galaxy_install", "plays.module", "plays.playbook"},
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				pullAttributeURL: &schema.Schema{
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				pullAttributeCheckout: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				pullAttributePlaybookFile: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				pullAttributeDirectory: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+					Default:  pullDefaultDirectory,
+				},
+				pullAttributeSchedule: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: vfCronSchedule,
+				},
+				pullAttributeLogFile: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+					Default:  pullDefaultLogFile,
+				},
+				pullAttributeRunNow: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+					Default:  true,
+				},
+			},
+		},
+	}
+}
+
+// NewPullFromInterface reads ansible-pull configuration from Terraform schema.
+func NewPullFromInterface(i interface{}) *Pull {
+	vals := mapFromTypeSetList(i.(*schema.Set).List())
+	return &Pull{
+		url:          vals[pullAttributeURL].(string),
+		checkout:     vals[pullAttributeCheckout].(string),
+		playbookFile: vals[pullAttributePlaybookFile].(string),
+		directory:    vals[pullAttributeDirectory].(string),
+		schedule:     vals[pullAttributeSchedule].(string),
+		logFile:      vals[pullAttributeLogFile].(string),
+		runNow:       vals[pullAttributeRunNow].(bool),
+	}
+}
+
+// URL returns the git repository ansible-pull checks out.
+func (v *Pull) URL() string {
+	return v.url
+}
+
+// Checkout returns the branch, tag or commit to check out, empty string means the repository default.
+func (v *Pull) Checkout() string {
+	return v.checkout
+}
+
+// PlaybookFile returns the playbook path relative to the repository root.
+// When empty, ansible-pull looks for <fqdn>.yml, <hostname>.yml and local.yml.
+func (v *Pull) PlaybookFile() string {
+	return v.playbookFile
+}
+
+// Directory returns the directory on the target the repository is checked out to.
+func (v *Pull) Directory() string {
+	return v.directory
+}
+
+// Schedule returns the cron schedule, five whitespace separated fields.
+// When empty, no cron job is installed.
+func (v *Pull) Schedule() string {
+	return v.schedule
+}
+
+// LogFile returns the file on the target the scheduled runs append their output to.
+func (v *Pull) LogFile() string {
+	return v.logFile
+}
+
+// RunNow controls if ansible-pull is executed immediately, in addition to the schedule.
+func (v *Pull) RunNow() bool {
+	return v.runNow
+}
+
+// CronName returns the name of the cron job managing the scheduled ansible-pull runs.
+func (v *Pull) CronName() string {
+	return fmt.Sprintf("terraform-provisioner-ansible pull %s", v.URL())
+}
+
+// ToPullCommand serializes the settings to an ansible-pull command executed on the target.
+// Scheduled runs apply the playbook only when the repository has changed.
+func (v *Pull) ToPullCommand(scheduled bool) string {
+	command := fmt.Sprintf("ansible-pull --url=%s", ShellQuote(v.URL()))
+	if v.Checkout() != "" {
+		command = fmt.Sprintf("%s --checkout=%s", command, ShellQuote(v.Checkout()))
+	}
+	if v.Directory() != "" {
+		command = fmt.Sprintf("%s --directory=%s", command, ShellQuote(v.Directory()))
+	}
+	if scheduled {
+		command = fmt.Sprintf("%s --only-if-changed", command)
+	}
+	if v.PlaybookFile() != "" {
+		command = fmt.Sprintf("%s %s", command, ShellQuote(v.PlaybookFile()))
+	}
+	if scheduled && v.LogFile() != "" {
+		command = fmt.Sprintf("%s >> %s 2>&1", command, ShellQuote(v.LogFile()))
+	}
+	return command
+}
+
+// ToCronArgs returns the cron module arguments installing the scheduled ansible-pull runs.
+func (v *Pull) ToCronArgs() map[string]interface{} {
+	fields := strings.Fields(v.Schedule())
+	return map[string]interface{}{
+		"name":    v.CronName(),
+		"job":     v.ToPullCommand(true),
+		"minute":  fields[0],
+		"hour":    fields[1],
+		"day":     fields[2],
+		"month":   fields[3],
+		"weekday": fields[4],
+	}
+}
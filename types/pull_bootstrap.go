@@ -0,0 +1,278 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+const (
+	// PullSchedulerSystemd schedules the ansible-pull runs with a systemd timer.
+	PullSchedulerSystemd = "systemd"
+	// PullSchedulerCron schedules the ansible-pull runs with a cron job.
+	PullSchedulerCron = "cron"
+)
+
+// PullBootstrapSettings represents the continuous ansible-pull configuration of the target.
+type PullBootstrapSettings struct {
+	isPullBootstrapInUse bool
+	url                  string
+	checkout             string
+	playbookFile         string
+	directory            string
+	deployKey            string
+	acceptHostKey        bool
+	scheduler            string
+	schedule             string
+	logFile              string
+	extraArgs            []string
+	verify               bool
+}
+
+const (
+	// default values:
+	pullBootstrapDefaultScheduler       = PullSchedulerSystemd
+	pullBootstrapDefaultSystemdSchedule = "*:0/15"
+	pullBootstrapDefaultCronSchedule    = "*/15 * * * *"
+	pullBootstrapDefaultVerify          = true
+	// attribute names:
+	pullBootstrapAttributeURL           = "url"
+	pullBootstrapAttributeCheckout      = "checkout"
+	pullBootstrapAttributePlaybookFile  = "playbook_file"
+	pullBootstrapAttributeDirectory     = "directory"
+	pullBootstrapAttributeDeployKey     = "deploy_key"
+	pullBootstrapAttributeAcceptHostKey = "accept_host_key"
+	pullBootstrapAttributeScheduler     = "scheduler"
+	pullBootstrapAttributeSchedule      = "schedule"
+	pullBootstrapAttributeLogFile       = "log_file"
+	pullBootstrapAttributeExtraArgs     = "extra_args"
+	pullBootstrapAttributeVerify        = "verify"
+)
+
+// NewPullBootstrapSchema returns a new ansible-pull bootstrap schema.
+func NewPullBootstrapSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:          schema.TypeSet,
+		Optional:      true,
+		MaxItems:      1,
+		ConflictsWith: []string{"remote", "tower", "kubernetes", "execution_environment", "run_in_docker"},
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				pullBootstrapAttributeURL: &schema.Schema{
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				pullBootstrapAttributeCheckout: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				pullBootstrapAttributePlaybookFile: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				pullBootstrapAttributeDirectory: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+					Default:  pullDefaultDirectory,
+				},
+				pullBootstrapAttributeDeployKey: &schema.Schema{
+					Type:      schema.TypeString,
+					Optional:  true,
+					Sensitive: true,
+				},
+				pullBootstrapAttributeAcceptHostKey: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+					Default:  false,
+				},
+				pullBootstrapAttributeScheduler: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					Default:      pullBootstrapDefaultScheduler,
+					ValidateFunc: vfPullScheduler,
+				},
+				pullBootstrapAttributeSchedule: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				pullBootstrapAttributeLogFile: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+					Default:  pullDefaultLogFile,
+				},
+				pullBootstrapAttributeExtraArgs: &schema.Schema{
+					Type:     schema.TypeList,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+					Optional: true,
+				},
+				pullBootstrapAttributeVerify: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+					Default:  pullBootstrapDefaultVerify,
+				},
+			},
+		},
+	}
+}
+
+// NewPullBootstrapSettingsFromInterface reads ansible-pull bootstrap configuration from Terraform schema.
+func NewPullBootstrapSettingsFromInterface(i interface{}, ok bool) *PullBootstrapSettings {
+	if ok {
+		return NewPullBootstrapSettingsFromMapInterface(mapFromTypeSetList(i.(*schema.Set).List()), ok)
+	}
+	return newDefaultPullBootstrapSettings()
+}
+
+// NewPullBootstrapSettingsFromMapInterface reads ansible-pull bootstrap configuration from a map.
+func NewPullBootstrapSettingsFromMapInterface(vals map[string]interface{}, ok bool) *PullBootstrapSettings {
+	v := newDefaultPullBootstrapSettings()
+	if ok {
+		v.isPullBootstrapInUse = true
+		v.url = vals[pullBootstrapAttributeURL].(string)
+		if val, ok := vals[pullBootstrapAttributeCheckout]; ok {
+			v.checkout = val.(string)
+		}
+		if val, ok := vals[pullBootstrapAttributePlaybookFile]; ok {
+			v.playbookFile = val.(string)
+		}
+		if val, ok := vals[pullBootstrapAttributeDirectory]; ok && val.(string) != "" {
+			v.directory = val.(string)
+		}
+		if val, ok := vals[pullBootstrapAttributeDeployKey]; ok {
+			v.deployKey = val.(string)
+		}
+		if val, ok := vals[pullBootstrapAttributeAcceptHostKey]; ok {
+			v.acceptHostKey = val.(bool)
+		}
+		if val, ok := vals[pullBootstrapAttributeScheduler]; ok && val.(string) != "" {
+			v.scheduler = val.(string)
+		}
+		if val, ok := vals[pullBootstrapAttributeSchedule]; ok {
+			v.schedule = val.(string)
+		}
+		if val, ok := vals[pullBootstrapAttributeLogFile]; ok && val.(string) != "" {
+			v.logFile = val.(string)
+		}
+		if val, ok := vals[pullBootstrapAttributeExtraArgs]; ok {
+			v.extraArgs = listOfInterfaceToListOfString(val)
+		}
+		if val, ok := vals[pullBootstrapAttributeVerify]; ok {
+			v.verify = val.(bool)
+		}
+	}
+	return v
+}
+
+func newDefaultPullBootstrapSettings() *PullBootstrapSettings {
+	return &PullBootstrapSettings{
+		directory: pullDefaultDirectory,
+		scheduler: pullBootstrapDefaultScheduler,
+		logFile:   pullDefaultLogFile,
+		extraArgs: make([]string, 0),
+		verify:    pullBootstrapDefaultVerify,
+	}
+}
+
+// IsPullBootstrapInUse returns true when the target is configured for continuous ansible-pull.
+func (v *PullBootstrapSettings) IsPullBootstrapInUse() bool {
+	return v.isPullBootstrapInUse
+}
+
+// URL returns the git repository ansible-pull checks out.
+func (v *PullBootstrapSettings) URL() string {
+	return v.url
+}
+
+// Checkout returns the branch, tag or commit to check out, empty string means the repository default.
+func (v *PullBootstrapSettings) Checkout() string {
+	return v.checkout
+}
+
+// PlaybookFile returns the playbook path relative to the repository root.
+// When empty, ansible-pull looks for <fqdn>.yml, <hostname>.yml and local.yml.
+func (v *PullBootstrapSettings) PlaybookFile() string {
+	return v.playbookFile
+}
+
+// Directory returns the directory on the target the repository is checked out to.
+func (v *PullBootstrapSettings) Directory() string {
+	return v.directory
+}
+
+// DeployKey returns the private key git authenticates with, empty string means no key.
+func (v *PullBootstrapSettings) DeployKey() string {
+	return v.deployKey
+}
+
+// AcceptHostKey returns true when the host key of the git server is added on the first checkout.
+func (v *PullBootstrapSettings) AcceptHostKey() bool {
+	return v.acceptHostKey
+}
+
+// Scheduler returns what schedules the ansible-pull runs, systemd or cron.
+func (v *PullBootstrapSettings) Scheduler() string {
+	return v.scheduler
+}
+
+// Schedule returns the OnCalendar expression of the systemd timer or the five fields of the cron job,
+// every 15 minutes when not configured.
+func (v *PullBootstrapSettings) Schedule() string {
+	if v.schedule != "" {
+		return v.schedule
+	}
+	if v.scheduler == PullSchedulerCron {
+		return pullBootstrapDefaultCronSchedule
+	}
+	return pullBootstrapDefaultSystemdSchedule
+}
+
+// LogFile returns the file the cron job appends the output of the runs to, systemd writes to the journal.
+func (v *PullBootstrapSettings) LogFile() string {
+	return v.logFile
+}
+
+// ExtraArgs returns additional ansible-pull arguments.
+func (v *PullBootstrapSettings) ExtraArgs() []string {
+	return v.extraArgs
+}
+
+// Verify returns true when the first ansible-pull run is executed by the provisioner and must succeed.
+func (v *PullBootstrapSettings) Verify() bool {
+	return v.verify
+}
+
+// Validate checks the schedule against the format of the scheduler.
+func (v *PullBootstrapSettings) Validate() error {
+	if v.scheduler == PullSchedulerCron && len(strings.Fields(v.Schedule())) != 5 {
+		return fmt.Errorf("pull_bootstrap.schedule must have five fields for the cron scheduler: minute, hour, day, month and weekday, got: %s", v.Schedule())
+	}
+	if strings.ContainsAny(v.Schedule(), "\n") {
+		return fmt.Errorf("pull_bootstrap.schedule must be a single line, got: %q", v.Schedule())
+	}
+	return nil
+}
+
+// ToPullCommand serializes the settings to the ansible-pull command executed on the target.
+// The key file is passed to git when a deploy key is configured.
+func (v *PullBootstrapSettings) ToPullCommand(keyFile string) string {
+	command := fmt.Sprintf("ansible-pull --url=%s", ShellQuote(v.URL()))
+	if v.Checkout() != "" {
+		command = fmt.Sprintf("%s --checkout=%s", command, ShellQuote(v.Checkout()))
+	}
+	command = fmt.Sprintf("%s --directory=%s", command, ShellQuote(v.Directory()))
+	if v.DeployKey() != "" {
+		command = fmt.Sprintf("%s --key-file=%s", command, ShellQuote(keyFile))
+	}
+	if v.AcceptHostKey() {
+		command = fmt.Sprintf("%s --accept-host-key", command)
+	}
+	for _, arg := range v.ExtraArgs() {
+		command = fmt.Sprintf("%s %s", command, ShellQuote(arg))
+	}
+	command = fmt.Sprintf("%s \"$@\"", command)
+	if v.PlaybookFile() != "" {
+		command = fmt.Sprintf("%s %s", command, ShellQuote(v.PlaybookFile()))
+	}
+	return command
+}
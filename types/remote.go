@@ -14,25 +14,71 @@ type RemoteSettings struct {
 	skipInstall              bool
 	skipCleanup              bool
 	installVersion           string
+	installPackage           string
+	virtualenvDirectory      string
+	offlinePackagesDirectory string
 	localInstallerPath       string
 	remoteInstallerDirectory string
 	bootstrapDirectory       string
+	bootstrapDirectoryMode   string
+	bootstrapDirectoryOwner  string
+	verifyUploads            bool
+	compressUploads          bool
+	uploadConcurrency        int
+	sudoPassword             string
+	rootless                 bool
+	packagesScriptPath       string
+	ensureVersion            string
+	orchestrate              bool
+	bootstrapScriptPath      string
+	httpProxy                string
+	httpsProxy               string
+	noProxy                  string
+	wslDistribution          string
+	containerImage           string
+	containerEngine          string
 }
 
 const (
 	// default values:
 	remoteDefaultUseSudo                  = true
 	remoteDefaultInstallVersion           = "" // latest
+	remoteDefaultInstallPackage           = "ansible"
 	remoteDefaultRemoteInstallerDirectory = "/tmp"
 	remoteDefaultBootstrapDirectory       = "/tmp"
+	remoteDefaultRootlessVirtualenv       = ".tf-ansible/venv" // relative to the home directory
+	remoteDefaultWSLDirectory             = "/mnt/c/Windows/Temp"
+	remoteDefaultUploadConcurrency        = 1
+	remoteDefaultContainerEngine          = "podman"
+	remoteDefaultContainerHostRoot        = "/host"
 	// attribute names:
 	remoteAttributeUseSudo                  = "use_sudo"
 	remoteAttributeSkipInstall              = "skip_install"
 	remoteAttributeSkipCleanup              = "skip_cleanup"
 	remoteAttributeInstallVersion           = "install_version"
+	remoteAttributeInstallPackage           = "install_package"
+	remoteAttributeVirtualenvDirectory      = "virtualenv_directory"
+	remoteAttributeOfflinePackagesDirectory = "offline_packages_directory"
 	remoteAttributeLocalInstallerPath       = "local_installer_path"
 	remoteAttributeRemoteInstallerDirectory = "remote_installer_directory"
 	remoteAttributeBootstrapDirectory       = "bootstrap_directory"
+	remoteAttributeBootstrapDirectoryMode   = "bootstrap_directory_mode"
+	remoteAttributeBootstrapDirectoryOwner  = "bootstrap_directory_owner"
+	remoteAttributeVerifyUploads            = "verify_uploads"
+	remoteAttributeCompressUploads          = "compress_uploads"
+	remoteAttributeUploadConcurrency        = "upload_concurrency"
+	remoteAttributeSudoPassword             = "sudo_password"
+	remoteAttributeRootless                 = "rootless"
+	remoteAttributePackagesScriptPath       = "packages_script_path"
+	remoteAttributeEnsureVersion            = "ensure_version"
+	remoteAttributeOrchestrate              = "orchestrate"
+	remoteAttributeBootstrapScriptPath      = "bootstrap_script_path"
+	remoteAttributeHTTPProxy                = "http_proxy"
+	remoteAttributeHTTPSProxy               = "https_proxy"
+	remoteAttributeNoProxy                  = "no_proxy"
+	remoteAttributeWSLDistribution          = "wsl_distribution"
+	remoteAttributeContainerImage           = "container_image"
+	remoteAttributeContainerEngine          = "container_engine"
 )
 
 // NewRemoteSchema returns a new remote schema.
@@ -61,6 +107,28 @@ func NewRemoteSchema() *schema.Schema {
 					Default:       remoteDefaultInstallVersion,
 					ConflictsWith: []string{fmt.Sprintf("remote.%s", remoteAttributeLocalInstallerPath)},
 				},
+				remoteAttributeInstallPackage: &schema.Schema{
+					Type:          schema.TypeString,
+					Optional:      true,
+					Default:       remoteDefaultInstallPackage,
+					ValidateFunc:  vfInstallPackage,
+					ConflictsWith: []string{fmt.Sprintf("remote.%s", remoteAttributeLocalInstallerPath)},
+				},
+				remoteAttributeEnsureVersion: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: VfAnsibleVersion,
+				},
+				remoteAttributeVirtualenvDirectory: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				remoteAttributeOfflinePackagesDirectory: &schema.Schema{
+					Type:          schema.TypeString,
+					Optional:      true,
+					ValidateFunc:  VfPathDirectory,
+					ConflictsWith: []string{fmt.Sprintf("remote.%s", remoteAttributeLocalInstallerPath)},
+				},
 				remoteAttributeLocalInstallerPath: &schema.Schema{
 					Type:          schema.TypeString,
 					Optional:      true,
@@ -77,6 +145,87 @@ func NewRemoteSchema() *schema.Schema {
 					Optional: true,
 					Default:  remoteDefaultBootstrapDirectory,
 				},
+				remoteAttributeBootstrapDirectoryMode: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: vfFileMode,
+				},
+				remoteAttributeBootstrapDirectoryOwner: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				remoteAttributeVerifyUploads: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
+				remoteAttributeCompressUploads: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
+				remoteAttributeUploadConcurrency: &schema.Schema{
+					Type:         schema.TypeInt,
+					Optional:     true,
+					Default:      remoteDefaultUploadConcurrency,
+					ValidateFunc: vfPositiveInt,
+				},
+				remoteAttributeWSLDistribution: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				remoteAttributeContainerImage: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+					ConflictsWith: []string{
+						fmt.Sprintf("remote.%s", remoteAttributeLocalInstallerPath),
+						fmt.Sprintf("remote.%s", remoteAttributeRootless),
+						fmt.Sprintf("remote.%s", remoteAttributeWSLDistribution),
+					},
+				},
+				remoteAttributeContainerEngine: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					Default:      remoteDefaultContainerEngine,
+					ValidateFunc: vfContainerEngine,
+				},
+				remoteAttributeHTTPProxy: &schema.Schema{
+					Type:      schema.TypeString,
+					Optional:  true,
+					Sensitive: true,
+				},
+				remoteAttributeHTTPSProxy: &schema.Schema{
+					Type:      schema.TypeString,
+					Optional:  true,
+					Sensitive: true,
+				},
+				remoteAttributeNoProxy: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				remoteAttributeBootstrapScriptPath: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: vfPath,
+				},
+				remoteAttributePackagesScriptPath: &schema.Schema{
+					Type:          schema.TypeString,
+					Optional:      true,
+					ValidateFunc:  vfPath,
+					ConflictsWith: []string{fmt.Sprintf("remote.%s", remoteAttributeLocalInstallerPath)},
+				},
+				remoteAttributeOrchestrate: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
+				remoteAttributeRootless: &schema.Schema{
+					Type:          schema.TypeBool,
+					Optional:      true,
+					ConflictsWith: []string{fmt.Sprintf("remote.%s", remoteAttributeLocalInstallerPath)},
+				},
+				remoteAttributeSudoPassword: &schema.Schema{
+					Type:      schema.TypeString,
+					Optional:  true,
+					Sensitive: true,
+				},
 			},
 		},
 	}
@@ -88,16 +237,20 @@ func NewRemoteSettingsFromInterface(i interface{}, ok bool) *RemoteSettings {
 		return NewRemoteSettingsFromMapInterface(mapFromTypeSetList(i.(*schema.Set).List()), ok)
 	}
 	return &RemoteSettings{
-		isRemoteInUse: false,
-		useSudo:       remoteDefaultUseSudo,
+		isRemoteInUse:     false,
+		useSudo:           remoteDefaultUseSudo,
+		installPackage:    remoteDefaultInstallPackage,
+		uploadConcurrency: remoteDefaultUploadConcurrency,
 	}
 }
 
 // NewRemoteSettingsFromMapInterface reads Remote configuration from a map.
 func NewRemoteSettingsFromMapInterface(vals map[string]interface{}, ok bool) *RemoteSettings {
 	v := &RemoteSettings{
-		isRemoteInUse: false,
-		useSudo:       remoteDefaultUseSudo,
+		isRemoteInUse:     false,
+		useSudo:           remoteDefaultUseSudo,
+		installPackage:    remoteDefaultInstallPackage,
+		uploadConcurrency: remoteDefaultUploadConcurrency,
 	}
 	if ok {
 		v.isRemoteInUse = true
@@ -108,6 +261,66 @@ func NewRemoteSettingsFromMapInterface(vals map[string]interface{}, ok bool) *Re
 		v.localInstallerPath = vals[remoteAttributeLocalInstallerPath].(string)
 		v.remoteInstallerDirectory = vals[remoteAttributeRemoteInstallerDirectory].(string)
 		v.bootstrapDirectory = vals[remoteAttributeBootstrapDirectory].(string)
+		if val, ok := vals[remoteAttributeInstallPackage]; ok && val.(string) != "" {
+			v.installPackage = val.(string)
+		}
+		if val, ok := vals[remoteAttributeEnsureVersion]; ok {
+			v.ensureVersion = val.(string)
+		}
+		if val, ok := vals[remoteAttributeVirtualenvDirectory]; ok {
+			v.virtualenvDirectory = val.(string)
+		}
+		if val, ok := vals[remoteAttributeBootstrapDirectoryMode]; ok {
+			v.bootstrapDirectoryMode = val.(string)
+		}
+		if val, ok := vals[remoteAttributeBootstrapDirectoryOwner]; ok {
+			v.bootstrapDirectoryOwner = val.(string)
+		}
+		if val, ok := vals[remoteAttributeVerifyUploads]; ok {
+			v.verifyUploads = val.(bool)
+		}
+		if val, ok := vals[remoteAttributeCompressUploads]; ok {
+			v.compressUploads = val.(bool)
+		}
+		if val, ok := vals[remoteAttributeUploadConcurrency]; ok && val.(int) > 0 {
+			v.uploadConcurrency = val.(int)
+		}
+		if val, ok := vals[remoteAttributeWSLDistribution]; ok {
+			v.wslDistribution = val.(string)
+		}
+		if val, ok := vals[remoteAttributeContainerImage]; ok {
+			v.containerImage = val.(string)
+		}
+		if val, ok := vals[remoteAttributeContainerEngine]; ok {
+			v.containerEngine = val.(string)
+		}
+		if val, ok := vals[remoteAttributeHTTPProxy]; ok {
+			v.httpProxy = val.(string)
+		}
+		if val, ok := vals[remoteAttributeHTTPSProxy]; ok {
+			v.httpsProxy = val.(string)
+		}
+		if val, ok := vals[remoteAttributeNoProxy]; ok {
+			v.noProxy = val.(string)
+		}
+		if val, ok := vals[remoteAttributeBootstrapScriptPath]; ok {
+			v.bootstrapScriptPath = val.(string)
+		}
+		if val, ok := vals[remoteAttributePackagesScriptPath]; ok {
+			v.packagesScriptPath = val.(string)
+		}
+		if val, ok := vals[remoteAttributeOrchestrate]; ok {
+			v.orchestrate = val.(bool)
+		}
+		if val, ok := vals[remoteAttributeRootless]; ok {
+			v.rootless = val.(bool)
+		}
+		if val, ok := vals[remoteAttributeSudoPassword]; ok {
+			v.sudoPassword = val.(string)
+		}
+		if val, ok := vals[remoteAttributeOfflinePackagesDirectory]; ok {
+			v.offlinePackagesDirectory = val.(string)
+		}
 	}
 	return v
 }
@@ -117,9 +330,46 @@ func (v *RemoteSettings) IsRemoteInUse() bool {
 	return v.isRemoteInUse
 }
 
-// UseSudo returns true is sudo should be use, false otherwise.
+// UseSudo returns true is sudo should be use, false otherwise. Never true for a rootless installation
+// and in WSL, where the commands are executed as root.
 func (v *RemoteSettings) UseSudo() bool {
-	return v.useSudo
+	return v.useSudo && !v.rootless && v.wslDistribution == ""
+}
+
+// WSLDistribution returns the WSL distribution Ansible is installed to and executed in on a Windows host.
+func (v *RemoteSettings) WSLDistribution() string {
+	return v.wslDistribution
+}
+
+// ContainerImage returns the execution environment image the plays run in on the host,
+// empty string means the plays run with Ansible installed on the host.
+func (v *RemoteSettings) ContainerImage() string {
+	return v.containerImage
+}
+
+// ContainerEngine returns the container engine running the execution environment image, podman or docker.
+func (v *RemoteSettings) ContainerEngine() string {
+	if v.containerEngine == "" {
+		return remoteDefaultContainerEngine
+	}
+	return v.containerEngine
+}
+
+// ContainerHostRoot returns the path the root file system of the host is mounted at in the execution environment container.
+func (v *RemoteSettings) ContainerHostRoot() string {
+	return remoteDefaultContainerHostRoot
+}
+
+// Orchestrate returns true when the host is a controller of the other hosts of the plays.
+// The generated inventory connects to the host itself locally and to the other hosts over SSH.
+func (v *RemoteSettings) Orchestrate() bool {
+	return v.orchestrate
+}
+
+// Rootless returns true when Ansible is installed to and executed from a virtualenv
+// in the home directory of the connection user, without root privileges.
+func (v *RemoteSettings) Rootless() bool {
+	return v.rootless
 }
 
 // SkipInstall returns true is Ansible installation should be skipped during remote provisioning, false otherwise.
@@ -137,6 +387,83 @@ func (v *RemoteSettings) InstallVersion() string {
 	return v.installVersion
 }
 
+// EnsureVersion returns the minimum version of an existing Ansible installation on the host,
+// the installation is skipped when the version is met. Empty string means Ansible is always installed.
+func (v *RemoteSettings) EnsureVersion() string {
+	return v.ensureVersion
+}
+
+// InstallPackage returns the pip package Ansible is installed from, ansible or ansible-core.
+func (v *RemoteSettings) InstallPackage() string {
+	return v.installPackage
+}
+
+// VirtualenvDirectory returns a path to the virtualenv Ansible is installed to and executed from,
+// empty string means Ansible is installed system wide. A rootless installation always uses a virtualenv,
+// a relative path is relative to the home directory of the connection user.
+func (v *RemoteSettings) VirtualenvDirectory() string {
+	if v.virtualenvDirectory == "" && v.rootless {
+		return remoteDefaultRootlessVirtualenv
+	}
+	return v.virtualenvDirectory
+}
+
+// VirtualenvBinDirectory returns a path to the bin directory of the virtualenv, empty when no virtualenv is used.
+func (v *RemoteSettings) VirtualenvBinDirectory() string {
+	if v.VirtualenvDirectory() == "" {
+		return ""
+	}
+	return filepath.Join(v.VirtualenvDirectory(), "bin")
+}
+
+// OfflinePackagesDirectory returns a local path to the directory with pre-downloaded Python wheels
+// and OS packages, Ansible is installed from these without accessing the internet.
+func (v *RemoteSettings) OfflinePackagesDirectory() string {
+	return v.offlinePackagesDirectory
+}
+
+// RemoteOfflinePackagesDirectory returns a path to where the offline packages are uploaded to.
+func (v *RemoteSettings) RemoteOfflinePackagesDirectory() string {
+	return filepath.Join(v.BootstrapDirectory(), "ansible-offline-packages")
+}
+
+// HTTPProxy returns the proxy for HTTP requests of the bootstrap: the installation and galaxy_install plays.
+func (v *RemoteSettings) HTTPProxy() string {
+	return v.httpProxy
+}
+
+// HTTPSProxy returns the proxy for HTTPS requests of the bootstrap: the installation and galaxy_install plays.
+func (v *RemoteSettings) HTTPSProxy() string {
+	return v.httpsProxy
+}
+
+// NoProxy returns a comma separated list of hosts and domains the bootstrap connects to directly.
+func (v *RemoteSettings) NoProxy() string {
+	return v.noProxy
+}
+
+// BootstrapScriptPath returns a local path to the custom script preparing the host,
+// executed before Ansible is installed and before the plays.
+func (v *RemoteSettings) BootstrapScriptPath() string {
+	return v.bootstrapScriptPath
+}
+
+// RemoteBootstrapScriptPath returns a path to where the custom bootstrap script is uploaded to.
+func (v *RemoteSettings) RemoteBootstrapScriptPath() string {
+	return filepath.Join(v.BootstrapDirectory(), "tf-ansible-bootstrap-script")
+}
+
+// PackagesScriptPath returns a local path to the custom script installing the OS dependencies of the default installer,
+// used instead of the package manager detection.
+func (v *RemoteSettings) PackagesScriptPath() string {
+	return v.packagesScriptPath
+}
+
+// RemotePackagesScriptPath returns a path to where the custom packages script is uploaded to.
+func (v *RemoteSettings) RemotePackagesScriptPath() string {
+	return filepath.Join(v.BootstrapDirectory(), "tf-ansible-packages")
+}
+
 // LocalInstallerPath returns a path to the custom Ansible installer.
 func (v *RemoteSettings) LocalInstallerPath() string {
 	return v.localInstallerPath
@@ -145,10 +472,52 @@ func (v *RemoteSettings) LocalInstallerPath() string {
 // RemoteInstallerPath returns a path to the where the Ansible installer script in uploaded to and executed from.
 // This is essentially remote_installer_directory with /ansible-installer appended.
 func (v *RemoteSettings) RemoteInstallerPath() string {
-	return filepath.Join(v.remoteInstallerDirectory, "tf-ansible-installer")
+	return filepath.Join(v.hostDirectory(v.remoteInstallerDirectory), "tf-ansible-installer")
 }
 
 // BootstrapDirectory returns a path to where the playbooks, roles, inventory fiels, vault password / ID files and such are uploded to.
 func (v *RemoteSettings) BootstrapDirectory() string {
-	return filepath.Join(v.bootstrapDirectory, "tf-ansible-bootstrap")
+	return filepath.Join(v.hostDirectory(v.bootstrapDirectory), "tf-ansible-bootstrap")
+}
+
+// hostDirectory returns the directory on the host, in WSL the default /tmp is replaced with a directory
+// on the Windows drive, files are uploaded to the Windows file system.
+func (v *RemoteSettings) hostDirectory(directory string) string {
+	if v.wslDistribution != "" && (directory == "" || directory == remoteDefaultBootstrapDirectory) {
+		return remoteDefaultWSLDirectory
+	}
+	return directory
+}
+
+// BootstrapDirectoryMode returns the octal permissions of the bootstrap directory, empty string means umask default.
+func (v *RemoteSettings) BootstrapDirectoryMode() string {
+	return v.bootstrapDirectoryMode
+}
+
+// BootstrapDirectoryOwner returns the owner, in chown format, of the bootstrap directory and the uploaded files,
+// empty string means the connection user.
+func (v *RemoteSettings) BootstrapDirectoryOwner() string {
+	return v.bootstrapDirectoryOwner
+}
+
+// VerifyUploads returns true when checksums of the uploaded files are verified on the host before these are used.
+func (v *RemoteSettings) VerifyUploads() bool {
+	return v.verifyUploads
+}
+
+// CompressUploads returns true when directories are uploaded as a single compressed tarball extracted on the host.
+func (v *RemoteSettings) CompressUploads() bool {
+	return v.compressUploads
+}
+
+// UploadConcurrency returns the number of directories uploaded at the same time over separate SSH sessions,
+// 1 means the directories are uploaded one after another.
+func (v *RemoteSettings) UploadConcurrency() int {
+	return v.uploadConcurrency
+}
+
+// SudoPassword returns the password of the connection user for the sudo commands of the provisioner,
+// empty string means password-less sudo.
+func (v *RemoteSettings) SudoPassword() string {
+	return v.sudoPassword
 }
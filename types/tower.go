@@ -0,0 +1,257 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// TowerSettings represents AWX / Ansible Tower settings.
+type TowerSettings struct {
+	isTowerInUse  bool
+	url           string
+	token         string
+	tokenEnv      string
+	username      string
+	password      string
+	jobTemplate   string
+	inventory     string
+	limit         string
+	extraVars     map[string]interface{}
+	extraVarsJSON string
+	pollInterval  int
+	timeout       int
+	insecure      bool
+}
+
+const (
+	// default values:
+	towerDefaultPollInterval = 5
+	// attribute names:
+	towerAttributeURL           = "url"
+	towerAttributeToken         = "token"
+	towerAttributeTokenEnv      = "token_env"
+	towerAttributeUsername      = "username"
+	towerAttributePassword      = "password"
+	towerAttributeJobTemplate   = "job_template"
+	towerAttributeInventory     = "inventory"
+	towerAttributeLimit         = "limit"
+	towerAttributeExtraVars     = "extra_vars"
+	towerAttributeExtraVarsJSON = "extra_vars_json"
+	towerAttributePollInterval  = "poll_interval"
+	towerAttributeTimeout       = "timeout"
+	towerAttributeInsecure      = "insecure"
+)
+
+// NewTowerSchema returns a new AWX / Ansible Tower schema.
+func NewTowerSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:          schema.TypeSet,
+		Optional:      true,
+		MaxItems:      1,
+		ConflictsWith: []string{"remote"},
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				towerAttributeURL: &schema.Schema{
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				towerAttributeToken: &schema.Schema{
+					Type:          schema.TypeString,
+					Optional:      true,
+					Sensitive:     true,
+					ConflictsWith: []string{fmt.Sprintf("tower.%s", towerAttributeTokenEnv), fmt.Sprintf("tower.%s", towerAttributeUsername)},
+				},
+				towerAttributeTokenEnv: &schema.Schema{
+					Type:          schema.TypeString,
+					Optional:      true,
+					ConflictsWith: []string{fmt.Sprintf("tower.%s", towerAttributeToken), fmt.Sprintf("tower.%s", towerAttributeUsername)},
+				},
+				towerAttributeUsername: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				towerAttributePassword: &schema.Schema{
+					Type:      schema.TypeString,
+					Optional:  true,
+					Sensitive: true,
+				},
+				towerAttributeJobTemplate: &schema.Schema{
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				towerAttributeInventory: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				towerAttributeLimit: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				towerAttributeExtraVars: &schema.Schema{
+					Type:     schema.TypeMap,
+					Optional: true,
+				},
+				towerAttributeExtraVarsJSON: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: vfJSONObject,
+				},
+				towerAttributePollInterval: &schema.Schema{
+					Type:         schema.TypeInt,
+					Optional:     true,
+					Default:      towerDefaultPollInterval,
+					ValidateFunc: vfPositiveInt,
+				},
+				towerAttributeTimeout: &schema.Schema{
+					Type:         schema.TypeInt,
+					Optional:     true,
+					ValidateFunc: vfNonNegativeInt,
+				},
+				towerAttributeInsecure: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
+			},
+		},
+	}
+}
+
+// NewTowerSettingsFromInterface reads AWX / Ansible Tower configuration from Terraform schema.
+func NewTowerSettingsFromInterface(i interface{}, ok bool) *TowerSettings {
+	if ok {
+		return NewTowerSettingsFromMapInterface(mapFromTypeSetList(i.(*schema.Set).List()), ok)
+	}
+	return &TowerSettings{pollInterval: towerDefaultPollInterval}
+}
+
+// NewTowerSettingsFromMapInterface reads AWX / Ansible Tower configuration from a map.
+func NewTowerSettingsFromMapInterface(vals map[string]interface{}, ok bool) *TowerSettings {
+	v := &TowerSettings{pollInterval: towerDefaultPollInterval}
+	if ok {
+		v.isTowerInUse = true
+		v.url = vals[towerAttributeURL].(string)
+		v.jobTemplate = vals[towerAttributeJobTemplate].(string)
+		if val, ok := vals[towerAttributeToken]; ok {
+			v.token = val.(string)
+		}
+		if val, ok := vals[towerAttributeTokenEnv]; ok {
+			v.tokenEnv = val.(string)
+		}
+		if val, ok := vals[towerAttributeUsername]; ok {
+			v.username = val.(string)
+		}
+		if val, ok := vals[towerAttributePassword]; ok {
+			v.password = val.(string)
+		}
+		if val, ok := vals[towerAttributeInventory]; ok {
+			v.inventory = val.(string)
+		}
+		if val, ok := vals[towerAttributeLimit]; ok {
+			v.limit = val.(string)
+		}
+		if val, ok := vals[towerAttributeExtraVars]; ok {
+			v.extraVars = mapFromTypeMap(val)
+		}
+		if val, ok := vals[towerAttributeExtraVarsJSON]; ok {
+			v.extraVarsJSON = val.(string)
+		}
+		if val, ok := vals[towerAttributePollInterval]; ok && val.(int) > 0 {
+			v.pollInterval = val.(int)
+		}
+		if val, ok := vals[towerAttributeTimeout]; ok {
+			v.timeout = val.(int)
+		}
+		if val, ok := vals[towerAttributeInsecure]; ok {
+			v.insecure = val.(bool)
+		}
+	}
+	return v
+}
+
+// IsTowerInUse returns true when the plays are executed by AWX / Ansible Tower.
+func (v *TowerSettings) IsTowerInUse() bool {
+	return v.isTowerInUse
+}
+
+// URL returns the base URL of AWX / Ansible Tower, without the /api/v2 path.
+func (v *TowerSettings) URL() string {
+	return strings.TrimRight(v.url, "/")
+}
+
+// Token returns the OAuth2 token the API is called with, read from token_env when given.
+func (v *TowerSettings) Token() (string, error) {
+	if v.tokenEnv != "" {
+		val, ok := os.LookupEnv(v.tokenEnv)
+		if !ok || val == "" {
+			return "", fmt.Errorf("Tower token environment variable '%s' is not set", v.tokenEnv)
+		}
+		return val, nil
+	}
+	return v.token, nil
+}
+
+// Username returns the user the API is called as with basic authentication, used when no token is given.
+func (v *TowerSettings) Username() string {
+	return v.username
+}
+
+// Password returns the password of the basic authentication user.
+func (v *TowerSettings) Password() string {
+	return v.password
+}
+
+// JobTemplate returns the name or the numeric ID of the job template to launch.
+func (v *TowerSettings) JobTemplate() string {
+	return v.jobTemplate
+}
+
+// Inventory returns the name or the numeric ID of the inventory the job runs against,
+// empty string means the inventory of the job template.
+func (v *TowerSettings) Inventory() string {
+	return v.inventory
+}
+
+// Limit returns the limit of the job, empty string means the host of the connection.
+func (v *TowerSettings) Limit() string {
+	return v.limit
+}
+
+// ExtraVars returns the extra vars of the job, values of extra_vars_json keep their types
+// and take precedence over extra_vars.
+func (v *TowerSettings) ExtraVars() (map[string]interface{}, error) {
+	extraVars := make(map[string]interface{})
+	for key, value := range v.extraVars {
+		extraVars[key] = value
+	}
+	if v.extraVarsJSON != "" {
+		decoder := json.NewDecoder(strings.NewReader(v.extraVarsJSON))
+		decoder.UseNumber()
+		var typed map[string]interface{}
+		if err := decoder.Decode(&typed); err != nil {
+			return nil, fmt.Errorf("extra_vars_json must be a JSON object: %v", err)
+		}
+		for key, value := range typed {
+			extraVars[key] = value
+		}
+	}
+	return extraVars, nil
+}
+
+// PollInterval returns the number of seconds between the job status checks.
+func (v *TowerSettings) PollInterval() int {
+	return v.pollInterval
+}
+
+// Timeout returns the number of seconds the job may run for before it is canceled, 0 means no timeout.
+func (v *TowerSettings) Timeout() int {
+	return v.timeout
+}
+
+// Insecure returns true when the TLS certificate of AWX / Ansible Tower is not verified.
+func (v *TowerSettings) Insecure() bool {
+	return v.insecure
+}
@@ -0,0 +1,88 @@
+package types
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+const (
+	// attribute names:
+	windowsHostAttributeAddress  = "address"
+	windowsHostAttributeUser     = "user"
+	windowsHostAttributePassword = "password"
+	windowsHostAttributePort     = "port"
+)
+
+// WindowsHost represents a Windows host with its own credentials.
+type WindowsHost struct {
+	address  string
+	user     string
+	password string
+	port     int
+}
+
+// NewWindowsHostSchema returns a new Windows host schema.
+func NewWindowsHostSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				windowsHostAttributeAddress: &schema.Schema{
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				windowsHostAttributeUser: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				windowsHostAttributePassword: &schema.Schema{
+					Type:      schema.TypeString,
+					Optional:  true,
+					Sensitive: true,
+				},
+				windowsHostAttributePort: &schema.Schema{
+					Type:     schema.TypeInt,
+					Optional: true,
+				},
+			},
+		},
+	}
+}
+
+// NewWindowsHostFromMapInterface reads a Windows host configuration from a map.
+func NewWindowsHostFromMapInterface(vals map[string]interface{}) *WindowsHost {
+	v := &WindowsHost{}
+	if val, ok := vals[windowsHostAttributeAddress]; ok {
+		v.address = val.(string)
+	}
+	if val, ok := vals[windowsHostAttributeUser]; ok {
+		v.user = val.(string)
+	}
+	if val, ok := vals[windowsHostAttributePassword]; ok {
+		v.password = val.(string)
+	}
+	if val, ok := vals[windowsHostAttributePort]; ok {
+		v.port = val.(int)
+	}
+	return v
+}
+
+// Address returns the host name or IP address of the host.
+func (v *WindowsHost) Address() string {
+	return v.address
+}
+
+// User returns the user for the host, empty string means the connection user is used.
+func (v *WindowsHost) User() string {
+	return v.user
+}
+
+// Password returns the password for the host, empty string means the connection password is used.
+func (v *WindowsHost) Password() string {
+	return v.password
+}
+
+// Port returns the port for the host, 0 means the connection port is used.
+func (v *WindowsHost) Port() int {
+	return v.port
+}
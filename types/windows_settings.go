@@ -0,0 +1,214 @@
+package types
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// WindowsSettings represents Windows target settings.
+type WindowsSettings struct {
+	become            bool
+	becomeUser        string
+	becomePassword    string
+	caTrustPath       string
+	connectionType    string
+	hosts             []*WindowsHost
+	kerberos          bool
+	kinitMode         string
+	messageEncryption string
+	proxy             string
+	scheme            string
+	shellType         string
+}
+
+const (
+	// default values:
+	windowsDefaultBecomeMethod = "runas"
+	// attribute names:
+	windowsAttributeBecome            = "become"
+	windowsAttributeBecomeUser        = "become_user"
+	windowsAttributeBecomePassword    = "become_password"
+	windowsAttributeCATrustPath       = "ca_trust_path"
+	windowsAttributeConnectionType    = "connection_type"
+	windowsAttributeHosts             = "hosts"
+	windowsAttributeKerberos          = "kerberos"
+	windowsAttributeKinitMode         = "kinit_mode"
+	windowsAttributeMessageEncryption = "message_encryption"
+	windowsAttributeProxy             = "proxy"
+	windowsAttributeScheme            = "scheme"
+	windowsAttributeShellType         = "shell_type"
+)
+
+// NewWindowsSettingsSchema returns a new WindowsSettings schema.
+func NewWindowsSettingsSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeSet,
+		Optional: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				windowsAttributeBecome: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+					Default:  false,
+				},
+				windowsAttributeBecomeUser: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+					Default:  "",
+				},
+				windowsAttributeBecomePassword: &schema.Schema{
+					Type:      schema.TypeString,
+					Optional:  true,
+					Default:   "",
+					Sensitive: true,
+				},
+				windowsAttributeCATrustPath: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: vfPath,
+				},
+				windowsAttributeConnectionType: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					Default:      "",
+					ValidateFunc: vfWindowsConnectionType,
+				},
+				windowsAttributeHosts: NewWindowsHostSchema(),
+				windowsAttributeKerberos: &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+					Default:  false,
+				},
+				windowsAttributeKinitMode: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					Default:      "",
+					ValidateFunc: vfWindowsKinitMode,
+				},
+				windowsAttributeMessageEncryption: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					Default:      "",
+					ValidateFunc: vfWindowsMessageEncryption,
+				},
+				windowsAttributeProxy: &schema.Schema{
+					Type:      schema.TypeString,
+					Optional:  true,
+					Default:   "",
+					Sensitive: true,
+				},
+				windowsAttributeScheme: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					Default:      "",
+					ValidateFunc: vfWindowsScheme,
+				},
+				windowsAttributeShellType: &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					Default:      "",
+					ValidateFunc: vfWindowsShellType,
+				},
+			},
+		},
+	}
+}
+
+// NewWindowsSettingsFromInterface reads WindowsSettings configuration from Terraform schema.
+func NewWindowsSettingsFromInterface(i interface{}, ok bool) *WindowsSettings {
+	v := &WindowsSettings{}
+	if ok {
+		vals := mapFromTypeSetList(i.(*schema.Set).List())
+		v.become = vals[windowsAttributeBecome].(bool)
+		v.becomeUser = vals[windowsAttributeBecomeUser].(string)
+		v.becomePassword = vals[windowsAttributeBecomePassword].(string)
+		v.caTrustPath = vals[windowsAttributeCATrustPath].(string)
+		v.connectionType = vals[windowsAttributeConnectionType].(string)
+		if val, ok := vals[windowsAttributeHosts]; ok {
+			for _, host := range val.([]interface{}) {
+				v.hosts = append(v.hosts, NewWindowsHostFromMapInterface(host.(map[string]interface{})))
+			}
+		}
+		v.kerberos = vals[windowsAttributeKerberos].(bool)
+		v.kinitMode = vals[windowsAttributeKinitMode].(string)
+		v.messageEncryption = vals[windowsAttributeMessageEncryption].(string)
+		v.proxy = vals[windowsAttributeProxy].(string)
+		v.scheme = vals[windowsAttributeScheme].(string)
+		v.shellType = vals[windowsAttributeShellType].(string)
+	}
+	return v
+}
+
+// Become returns true if tasks on Windows hosts should run with ansible_become=yes.
+func (v *WindowsSettings) Become() bool {
+	return v.become
+}
+
+// BecomeMethod returns the become method for Windows hosts, always runas.
+func (v *WindowsSettings) BecomeMethod() string {
+	return windowsDefaultBecomeMethod
+}
+
+// BecomeUser returns the account the tasks on Windows hosts run as.
+func (v *WindowsSettings) BecomeUser() string {
+	return v.becomeUser
+}
+
+// BecomePassword returns the password of the become user.
+// The value is written to the temporary inventory only, never to the command line.
+func (v *WindowsSettings) BecomePassword() string {
+	return v.becomePassword
+}
+
+// CATrustPath returns a path to a CA bundle file used to validate the WinRM / PSRP certificate.
+// Takes precedence over the cacert of the resource connection.
+func (v *WindowsSettings) CATrustPath() string {
+	return v.caTrustPath
+}
+
+// ConnectionType returns the Ansible connection plugin used for WinRM targets,
+// empty string means the connection type of the resource connection is used.
+func (v *WindowsSettings) ConnectionType() string {
+	return v.connectionType
+}
+
+// Hosts returns Windows hosts with their own credentials, used with null_resource.
+func (v *WindowsSettings) Hosts() []*WindowsHost {
+	return v.hosts
+}
+
+// Kerberos returns true if Kerberos authentication should be used for WinRM / PSRP targets.
+func (v *WindowsSettings) Kerberos() bool {
+	return v.kerberos
+}
+
+// KinitMode returns ansible_winrm_kinit_mode, managed lets Ansible perform kinit
+// for the connection user, manual expects a ticket to be already present.
+func (v *WindowsSettings) KinitMode() string {
+	return v.kinitMode
+}
+
+// MessageEncryption returns ansible_winrm_message_encryption, one of auto, always or never.
+func (v *WindowsSettings) MessageEncryption() string {
+	return v.messageEncryption
+}
+
+// Proxy returns the HTTP proxy used to reach WinRM / PSRP targets.
+func (v *WindowsSettings) Proxy() string {
+	return v.proxy
+}
+
+// Scheme returns ansible_winrm_scheme, http or https, empty string means the
+// scheme is derived from the https setting of the resource connection.
+func (v *WindowsSettings) Scheme() string {
+	return v.scheme
+}
+
+// ShellType returns the ansible_shell_type used for Windows hosts reachable over OpenSSH.
+func (v *WindowsSettings) ShellType() string {
+	return v.shellType
+}
+
+// IsWindowsOverSSH returns true when an SSH connection targets a Windows host.
+func (v *WindowsSettings) IsWindowsOverSSH() bool {
+	return v.shellType != ""
+}
@@ -0,0 +1,120 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// WSLSettings represents the shell the local provisioner runs Ansible in when Terraform runs on Windows:
+// a WSL distribution or a bash.exe.
+type WSLSettings struct {
+	isInUse      bool
+	distribution string
+	user         string
+	bashPath     string
+	mountRoot    string
+}
+
+const (
+	// default values:
+	wslDefaultMountRoot = "/mnt"
+	// attribute names:
+	wslAttributeDistribution = "distribution"
+	wslAttributeUser         = "user"
+	wslAttributeBashPath     = "bash_path"
+	wslAttributeMountRoot    = "mount_root"
+)
+
+// NewWSLSchema returns a new WSL schema.
+func NewWSLSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:          schema.TypeSet,
+		Optional:      true,
+		MaxItems:      1,
+		ConflictsWith: []string{"remote", "tower", "kubernetes", "pull_bootstrap"},
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				wslAttributeDistribution: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				wslAttributeUser: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				wslAttributeBashPath: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				wslAttributeMountRoot: &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+					Default:  wslDefaultMountRoot,
+				},
+			},
+		},
+	}
+}
+
+// NewWSLSettingsFromInterface reads WSL configuration from Terraform schema.
+func NewWSLSettingsFromInterface(i interface{}, ok bool) *WSLSettings {
+	if ok {
+		return NewWSLSettingsFromMapInterface(mapFromTypeSetList(i.(*schema.Set).List()), ok)
+	}
+	return &WSLSettings{mountRoot: wslDefaultMountRoot}
+}
+
+// NewWSLSettingsFromMapInterface reads WSL configuration from a map.
+func NewWSLSettingsFromMapInterface(vals map[string]interface{}, ok bool) *WSLSettings {
+	v := &WSLSettings{mountRoot: wslDefaultMountRoot}
+	if ok {
+		v.isInUse = true
+		if val, ok := vals[wslAttributeDistribution]; ok {
+			v.distribution = val.(string)
+		}
+		if val, ok := vals[wslAttributeUser]; ok {
+			v.user = val.(string)
+		}
+		if val, ok := vals[wslAttributeBashPath]; ok {
+			v.bashPath = val.(string)
+		}
+		if val, ok := vals[wslAttributeMountRoot]; ok && val.(string) != "" {
+			v.mountRoot = val.(string)
+		}
+	}
+	return v
+}
+
+// IsInUse returns true when Ansible runs in WSL or in the configured bash.exe.
+func (v *WSLSettings) IsInUse() bool {
+	return v.isInUse
+}
+
+// Distribution returns the WSL distribution, empty for the default distribution.
+func (v *WSLSettings) Distribution() string {
+	return v.distribution
+}
+
+// User returns the user of the distribution running Ansible, empty for the default user.
+func (v *WSLSettings) User() string {
+	return v.user
+}
+
+// BashPath returns the bash.exe running Ansible instead of wsl.exe.
+func (v *WSLSettings) BashPath() string {
+	return v.bashPath
+}
+
+// MountRoot returns the directory the Windows drives are mounted under.
+func (v *WSLSettings) MountRoot() string {
+	return v.mountRoot
+}
+
+// Validate checks that a bash.exe is not combined with the wsl.exe options.
+func (v *WSLSettings) Validate() error {
+	if v.bashPath != "" && (v.distribution != "" || v.user != "") {
+		return fmt.Errorf("wsl.bash_path can not be combined with wsl.distribution and wsl.user, bash.exe runs in its own environment")
+	}
+	return nil
+}